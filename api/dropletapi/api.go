@@ -0,0 +1,60 @@
+package dropletapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/google/uuid"
+	"github.com/ipfs/go-cid"
+
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const (
+	// RPCPath is the path of droplet api on the rpc server
+	RPCPath = "/rpc/droplet"
+	// MethodNamespace is the same as the namespace of market api, so both apis share the rpc server options
+	MethodNamespace = "VENUS_MARKET"
+)
+
+// IDroplet is the api of droplet which is not defined in venus-shared market api
+type IDroplet interface {
+	// DealUsageList lists the usage of the deal rate limits of the clients and peers of the miner
+	DealUsageList(ctx context.Context, mAddr address.Address) ([]types2.DealUsage, error) //perm:read
+	// DealUsageReset clears the counted deals of the client address or peer id, all usage of the miner is cleared if id is empty
+	DealUsageReset(ctx context.Context, mAddr address.Address, id string) error //perm:admin
+	// DealPublishMessages lists the publish messages of the miner sent in the last day and the pending ones
+	DealPublishMessages(ctx context.Context, mAddr address.Address) ([]types2.PublishMessage, error) //perm:read
+	// DealAssign is the same as AssignDeals of market api, and each piece has its kind and whether to keep its unsealed copy
+	DealAssign(ctx context.Context, sid abi.SectorID, ssize abi.SectorSize, spec *market.GetDealSpec) ([]*types2.AssignedDeal, error) //perm:write
+
+	// PieceStorageGC runs a round of piece storage GC, the actions are only reported if dryRun is true
+	PieceStorageGC(ctx context.Context, dryRun bool) (*types2.PieceGCReport, error) //perm:admin
+	// PieceVerifyList lists the latest verification of the pieces in the storage, all pieces if storage is empty.
+	// Only the pieces of the miners of the caller are listed, the same for the items of PieceStorageGC and HTTPRetrievalList.
+	PieceVerifyList(ctx context.Context, storage string) ([]types2.PieceVerification, error) //perm:read
+	// PieceScrub reads the piece in all storages which have it and checks it against the piece cid
+	PieceScrub(ctx context.Context, pieceCid cid.Cid) ([]types2.PieceVerification, error) //perm:admin
+	// PieceScrubStorage checks all pieces in the storage in background, the progress is reported by PieceScrubStatus
+	PieceScrubStorage(ctx context.Context, storage string) error //perm:admin
+	// PieceScrubStatus returns the progress of the running or the last scrub of piece storage
+	PieceScrubStatus(ctx context.Context) (types2.PieceScrubStatus, error) //perm:read
+
+	// HTTPRetrievalList lists the requests served by the http retrieval server, the latest ones first
+	HTTPRetrievalList(ctx context.Context, params types2.HTTPRetrievalQueryParams) ([]types2.HTTPRetrieval, error) //perm:read
+	// HTTPRetrievalGet returns a request served by the http retrieval server
+	HTTPRetrievalGet(ctx context.Context, id uuid.UUID) (*types2.HTTPRetrieval, error) //perm:read
+	// PieceSignURL mints a signed url to download the piece for a deal client, the lifetime is PieceAccess.SignedURLTTL if ttl is 0
+	PieceSignURL(ctx context.Context, pieceCid cid.Cid, client address.Address, ttl time.Duration) (*types2.SignedPieceURL, error) //perm:admin
+
+	// FundStatus lists the market escrow of the addresses tracked by the fund manager
+	FundStatus(ctx context.Context) ([]types2.FundAddressStatus, error) //perm:read
+
+	// PaychRedeemStatus lists the unredeemed value of the inbound payment channels
+	PaychRedeemStatus(ctx context.Context) ([]types2.PaychRedeemStatus, error) //perm:read
+	// PaychRedeem submits the best voucher of each lane of the channel, the vouchers which don't cover the gas fee are skipped
+	PaychRedeem(ctx context.Context, ch address.Address) (*types2.PaychRedeemResult, error) //perm:sign
+}
@@ -0,0 +1,26 @@
+package dropletapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/filecoin-project/go-jsonrpc"
+
+	"github.com/filecoin-project/venus/venus-shared/api"
+)
+
+// NewIDropletRPC creates a client of droplet api, addr is the url of the rpc server, its path is replaced with RPCPath
+func NewIDropletRPC(ctx context.Context, addr string, requestHeader http.Header, opts ...jsonrpc.Option) (IDroplet, jsonrpc.ClientCloser, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid addr %s: %w", addr, err)
+	}
+	u.Path = RPCPath
+
+	var res IDropletStruct
+	closer, err := jsonrpc.NewMergeClient(ctx, u.String(), MethodNamespace, api.GetInternalStructs(&res), requestHeader, opts...)
+
+	return &res, closer, err
+}
@@ -0,0 +1,101 @@
+package dropletapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/google/uuid"
+	"github.com/ipfs/go-cid"
+
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+var _ IDroplet = (*IDropletStruct)(nil)
+
+// IDropletStruct is the rpc proxy of IDroplet, keep the fields in sync with IDroplet
+type IDropletStruct struct {
+	Internal struct {
+		DealUsageList       func(ctx context.Context, mAddr address.Address) ([]types2.DealUsage, error)                                                `perm:"read"`
+		DealUsageReset      func(ctx context.Context, mAddr address.Address, id string) error                                                           `perm:"admin"`
+		DealPublishMessages func(ctx context.Context, mAddr address.Address) ([]types2.PublishMessage, error)                                           `perm:"read"`
+		DealAssign          func(ctx context.Context, sid abi.SectorID, ssize abi.SectorSize, spec *market.GetDealSpec) ([]*types2.AssignedDeal, error) `perm:"write"`
+
+		PieceStorageGC    func(ctx context.Context, dryRun bool) (*types2.PieceGCReport, error)           `perm:"admin"`
+		PieceVerifyList   func(ctx context.Context, storage string) ([]types2.PieceVerification, error)   `perm:"read"`
+		PieceScrub        func(ctx context.Context, pieceCid cid.Cid) ([]types2.PieceVerification, error) `perm:"admin"`
+		PieceScrubStorage func(ctx context.Context, storage string) error                                 `perm:"admin"`
+		PieceScrubStatus  func(ctx context.Context) (types2.PieceScrubStatus, error)                      `perm:"read"`
+
+		HTTPRetrievalList func(ctx context.Context, params types2.HTTPRetrievalQueryParams) ([]types2.HTTPRetrieval, error)                      `perm:"read"`
+		HTTPRetrievalGet  func(ctx context.Context, id uuid.UUID) (*types2.HTTPRetrieval, error)                                                 `perm:"read"`
+		PieceSignURL      func(ctx context.Context, pieceCid cid.Cid, client address.Address, ttl time.Duration) (*types2.SignedPieceURL, error) `perm:"admin"`
+
+		FundStatus func(ctx context.Context) ([]types2.FundAddressStatus, error) `perm:"read"`
+
+		PaychRedeemStatus func(ctx context.Context) ([]types2.PaychRedeemStatus, error)                    `perm:"read"`
+		PaychRedeem       func(ctx context.Context, ch address.Address) (*types2.PaychRedeemResult, error) `perm:"sign"`
+	}
+}
+
+func (s *IDropletStruct) DealUsageList(p0 context.Context, p1 address.Address) ([]types2.DealUsage, error) {
+	return s.Internal.DealUsageList(p0, p1)
+}
+
+func (s *IDropletStruct) DealUsageReset(p0 context.Context, p1 address.Address, p2 string) error {
+	return s.Internal.DealUsageReset(p0, p1, p2)
+}
+
+func (s *IDropletStruct) DealPublishMessages(p0 context.Context, p1 address.Address) ([]types2.PublishMessage, error) {
+	return s.Internal.DealPublishMessages(p0, p1)
+}
+
+func (s *IDropletStruct) DealAssign(p0 context.Context, p1 abi.SectorID, p2 abi.SectorSize, p3 *market.GetDealSpec) ([]*types2.AssignedDeal, error) {
+	return s.Internal.DealAssign(p0, p1, p2, p3)
+}
+
+func (s *IDropletStruct) PieceStorageGC(p0 context.Context, p1 bool) (*types2.PieceGCReport, error) {
+	return s.Internal.PieceStorageGC(p0, p1)
+}
+
+func (s *IDropletStruct) PieceVerifyList(p0 context.Context, p1 string) ([]types2.PieceVerification, error) {
+	return s.Internal.PieceVerifyList(p0, p1)
+}
+
+func (s *IDropletStruct) PieceScrub(p0 context.Context, p1 cid.Cid) ([]types2.PieceVerification, error) {
+	return s.Internal.PieceScrub(p0, p1)
+}
+
+func (s *IDropletStruct) PieceScrubStorage(p0 context.Context, p1 string) error {
+	return s.Internal.PieceScrubStorage(p0, p1)
+}
+
+func (s *IDropletStruct) PieceScrubStatus(p0 context.Context) (types2.PieceScrubStatus, error) {
+	return s.Internal.PieceScrubStatus(p0)
+}
+
+func (s *IDropletStruct) HTTPRetrievalList(p0 context.Context, p1 types2.HTTPRetrievalQueryParams) ([]types2.HTTPRetrieval, error) {
+	return s.Internal.HTTPRetrievalList(p0, p1)
+}
+
+func (s *IDropletStruct) HTTPRetrievalGet(p0 context.Context, p1 uuid.UUID) (*types2.HTTPRetrieval, error) {
+	return s.Internal.HTTPRetrievalGet(p0, p1)
+}
+
+func (s *IDropletStruct) PieceSignURL(p0 context.Context, p1 cid.Cid, p2 address.Address, p3 time.Duration) (*types2.SignedPieceURL, error) {
+	return s.Internal.PieceSignURL(p0, p1, p2, p3)
+}
+
+func (s *IDropletStruct) FundStatus(p0 context.Context) ([]types2.FundAddressStatus, error) {
+	return s.Internal.FundStatus(p0)
+}
+
+func (s *IDropletStruct) PaychRedeemStatus(p0 context.Context) ([]types2.PaychRedeemStatus, error) {
+	return s.Internal.PaychRedeemStatus(p0)
+}
+
+func (s *IDropletStruct) PaychRedeem(p0 context.Context, p1 address.Address) (*types2.PaychRedeemResult, error) {
+	return s.Internal.PaychRedeem(p0, p1)
+}
@@ -0,0 +1,247 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/google/uuid"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs-force-community/sophon-auth/jwtclient"
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipfs-force-community/droplet/v2/api/dropletapi"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+var _ dropletapi.IDroplet = (*MarketNodeImpl)(nil)
+
+func (m *MarketNodeImpl) DealUsageList(ctx context.Context, mAddr address.Address) ([]types2.DealUsage, error) {
+	if err := jwtclient.CheckPermissionByMiner(ctx, m.AuthClient, mAddr); err != nil {
+		return nil, err
+	}
+	return m.DealLimiter.Usage(ctx, mAddr)
+}
+
+func (m *MarketNodeImpl) DealUsageReset(ctx context.Context, mAddr address.Address, id string) error {
+	if err := jwtclient.CheckPermissionByMiner(ctx, m.AuthClient, mAddr); err != nil {
+		return err
+	}
+	return m.DealLimiter.Reset(ctx, mAddr, id)
+}
+
+func (m *MarketNodeImpl) DealPublishMessages(ctx context.Context, mAddr address.Address) ([]types2.PublishMessage, error) {
+	if err := jwtclient.CheckPermissionByMiner(ctx, m.AuthClient, mAddr); err != nil {
+		return nil, err
+	}
+	return m.DealPublisher.PublishMessages(mAddr), nil
+}
+
+func (m *MarketNodeImpl) DealAssign(ctx context.Context, sid abi.SectorID, ssize abi.SectorSize, spec *market.GetDealSpec) ([]*types2.AssignedDeal, error) {
+	return m.assignDeals(ctx, sid, ssize, spec)
+}
+
+func (m *MarketNodeImpl) PieceStorageGC(ctx context.Context, dryRun bool) (*types2.PieceGCReport, error) {
+	report, err := m.PieceGC.Run(ctx, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := m.pieceFilter(ctx)
+	items := make([]types2.PieceGCItem, 0, len(report.Items))
+	for _, item := range report.Items {
+		pieceCid, err := cid.Decode(strings.TrimSuffix(item.Resource, ".car"))
+		if err == nil && allowed(pieceCid) {
+			items = append(items, item)
+		}
+	}
+	report.Items = items
+	return report, nil
+}
+
+func (m *MarketNodeImpl) PieceVerifyList(ctx context.Context, storage string) ([]types2.PieceVerification, error) {
+	verifications, err := m.PieceStorageMgr.ListVerification(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := m.pieceFilter(ctx)
+	out := make([]types2.PieceVerification, 0, len(verifications))
+	for _, verification := range verifications {
+		if allowed(verification.PieceCID) {
+			out = append(out, *verification)
+		}
+	}
+	return out, nil
+}
+
+func (m *MarketNodeImpl) PieceScrub(ctx context.Context, pieceCid cid.Cid) ([]types2.PieceVerification, error) {
+	if err := m.checkPiecePermission(ctx, pieceCid); err != nil {
+		return nil, err
+	}
+	return m.PieceScrubber.ScrubPiece(ctx, pieceCid)
+}
+
+func (m *MarketNodeImpl) PieceScrubStorage(ctx context.Context, storage string) error {
+	return m.PieceScrubber.ScrubStorage(ctx, storage)
+}
+
+func (m *MarketNodeImpl) PieceScrubStatus(_ context.Context) (types2.PieceScrubStatus, error) {
+	return m.PieceScrubber.Status(), nil
+}
+
+func (m *MarketNodeImpl) HTTPRetrievalList(ctx context.Context, params types2.HTTPRetrievalQueryParams) ([]types2.HTTPRetrieval, error) {
+	retrievals, err := m.Repo.HTTPRetrievalRepo().ListRetrieval(ctx, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := m.pieceFilter(ctx)
+	out := make([]types2.HTTPRetrieval, 0, len(retrievals))
+	for _, retrieval := range retrievals {
+		if allowed(retrieval.PieceCID) {
+			out = append(out, *retrieval)
+		}
+	}
+	return out, nil
+}
+
+func (m *MarketNodeImpl) HTTPRetrievalGet(ctx context.Context, id uuid.UUID) (*types2.HTTPRetrieval, error) {
+	retrieval, err := m.Repo.HTTPRetrievalRepo().GetRetrieval(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkPiecePermission(ctx, retrieval.PieceCID); err != nil {
+		return nil, err
+	}
+	return retrieval, nil
+}
+
+// checkPiecePermission checks the caller has the permission of a miner which has storage or direct deals of the piece,
+// the pieces without deals are only accessible by admin
+func (m *MarketNodeImpl) checkPiecePermission(ctx context.Context, pieceCid cid.Cid) error {
+	if core.HasPerm(ctx, []core.Permission{}, core.PermAdmin) {
+		return nil
+	}
+
+	miners, err := m.pieceMiners(ctx, pieceCid)
+	if err != nil {
+		return err
+	}
+	for _, mAddr := range miners {
+		if jwtclient.CheckPermissionByMiner(ctx, m.AuthClient, mAddr) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("no miner of piece %s belongs to the user: %w", pieceCid, jwtclient.ErrorPermissionDeny)
+}
+
+// pieceFilter returns a filter of the pieces the caller has permission of, the results are cached for a call of api
+func (m *MarketNodeImpl) pieceFilter(ctx context.Context) func(cid.Cid) bool {
+	if core.HasPerm(ctx, []core.Permission{}, core.PermAdmin) {
+		return func(cid.Cid) bool { return true }
+	}
+
+	allowed := make(map[cid.Cid]bool)
+	return func(pieceCid cid.Cid) bool {
+		if !pieceCid.Defined() {
+			return false
+		}
+		ok, checked := allowed[pieceCid]
+		if !checked {
+			err := m.checkPiecePermission(ctx, pieceCid)
+			if err != nil && !errors.Is(err, jwtclient.ErrorPermissionDeny) {
+				log.Warnf("check permission of piece %s: %v", pieceCid, err)
+			}
+			ok = err == nil
+			allowed[pieceCid] = ok
+		}
+		return ok
+	}
+}
+
+// pieceMiners returns the miners which have storage or direct deals of the piece
+func (m *MarketNodeImpl) pieceMiners(ctx context.Context, pieceCid cid.Cid) ([]address.Address, error) {
+	if !pieceCid.Defined() {
+		return nil, nil
+	}
+
+	miners := make(map[address.Address]struct{})
+	deals, err := m.Repo.StorageDealRepo().ListDeal(ctx, &market.StorageDealQueryParams{
+		PieceCID: pieceCid.String(),
+		Page:     market.Page{Limit: math.MaxInt32},
+	})
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return nil, fmt.Errorf("list storage deals of piece %s: %w", pieceCid, err)
+	}
+	for _, deal := range deals {
+		miners[deal.Proposal.Provider] = struct{}{}
+	}
+
+	directDeals, err := m.Repo.DirectDealRepo().GetDealsByPieceAndState(ctx, pieceCid, market.DealAllocated, market.DealSealing,
+		market.DealActive, market.DealExpired, market.DealSlashed, market.DealError)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return nil, fmt.Errorf("get direct deals of piece %s: %w", pieceCid, err)
+	}
+	for _, deal := range directDeals {
+		miners[deal.Provider] = struct{}{}
+	}
+
+	out := make([]address.Address, 0, len(miners))
+	for mAddr := range miners {
+		out = append(out, mAddr)
+	}
+	return out, nil
+}
+
+func (m *MarketNodeImpl) PieceSignURL(ctx context.Context, pieceCid cid.Cid, client address.Address, ttl time.Duration) (*types2.SignedPieceURL, error) {
+	return m.PieceAccess.SignURL(ctx, pieceCid, client, ttl)
+}
+
+func (m *MarketNodeImpl) FundStatus(ctx context.Context) ([]types2.FundAddressStatus, error) {
+	status, err := m.FMgr.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]types2.FundAddressStatus, 0, len(status))
+	for _, st := range status {
+		if jwtclient.CheckPermissionByMiner(ctx, m.AuthClient, st.Addr) == nil {
+			out = append(out, st)
+		}
+	}
+	return out, nil
+}
+
+func (m *MarketNodeImpl) PaychRedeemStatus(ctx context.Context) ([]types2.PaychRedeemStatus, error) {
+	status, err := m.PaychRedeemer.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]types2.PaychRedeemStatus, 0, len(status))
+	for _, st := range status {
+		if jwtclient.CheckPermissionBySigner(ctx, m.AuthClient, st.To) == nil {
+			out = append(out, st)
+		}
+	}
+	return out, nil
+}
+
+func (m *MarketNodeImpl) PaychRedeem(ctx context.Context, ch address.Address) (*types2.PaychRedeemResult, error) {
+	ci, err := m.Repo.PaychChannelInfoRepo().GetChannelByAddress(ctx, ch)
+	if err != nil {
+		return nil, err
+	}
+	if err := jwtclient.CheckPermissionBySigner(ctx, m.AuthClient, ci.Control); err != nil {
+		return nil, err
+	}
+	return m.PaychRedeemer.Redeem(ctx, ch)
+}
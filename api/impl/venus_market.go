@@ -39,6 +39,7 @@ import (
 	"github.com/ipfs-force-community/droplet/v2/paychmgr"
 	"github.com/ipfs-force-community/droplet/v2/piecestorage"
 	"github.com/ipfs-force-community/droplet/v2/retrievalprovider"
+	"github.com/ipfs-force-community/droplet/v2/retrievalprovider/httpretrieval"
 	"github.com/ipfs-force-community/droplet/v2/storageprovider"
 	"github.com/ipfs-force-community/droplet/v2/version"
 
@@ -49,6 +50,7 @@ import (
 	vTypes "github.com/filecoin-project/venus/venus-shared/types"
 	gatewayTypes "github.com/filecoin-project/venus/venus-shared/types/gateway"
 	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
 )
 
 var (
@@ -61,14 +63,21 @@ type MarketNodeImpl struct {
 
 	FundAPI
 	gatewayAPIV2.IMarketServiceProvider
+	GatewayMarketClient gatewayAPIV2.IMarketClient
 
 	FullNode          v1api.FullNode
 	Host              host.Host
 	StorageProvider   storageprovider.StorageProvider
 	RetrievalProvider retrievalprovider.IRetrievalProvider
+	RetrievalLoad     *retrievalprovider.RetrievalLoad
 	DataTransfer      network.ProviderDataTransfer
 	DealPublisher     *storageprovider.DealPublisher
 	DealAssigner      storageprovider.DealAssiger
+	DealLimiter       *storageprovider.DealLimiter
+	PieceGC           *storageprovider.PieceGC
+	PieceScrubber     *storageprovider.PieceScrubber
+	PieceAccess       *httpretrieval.PieceAccess
+	PaychRedeemer     *paychmgr.Redeemer
 	IndexProviderMgr  *indexprovider.IndexProviderMgr
 
 	DirectDealProvider *storageprovider.DirectDealProvider
@@ -93,6 +102,7 @@ type MarketNodeImpl struct {
 	ConsiderOfflineStorageDealsConfigFunc       config.ConsiderOfflineStorageDealsConfigFunc
 	SetConsiderOfflineStorageDealsConfigFunc    config.SetConsiderOfflineStorageDealsConfigFunc
 	ConsiderOfflineRetrievalDealsConfigFunc     config.ConsiderOfflineRetrievalDealsConfigFunc
+	RetrievalDealFilter                         config.RetrievalDealFilter
 	SetConsiderOfflineRetrievalDealsConfigFunc  config.SetConsiderOfflineRetrievalDealsConfigFunc
 	ConsiderVerifiedStorageDealsConfigFunc      config.ConsiderVerifiedStorageDealsConfigFunc
 	SetConsiderVerifiedStorageDealsConfigFunc   config.SetConsiderVerifiedStorageDealsConfigFunc
@@ -1111,6 +1121,18 @@ func (m *MarketNodeImpl) UpdateDealOnPacking(ctx context.Context, miner address.
 }
 
 func (m *MarketNodeImpl) AssignDeals(ctx context.Context, sid abi.SectorID, ssize abi.SectorSize, spec *types.GetDealSpec) ([]*types.DealInfoV2, error) {
+	deals, err := m.assignDeals(ctx, sid, ssize, spec)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*types.DealInfoV2, 0, len(deals))
+	for _, deal := range deals {
+		out = append(out, deal.DealInfoV2)
+	}
+	return out, nil
+}
+
+func (m *MarketNodeImpl) assignDeals(ctx context.Context, sid abi.SectorID, ssize abi.SectorSize, spec *types.GetDealSpec) ([]*types2.AssignedDeal, error) {
 	mAddr, err := address.NewIDAddress(uint64(sid.Miner))
 	if err != nil {
 		return nil, err
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/filecoin-project/go-address"
@@ -77,6 +79,12 @@ ShardStateUnknown
 			return nil
 		}
 
+		verifyStates, err := pieceVerifyStates(ctx, cctx)
+		if err != nil {
+			// the verifications are optional, the shards are listed without them
+			fmt.Fprintf(os.Stderr, "WARN: list piece verifications: %v\n", err)
+		}
+
 		filterStates := make(map[string]struct{})
 		for _, state := range cctx.StringSlice("filter") {
 			filterStates[state] = struct{}{}
@@ -85,6 +93,7 @@ ShardStateUnknown
 		tw := tablewriter.New(
 			tablewriter.Col("Key"),
 			tablewriter.Col("State"),
+			tablewriter.Col("Verified"),
 			tablewriter.Col("Error"),
 		)
 
@@ -107,7 +116,11 @@ ShardStateUnknown
 					}
 					return s.State
 				}(),
-				"Error": s.Error,
+				"Verified": "-",
+				"Error":    s.Error,
+			}
+			if state, ok := verifyStates[s.Key]; ok {
+				m["Verified"] = state
 			}
 			tw.Write(m)
 		}
@@ -116,6 +129,32 @@ ShardStateUnknown
 	},
 }
 
+// pieceVerifyStates returns the verify states of the pieces, keyed by piece cid.
+// The states of a piece kept in several storages are joined with the storage names.
+func pieceVerifyStates(ctx context.Context, cctx *cli.Context) (map[string]string, error) {
+	dropletApi, closer, err := NewDropletNode(cctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	verifications, err := dropletApi.PieceVerifyList(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	storageStates := make(map[string][]string, len(verifications))
+	for _, verification := range verifications {
+		piece := verification.PieceCID.String()
+		storageStates[piece] = append(storageStates[piece], fmt.Sprintf("%s:%s", verification.Storage, verification.State))
+	}
+	verifyStates := make(map[string]string, len(storageStates))
+	for piece, states := range storageStates {
+		sort.Strings(states)
+		verifyStates[piece] = strings.Join(states, ",")
+	}
+	return verifyStates, nil
+}
+
 type dealIndex struct {
 	dealCount  int
 	indexCount int
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/go-units"
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/ipfs-force-community/droplet/v2/cli/tablewriter"
+)
+
+var dealLimitCmds = &cli.Command{
+	Name:  "limit",
+	Usage: "Inspect and reset the usage of deal rate limits of clients and peers",
+	Subcommands: []*cli.Command{
+		dealLimitUsageCmd,
+		dealLimitResetCmd,
+	},
+}
+
+var dealLimitUsageCmd = &cli.Command{
+	Name:      "usage",
+	Usage:     "List the usage of clients and peers which sent deals to the miner",
+	ArgsUsage: "<miner address>",
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return fmt.Errorf("must pass miner address")
+		}
+		mAddr, err := address.NewFromString(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		api, closer, err := NewDropletNode(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		usage, err := api.DealUsageList(ctx, mAddr)
+		if err != nil {
+			return err
+		}
+
+		tw := tablewriter.New(
+			tablewriter.Col("Kind"),
+			tablewriter.Col("ID"),
+			tablewriter.Col("DealsLastHour"),
+			tablewriter.Col("BytesLastDay"),
+			tablewriter.Col("Transfers"),
+		)
+		for _, u := range usage {
+			tw.Write(map[string]interface{}{
+				"Kind":          u.Kind,
+				"ID":            u.ID,
+				"DealsLastHour": u.DealsLastHour,
+				"BytesLastDay":  units.BytesSize(float64(u.BytesLastDay)),
+				"Transfers":     u.ConcurrentTransfers,
+			})
+		}
+
+		return tw.Flush(os.Stdout)
+	},
+}
+
+var dealLimitResetCmd = &cli.Command{
+	Name:      "reset",
+	Usage:     "Clear the counted deals of a client address or peer id, the transfers in progress are still counted",
+	ArgsUsage: "<miner address> [client address or peer id]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "clear the usage of all clients and peers of the miner",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() < 1 {
+			return fmt.Errorf("must pass miner address")
+		}
+		mAddr, err := address.NewFromString(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+		id := cctx.Args().Get(1)
+		if len(id) == 0 && !cctx.Bool("all") {
+			return fmt.Errorf("must pass client address or peer id, or set --all")
+		}
+
+		api, closer, err := NewDropletNode(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if err := api.DealUsageReset(ctx, mAddr, id); err != nil {
+			return err
+		}
+		fmt.Println("reset usage success")
+
+		return nil
+	},
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"strconv"
 
 	"github.com/filecoin-project/go-bitfield"
@@ -18,6 +19,8 @@ import (
 	v1 "github.com/filecoin-project/venus/venus-shared/api/chain/v1"
 	"github.com/filecoin-project/venus/venus-shared/types"
 	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/droplet/v2/cli/tablewriter"
 )
 
 var MarketCmds = &cli.Command{
@@ -28,6 +31,7 @@ var MarketCmds = &cli.Command{
 		walletMarketAdd,
 		walletMarketWithdraw,
 		dealSettlementCmd,
+		fundStatusCmd,
 	},
 }
 
@@ -305,6 +309,54 @@ var walletMarketWithdraw = &cli.Command{
 	},
 }
 
+var fundStatusCmd = &cli.Command{
+	Name:  "status",
+	Usage: "Print the reserved, locked, available and in-flight escrow of the addresses tracked by the fund manager",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := NewDropletNode(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		status, err := api.FundStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tablewriter.New(
+			tablewriter.Col("Address"),
+			tablewriter.Col("Escrow"),
+			tablewriter.Col("Locked"),
+			tablewriter.Col("Available"),
+			tablewriter.Col("Reserved"),
+			tablewriter.Col("InFlightAdd"),
+			tablewriter.Col("InFlightWithdraw"),
+			tablewriter.Col("TopUpLastDay"),
+			tablewriter.Col("Message"),
+		)
+		for _, st := range status {
+			msg := "-"
+			if st.MsgCid != nil {
+				msg = st.MsgCid.String()
+			}
+			tw.Write(map[string]interface{}{
+				"Address":          st.Addr,
+				"Escrow":           types.FIL(st.Escrow).Short(),
+				"Locked":           types.FIL(st.Locked).Short(),
+				"Available":        types.FIL(st.Available).Short(),
+				"Reserved":         types.FIL(st.Reserved).Short(),
+				"InFlightAdd":      types.FIL(st.InFlightAdd).Short(),
+				"InFlightWithdraw": types.FIL(st.InFlightWithdraw).Short(),
+				"TopUpLastDay":     types.FIL(st.TopUpLastDay).Short(),
+				"Message":          msg,
+			})
+		}
+		return tw.Flush(os.Stdout)
+	},
+}
+
 var dealSettlementCmd = &cli.Command{
 	Name:      "settle-deal",
 	Usage:     "Settle deals manually, if dealIds are not provided all deals will be settled",
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/ipfs-force-community/droplet/v2/cli/tablewriter"
+
+	"github.com/filecoin-project/venus/venus-shared/types"
+)
+
+var PaychCmds = &cli.Command{
+	Name:  "paych",
+	Usage: "Inspect and redeem the vouchers of inbound payment channels",
+	Subcommands: []*cli.Command{
+		paychRedeemStatusCmd,
+		paychRedeemCmd,
+	},
+}
+
+var paychRedeemStatusCmd = &cli.Command{
+	Name:  "redeem-status",
+	Usage: "List the unredeemed value of inbound payment channels",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "lanes",
+			Usage: "print the unredeemed value of each lane",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := NewDropletNode(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		status, err := api.PaychRedeemStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		if cctx.Bool("lanes") {
+			tw := tablewriter.New(
+				tablewriter.Col("Channel"),
+				tablewriter.Col("Lane"),
+				tablewriter.Col("Redeemed"),
+				tablewriter.Col("BestVoucher"),
+				tablewriter.Col("Unredeemed"),
+			)
+			for _, st := range status {
+				for _, lane := range st.Lanes {
+					tw.Write(map[string]interface{}{
+						"Channel":     st.Channel,
+						"Lane":        lane.Lane,
+						"Redeemed":    types.FIL(lane.Redeemed).Short(),
+						"BestVoucher": types.FIL(lane.Best).Short(),
+						"Unredeemed":  types.FIL(lane.Unredeemed).Short(),
+					})
+				}
+			}
+			return tw.Flush(os.Stdout)
+		}
+
+		tw := tablewriter.New(
+			tablewriter.Col("Channel"),
+			tablewriter.Col("From"),
+			tablewriter.Col("To"),
+			tablewriter.Col("Lanes"),
+			tablewriter.Col("Unredeemed"),
+			tablewriter.Col("SettlingAt"),
+			tablewriter.Col("LastRedeem"),
+			tablewriter.NewLineCol("Error"),
+		)
+		for _, st := range status {
+			tw.Write(map[string]interface{}{
+				"Channel":    st.Channel,
+				"From":       st.From,
+				"To":         st.To,
+				"Lanes":      len(st.Lanes),
+				"Unredeemed": types.FIL(st.Unredeemed).Short(),
+				"SettlingAt": st.SettlingAt,
+				"LastRedeem": st.LastRedeem.Format(time.RFC3339),
+				"Error":      st.LastError,
+			})
+		}
+		return tw.Flush(os.Stdout)
+	},
+}
+
+var paychRedeemCmd = &cli.Command{
+	Name:      "redeem",
+	Usage:     "Submit the best voucher of each lane of the channel, the vouchers which don't cover the gas fee are skipped",
+	ArgsUsage: "<channel address>",
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return fmt.Errorf("must pass channel address")
+		}
+		ch, err := address.NewFromString(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		api, closer, err := NewDropletNode(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		res, err := api.PaychRedeem(ctx, ch)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("redeemed %s in %d messages, %d vouchers skipped\n", types.FIL(res.Redeemed).Short(), len(res.Messages), res.Skipped)
+		for _, msg := range res.Messages {
+			fmt.Println(msg)
+		}
+		return nil
+	},
+}
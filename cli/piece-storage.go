@@ -2,10 +2,17 @@ package cli
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"time"
 
+	"github.com/docker/go-units"
 	"github.com/ipfs-force-community/droplet/v2/cli/tablewriter"
+	"github.com/ipfs/go-cid"
 	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	mtypes "github.com/ipfs-force-community/droplet/v2/types"
 )
 
 var PieceStorageCmd = &cli.Command{
@@ -17,6 +24,8 @@ var PieceStorageCmd = &cli.Command{
 		pieceStorageAddS3Cmd,
 		pieceStorageListCmd,
 		pieceStorageRemoveCmd,
+		pieceStorageGCCmd,
+		pieceStorageScrubCmd,
 	},
 }
 
@@ -164,7 +173,21 @@ var pieceStorageAddS3Cmd = &cli.Command{
 var pieceStorageListCmd = &cli.Command{
 	Name:  "list",
 	Usage: "list piece storages",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "pieces",
+			Usage: "list the verification of the pieces written with VerifyOnWrite enabled",
+		},
+		&cli.StringFlag{
+			Name:  "storage",
+			Usage: "only list the pieces in the storage, works with --pieces",
+		},
+	},
 	Action: func(cctx *cli.Context) error {
+		if cctx.Bool("pieces") {
+			return listPieceVerification(cctx)
+		}
+
 		nodeApi, closer, err := NewMarketNode(cctx)
 		if err != nil {
 			return err
@@ -179,30 +202,98 @@ var pieceStorageListCmd = &cli.Command{
 			tablewriter.Col("ReadOnly"),
 			tablewriter.Col("Type"),
 			tablewriter.Col("Path"),
+			tablewriter.Col("Capacity"),
+			tablewriter.Col("Available"),
+			tablewriter.Col("Reserved"),
+			tablewriter.Col("Free"),
 		)
 
 		for _, storage := range storagelist.FsStorage {
-			w.Write(map[string]interface{}{
-				"Name":     storage.Name,
-				"ReadOnly": storage.ReadOnly,
-				"Path":     storage.Path,
-				"Type":     "file system",
-			})
+			row := storageSpace(storage.Status)
+			row["Name"] = storage.Name
+			row["ReadOnly"] = storage.ReadOnly
+			row["Path"] = storage.Path
+			row["Type"] = "file system"
+			w.Write(row)
 		}
 
 		for _, storage := range storagelist.S3Storage {
-			w.Write(map[string]interface{}{
-				"Name":     storage.Name,
-				"ReadOnly": storage.ReadOnly,
-				"Path":     storage.EndPoint + "/" + storage.SubDir + storage.Bucket,
-				"Type":     "S3",
-			})
+			row := storageSpace(storage.Status)
+			row["Name"] = storage.Name
+			row["ReadOnly"] = storage.ReadOnly
+			row["Path"] = storage.EndPoint + "/" + storage.SubDir + storage.Bucket
+			row["Type"] = "S3"
+			w.Write(row)
 		}
 
 		return w.Flush(os.Stdout)
 	},
 }
 
+func listPieceVerification(cctx *cli.Context) error {
+	api, closer, err := NewDropletNode(cctx)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	ctx := ReqContext(cctx)
+
+	verifications, err := api.PieceVerifyList(ctx, cctx.String("storage"))
+	if err != nil {
+		return err
+	}
+	return printPieceVerifications(verifications)
+}
+
+func printPieceVerifications(verifications []mtypes.PieceVerification) error {
+	tw := tablewriter.New(
+		tablewriter.Col("Piece"),
+		tablewriter.Col("Storage"),
+		tablewriter.Col("State"),
+		tablewriter.Col("Size"),
+		tablewriter.Col("UpdatedAt"),
+		tablewriter.NewLineCol("Message"),
+	)
+	for _, verification := range verifications {
+		row := map[string]interface{}{
+			"Piece":     verification.PieceCID,
+			"Storage":   verification.Storage,
+			"State":     verification.State,
+			"Size":      units.BytesSize(float64(verification.Size)),
+			"UpdatedAt": time.Unix(int64(verification.UpdatedAt), 0).Format(time.RFC3339),
+		}
+		if len(verification.Message) != 0 {
+			row["Message"] = verification.Message
+		}
+		tw.Write(row)
+	}
+	return tw.Flush(os.Stdout)
+}
+
+// storageSpace shows the space of storage, free is the available space which is not reserved by the deals in transferring
+func storageSpace(status market.StorageStatus) map[string]interface{} {
+	// the space of object storage is unlimited
+	if status.Available == math.MaxInt64 {
+		return map[string]interface{}{
+			"Capacity":  "-",
+			"Available": "-",
+			"Reserved":  units.BytesSize(float64(status.Reserved)),
+			"Free":      "-",
+		}
+	}
+
+	free := status.Available - status.Reserved
+	if free < 0 {
+		free = 0
+	}
+	return map[string]interface{}{
+		"Capacity":  units.BytesSize(float64(status.Capacity)),
+		"Available": units.BytesSize(float64(status.Available)),
+		"Reserved":  units.BytesSize(float64(status.Reserved)),
+		"Free":      units.BytesSize(float64(free)),
+	}
+}
+
 var pieceStorageRemoveCmd = &cli.Command{
 	Name:      "remove",
 	ArgsUsage: "<name>",
@@ -223,3 +314,141 @@ var pieceStorageRemoveCmd = &cli.Command{
 		return nodeApi.RemovePieceStorage(ctx, name)
 	},
 }
+
+var pieceStorageGCCmd = &cli.Command{
+	Name:  "gc",
+	Usage: "collect the pieces whose deals are all terminated",
+	Description: `The pieces whose deals are all expired, slashed or failed are moved to the quarantine area of the storage,
+and deleted after the grace period. A quarantined piece is restored if it is referenced by a deal again.
+The pieces which are not referenced by any deal are never collected.`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only report what would be done",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := NewDropletNode(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		report, err := api.PieceStorageGC(ctx, cctx.Bool("dry-run"))
+		if err != nil {
+			return err
+		}
+
+		tw := tablewriter.New(
+			tablewriter.Col("Storage"),
+			tablewriter.Col("Resource"),
+			tablewriter.Col("Action"),
+			tablewriter.Col("QuarantinedAt"),
+			tablewriter.Col("Reason"),
+			tablewriter.NewLineCol("Error"),
+		)
+		for _, item := range report.Items {
+			row := map[string]interface{}{
+				"Storage":       item.Storage,
+				"Resource":      item.Resource,
+				"Action":        item.Action,
+				"QuarantinedAt": "-",
+				"Reason":        item.Reason,
+			}
+			if !item.QuarantinedAt.IsZero() {
+				row["QuarantinedAt"] = item.QuarantinedAt.Format(time.RFC3339)
+			}
+			if len(item.Error) != 0 {
+				row["Error"] = item.Error
+			}
+			tw.Write(row)
+		}
+		if err := tw.Flush(os.Stdout); err != nil {
+			return err
+		}
+
+		if report.DryRun {
+			fmt.Println("Dry run, no piece is changed")
+		}
+		fmt.Printf("Scanned: %d, Kept: %d, Unknown: %d, Waiting in quarantine: %d\n",
+			report.Scanned, report.Kept, report.Unknown, report.Quarantined)
+
+		return nil
+	},
+}
+
+var pieceStorageScrubCmd = &cli.Command{
+	Name:      "scrub",
+	ArgsUsage: "[piece cid]",
+	Usage:     "read pieces from piece storage and check them against the piece cid",
+	Description: `The piece given by the argument is checked in all storages which have it and the results are printed.
+With --storage, all pieces of the storage are checked in background, use --status to show the progress.
+The corrupted pieces are not served by the dagstore and retrieval until they are verified again or rewritten.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "storage",
+			Usage: "check all pieces of the storage in background",
+		},
+		&cli.BoolFlag{
+			Name:  "status",
+			Usage: "show the progress of the running or the last scrub of storages",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := NewDropletNode(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		switch {
+		case cctx.Bool("status"):
+			status, err := api.PieceScrubStatus(ctx)
+			if err != nil {
+				return err
+			}
+			if status.StartedAt.IsZero() {
+				fmt.Println("No scrub of piece storage since start")
+				return nil
+			}
+			storage := status.Storage
+			if len(storage) == 0 {
+				storage = "all"
+			}
+			fmt.Printf("Storage: %s\n", storage)
+			fmt.Printf("Running: %t\n", status.Running)
+			fmt.Printf("StartedAt: %s\n", status.StartedAt.Format(time.RFC3339))
+			if !status.FinishedAt.IsZero() {
+				fmt.Printf("FinishedAt: %s\n", status.FinishedAt.Format(time.RFC3339))
+			}
+			fmt.Printf("Scanned: %d, Verified: %d, Corrupted: %d, Failed: %d, Skipped: %d, Read: %s\n",
+				status.Scanned, status.Verified, status.Corrupted, status.Failed, status.Skipped,
+				units.BytesSize(float64(status.BytesRead)))
+			if len(status.Error) != 0 {
+				fmt.Printf("Error: %s\n", status.Error)
+			}
+			return nil
+		case cctx.IsSet("storage"):
+			if err := api.PieceScrubStorage(ctx, cctx.String("storage")); err != nil {
+				return err
+			}
+			fmt.Println("Scrub started in background, use --status to show the progress")
+			return nil
+		}
+
+		if cctx.Args().Len() != 1 {
+			return fmt.Errorf("piece cid is required")
+		}
+		pieceCid, err := cid.Decode(cctx.Args().First())
+		if err != nil {
+			return fmt.Errorf("invalid piece cid: %w", err)
+		}
+		verifications, err := api.PieceScrub(ctx, pieceCid)
+		if err != nil {
+			return err
+		}
+		return printPieceVerifications(verifications)
+	},
+}
@@ -27,6 +27,7 @@ var RetrievalCmds = &cli.Command{
 		retrievalDealsCmds,
 		retirevalAsksCmds,
 		retrievalDealSelectionCmds,
+		retrievalHTTPCmds,
 		queryProtocols,
 	},
 }
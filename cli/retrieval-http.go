@@ -0,0 +1,225 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/google/uuid"
+	"github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipfs-force-community/droplet/v2/cli/tablewriter"
+	mtypes "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+var retrievalHTTPCmds = &cli.Command{
+	Name:  "http",
+	Usage: "Show the requests served by the http retrieval server",
+	Subcommands: []*cli.Command{
+		retrievalHTTPListCmd,
+		retrievalHTTPGetCmd,
+		retrievalHTTPSignCmd,
+	},
+}
+
+var retrievalHTTPListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List the requests served by the http retrieval server, the latest ones first",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "client",
+			Usage: "ip address of the client",
+		},
+		&cli.StringFlag{
+			Name:  "piece",
+			Usage: "piece cid",
+		},
+		&cli.StringFlag{
+			Name:  "data-cid",
+			Usage: "root cid of the requests on the /ipfs/ path",
+		},
+		&cli.StringFlag{
+			Name:  "path",
+			Usage: "only list the requests on the path, piece or ipfs",
+		},
+		offsetFlag,
+		limitFlag,
+		&cli.BoolFlag{
+			Name:    "verbose",
+			Aliases: []string{"v"},
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := NewDropletNode(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		path := cctx.String("path")
+		if len(path) != 0 && path != mtypes.HTTPRetrievalPiece && path != mtypes.HTTPRetrievalIPFS {
+			return fmt.Errorf("invalid path %s, expect %s or %s", path, mtypes.HTTPRetrievalPiece, mtypes.HTTPRetrievalIPFS)
+		}
+		params := mtypes.HTTPRetrievalQueryParams{
+			Client:     cctx.String("client"),
+			PieceCID:   cctx.String("piece"),
+			PayloadCID: cctx.String("data-cid"),
+			Path:       path,
+			Page: market.Page{
+				Offset: cctx.Int(offsetFlag.Name),
+				Limit:  cctx.Int(limitFlag.Name),
+			},
+		}
+		retrievals, err := api.HTTPRetrievalList(ReqContext(cctx), params)
+		if err != nil {
+			return err
+		}
+
+		verbose := cctx.Bool("verbose")
+		shorten := func(c cid.Cid) string {
+			if !c.Defined() {
+				return "-"
+			}
+			s := c.String()
+			if !verbose && len(s) > 8 {
+				s = "..." + s[len(s)-8:]
+			}
+			return s
+		}
+
+		tw := tablewriter.New(
+			tablewriter.Col("ID"),
+			tablewriter.Col("Client"),
+			tablewriter.Col("Path"),
+			tablewriter.Col("Piece"),
+			tablewriter.Col("Payload"),
+			tablewriter.Col("Range"),
+			tablewriter.Col("Status"),
+			tablewriter.Col("Sent"),
+			tablewriter.Col("Duration"),
+			tablewriter.Col("CreatedAt"),
+			tablewriter.NewLineCol("Message"),
+		)
+		for _, retrieval := range retrievals {
+			row := map[string]interface{}{
+				"ID":        retrieval.ID,
+				"Client":    retrieval.Client,
+				"Path":      retrieval.Path,
+				"Piece":     shorten(retrieval.PieceCID),
+				"Payload":   shorten(retrieval.PayloadCID),
+				"Range":     retrieval.Range,
+				"Status":    retrieval.Status,
+				"Sent":      units.BytesSize(float64(retrieval.Sent)),
+				"Duration":  retrieval.Duration.Round(time.Millisecond),
+				"CreatedAt": time.Unix(int64(retrieval.CreatedAt), 0).Format(time.RFC3339),
+			}
+			if len(retrieval.Message) != 0 {
+				row["Message"] = retrieval.Message
+			}
+			tw.Write(row)
+		}
+		return tw.Flush(os.Stdout)
+	},
+}
+
+var retrievalHTTPGetCmd = &cli.Command{
+	Name:      "get",
+	Usage:     "Print a request served by the http retrieval server",
+	ArgsUsage: "<id>",
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return fmt.Errorf("expected 1 argument")
+		}
+		id, err := uuid.Parse(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		api, closer, err := NewDropletNode(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		retrieval, err := api.HTTPRetrievalGet(ReqContext(cctx), id)
+		if err != nil {
+			return err
+		}
+
+		var pieceCID, payloadCID string
+		if retrieval.PieceCID.Defined() {
+			pieceCID = retrieval.PieceCID.String()
+		}
+		if retrieval.PayloadCID.Defined() {
+			payloadCID = retrieval.PayloadCID.String()
+		}
+		data := []kv{
+			{"ID", retrieval.ID},
+			{"Client", retrieval.Client},
+			{"Path", retrieval.Path},
+			{"PieceCID", pieceCID},
+			{"PayloadCID", payloadCID},
+			{"Range", retrieval.Range},
+			{"Status", retrieval.Status},
+			{"Sent", retrieval.Sent},
+			{"Duration", retrieval.Duration},
+			{"Message", retrieval.Message},
+			{"CreatedAt", time.Unix(int64(retrieval.CreatedAt), 0).Format(time.RFC3339)},
+		}
+		fillSpaceAndPrint(data, len("PayloadCID"))
+
+		return nil
+	},
+}
+
+var retrievalHTTPSignCmd = &cli.Command{
+	Name:      "sign",
+	Usage:     "Mint a signed url to download the piece for a deal client, the piece access control must be enabled",
+	ArgsUsage: "<piece cid> <client>",
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "ttl",
+			Usage: "lifetime of the url, PieceAccess.SignedURLTTL is used if it's 0",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 2 {
+			return fmt.Errorf("expected 2 arguments")
+		}
+		pieceCID, err := cid.Decode(cctx.Args().Get(0))
+		if err != nil {
+			return fmt.Errorf("parse piece cid: %w", err)
+		}
+		client, err := address.NewFromString(cctx.Args().Get(1))
+		if err != nil {
+			return fmt.Errorf("parse client: %w", err)
+		}
+
+		api, closer, err := NewDropletNode(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		signed, err := api.PieceSignURL(ReqContext(cctx), pieceCID, client, cctx.Duration("ttl"))
+		if err != nil {
+			return err
+		}
+
+		data := []kv{
+			{"PieceCID", signed.PieceCID},
+			{"Client", signed.Client},
+			{"Expires", signed.Expires.Format(time.RFC3339)},
+			{"Path", signed.Path},
+			{"Query", signed.Query},
+		}
+		fillSpaceAndPrint(data, len("PieceCID"))
+		fmt.Printf("\nthe query is also accepted by /resource?resource-id=%s&<query>\n", signed.PieceCID)
+
+		return nil
+	},
+}
@@ -39,6 +39,7 @@ var StorageCmds = &cli.Command{
 		storageAsksCmds,
 		storageCfgCmds,
 		directDealCmds,
+		dealLimitCmds,
 	},
 }
 
@@ -52,6 +53,7 @@ var storageDealsCmds = &cli.Command{
 		dealsListCmd,
 		updateStorageDealStateCmd,
 		dealsPendingPublish,
+		dealsPublishMessages,
 		getDealCmd,
 		dealStateCmd,
 		autoUpdateDealPayloadSizeCmd,
@@ -706,6 +708,66 @@ var dealsPendingPublish = &cli.Command{
 	},
 }
 
+var dealsPublishMessages = &cli.Command{
+	Name:      "publish-messages",
+	Usage:     "list the publish messages of the miner sent in the last day and the pending ones",
+	ArgsUsage: "<miner address>",
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return fmt.Errorf("must pass miner address")
+		}
+		mAddr, err := address.NewFromString(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		api, closer, err := NewDropletNode(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		msgs, err := api.DealPublishMessages(ctx, mAddr)
+		if err != nil {
+			return err
+		}
+
+		tw := tablewriter.New(
+			tablewriter.Col("MsgCid"),
+			tablewriter.Col("State"),
+			tablewriter.Col("Deals"),
+			tablewriter.Col("BaseFee"),
+			tablewriter.Col("EstimatedFee"),
+			tablewriter.Col("Replaced"),
+			tablewriter.Col("FinalCid"),
+			tablewriter.Col("ExitCode"),
+			tablewriter.Col("PushedAt"),
+			tablewriter.NewLineCol("Error"),
+		)
+		for _, msg := range msgs {
+			finalCid := "-"
+			if msg.FinalCid.Defined() {
+				finalCid = msg.FinalCid.String()
+			}
+			tw.Write(map[string]interface{}{
+				"MsgCid":       msg.MsgCid,
+				"State":        msg.State,
+				"Deals":        len(msg.Deals),
+				"BaseFee":      types.FIL(msg.BaseFee).Short(),
+				"EstimatedFee": types.FIL(msg.EstimatedFee).Short(),
+				"Replaced":     len(msg.ReplacedCids),
+				"FinalCid":     finalCid,
+				"ExitCode":     msg.ExitCode,
+				"PushedAt":     msg.PushedAt.Format(time.RFC3339),
+				"Error":        msg.Error,
+			})
+		}
+
+		return tw.Flush(os.Stdout)
+	},
+}
+
 var getDealCmd = &cli.Command{
 	Name:  "get",
 	Usage: "Print a storage deal",
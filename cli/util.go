@@ -41,6 +41,7 @@ import (
 	cbg "github.com/whyrusleeping/cbor-gen"
 
 	"github.com/ipfs-force-community/droplet/v2/api/clients/signer"
+	"github.com/ipfs-force-community/droplet/v2/api/dropletapi"
 	"github.com/ipfs-force-community/droplet/v2/cli/tablewriter"
 	"github.com/ipfs-force-community/droplet/v2/config"
 	"github.com/ipfs-force-community/droplet/v2/utils"
@@ -122,6 +123,31 @@ func NewMarketNode(cctx *cli.Context) (marketapi.IMarket, jsonrpc.ClientCloser,
 	return marketapi.NewIMarketRPC(cctx.Context, addr, apiInfo.AuthHeader())
 }
 
+// NewDropletNode creates a client of the droplet api which is not defined in market api
+func NewDropletNode(cctx *cli.Context) (dropletapi.IDroplet, jsonrpc.ClientCloser, error) {
+	homePath, err := GetRepoPath(cctx, "repo", OldMarketRepoPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	apiUrl, err := os.ReadFile(path.Join(homePath, "api"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token, err := os.ReadFile(path.Join(homePath, "token"))
+	if err != nil {
+		return nil, nil, err
+	}
+	apiInfo := api.NewAPIInfo(string(apiUrl), string(token))
+	addr, err := apiInfo.DialArgs("v0")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dropletapi.NewIDropletRPC(cctx.Context, addr, apiInfo.AuthHeader())
+}
+
 func DailDropletNode(ctx context.Context, token, url string) (marketapi.IMarket, jsonrpc.ClientCloser, error) {
 	apiInfo := api.NewAPIInfo(url, token)
 	addr, err := apiInfo.DialArgs("v0")
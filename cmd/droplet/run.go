@@ -15,6 +15,7 @@ import (
 	"github.com/ipfs-force-community/sophon-auth/jwtclient"
 
 	"github.com/ipfs-force-community/droplet/v2/api/clients"
+	"github.com/ipfs-force-community/droplet/v2/api/dropletapi"
 	"github.com/ipfs-force-community/droplet/v2/api/impl"
 	"github.com/ipfs-force-community/droplet/v2/api/impl/v0api"
 	cli2 "github.com/ipfs-force-community/droplet/v2/cli"
@@ -30,6 +31,7 @@ import (
 	"github.com/ipfs-force-community/droplet/v2/paychmgr"
 	"github.com/ipfs-force-community/droplet/v2/piecestorage"
 	"github.com/ipfs-force-community/droplet/v2/retrievalprovider"
+	"github.com/ipfs-force-community/droplet/v2/retrievalprovider/bitswap"
 	"github.com/ipfs-force-community/droplet/v2/retrievalprovider/httpretrieval"
 	"github.com/ipfs-force-community/droplet/v2/rpc"
 	"github.com/ipfs-force-community/droplet/v2/storageprovider"
@@ -190,6 +192,16 @@ func prepare(cctx *cli.Context) (*config.MarketConfig, error) {
 		return nil, err
 	}
 
+	// the keys are kept in their own files rather than the config, they are only created once
+	if err := config.InitKeyFile(cfg, config.PieceAccessKeyFile, config.RandKey(32)); err != nil {
+		return nil, fmt.Errorf("init the sign key of piece access: %w", err)
+	}
+	if cfg.Bitswap.Enable && len(cfg.Bitswap.ListenAddresses) > 0 {
+		if err := config.InitKeyFile(cfg, config.BitswapKeyFile, bitswap.GenerateKey); err != nil {
+			return nil, fmt.Errorf("init the private key of bitswap peer: %w", err)
+		}
+	}
+
 	return cfg, cmd.FetchAndLoadBundles(cctx.Context, cfg.GetNode())
 }
 
@@ -249,8 +261,10 @@ func runDaemon(cctx *cli.Context) error {
 		network.NetworkOpts(true, cfg.SimultaneousTransfersForRetrieval, cfg.SimultaneousTransfersForStoragePerClient, cfg.SimultaneousTransfersForStorage),
 		piecestorage.PieceStorageOpts(&cfg.PieceStorage),
 		fundmgr.FundMgrOpts,
+		fundmgr.EscrowTopUpOpts(cfg),
 		dagstore.DagstoreOpts,
 		paychmgr.PaychOpts,
+		paychmgr.PaychRedeemOpts(&cfg.PaychRedeem),
 		// Markets
 		storageprovider.StorageProviderOpts(cfg),
 		retrievalprovider.RetrievalProviderOpts(cfg),
@@ -272,10 +286,18 @@ func runDaemon(cctx *cli.Context) error {
 	finishCh := utils.MonitorShutdown(shutdownChan)
 
 	router := mux.NewRouter()
-	if err = router.Handle("/resource", rpc.NewPieceStorageServer(resAPI.PieceStorageMgr)).GetError(); err != nil {
+	if err = router.Handle("/resource", rpc.NewPieceStorageServer(resAPI.PieceStorageMgr, resAPI.PieceAccess)).GetError(); err != nil {
 		return fmt.Errorf("handle 'resource' failed: %w", err)
 	}
-	httpRetrievalServer, err := httpretrieval.NewServer(ctx, resAPI.PieceStorageMgr, resAPI, resAPI.DAGStoreWrapper, gzip.BestSpeed)
+	httpRetrievalServer, err := httpretrieval.NewServer(ctx, resAPI.PieceStorageMgr, resAPI, resAPI.DAGStoreWrapper, gzip.BestSpeed,
+		httpretrieval.ServerOptions{
+			GatewayMarketClient: resAPI.GatewayMarketClient,
+			RetrievalFilter:     resAPI.RetrievalDealFilter,
+			LoadTracker:         resAPI.RetrievalLoad,
+			Repo:                resAPI.Repo,
+			Config:              &cfg.HTTPRetrieval,
+			Access:              resAPI.PieceAccess,
+		})
 	if err != nil {
 		return err
 	}
@@ -283,11 +305,15 @@ func runDaemon(cctx *cli.Context) error {
 	var iMarket marketapiV1.IMarketStruct
 	permission.PermissionProxy(marketapiV1.IMarket(resAPI), &iMarket)
 
+	var iDroplet dropletapi.IDropletStruct
+	permission.PermissionProxy(dropletapi.IDroplet(resAPI), &iDroplet)
+
 	api := (marketapiV1.IMarket)(&iMarket)
 	apiHandles := []rpc.APIHandle{
 		{Path: "/rpc/v1", API: api},
 		{Path: "/rpc/v0", API: v0api.WrapperV1IMarket{IMarket: api}},
+		{Path: dropletapi.RPCPath, API: (dropletapi.IDroplet)(&iDroplet)},
 	}
 
-	return rpc.ServeRPC(ctx, cfg, &cfg.API, router, 1000, cli2.API_NAMESPACE_VENUS_MARKET, authClient, apiHandles, finishCh, httpRetrievalServer)
+	return rpc.ServeRPC(ctx, cfg, &cfg.API, router, 1000, cli2.API_NAMESPACE_VENUS_MARKET, authClient, apiHandles, finishCh, httpRetrievalServer, resAPI.PieceAccess)
 }
@@ -177,14 +177,27 @@ type ProviderConfig struct {
 	// A command used for fine-grained evaluation of retrieval deals
 	// see https://docs.filecoin.io/mine/lotus/miner-configuration/#using-filters-for-fine-grained-storage-and-retrieval-deal-acceptance for more details
 	RetrievalFilter string
+	// The way to evaluate storage and retrieval deals, Filter and RetrievalFilter commands are used in script mode
+	DealFilter *DealFilter
+	// Limits of the storage deals accepted from each client address and each peer
+	DealRateLimit *DealRateLimit
+	// Keep the escrow of the miner in the market actor between Min and Target
+	EscrowTopUp *EscrowTopUp
+	// The strategy to pack deals into sectors, "greedy", "best-fit-decreasing", "deadline-first" or "affinity"
+	PackingStrategy string
 
 	TransferPath string
 
-	RetrievalPricing *RetrievalPricing // todo reserve
+	RetrievalPricing *RetrievalPricing
 
 	MaxPublishDealsFee     types.FIL
 	MaxMarketBalanceAddFee types.FIL
 
+	// Publishing deals is delayed while the base fee is above it, 0 means no limit
+	MaxPublishBaseFee types.FIL
+	// The deals whose StartEpoch is within this duration are published even if the base fee is above MaxPublishBaseFee
+	PublishUrgentWindow Duration
+
 	RetrievalPaymentAddress Address
 
 	DealPublishAddress []Address
@@ -214,6 +227,28 @@ func defaultProviderConfig() *ProviderConfig {
 
 		Filter:          "",
 		RetrievalFilter: "",
+		DealFilter: &DealFilter{
+			Mode: DealFilterScriptMode,
+			Rules: &DealFilterRules{
+				AllowClients:           []Address{},
+				DenyClients:            []Address{},
+				AllowRetrievalClients:  []string{},
+				DenyRetrievalClients:   []string{},
+				MinPricePerGiB:         types.FIL(types.NewInt(0)),
+				MinVerifiedPricePerGiB: types.FIL(types.NewInt(0)),
+			},
+			Webhook: &DealFilterWebhook{
+				Headers: map[string]string{},
+				Timeout: Duration(10 * time.Second),
+			},
+		},
+		DealRateLimit: &DealRateLimit{},
+		EscrowTopUp: &EscrowTopUp{
+			Min:       types.FIL(types.NewInt(0)),
+			Target:    types.FIL(types.NewInt(0)),
+			MaxPerDay: types.FIL(types.NewInt(0)),
+		},
+		PackingStrategy: PackingGreedy,
 
 		TransferPath: "",
 
@@ -229,6 +264,10 @@ func defaultProviderConfig() *ProviderConfig {
 
 		MaxPublishDealsFee:     types.FIL(types.NewInt(0)),
 		MaxMarketBalanceAddFee: types.FIL(types.NewInt(0)),
+
+		MaxPublishBaseFee:   types.FIL(types.NewInt(0)),
+		PublishUrgentWindow: Duration(time.Hour * 48),
+
 		HTTPRetrievalMultiaddr: "",
 
 		IndexProvider: IndexProviderConfig{
@@ -42,6 +42,87 @@ type RetrievalPricingDefault struct {
 	VerifiedDealsFreeTransfer bool
 }
 
+const (
+	// DealFilterScriptMode runs the Filter and RetrievalFilter commands to evaluate deals.
+	DealFilterScriptMode = "script"
+	// DealFilterRulesMode evaluates deals in process with the rules in DealFilter.Rules.
+	DealFilterRulesMode = "rules"
+	// DealFilterWebhookMode posts deals to the url in DealFilter.Webhook.
+	DealFilterWebhookMode = "webhook"
+)
+
+type DealFilter struct {
+	Mode string // possible values: "script", "rules", "webhook"
+
+	Rules   *DealFilterRules
+	Webhook *DealFilterWebhook
+}
+
+type DealFilterRules struct {
+	// Clients whose storage deals are accepted, empty means all clients which are not in DenyClients
+	AllowClients []Address
+	// Clients whose storage deals are rejected
+	DenyClients []Address
+	// Clients allowed to retrieve data, peer id for graphsync or ip for http,
+	// empty means all clients which are not in DenyRetrievalClients
+	AllowRetrievalClients []string
+	// Clients not allowed to retrieve data, peer id for graphsync or ip for http
+	DenyRetrievalClients []string
+
+	// The lowest price per GiB per epoch of unverified deals
+	MinPricePerGiB types.FIL
+	// The lowest price per GiB per epoch of verified deals
+	MinVerifiedPricePerGiB types.FIL
+	// The range of padded piece size in bytes, 0 means no limit
+	MinPieceSize uint64
+	MaxPieceSize uint64
+	// When enabled, only verified deals are accepted
+	VerifiedOnly bool
+
+	// The max number of deals a client can make with the miner in 24 hours, 0 means no limit
+	ClientDailyDealLimit uint64
+	// The max padded piece size in bytes a client can store with the miner in 24 hours, 0 means no limit
+	ClientDailySizeLimit uint64
+}
+
+type DealFilterWebhook struct {
+	// The url the deal is posted to, the response must be a json like {"Accept": true, "Reason": ""}
+	URL string
+	// Headers sent with the request, eg "Authorization"
+	Headers map[string]string
+	// Timeout of the request
+	Timeout Duration
+}
+
+// DealRateLimit limits the storage deals accepted from each client address and each peer
+type DealRateLimit struct {
+	// Limits of each client address
+	Client RateLimit
+	// Limits of each peer
+	Peer RateLimit
+}
+
+type RateLimit struct {
+	// The max number of deals accepted in the last hour, 0 means no limit
+	DealsPerHour uint64
+	// The max piece size of deals accepted in the last 24 hours, 0 means no limit
+	BytesPerDay uint64
+	// The max number of online deals transferring data at the same time, 0 means no limit
+	ConcurrentTransfers uint64
+}
+
+// EscrowTopUp keeps the available escrow of the miner in the market actor above Min by topping it up to Target
+type EscrowTopUp struct {
+	// The available escrow (escrow - locked - reserved) under which the escrow is topped up, 0 disables the top-up
+	Min types.FIL
+	// The available escrow after topping up, it is raised to Min if it is smaller than Min
+	Target types.FIL
+	// The wallet to top up from
+	Wallet Address
+	// The max amount topped up in the last 24 hours, 0 means no limit
+	MaxPerDay types.FIL
+}
+
 type Journal struct {
 	Path string
 }
@@ -96,14 +177,77 @@ type MongoTopIndex struct {
 	Url string
 }
 
+const (
+	// PlacementRandom writes pieces to a random storage which has enough free space.
+	PlacementRandom = "random"
+	// PlacementWeighted writes pieces to a random storage, the chance is proportional to the Weight of the storage.
+	PlacementWeighted = "weighted"
+	// PlacementLeastUsed writes pieces to the storage with the lowest ratio of used and reserved space.
+	PlacementLeastUsed = "least-used"
+	// PlacementAffinity writes pieces to the least used storage whose Miners or Clients contains the deal,
+	// the storages without Miners and Clients are used when no storage matches.
+	PlacementAffinity = "affinity"
+)
+
+const (
+	// PackingGreedy fills the sector with deals from the smallest, and puts fillers between deals for alignment.
+	PackingGreedy = "greedy"
+	// PackingBestFitDecreasing fills the sector with the largest deals which fit the remaining space.
+	PackingBestFitDecreasing = "best-fit-decreasing"
+	// PackingDeadlineFirst fills the sector with the deals whose StartEpoch is nearest.
+	PackingDeadlineFirst = "deadline-first"
+	// PackingAffinity fills the sector with the deals of the same client and verified type first,
+	// the remaining space is filled with the deals of other groups.
+	PackingAffinity = "affinity"
+)
+
 type PieceStorage struct {
+	// The policy to choose the storage which pieces are written to, "random", "weighted", "least-used" or "affinity"
+	Placement string
+
+	// The time between calls to periodic piece storage GC, in time.Duration string
+	// representation, e.g. 1h, 24h. The pieces whose deals are all terminated are moved to quarantine by GC.
+	// Default value: 0, disabled periodic GC, `droplet piece-storage gc` still works.
+	GCInterval Duration
+	// The time a piece stays in quarantine before it is deleted by GC.
+	// Default value: 168h.
+	GCGracePeriod Duration
+	// Whether to compute the CommP of the pieces while writing them to piece storage, the pieces which don't hash
+	// to their piece cid are rejected and not kept. Default value: false.
+	VerifyOnWrite bool
+	// The time between rounds of the background scrubber, which re-reads the pieces in piece storage and checks them
+	// against their piece cid, the pieces verified within the interval are skipped. The corrupted pieces are not served.
+	// Default value: 0, disabled periodic scrub, `droplet piece-storage scrub` still works.
+	ScrubInterval Duration
+	// The max number of bytes read by the scrubber per second, 0 means no limit.
+	// Default value: 52428800 (50MiB).
+	ScrubRate uint64
+
 	Fs []*FsPieceStorage
 	S3 []*S3PieceStorage
 }
+
+// StoragePlacement is the options of a piece storage used by the placement policy
+type StoragePlacement struct {
+	// Weight of the storage in weighted placement, 0 is treated as 1
+	Weight uint64
+	// The miners and clients whose pieces are preferred to be written to the storage in affinity placement
+	Miners  []Address
+	Clients []Address
+}
+
 type FsPieceStorage struct {
 	Name     string
 	ReadOnly bool
 	Path     string
+	// Shared is set when the directory is shared by multiple droplet instances, e.g. on NFS or CephFS,
+	// the writes and removals of a piece are protected by a lock file in the directory.
+	Shared bool
+	// The lease of the lock file in shared mode, a lock not refreshed in the lease is treated as stale
+	// and taken over by others. Default value: 0, treated as 1m.
+	LockLease Duration
+
+	StoragePlacement
 }
 type S3PieceStorage struct {
 	Name     string
@@ -115,6 +259,65 @@ type S3PieceStorage struct {
 	AccessKey string
 	SecretKey string
 	Token     string
+
+	StoragePlacement
+}
+
+// PaychRedeem is the policy to redeem the vouchers of inbound payment channels,
+// the best voucher of each lane is submitted when any condition is met and its value covers the gas cost
+type PaychRedeem struct {
+	// Enable the automatic redeem, `droplet paych redeem` still works if it is disabled
+	Enable bool
+	// Redeem the vouchers of a channel when its unredeemed value is above it, 0 means no threshold
+	Threshold types.FIL
+	// Redeem the vouchers of every channel on this interval, 0 means no schedule.
+	// The vouchers of a settling channel are always redeemed before the settlement.
+	Interval Duration
+	// A voucher is redeemed only if its unredeemed value is at least GasRatio times the estimated gas fee
+	GasRatio float64
+}
+
+// Bitswap serves the blocks of the deals in the dagstore over bitswap, it is announced to the indexer as an extended provider
+type Bitswap struct {
+	// Enable the bitswap server
+	Enable bool
+	// The addresses the separate bitswap peer listens on, the bitswap server runs with the droplet peer if it is empty.
+	// The private key of the separate peer is kept in the bitswap.key file in the repo, it is generated at startup.
+	ListenAddresses []string
+	// The public addresses of the separate bitswap peer announced to the indexer, ListenAddresses are announced if it is empty
+	PublicAddresses []string
+	// The max number of blocks requested by a peer per second, 0 means no limit
+	PeerRateLimit float64
+	// The max number of blocks a peer can request at once, it is at least 1 if PeerRateLimit is set
+	PeerRateBurst int
+}
+
+// HTTPRetrieval is the policy of the trustless gateway on the /ipfs/ path of the http retrieval server
+type HTTPRetrieval struct {
+	// Only serve the blocks of the pieces which have active storage or direct deals
+	ActiveDealsOnly bool
+	// The max duration of a response, the response is cut off when it's reached, 0 means no limit
+	MaxResponseDuration Duration
+	// The max number of bytes of a response, the response is cut off when it's reached, 0 means no limit
+	MaxResponseBytes int64
+	// The max number of bytes sent to a client per second, it's shared by the requests of the client, 0 means no limit
+	ClientBandwidth int64
+	// The records of the requests older than it are removed, 0 means they are kept forever
+	RecordRetention Duration
+}
+
+// PieceAccess controls the downloads of pieces through /piece/{cid} of the http retrieval server and GET /resource,
+// anyone who can reach the http retrieval server can download the pieces if it's disabled.
+// The trustless gateway on /ipfs/ also requires a bearer token when it's enabled, the signed urls are only for pieces.
+// The HMAC key of the signed urls is kept in the piece-access.key file of the repo, which is created at startup.
+type PieceAccess struct {
+	// Only serve the requests with a bearer token verified by the auth node or a signed url minted by droplet
+	Enable bool
+	// The lifetime of the signed urls if it is not given when they are minted
+	SignedURLTTL Duration
+	// The deal clients who can get signed urls, a signed url is only valid for the pieces of the deals of its client.
+	// Empty means all deal clients.
+	AllowedClients []Address
 }
 
 type Mysql struct {
@@ -161,6 +364,14 @@ type MarketConfig struct {
 	PieceStorage PieceStorage
 	DAGStore     DAGStoreConfig
 
+	PaychRedeem PaychRedeem
+
+	Bitswap Bitswap
+
+	HTTPRetrieval HTTPRetrieval
+
+	PieceAccess PieceAccess
+
 	CommonProvider *ProviderConfig
 	Miners         []*MinerConfig
 
@@ -259,6 +470,31 @@ func (m *MarketConfig) AddS3PieceStorage(fsps *S3PieceStorage) error {
 }
 
 // MinerProviderConfig returns provider config. if mAddr is empty, returns global provider config.
+// CheckPackingStrategy returns an error if the packing strategy of the common provider or any miner is unknown
+func (m *MarketConfig) CheckPackingStrategy() error {
+	if err := checkPackingStrategy(m.CommonProvider); err != nil {
+		return fmt.Errorf("common provider: %w", err)
+	}
+	for _, mCfg := range m.Miners {
+		if err := checkPackingStrategy(mCfg.ProviderConfig); err != nil {
+			return fmt.Errorf("miner %s: %w", address.Address(mCfg.Addr), err)
+		}
+	}
+	return nil
+}
+
+func checkPackingStrategy(pCfg *ProviderConfig) error {
+	if pCfg == nil {
+		return nil
+	}
+	switch pCfg.PackingStrategy {
+	case "", PackingGreedy, PackingBestFitDecreasing, PackingDeadlineFirst, PackingAffinity:
+		return nil
+	default:
+		return fmt.Errorf("unknown packing strategy %s", pCfg.PackingStrategy)
+	}
+}
+
 func (m *MarketConfig) MinerProviderConfig(mAddr address.Address, useCommon bool) (*ProviderConfig, error) {
 	if mAddr.Empty() {
 		return m.CommonProvider, nil
@@ -324,8 +560,20 @@ func mergeProviderConfig(providerCfg, commonCfg *ProviderConfig) {
 	if len(providerCfg.TransferPath) == 0 && len(commonCfg.TransferPath) != 0 {
 		providerCfg.TransferPath = commonCfg.TransferPath
 	}
+	if providerCfg.DealFilter == nil && commonCfg.DealFilter != nil {
+		providerCfg.DealFilter = commonCfg.DealFilter
+	}
+	if providerCfg.DealRateLimit == nil && commonCfg.DealRateLimit != nil {
+		providerCfg.DealRateLimit = commonCfg.DealRateLimit
+	}
+	if providerCfg.EscrowTopUp == nil && commonCfg.EscrowTopUp != nil {
+		providerCfg.EscrowTopUp = commonCfg.EscrowTopUp
+	}
+	if len(providerCfg.PackingStrategy) == 0 && len(commonCfg.PackingStrategy) != 0 {
+		providerCfg.PackingStrategy = commonCfg.PackingStrategy
+	}
 	if providerCfg.RetrievalPricing == nil && commonCfg.RetrievalPricing != nil {
-		providerCfg.RetrievalFilter = commonCfg.RetrievalFilter
+		providerCfg.RetrievalPricing = commonCfg.RetrievalPricing
 	}
 	if nilOrZero(providerCfg.MaxPublishDealsFee) && !nilOrZero(commonCfg.MaxPublishDealsFee) {
 		providerCfg.MaxPublishDealsFee.Int = commonCfg.MaxPublishDealsFee.Int
@@ -333,6 +581,12 @@ func mergeProviderConfig(providerCfg, commonCfg *ProviderConfig) {
 	if nilOrZero(providerCfg.MaxMarketBalanceAddFee) && !nilOrZero(commonCfg.MaxMarketBalanceAddFee) {
 		providerCfg.MaxMarketBalanceAddFee.Int = commonCfg.MaxMarketBalanceAddFee.Int
 	}
+	if nilOrZero(providerCfg.MaxPublishBaseFee) && !nilOrZero(commonCfg.MaxPublishBaseFee) {
+		providerCfg.MaxPublishBaseFee.Int = commonCfg.MaxPublishBaseFee.Int
+	}
+	if providerCfg.PublishUrgentWindow == 0 && commonCfg.PublishUrgentWindow != 0 {
+		providerCfg.PublishUrgentWindow = commonCfg.PublishUrgentWindow
+	}
 	if address.Address(providerCfg.RetrievalPaymentAddress).Empty() {
 		providerCfg.RetrievalPaymentAddress = commonCfg.RetrievalPaymentAddress
 	}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeProviderConfig(t *testing.T) {
+	commonCfg := &ProviderConfig{
+		RetrievalFilter: "common-filter",
+		RetrievalPricing: &RetrievalPricing{
+			Strategy: "external",
+			External: &RetrievalPricingExternal{Path: "/bin/pricing"},
+		},
+	}
+
+	// the miner inherits the unset retrieval pricing and keeps its own retrieval filter
+	providerCfg := &ProviderConfig{RetrievalFilter: "miner-filter"}
+	mergeProviderConfig(providerCfg, commonCfg)
+	require.Equal(t, commonCfg.RetrievalPricing, providerCfg.RetrievalPricing)
+	require.Equal(t, "miner-filter", providerCfg.RetrievalFilter)
+
+	// the retrieval pricing of the miner is kept
+	minerPricing := &RetrievalPricing{Strategy: "default", Default: &RetrievalPricingDefault{VerifiedDealsFreeTransfer: true}}
+	providerCfg = &ProviderConfig{RetrievalPricing: minerPricing}
+	mergeProviderConfig(providerCfg, commonCfg)
+	require.Equal(t, minerPricing, providerCfg.RetrievalPricing)
+	require.Equal(t, "common-filter", providerCfg.RetrievalFilter)
+}
+
+func TestCheckPackingStrategy(t *testing.T) {
+	cfg := &MarketConfig{
+		CommonProvider: &ProviderConfig{PackingStrategy: PackingGreedy},
+		Miners:         []*MinerConfig{{ProviderConfig: &ProviderConfig{PackingStrategy: PackingAffinity}}, {}},
+	}
+	require.NoError(t, cfg.CheckPackingStrategy())
+
+	cfg.Miners[0].PackingStrategy = "unknown"
+	require.ErrorContains(t, cfg.CheckPackingStrategy(), "unknown packing strategy")
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/ipfs-force-community/metrics"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/venus/venus-shared/types"
 )
 
 const (
@@ -39,13 +40,43 @@ var DefaultMarketConfig = &MarketConfig{
 		Debug:            false,
 	},
 	PieceStorage: PieceStorage{
-		Fs: []*FsPieceStorage{},
+		Placement:     PlacementRandom,
+		GCInterval:    Duration(0),
+		GCGracePeriod: Duration(7 * 24 * time.Hour),
+		ScrubInterval: Duration(0),
+		ScrubRate:     50 << 20,
+		Fs:            []*FsPieceStorage{},
 	},
 	DAGStore: DAGStoreConfig{
 		MaxConcurrentIndex:         5,
 		MaxConcurrencyStorageCalls: 100,
 		GCInterval:                 Duration(0),
 	},
+	PaychRedeem: PaychRedeem{
+		Enable:    false,
+		Threshold: types.MustParseFIL("1"),
+		Interval:  Duration(7 * 24 * time.Hour),
+		GasRatio:  2,
+	},
+	Bitswap: Bitswap{
+		Enable:          false,
+		ListenAddresses: []string{},
+		PublicAddresses: []string{},
+		PeerRateLimit:   0,
+		PeerRateBurst:   0,
+	},
+	HTTPRetrieval: HTTPRetrieval{
+		ActiveDealsOnly:     false,
+		MaxResponseDuration: Duration(0),
+		MaxResponseBytes:    0,
+		ClientBandwidth:     0,
+		RecordRetention:     Duration(30 * 24 * time.Hour),
+	},
+	PieceAccess: PieceAccess{
+		Enable:         false,
+		SignedURLTTL:   Duration(24 * time.Hour),
+		AllowedClients: []Address{},
+	},
 
 	SimultaneousTransfersForRetrieval:        DefaultSimultaneousTransfers,
 	SimultaneousTransfersForStoragePerClient: DefaultSimultaneousTransfers,
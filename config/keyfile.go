@@ -0,0 +1,70 @@
+package config
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// PieceAccessKeyFile is the file in the repo which keeps the HMAC key of the signed piece urls
+const PieceAccessKeyFile = "piece-access.key"
+
+// BitswapKeyFile is the file in the repo which keeps the libp2p private key of the separate bitswap peer
+const BitswapKeyFile = "bitswap.key"
+
+// keyFileMode makes the key files only readable by the owner
+const keyFileMode = 0o600
+
+// InitKeyFile creates the key file in the repo with the key returned by gen if it doesn't exist,
+// the key is kept out of the config file so it won't be shared with the config
+func InitKeyFile(home IHome, name string, gen func() ([]byte, error)) error {
+	keyPath, err := home.HomeJoin(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(keyPath); err == nil || !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	key, err := gen()
+	if err != nil {
+		return fmt.Errorf("generate key of %s: %w", name, err)
+	}
+	f, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, keyFileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(key); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadKeyFile reads the key file in the repo, it's an error if the file is readable by others
+func ReadKeyFile(home IHome, name string) ([]byte, error) {
+	keyPath, err := home.HomeJoin(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %w", keyPath, err)
+	}
+	if fi.Mode().Perm()&^keyFileMode != 0 {
+		return nil, fmt.Errorf("key file %s is accessible by others, its mode %o should be %o", keyPath, fi.Mode().Perm(), keyFileMode)
+	}
+	return os.ReadFile(keyPath)
+}
+
+// RandKey returns a generator of random keys of the size
+func RandKey(size int) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		key := make([]byte, size)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyFile(t *testing.T) {
+	home := &Home{HomeDir: t.TempDir()}
+
+	_, err := ReadKeyFile(home, PieceAccessKeyFile)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, InitKeyFile(home, PieceAccessKeyFile, RandKey(32)))
+	key, err := ReadKeyFile(home, PieceAccessKeyFile)
+	require.NoError(t, err)
+	require.Len(t, key, 32)
+
+	// the key is created only once
+	require.NoError(t, InitKeyFile(home, PieceAccessKeyFile, RandKey(32)))
+	key2, err := ReadKeyFile(home, PieceAccessKeyFile)
+	require.NoError(t, err)
+	require.Equal(t, key, key2)
+
+	keyPath := filepath.Join(home.HomeDir, PieceAccessKeyFile)
+	fi, err := os.Stat(keyPath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	require.NoError(t, os.Chmod(keyPath, 0o644))
+	_, err = ReadKeyFile(home, PieceAccessKeyFile)
+	require.ErrorContains(t, err, "accessible by others")
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-fil-markets/filestore"
 	vsTypes "github.com/filecoin-project/venus/venus-shared/types"
-	types "github.com/filecoin-project/venus/venus-shared/types/market"
 	types2 "github.com/ipfs-force-community/droplet/v2/types"
 )
 
@@ -85,7 +84,7 @@ type GetExpectedSealDurationFunc func(address.Address) (time.Duration, error)
 
 type (
 	StorageDealFilter   func(ctx context.Context, mAddr address.Address, dealParams *types2.DealParams) (bool, string, error)
-	RetrievalDealFilter func(ctx context.Context, mAddr address.Address, deal types.ProviderDealState) (bool, string, error)
+	RetrievalDealFilter func(ctx context.Context, mAddr address.Address, params *types2.RetrievalDealParams) (bool, string, error)
 )
 
 // TransferFileStoreConfigFunc is a function which reads transfer-path from miner config creates FileStore object.
@@ -0,0 +1,159 @@
+package dealfilter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const agent = "boost"
+const jsonVersion = "2.2.0"
+
+// StoragePlugin decides whether to accept a storage deal of the miner, the reason is returned when the deal is rejected
+type StoragePlugin interface {
+	FilterStorageDeal(ctx context.Context, mAddr address.Address, pCfg *config.ProviderConfig, dealParams *types2.DealParams) (bool, string, error)
+}
+
+// RetrievalPlugin decides whether to accept a retrieval of the miner, the reason is returned when the retrieval is rejected
+type RetrievalPlugin interface {
+	FilterRetrievalDeal(ctx context.Context, mAddr address.Address, pCfg *config.ProviderConfig, params *types2.RetrievalDealParams) (bool, string, error)
+}
+
+// StorageDeal is the json of storage deal sent to the filter script and webhook
+type StorageDeal struct {
+	*types2.DealParams
+	SealingPipelineState *SealingPipelineState
+	FundsState           *FundsState
+	StorageState         *StorageState
+	DealType             string
+	FormatVersion        string
+	Agent                string
+}
+
+// RetrievalDeal is the json of retrieval deal sent to the filter script and webhook
+type RetrievalDeal struct {
+	*types2.RetrievalDealParams
+	TransferLoad  *TransferLoad
+	DealType      string
+	FormatVersion string
+	Agent         string
+}
+
+// NewStorageDealFilter evaluates storage deals with the plugin of DealFilter.Mode in miner config,
+// the client quotas of the rules are checked with the deals counted in quota
+func NewStorageDealFilter(cfg *config.MarketConfig, sp StateProvider, quota *Quota) config.StorageDealFilter {
+	plugins := map[string]StoragePlugin{
+		config.DealFilterScriptMode:  &scriptPlugin{sp: sp},
+		config.DealFilterRulesMode:   newRulesPlugin(quota),
+		config.DealFilterWebhookMode: newWebhookPlugin(sp, nil),
+	}
+
+	return func(ctx context.Context, mAddr address.Address, dealParams *types2.DealParams) (bool, string, error) {
+		pCfg, err := cfg.MinerProviderConfig(mAddr, true)
+		if err != nil {
+			return false, "", err
+		}
+		if pCfg == nil {
+			return true, "", nil
+		}
+
+		mode := filterMode(pCfg)
+		plugin, ok := plugins[mode]
+		if !ok {
+			return false, "", fmt.Errorf("unknown deal filter mode %s", mode)
+		}
+		accept, reason, err := plugin.FilterStorageDeal(ctx, mAddr, pCfg, dealParams)
+		return filterResult(mode, accept, reason, err)
+	}
+}
+
+// NewRetrievalDealFilter evaluates retrievals with the plugin of DealFilter.Mode in miner config
+func NewRetrievalDealFilter(cfg *config.MarketConfig, lp RetrievalLoadProvider) config.RetrievalDealFilter {
+	plugins := map[string]RetrievalPlugin{
+		config.DealFilterScriptMode:  &scriptPlugin{lp: lp},
+		config.DealFilterRulesMode:   newRulesPlugin(nil),
+		config.DealFilterWebhookMode: newWebhookPlugin(nil, lp),
+	}
+
+	return func(ctx context.Context, mAddr address.Address, params *types2.RetrievalDealParams) (bool, string, error) {
+		pCfg, err := cfg.MinerProviderConfig(mAddr, true)
+		if err != nil {
+			return false, "", err
+		}
+		if pCfg == nil {
+			return true, "", nil
+		}
+
+		mode := filterMode(pCfg)
+		plugin, ok := plugins[mode]
+		if !ok {
+			return false, "", fmt.Errorf("unknown deal filter mode %s", mode)
+		}
+		accept, reason, err := plugin.FilterRetrievalDeal(ctx, mAddr, pCfg, params)
+		return filterResult(mode, accept, reason, err)
+	}
+}
+
+func filterMode(pCfg *config.ProviderConfig) string {
+	if pCfg.DealFilter == nil || len(pCfg.DealFilter.Mode) == 0 {
+		return config.DealFilterScriptMode
+	}
+	return pCfg.DealFilter.Mode
+}
+
+// filterResult adds the filter mode to the reason, which is recorded in the deal
+func filterResult(mode string, accept bool, reason string, err error) (bool, string, error) {
+	if err != nil {
+		return false, "", fmt.Errorf("%s deal filter: %w", mode, err)
+	}
+	if !accept {
+		return false, fmt.Sprintf("rejected by %s deal filter: %s", mode, reason), nil
+	}
+	return true, "", nil
+}
+
+func newStorageDeal(ctx context.Context, mAddr address.Address, sp StateProvider, dealParams *types2.DealParams) *StorageDeal {
+	deal := &StorageDeal{
+		DealParams:    dealParams,
+		DealType:      "storage",
+		FormatVersion: jsonVersion,
+		Agent:         agent,
+	}
+
+	// the filter still runs when some state is unavailable, the state is sent empty
+	var err error
+	if deal.SealingPipelineState, err = sp.SealingPipelineState(ctx, mAddr); err != nil {
+		log.Warnf("get sealing pipeline state of %s: %v", mAddr, err)
+		deal.SealingPipelineState = &SealingPipelineState{}
+	}
+	if deal.StorageState, err = sp.StorageState(ctx, mAddr); err != nil {
+		log.Warnf("get storage state of %s: %v", mAddr, err)
+		deal.StorageState = &StorageState{}
+	}
+	if deal.FundsState, err = sp.FundsState(ctx, mAddr); err != nil {
+		log.Warnf("get funds state of %s: %v", mAddr, err)
+		deal.FundsState = &FundsState{}
+	}
+
+	return deal
+}
+
+func newRetrievalDeal(ctx context.Context, lp RetrievalLoadProvider, params *types2.RetrievalDealParams) *RetrievalDeal {
+	transferLoad, err := lp.TransferLoad(ctx)
+	if err != nil {
+		log.Warnf("get retrieval transfer load: %v", err)
+		transferLoad = &TransferLoad{}
+	}
+
+	return &RetrievalDeal{
+		RetrievalDealParams: params,
+		TransferLoad:        transferLoad,
+		DealType:            "retrieval",
+		FormatVersion:       jsonVersion,
+		Agent:               agent,
+	}
+}
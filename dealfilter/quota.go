@@ -0,0 +1,188 @@
+package dealfilter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+// QuotaWindow is the longest period counted by the quotas, the older deals are dropped
+const QuotaWindow = 24 * time.Hour
+
+// QuotaKey identifies the deals counted together, they are the deals of a client address or a peer of a miner
+type QuotaKey struct {
+	Miner address.Address
+	// Kind is types.DealUsageClient or types.DealUsagePeer
+	Kind string
+	ID   string
+}
+
+func ClientQuotaKey(mAddr, client address.Address) QuotaKey {
+	return QuotaKey{Miner: mAddr, Kind: types2.DealUsageClient, ID: client.String()}
+}
+
+func PeerQuotaKey(mAddr address.Address, p peer.ID) QuotaKey {
+	return QuotaKey{Miner: mAddr, Kind: types2.DealUsagePeer, ID: p.String()}
+}
+
+type quotaRecord struct {
+	proposalCid cid.Cid
+	at          time.Time
+	size        uint64
+}
+
+// Quota counts the storage deals accepted in the last QuotaWindow by each client address and peer of the miners,
+// it is shared by the client quotas of the deal filter rules and the deal rate limits.
+// The deals are counted in memory and restored from the deals in repo after restart.
+type Quota struct {
+	deals DealLister
+
+	lk sync.Mutex
+	// loaded are the miners whose recent deals are loaded from repo
+	loaded  map[address.Address]struct{}
+	records map[QuotaKey][]quotaRecord
+}
+
+func NewQuota(deals DealLister) *Quota {
+	return &Quota{
+		deals:   deals,
+		loaded:  make(map[address.Address]struct{}),
+		records: make(map[QuotaKey][]quotaRecord),
+	}
+}
+
+// Load restores the deals accepted by the miner in the last QuotaWindow from repo, it only lists deals once for each miner.
+// The repo is queried without holding the lock.
+func (q *Quota) Load(ctx context.Context, mAddr address.Address) error {
+	q.lk.Lock()
+	_, ok := q.loaded[mAddr]
+	q.lk.Unlock()
+	if ok || q.deals == nil {
+		return nil
+	}
+
+	deals, err := q.deals.ListDeal(ctx, &types.StorageDealQueryParams{
+		Miner:             mAddr,
+		DiscardFailedDeal: true,
+		Page:              types.Page{Limit: math.MaxInt32},
+	})
+	if err != nil {
+		return fmt.Errorf("list deals of %s: %w", mAddr, err)
+	}
+
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	if _, ok := q.loaded[mAddr]; ok {
+		return nil
+	}
+	// the deals recorded while listing are not counted twice
+	recorded := make(map[cid.Cid]struct{})
+	for key, records := range q.records {
+		if key.Miner != mAddr {
+			continue
+		}
+		for _, r := range records {
+			recorded[r.proposalCid] = struct{}{}
+		}
+	}
+
+	since := time.Now().Add(-QuotaWindow)
+	for _, deal := range deals {
+		if deal.State == storagemarket.StorageDealRejecting || deal.State == storagemarket.StorageDealProposalRejected ||
+			deal.State == storagemarket.StorageDealUnknown {
+			continue
+		}
+		if _, ok := recorded[deal.ProposalCid]; ok {
+			continue
+		}
+		createdAt := time.Unix(int64(deal.CreatedAt), 0)
+		if createdAt.Before(since) {
+			continue
+		}
+		q.record(deal, createdAt)
+	}
+	q.loaded[mAddr] = struct{}{}
+
+	return nil
+}
+
+// Record counts the accepted deal for its client address and peer
+func (q *Quota) Record(deal *types.MinerDeal, at time.Time) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	q.record(deal, at)
+}
+
+func (q *Quota) record(deal *types.MinerDeal, at time.Time) {
+	r := quotaRecord{proposalCid: deal.ProposalCid, at: at, size: uint64(deal.Proposal.PieceSize)}
+	mAddr := deal.Proposal.Provider
+	for _, key := range []QuotaKey{ClientQuotaKey(mAddr, deal.Proposal.Client), PeerQuotaKey(mAddr, deal.Client)} {
+		q.records[key] = append(q.records[key], r)
+	}
+}
+
+// Count returns the number and the total piece size of the deals accepted in the window, which is at most QuotaWindow.
+// The records older than QuotaWindow are dropped.
+func (q *Quota) Count(key QuotaKey, window time.Duration) (uint64, uint64) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	now := time.Now()
+	var records []quotaRecord
+	var deals, size uint64
+	for _, r := range q.records[key] {
+		if now.Sub(r.at) > QuotaWindow {
+			continue
+		}
+		records = append(records, r)
+		if now.Sub(r.at) <= window {
+			deals++
+			size += r.size
+		}
+	}
+	if len(records) == 0 {
+		delete(q.records, key)
+	} else {
+		q.records[key] = records
+	}
+
+	return deals, size
+}
+
+// Keys returns the client addresses and peers which have deals counted for the miner
+func (q *Quota) Keys(mAddr address.Address) []QuotaKey {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	var keys []QuotaKey
+	for key := range q.records {
+		if key.Miner == mAddr {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Reset clears the counted deals of the client address or peer id, all deals of the miner are cleared if id is empty
+func (q *Quota) Reset(mAddr address.Address, id string) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	for key := range q.records {
+		if key.Miner == mAddr && (len(id) == 0 || key.ID == id) {
+			delete(q.records, key)
+		}
+	}
+}
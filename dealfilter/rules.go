@@ -0,0 +1,134 @@
+package dealfilter
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const gib = 1 << 30
+
+// DealLister lists storage deals, it is used to restore the client quotas
+type DealLister interface {
+	ListDeal(ctx context.Context, params *types.StorageDealQueryParams) ([]*types.MinerDeal, error)
+}
+
+// rulesPlugin evaluates deals in process with the rules in DealFilter.Rules
+type rulesPlugin struct {
+	// quota counts the accepted deals, the deals are counted after they pass all checks rather than by the filter
+	quota *Quota
+}
+
+func newRulesPlugin(quota *Quota) *rulesPlugin {
+	return &rulesPlugin{quota: quota}
+}
+
+func (p *rulesPlugin) FilterStorageDeal(ctx context.Context, mAddr address.Address, pCfg *config.ProviderConfig, dealParams *types2.DealParams) (bool, string, error) {
+	if pCfg.DealFilter == nil || pCfg.DealFilter.Rules == nil {
+		return true, "", nil
+	}
+	rules := pCfg.DealFilter.Rules
+	proposal := dealParams.ClientDealProposal.Proposal
+
+	if containsAddress(rules.DenyClients, proposal.Client) {
+		return false, fmt.Sprintf("client %s is denied", proposal.Client), nil
+	}
+	if len(rules.AllowClients) != 0 && !containsAddress(rules.AllowClients, proposal.Client) {
+		return false, fmt.Sprintf("client %s is not allowed", proposal.Client), nil
+	}
+
+	if rules.VerifiedOnly && !proposal.VerifiedDeal {
+		return false, "only verified deals are accepted", nil
+	}
+
+	pieceSize := uint64(proposal.PieceSize)
+	if rules.MinPieceSize != 0 && pieceSize < rules.MinPieceSize {
+		return false, fmt.Sprintf("piece size %d is less than %d", pieceSize, rules.MinPieceSize), nil
+	}
+	if rules.MaxPieceSize != 0 && pieceSize > rules.MaxPieceSize {
+		return false, fmt.Sprintf("piece size %d is greater than %d", pieceSize, rules.MaxPieceSize), nil
+	}
+
+	minPrice := rules.MinPricePerGiB
+	if proposal.VerifiedDeal {
+		minPrice = rules.MinVerifiedPricePerGiB
+	}
+	if mp := big.Int(minPrice); mp.Int != nil && !mp.IsZero() {
+		// price per GiB = StoragePricePerEpoch * GiB / PieceSize
+		price := big.Mul(proposal.StoragePricePerEpoch, big.NewInt(gib))
+		if price.LessThan(big.Mul(mp, big.NewIntUnsigned(pieceSize))) {
+			return false, fmt.Sprintf("storage price per epoch %s is lower than %s per GiB", proposal.StoragePricePerEpoch, minPrice), nil
+		}
+	}
+
+	if rules.ClientDailyDealLimit == 0 && rules.ClientDailySizeLimit == 0 {
+		return true, "", nil
+	}
+	return p.checkQuota(ctx, mAddr, proposal.Client, pieceSize, rules)
+}
+
+func (p *rulesPlugin) FilterRetrievalDeal(ctx context.Context, mAddr address.Address, pCfg *config.ProviderConfig, params *types2.RetrievalDealParams) (bool, string, error) {
+	if pCfg.DealFilter == nil || pCfg.DealFilter.Rules == nil {
+		return true, "", nil
+	}
+	rules := pCfg.DealFilter.Rules
+
+	if matchRetrievalClient(rules.DenyRetrievalClients, params.Client) {
+		return false, fmt.Sprintf("client %s is denied", params.Client), nil
+	}
+	if len(rules.AllowRetrievalClients) != 0 && !matchRetrievalClient(rules.AllowRetrievalClients, params.Client) {
+		return false, fmt.Sprintf("client %s is not allowed", params.Client), nil
+	}
+
+	return true, "", nil
+}
+
+// checkQuota checks the accepted deals of the client in the last 24 hours, the deal is not counted here
+func (p *rulesPlugin) checkQuota(ctx context.Context, mAddr, client address.Address, pieceSize uint64, rules *config.DealFilterRules) (bool, string, error) {
+	if p.quota == nil {
+		return true, "", nil
+	}
+	if err := p.quota.Load(ctx, mAddr); err != nil {
+		return false, "", err
+	}
+
+	deals, size := p.quota.Count(ClientQuotaKey(mAddr, client), QuotaWindow)
+	if rules.ClientDailyDealLimit != 0 && deals+1 > rules.ClientDailyDealLimit {
+		return false, fmt.Sprintf("client %s reached the daily deal limit %d", client, rules.ClientDailyDealLimit), nil
+	}
+	if rules.ClientDailySizeLimit != 0 && size+pieceSize > rules.ClientDailySizeLimit {
+		return false, fmt.Sprintf("client %s reached the daily size limit %d", client, rules.ClientDailySizeLimit), nil
+	}
+
+	return true, "", nil
+}
+
+func containsAddress(addrs []config.Address, addr address.Address) bool {
+	for _, a := range addrs {
+		if address.Address(a) == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRetrievalClient matches the peer id of graphsync client, or the ip of http client
+func matchRetrievalClient(clients []string, client string) bool {
+	host, _, err := net.SplitHostPort(client)
+	if err != nil {
+		host = client
+	}
+	for _, c := range clients {
+		if c == client || c == host {
+			return true
+		}
+	}
+	return false
+}
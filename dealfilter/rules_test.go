@@ -0,0 +1,189 @@
+package dealfilter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	vtypes "github.com/filecoin-project/venus/venus-shared/types"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+type mockDealLister struct {
+	deals []*types.MinerDeal
+}
+
+func (l *mockDealLister) ListDeal(ctx context.Context, params *types.StorageDealQueryParams) ([]*types.MinerDeal, error) {
+	return l.deals, nil
+}
+
+func newDealParams(client address.Address, size abi.PaddedPieceSize, price int64, verified bool) *types2.DealParams {
+	return &types2.DealParams{
+		ClientDealProposal: vtypes.ClientDealProposal{
+			Proposal: vtypes.DealProposal{
+				Client:               client,
+				PieceSize:            size,
+				StoragePricePerEpoch: big.NewInt(price),
+				VerifiedDeal:         verified,
+			},
+		},
+	}
+}
+
+func TestRulesStorageDeal(t *testing.T) {
+	ctx := context.Background()
+	addrGetter := address.NewForTestGetter()
+	mAddr, allowed, denied, other := addrGetter(), addrGetter(), addrGetter(), addrGetter()
+
+	pCfg := &config.ProviderConfig{
+		DealFilter: &config.DealFilter{
+			Mode: config.DealFilterRulesMode,
+			Rules: &config.DealFilterRules{
+				AllowClients:           []config.Address{config.Address(allowed), config.Address(denied)},
+				DenyClients:            []config.Address{config.Address(denied)},
+				MinPricePerGiB:         vtypes.FIL(big.NewInt(1)),
+				MinVerifiedPricePerGiB: vtypes.FIL(big.Zero()),
+				MinPieceSize:           1 << 20,
+				MaxPieceSize:           1 << 30,
+			},
+		},
+	}
+
+	cases := []struct {
+		name   string
+		params *types2.DealParams
+		accept bool
+	}{
+		{"accept", newDealParams(allowed, 1<<30, 1, false), true},
+		{"denied client", newDealParams(denied, 1<<30, 1, false), false},
+		{"client not in allow list", newDealParams(other, 1<<30, 1, false), false},
+		{"piece too small", newDealParams(allowed, 1<<10, 1, false), false},
+		{"piece too large", newDealParams(allowed, 1<<31, 2, false), false},
+		{"price too low", newDealParams(allowed, 1<<20, 0, false), false},
+		{"verified deal is free", newDealParams(allowed, 1<<20, 0, true), true},
+	}
+
+	p := newRulesPlugin(nil)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			accept, reason, err := p.FilterStorageDeal(ctx, mAddr, pCfg, c.params)
+			assert.NoError(t, err)
+			assert.Equal(t, c.accept, accept, reason)
+			if !c.accept {
+				assert.NotEmpty(t, reason)
+			}
+		})
+	}
+
+	t.Run("verified only", func(t *testing.T) {
+		pCfg.DealFilter.Rules.VerifiedOnly = true
+		defer func() { pCfg.DealFilter.Rules.VerifiedOnly = false }()
+
+		accept, _, err := p.FilterStorageDeal(ctx, mAddr, pCfg, newDealParams(allowed, 1<<30, 1, false))
+		assert.NoError(t, err)
+		assert.False(t, accept)
+		accept, _, err = p.FilterStorageDeal(ctx, mAddr, pCfg, newDealParams(allowed, 1<<30, 1, true))
+		assert.NoError(t, err)
+		assert.True(t, accept)
+	})
+}
+
+func TestRulesClientQuota(t *testing.T) {
+	ctx := context.Background()
+	addrGetter := address.NewForTestGetter()
+	mAddr, client := addrGetter(), addrGetter()
+
+	now := uint64(time.Now().Unix())
+	newDeal := func(createdAt uint64, state storagemarket.StorageDealStatus) *types.MinerDeal {
+		deal := &types.MinerDeal{State: state}
+		deal.Proposal.Provider = mAddr
+		deal.Proposal.Client = client
+		deal.Proposal.PieceSize = 1 << 20
+		deal.CreatedAt = createdAt
+		return deal
+	}
+	lister := &mockDealLister{deals: []*types.MinerDeal{
+		newDeal(now-3600, storagemarket.StorageDealActive),
+		newDeal(now-3600, storagemarket.StorageDealRejecting),
+		newDeal(now-2*24*3600, storagemarket.StorageDealActive),
+	}}
+
+	pCfg := &config.ProviderConfig{
+		DealFilter: &config.DealFilter{
+			Mode:  config.DealFilterRulesMode,
+			Rules: &config.DealFilterRules{ClientDailyDealLimit: 3},
+		},
+	}
+
+	// one deal in repo counts, the filter does not count the deals it accepts
+	quota := NewQuota(lister)
+	p := newRulesPlugin(quota)
+	for i := 0; i < 3; i++ {
+		accept, reason, err := p.FilterStorageDeal(ctx, mAddr, pCfg, newDealParams(client, 1<<20, 0, false))
+		assert.NoError(t, err)
+		assert.True(t, accept, reason)
+	}
+
+	// the deals are counted after they are accepted
+	accepted := &types.MinerDeal{}
+	accepted.Proposal.Provider = mAddr
+	accepted.Proposal.Client = client
+	accepted.Proposal.PieceSize = 2 << 20
+	for i := 0; i < 2; i++ {
+		quota.Record(accepted, time.Now())
+	}
+	accept, reason, err := p.FilterStorageDeal(ctx, mAddr, pCfg, newDealParams(client, 1<<20, 0, false))
+	assert.NoError(t, err)
+	assert.False(t, accept)
+	assert.Contains(t, reason, "daily deal limit")
+
+	// size limit
+	pCfg.DealFilter.Rules = &config.DealFilterRules{ClientDailySizeLimit: 7 << 20}
+	accept, reason, err = p.FilterStorageDeal(ctx, mAddr, pCfg, newDealParams(client, 2<<20, 0, false))
+	assert.NoError(t, err)
+	assert.True(t, accept, reason)
+	accept, reason, err = p.FilterStorageDeal(ctx, mAddr, pCfg, newDealParams(client, 3<<20, 0, false))
+	assert.NoError(t, err)
+	assert.False(t, accept)
+	assert.Contains(t, reason, "daily size limit")
+}
+
+func TestRulesRetrievalDeal(t *testing.T) {
+	ctx := context.Background()
+	pCfg := &config.ProviderConfig{
+		DealFilter: &config.DealFilter{
+			Mode: config.DealFilterRulesMode,
+			Rules: &config.DealFilterRules{
+				DenyRetrievalClients: []string{"12D3KooWPexjphGPRWx6WsPEvYiNNpeQrUQLzTpp6rFUUbT5Nmoo", "192.168.1.2"},
+			},
+		},
+	}
+
+	p := newRulesPlugin(nil)
+	cases := map[string]bool{
+		"12D3KooWPexjphGPRWx6WsPEvYiNNpeQrUQLzTpp6rFUUbT5Nmoo": false,
+		"192.168.1.2:3456": false,
+		"192.168.1.3:3456": true,
+	}
+	for client, expect := range cases {
+		accept, _, err := p.FilterRetrievalDeal(ctx, address.Undef, pCfg, &types2.RetrievalDealParams{Client: client})
+		assert.NoError(t, err)
+		assert.Equal(t, expect, accept, client)
+	}
+
+	pCfg.DealFilter.Rules = &config.DealFilterRules{AllowRetrievalClients: []string{"192.168.1.3"}}
+	accept, _, err := p.FilterRetrievalDeal(ctx, address.Undef, pCfg, &types2.RetrievalDealParams{Client: "192.168.1.3:3456"})
+	assert.NoError(t, err)
+	assert.True(t, accept)
+	accept, _, err = p.FilterRetrievalDeal(ctx, address.Undef, pCfg, &types2.RetrievalDealParams{Client: "192.168.1.4:3456"})
+	assert.NoError(t, err)
+	assert.False(t, accept)
+}
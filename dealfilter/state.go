@@ -0,0 +1,88 @@
+package dealfilter
+
+import (
+	"context"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+)
+
+// the states below are passed to the storage deal filter, the json format is the same as boost
+
+type Worker struct {
+	ID     string
+	Start  time.Time
+	Stage  string
+	Sector int32
+}
+
+type SealingPipelineState struct {
+	SectorStates map[string]int
+	Workers      []*Worker
+}
+
+type StorageState struct {
+	// The total number of bytes allocated for incoming data
+	TotalAvailable uint64
+	// The number of bytes reserved for accepted deals
+	Tagged uint64
+	// The number of bytes that have been downloaded and are waiting to be added to a sector
+	Staged uint64
+	// The number of bytes that are not tagged
+	Free uint64
+}
+
+type SMAEscrow struct {
+	// Funds tagged for ongoing deals
+	Tagged abi.TokenAmount
+	// Funds in escrow available to be used for deal making
+	Available abi.TokenAmount
+	// Funds in escrow that are locked for ongoing deals
+	Locked abi.TokenAmount
+}
+
+type CollatWallet struct {
+	// The wallet address
+	Address string
+	// The wallet balance
+	Balance abi.TokenAmount
+}
+
+type PubMsgWallet struct {
+	// The wallet address
+	Address string
+	// The wallet balance
+	Balance abi.TokenAmount
+	// The funds that are tagged for ongoing deals
+	Tagged abi.TokenAmount
+}
+
+type FundsState struct {
+	// Funds in the Storage Market Actor
+	Escrow SMAEscrow
+	// Funds in the wallet used for deal collateral
+	Collateral CollatWallet
+	// Funds in the wallet used to pay for Publish Storage Deals messages
+	PubMsg PubMsgWallet
+}
+
+// StateProvider provides the states of the miner which are passed to the storage deal filter
+type StateProvider interface {
+	SealingPipelineState(ctx context.Context, mAddr address.Address) (*SealingPipelineState, error)
+	StorageState(ctx context.Context, mAddr address.Address) (*StorageState, error)
+	FundsState(ctx context.Context, mAddr address.Address) (*FundsState, error)
+}
+
+// TransferLoad is the number of retrievals being served, it is passed to the retrieval deal filter
+type TransferLoad struct {
+	// The number of ongoing graphsync retrieval deals
+	Graphsync int64
+	// The number of http retrievals being served
+	HTTP int64
+}
+
+// RetrievalLoadProvider provides the transfer load passed to the retrieval deal filter
+type RetrievalLoadProvider interface {
+	TransferLoad(ctx context.Context) (*TransferLoad, error)
+}
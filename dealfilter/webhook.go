@@ -0,0 +1,91 @@
+package dealfilter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+// WebhookResponse is the response of the filter webhook
+type WebhookResponse struct {
+	Accept bool
+	Reason string
+}
+
+// webhookPlugin posts the deal json to DealFilter.Webhook.URL
+type webhookPlugin struct {
+	sp     StateProvider
+	lp     RetrievalLoadProvider
+	client *http.Client
+}
+
+func newWebhookPlugin(sp StateProvider, lp RetrievalLoadProvider) *webhookPlugin {
+	return &webhookPlugin{sp: sp, lp: lp, client: &http.Client{}}
+}
+
+func (p *webhookPlugin) FilterStorageDeal(ctx context.Context, mAddr address.Address, pCfg *config.ProviderConfig, dealParams *types2.DealParams) (bool, string, error) {
+	return p.post(ctx, pCfg, newStorageDeal(ctx, mAddr, p.sp, dealParams))
+}
+
+func (p *webhookPlugin) FilterRetrievalDeal(ctx context.Context, mAddr address.Address, pCfg *config.ProviderConfig, params *types2.RetrievalDealParams) (bool, string, error) {
+	return p.post(ctx, pCfg, newRetrievalDeal(ctx, p.lp, params))
+}
+
+func (p *webhookPlugin) post(ctx context.Context, pCfg *config.ProviderConfig, deal interface{}) (bool, string, error) {
+	if pCfg.DealFilter == nil || pCfg.DealFilter.Webhook == nil || len(pCfg.DealFilter.Webhook.URL) == 0 {
+		return false, "", fmt.Errorf("webhook url is not set")
+	}
+	webhook := pCfg.DealFilter.Webhook
+
+	body, err := json.Marshal(deal)
+	if err != nil {
+		return false, "", err
+	}
+
+	timeout := time.Duration(webhook.Timeout)
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range webhook.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close() // nolint
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, "", fmt.Errorf("webhook response status %d: %s", resp.StatusCode, data)
+	}
+
+	var res WebhookResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return false, "", fmt.Errorf("unmarshal webhook response %q: %w", data, err)
+	}
+	return res.Accept, res.Reason, nil
+}
@@ -0,0 +1,87 @@
+package dealfilter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+type mockStateProvider struct{}
+
+func (sp *mockStateProvider) SealingPipelineState(ctx context.Context, mAddr address.Address) (*SealingPipelineState, error) {
+	return &SealingPipelineState{SectorStates: map[string]int{"Packing": 1}}, nil
+}
+
+func (sp *mockStateProvider) StorageState(ctx context.Context, mAddr address.Address) (*StorageState, error) {
+	return &StorageState{TotalAvailable: 100, Tagged: 10, Free: 90}, nil
+}
+
+func (sp *mockStateProvider) FundsState(ctx context.Context, mAddr address.Address) (*FundsState, error) {
+	return &FundsState{}, nil
+}
+
+func TestWebhookStorageDeal(t *testing.T) {
+	ctx := context.Background()
+	client := address.NewForTestGetter()()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token", r.Header.Get("Authorization"))
+
+		var deal StorageDeal
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&deal))
+		assert.Equal(t, "storage", deal.DealType)
+		assert.Equal(t, uint64(90), deal.StorageState.Free)
+
+		res := WebhookResponse{Accept: deal.ClientDealProposal.Proposal.VerifiedDeal}
+		if !res.Accept {
+			res.Reason = "only verified deals"
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(res))
+	}))
+	defer srv.Close()
+
+	cfg := &config.MarketConfig{CommonProvider: &config.ProviderConfig{
+		DealFilter: &config.DealFilter{
+			Mode: config.DealFilterWebhookMode,
+			Webhook: &config.DealFilterWebhook{
+				URL:     srv.URL,
+				Headers: map[string]string{"Authorization": "token"},
+			},
+		},
+	}}
+	filter := NewStorageDealFilter(cfg, &mockStateProvider{}, nil)
+
+	accept, reason, err := filter(ctx, address.Undef, newDealParams(client, 1<<20, 0, true))
+	assert.NoError(t, err)
+	assert.True(t, accept, reason)
+
+	accept, reason, err = filter(ctx, address.Undef, newDealParams(client, 1<<20, 0, false))
+	assert.NoError(t, err)
+	assert.False(t, accept)
+	assert.Equal(t, "rejected by webhook deal filter: only verified deals", reason)
+
+	// the deal is not accepted when the webhook fails
+	srv.Close()
+	accept, _, err = filter(ctx, address.Undef, newDealParams(client, 1<<20, 0, true))
+	assert.Error(t, err)
+	assert.False(t, accept)
+}
+
+func TestUnknownFilterMode(t *testing.T) {
+	cfg := &config.MarketConfig{CommonProvider: &config.ProviderConfig{
+		DealFilter: &config.DealFilter{Mode: "unknown"},
+	}}
+	filter := NewRetrievalDealFilter(cfg, nil)
+
+	accept, _, err := filter(context.Background(), address.Undef, &types2.RetrievalDealParams{})
+	assert.Error(t, err)
+	assert.False(t, accept)
+}
@@ -0,0 +1,223 @@
+package fundmgr
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+
+	types2 "github.com/filecoin-project/venus/venus-shared/types"
+	types3 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const (
+	// escrowCheckInterval is the interval to check the escrow of the miners with a top-up policy
+	escrowCheckInterval = 5 * time.Minute
+	// topUpWindow is the window of the daily top-up limit
+	topUpWindow = 24 * time.Hour
+)
+
+// EscrowPolicy keeps the available escrow of a miner above Min by topping it up to Target from Wallet
+type EscrowPolicy struct {
+	Miner     address.Address
+	Wallet    address.Address
+	Min       abi.TokenAmount
+	Target    abi.TokenAmount
+	MaxPerDay abi.TokenAmount
+}
+
+// EscrowPolicies returns the top-up policies of the miners in config, the miners without Min or Wallet are skipped
+func EscrowPolicies(cfg *config.MarketConfig) []EscrowPolicy {
+	var out []EscrowPolicy
+	for _, miner := range cfg.Miners {
+		pCfg, err := cfg.MinerProviderConfig(address.Address(miner.Addr), true)
+		if err != nil || pCfg.EscrowTopUp == nil {
+			continue
+		}
+		topUp := pCfg.EscrowTopUp
+		if nilOrZero(topUp.Min) || address.Address(topUp.Wallet).Empty() {
+			continue
+		}
+
+		policy := EscrowPolicy{
+			Miner:     address.Address(miner.Addr),
+			Wallet:    address.Address(topUp.Wallet),
+			Min:       abi.TokenAmount(topUp.Min),
+			Target:    abi.TokenAmount(topUp.Target),
+			MaxPerDay: big.Zero(),
+		}
+		if policy.Target.Nil() || policy.Target.LessThan(policy.Min) {
+			policy.Target = policy.Min
+		}
+		if !nilOrZero(topUp.MaxPerDay) {
+			policy.MaxPerDay = abi.TokenAmount(topUp.MaxPerDay)
+		}
+		out = append(out, policy)
+	}
+	return out
+}
+
+func nilOrZero(fil types2.FIL) bool {
+	return fil.Int == nil || fil.Int.Sign() == 0
+}
+
+// StartEscrowTopUp checks the escrow of the miners periodically and tops it up by the policies,
+// policies is called in every round so that the changes of config take effect.
+func (fm *FundManager) StartEscrowTopUp(ctx context.Context, policies func() []EscrowPolicy) {
+	go func() {
+		ticker := time.NewTicker(escrowCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				for _, policy := range policies() {
+					if err := fm.topUpEscrow(ctx, policy); err != nil {
+						log.Errorf("top up escrow of %s from %s: %v", policy.Miner, policy.Wallet, err)
+					}
+				}
+			case <-ctx.Done():
+				log.Warnf("exit escrow top-up by context")
+				return
+			}
+		}
+	}()
+}
+
+func (fm *FundManager) topUpEscrow(ctx context.Context, policy EscrowPolicy) error {
+	fa := fm.getFundedAddress(policy.Miner)
+
+	avail, err := fa.env.AvailableFunds(ctx, policy.Miner)
+	if err != nil {
+		return err
+	}
+	avail = big.Sub(avail, fa.getReserved())
+
+	spent, err := fm.toppedUpLastDay(ctx, policy.Miner, time.Now())
+	if err != nil {
+		return err
+	}
+	amt := topUpAmount(policy, avail, spent)
+	if amt.IsZero() {
+		return nil
+	}
+
+	msgCid, err := fa.topUp(ctx, policy.Wallet, amt)
+	if err != nil {
+		return err
+	}
+	if msgCid == cid.Undef {
+		log.Debugf("skip topping up escrow of %s, waiting for the in-progress message", policy.Miner)
+		return nil
+	}
+
+	log.Infof("top up escrow of %s from %s by %s, available %s, message %s",
+		policy.Miner, policy.Wallet, types2.FIL(amt), types2.FIL(avail), msgCid)
+
+	// the top-up is saved to keep the daily budget after restart
+	return fm.str.SaveEscrowTopUp(ctx, &types3.EscrowTopUp{
+		MsgCid: msgCid,
+		Addr:   policy.Miner,
+		Wallet: policy.Wallet,
+		Amount: amt,
+	})
+}
+
+// topUpAmount returns the amount to top up if the available escrow is below Min, it is limited by the daily budget
+func topUpAmount(policy EscrowPolicy, avail, spent abi.TokenAmount) abi.TokenAmount {
+	if avail.GreaterThanEqual(policy.Min) {
+		return big.Zero()
+	}
+
+	amt := big.Sub(policy.Target, avail)
+	if !policy.MaxPerDay.IsZero() {
+		amt = big.Min(amt, big.Sub(policy.MaxPerDay, spent))
+	}
+	if amt.LessThanEqual(big.Zero()) {
+		return big.Zero()
+	}
+	return amt
+}
+
+// toppedUpLastDay returns the amount topped up for the address in the last day by the saved top-ups
+func (fm *FundManager) toppedUpLastDay(ctx context.Context, addr address.Address, now time.Time) (abi.TokenAmount, error) {
+	topUps, err := fm.str.ListEscrowTopUp(ctx, addr, now.Add(-topUpWindow))
+	if err != nil {
+		return big.Zero(), fmt.Errorf("list top-ups of %s: %w", addr, err)
+	}
+
+	total := big.Zero()
+	for _, topUp := range topUps {
+		total = big.Add(total, topUp.Amount)
+	}
+	return total, nil
+}
+
+// Status returns the escrow of all addresses tracked by the fund manager
+func (fm *FundManager) Status(ctx context.Context) ([]types3.FundAddressStatus, error) {
+	fm.lk.Lock()
+	fas := make([]*fundedAddress, 0, len(fm.fundedAddrs))
+	for _, fa := range fm.fundedAddrs {
+		fas = append(fas, fa)
+	}
+	fm.lk.Unlock()
+
+	out := make([]types3.FundAddressStatus, 0, len(fas))
+	for _, fa := range fas {
+		status := fa.status()
+		bal, err := fm.api.StateMarketBalance(ctx, status.Addr, types2.EmptyTSK)
+		if err != nil {
+			return nil, err
+		}
+		status.Escrow = bal.Escrow
+		status.Locked = bal.Locked
+		status.Available = big.Sub(bal.Escrow, bal.Locked)
+		status.TopUpLastDay, err = fm.toppedUpLastDay(ctx, status.Addr, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, status)
+	}
+	return out, nil
+}
+
+func (a *fundedAddress) status() types3.FundAddressStatus {
+	a.lk.RLock()
+	defer a.lk.RUnlock()
+
+	return types3.FundAddressStatus{
+		Addr:             a.state.Addr,
+		Reserved:         a.state.AmtReserved,
+		MsgCid:           a.state.MsgCid,
+		InFlightAdd:      a.inFlightAdd,
+		InFlightWithdraw: a.inFlightWithdraw,
+	}
+}
+
+// topUp adds funds to the address without changing the reserved amount,
+// it returns cid.Undef if there is an in-progress message
+func (a *fundedAddress) topUp(ctx context.Context, wallet address.Address, amt abi.TokenAmount) (cid.Cid, error) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	if a.state.MsgCid != nil {
+		return cid.Undef, nil
+	}
+
+	msgCid, err := a.env.AddFunds(ctx, wallet, a.state.Addr, amt)
+	if err != nil {
+		return cid.Undef, err
+	}
+	a.inFlightAdd = amt
+	a.applyStateChange(ctx, &msgCid, types2.EmptyInt)
+	a.startWaitForResults(ctx, msgCid)
+
+	return msgCid, nil
+}
@@ -167,6 +167,10 @@ type fundedAddress struct {
 	lk    sync.RWMutex
 	state *types.FundedAddressState
 
+	// The amounts of the in-progress message, they are not saved to store
+	inFlightAdd      abi.TokenAmount
+	inFlightWithdraw abi.TokenAmount
+
 	// Note: These request queues are ephemeral, they are not saved to store
 	reservations []*fundRequest
 	releases     []*fundRequest
@@ -185,6 +189,8 @@ func newFundedAddress(fm *FundManager, addr address.Address) *fundedAddress {
 			Addr:        addr,
 			AmtReserved: abi.NewTokenAmount(0),
 		},
+		inFlightAdd:      abi.NewTokenAmount(0),
+		inFlightWithdraw: abi.NewTokenAmount(0),
 	}
 }
 
@@ -329,6 +335,8 @@ func (a *fundedAddress) applyStateChange(ctx context.Context, msgCid *cid.Cid, a
 // Clear the pending message cid so that a new message can be sent
 func (a *fundedAddress) clearWaitState(ctx context.Context) {
 	a.state.MsgCid = nil
+	a.inFlightAdd = abi.NewTokenAmount(0)
+	a.inFlightWithdraw = abi.NewTokenAmount(0)
 	a.saveState(ctx)
 }
 
@@ -430,6 +438,8 @@ func (a *fundedAddress) processReservations(reservations []*fundRequest, release
 		return res, err
 	}
 
+	a.inFlightAdd = amtToAdd
+
 	// Mark reservation requests as complete
 	res.added = toAdd
 
@@ -576,6 +586,8 @@ func (a *fundedAddress) processWithdrawals(withdrawals []*fundRequest) (msgCid c
 		return cid.Undef, err
 	}
 
+	a.inFlightWithdraw = allowedAmt
+
 	// Mark allowed requests as complete
 	for _, req := range allowed {
 		req.Complete(withdrawFundsCid, nil)
@@ -605,6 +605,105 @@ func TestFundManagerReleaseAfterPublish(t *testing.T) {
 	require.NoError(t, err)
 }
 
+// TestFundManagerEscrowTopUp verifies that the escrow is topped up by the policy without changing the reserved amount
+func TestFundManagerEscrowTopUp(t *testing.T) {
+	s := setup(t)
+	defer s.fm.Stop()
+
+	policy := EscrowPolicy{
+		Miner:     s.acctAddr,
+		Wallet:    s.walletAddr,
+		Min:       abi.NewTokenAmount(10),
+		Target:    abi.NewTokenAmount(20),
+		MaxPerDay: abi.NewTokenAmount(30),
+	}
+
+	// Reserve 5
+	// balance:  0 -> 5
+	// reserved: 0 -> 5
+	sentinel, err := s.fm.Reserve(s.ctx, s.walletAddr, s.acctAddr, abi.NewTokenAmount(5))
+	require.NoError(t, err)
+	s.mockApi.completeMsg(sentinel)
+	waitForMsg := func() {
+		require.Eventually(t, func() bool {
+			status, err := s.fm.Status(s.ctx)
+			return err == nil && status[0].MsgCid == nil
+		}, time.Second, 10*time.Millisecond)
+	}
+	waitForMsg()
+
+	// available: 5 - 5 = 0 < 10, top up 20
+	// balance:  5 -> 25
+	// reserved: 5
+	require.NoError(t, s.fm.topUpEscrow(s.ctx, policy))
+	require.Equal(t, 2, s.mockApi.messageCount())
+	status, err := s.fm.Status(s.ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	require.NotNil(t, status[0].MsgCid)
+	require.Equal(t, abi.NewTokenAmount(20), status[0].InFlightAdd)
+	require.Equal(t, abi.NewTokenAmount(5), status[0].Reserved)
+
+	msg := s.mockApi.getSentMessage(*status[0].MsgCid)
+	checkAddMessageFields(t, msg, s.walletAddr, s.acctAddr, abi.NewTokenAmount(20))
+
+	// no more message while the top-up message is in progress
+	require.NoError(t, s.fm.topUpEscrow(s.ctx, policy))
+	require.Equal(t, 2, s.mockApi.messageCount())
+
+	s.mockApi.completeMsg(*status[0].MsgCid)
+	waitForMsg()
+
+	// available: 25 - 5 = 20 >= 10, nothing to top up
+	require.NoError(t, s.fm.topUpEscrow(s.ctx, policy))
+	require.Equal(t, 2, s.mockApi.messageCount())
+
+	// the escrow is spent by publishing deals
+	// balance:  25 -> 5
+	// available: 5 - 5 = 0 < 10, but only 10 left in the daily budget
+	s.mockApi.publish(s.acctAddr, abi.NewTokenAmount(20))
+	require.NoError(t, s.fm.topUpEscrow(s.ctx, policy))
+	require.Equal(t, 3, s.mockApi.messageCount())
+	status, err = s.fm.Status(s.ctx)
+	require.NoError(t, err)
+	require.Equal(t, abi.NewTokenAmount(10), status[0].InFlightAdd)
+	require.Equal(t, abi.NewTokenAmount(30), status[0].TopUpLastDay)
+	s.mockApi.completeMsg(*status[0].MsgCid)
+	waitForMsg()
+
+	// the daily budget is kept by the saved top-ups after restart
+	// balance:  15 -> 5
+	// available: 5 - 5 = 0 < 10, but nothing left in the daily budget
+	s.fm.Stop()
+	fm := newFundManager(s.mockApi, s.fundRepo)
+	defer fm.Stop()
+	require.NoError(t, fm.Start(s.ctx))
+	s.mockApi.publish(s.acctAddr, abi.NewTokenAmount(10))
+	require.NoError(t, fm.topUpEscrow(s.ctx, policy))
+	require.Equal(t, 3, s.mockApi.messageCount())
+	status, err = fm.Status(s.ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	require.Nil(t, status[0].MsgCid)
+	require.Equal(t, abi.NewTokenAmount(30), status[0].TopUpLastDay)
+}
+
+func TestTopUpAmount(t *testing.T) {
+	policy := EscrowPolicy{
+		Min:       abi.NewTokenAmount(10),
+		Target:    abi.NewTokenAmount(20),
+		MaxPerDay: abi.NewTokenAmount(0),
+	}
+	require.Equal(t, abi.NewTokenAmount(0), topUpAmount(policy, abi.NewTokenAmount(10), abi.NewTokenAmount(0)))
+	require.Equal(t, abi.NewTokenAmount(15), topUpAmount(policy, abi.NewTokenAmount(5), abi.NewTokenAmount(100)))
+	// the reserved amount is more than escrow
+	require.Equal(t, abi.NewTokenAmount(25), topUpAmount(policy, abi.NewTokenAmount(-5), abi.NewTokenAmount(0)))
+
+	policy.MaxPerDay = abi.NewTokenAmount(12)
+	require.Equal(t, abi.NewTokenAmount(7), topUpAmount(policy, abi.NewTokenAmount(5), abi.NewTokenAmount(5)))
+	require.Equal(t, abi.NewTokenAmount(0), topUpAmount(policy, abi.NewTokenAmount(5), abi.NewTokenAmount(12)))
+}
+
 type scaffold struct {
 	ctx        context.Context
 	fundRepo   repo.FundRepo
@@ -1,5 +1,31 @@
 package fundmgr
 
-import "github.com/ipfs-force-community/venus-common-utils/builder"
+import (
+	"context"
+
+	"go.uber.org/fx"
+
+	"github.com/ipfs-force-community/metrics"
+	"github.com/ipfs-force-community/venus-common-utils/builder"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+)
+
+var StartEscrowTopUpKey = builder.NextInvoke()
 
 var FundMgrOpts = builder.Override(new(*FundManager), NewFundManager)
+
+// EscrowTopUpOpts keeps the escrow of the miners by the policies in config, it is only used by droplet
+var EscrowTopUpOpts = func(cfg *config.MarketConfig) builder.Option {
+	return builder.Override(StartEscrowTopUpKey, func(mctx metrics.MetricsCtx, lc fx.Lifecycle, fm *FundManager) {
+		ctx := metrics.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				fm.StartEscrowTopUp(ctx, func() []EscrowPolicy {
+					return EscrowPolicies(cfg)
+				})
+				return nil
+			},
+		})
+	})
+}
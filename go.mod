@@ -70,6 +70,7 @@ require (
 	github.com/ipld/go-codec-dagpb v1.7.0
 	github.com/ipld/go-ipld-prime v0.22.0
 	github.com/ipld/go-ipld-selector-text-lite v0.0.1
+	github.com/ipld/go-trustless-utils v0.4.1
 	github.com/libp2p/go-libp2p v0.42.0
 	github.com/libp2p/go-maddr-filter v0.1.0
 	github.com/mitchellh/go-homedir v1.1.0
@@ -89,6 +90,7 @@ require (
 	go.uber.org/fx v1.24.0
 	go.uber.org/multierr v1.11.0
 	golang.org/x/sync v0.19.0
+	golang.org/x/time v0.12.0
 	golang.org/x/xerrors v0.0.0-20240903120638-7835f813f4da
 	gorm.io/driver/mysql v1.3.5
 	gorm.io/driver/sqlite v1.1.4
@@ -260,7 +262,6 @@ require (
 	github.com/ipfs/go-unixfsnode v1.10.1 // indirect
 	github.com/ipfs/go-verifcid v0.0.3 // indirect
 	github.com/ipld/go-ipld-adl-hamt v0.0.0-20240322071803-376decb85801 // indirect
-	github.com/ipld/go-trustless-utils v0.4.1 // indirect
 	github.com/ipni/go-libipni v0.6.16
 	github.com/ipni/index-provider v0.15.4
 	github.com/jackpal/go-nat-pmp v1.0.2 // indirect
@@ -360,7 +361,6 @@ require (
 	golang.org/x/sys v0.41.0 // indirect
 	golang.org/x/term v0.40.0 // indirect
 	golang.org/x/text v0.34.0 // indirect
-	golang.org/x/time v0.12.0 // indirect
 	golang.org/x/tools v0.41.0 // indirect
 	google.golang.org/api v0.169.0 // indirect
 	google.golang.org/protobuf v1.36.11 // indirect
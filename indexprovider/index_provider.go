@@ -26,6 +26,7 @@ import (
 	types "github.com/filecoin-project/venus/venus-shared/types/market"
 	"github.com/ipfs-force-community/droplet/v2/config"
 	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/retrievalprovider/bitswap"
 )
 
 var log = logging.Logger("index-provider-wrapper")
@@ -37,8 +38,11 @@ type Wrapper struct {
 	dagStore      stores.DAGStoreWrapper
 	full          v1.FullNode
 	cfg           *config.ProviderConfig
+	home          config.IHome
+	bitswapCfg    *config.Bitswap
 	dealsDB       repo.StorageDealRepo
 	directDealsDB repo.DirectDealRepo
+	dealOptions   repo.DealOptionsRepo
 	prov          provider.Interface
 
 	meshCreator MeshCreator
@@ -51,6 +55,8 @@ type Wrapper struct {
 
 func NewWrapper(h host.Host,
 	cfg *config.ProviderConfig,
+	home config.IHome,
+	bitswapCfg *config.Bitswap,
 	full v1.FullNode,
 	r repo.Repo,
 	dagStore stores.DAGStoreWrapper,
@@ -58,20 +64,20 @@ func NewWrapper(h host.Host,
 ) (*Wrapper, error) {
 	_, isDisabled := prov.(*DisabledIndexProvider)
 
-	// todo: support bitswap
-	// bitswap is enabled if there is a bitswap peer id
-	bitswapEnabled := false
+	bitswapEnabled := bitswapCfg.Enable
 	// http is considered enabled if there is an http retrieval multiaddr set
 	httpEnabled := cfg.HTTPRetrievalMultiaddr != ""
 
-	// setup bitswap extended provider if there is a public multi addr for bitswap
 	w := &Wrapper{
 		h:              h,
 		dealsDB:        r.StorageDealRepo(),
 		directDealsDB:  r.DirectDealRepo(),
+		dealOptions:    r.DealOptionsRepo(),
 		prov:           prov,
 		meshCreator:    NewMeshCreator(full, h),
 		cfg:            cfg,
+		home:           home,
+		bitswapCfg:     bitswapCfg,
 		enabled:        !isDisabled,
 		bitswapEnabled: bitswapEnabled,
 		httpEnabled:    httpEnabled,
@@ -186,66 +192,17 @@ func (w *Wrapper) AnnounceExtendedProviders(ctx context.Context) error {
 }
 
 func (w *Wrapper) appendExtendedProviders(_ context.Context, adBuilder *xproviders.AdBuilder, key crypto.PrivKey) error {
-	// if !w.bitswapEnabled {
-	// 	// If bitswap is completely disabled, publish an advertisement with empty extended providers
-	// 	// which should override previously published extended providers associated to w.h.ID().
-	// 	log.Info("bitswap is not enabled - announcing bitswap disabled to Indexer")
-	// } else {
-	// if we're exposing bitswap publicly, we announce bitswap as an extended provider. If we're not
-	// we announce it as metadata on the main provider
-
-	// marshal bitswap metadata
-	// meta := metadata.Default.New(metadata.Bitswap{})
-	// mbytes, err := meta.MarshalBinary()
-	// if err != nil {
-	// 	return err
-	// }
-	// var ep xproviders.Info
-	// if len(w.cfg.Retrievals.Bitswap.BitswapPublicAddresses) > 0 {
-	// 	if w.cfg.Retrievals.Bitswap.BitswapPrivKeyFile == "" {
-	// 		return fmt.Errorf("missing required configuration key BitswapPrivKeyFile: " +
-	// 			"droplet is configured with BitswapPublicAddresses but the BitswapPrivKeyFile configuration key is empty")
-	// 	}
-
-	// 	// we need the private key for bitswaps peerID in order to announce publicly
-	// 	keyFile, err := os.ReadFile(w.cfg.Retrievals.Bitswap.BitswapPrivKeyFile)
-	// 	if err != nil {
-	// 		return fmt.Errorf("opening BitswapPrivKeyFile %s: %w", w.cfg.Retrievals.Bitswap.BitswapPrivKeyFile, err)
-	// 	}
-	// 	privKey, err := crypto.UnmarshalPrivateKey(keyFile)
-	// 	if err != nil {
-	// 		return fmt.Errorf("unmarshalling BitswapPrivKeyFile %s: %w", w.cfg.Retrievals.Bitswap.BitswapPrivKeyFile, err)
-	// 	}
-	// 	// setup an extended provider record, containing the booster-bitswap multi addr,
-	// 	// peer ID, private key for signing, and metadata
-	// 	ep = xproviders.Info{
-	// 		ID:       w.cfg.Retrievals.Bitswap.BitswapPeerID,
-	// 		Addrs:    w.cfg.Retrievals.Bitswap.BitswapPublicAddresses,
-	// 		Priv:     privKey,
-	// 		Metadata: mbytes,
-	// 	}
-	// 	log.Infof("bitswap is enabled and endpoint is public - "+
-	// 		"announcing bitswap endpoint to indexer as extended provider: %s %s",
-	// 		ep.ID, ep.Addrs)
-	// } else {
-	// 	log.Infof("bitswap is enabled with boostd as proxy - "+
-	// 		"announcing boostd as endpoint for bitswap to indexer: %s %s",
-	// 		w.h.ID(), w.h.Addrs())
-
-	// 	addrs := make([]string, 0, len(w.h.Addrs()))
-	// 	for _, addr := range w.h.Addrs() {
-	// 		addrs = append(addrs, addr.String())
-	// 	}
-
-	// 	ep = xproviders.Info{
-	// 		ID:       w.h.ID().String(),
-	// 		Addrs:    addrs,
-	// 		Priv:     key,
-	// 		Metadata: mbytes,
-	// 	}
-	// }
-	// adBuilder.WithExtendedProviders(ep)
-	// }
+	if !w.bitswapEnabled {
+		// If bitswap is completely disabled, publish an advertisement with empty extended providers
+		// which should override previously published extended providers associated to w.h.ID().
+		log.Info("bitswap is not enabled - announcing bitswap disabled to Indexer")
+	} else {
+		ep, err := w.bitswapProvider(key)
+		if err != nil {
+			return err
+		}
+		adBuilder.WithExtendedProviders(ep)
+	}
 
 	if !w.httpEnabled {
 		log.Info("ProviderConfig.HTTPRetrievalMultiaddr is not set - announcing http disabled to Indexer")
@@ -271,6 +228,55 @@ func (w *Wrapper) appendExtendedProviders(_ context.Context, adBuilder *xprovide
 	return nil
 }
 
+// bitswapProvider returns the extended provider record of the bitswap server, if it runs with a separate peer,
+// the record contains the peer and its public addresses, otherwise it's droplet with bitswap metadata
+func (w *Wrapper) bitswapProvider(key crypto.PrivKey) (xproviders.Info, error) {
+	meta := metadata.Default.New(metadata.Bitswap{})
+	mbytes, err := meta.MarshalBinary()
+	if err != nil {
+		return xproviders.Info{}, err
+	}
+
+	if len(w.bitswapCfg.ListenAddresses) == 0 {
+		log.Infof("bitswap is enabled with droplet peer - announcing droplet as endpoint for bitswap to indexer: %s %s",
+			w.h.ID(), w.h.Addrs())
+
+		addrs := make([]string, 0, len(w.h.Addrs()))
+		for _, addr := range w.h.Addrs() {
+			addrs = append(addrs, addr.String())
+		}
+		return xproviders.Info{
+			ID:       w.h.ID().String(),
+			Addrs:    addrs,
+			Priv:     key,
+			Metadata: mbytes,
+		}, nil
+	}
+
+	// we need the private key of the bitswap peer in order to announce it publicly
+	privKey, err := bitswap.PeerKey(w.home)
+	if err != nil {
+		return xproviders.Info{}, err
+	}
+	id, err := peer.IDFromPrivateKey(privKey)
+	if err != nil {
+		return xproviders.Info{}, err
+	}
+	addrs := w.bitswapCfg.PublicAddresses
+	if len(addrs) == 0 {
+		addrs = w.bitswapCfg.ListenAddresses
+	}
+	log.Infof("bitswap is enabled with a separate peer - announcing bitswap endpoint to indexer as extended provider: %s %s",
+		id, addrs)
+
+	return xproviders.Info{
+		ID:       id.String(),
+		Addrs:    addrs,
+		Priv:     privKey,
+		Metadata: mbytes,
+	}, nil
+}
+
 // ErrStringSkipAdIngest - While ingesting cids for each piece, if there is an error the indexer
 // checks if the error contains the string "content not found":
 // - if so, the indexer skips the piece and continues ingestion
@@ -415,11 +421,18 @@ func (w *Wrapper) MultihashLister(ctx context.Context, prov peer.ID, contextID [
 	return nil, skipError(err)
 }
 
+// AnnounceDeal announces the deal to the network indexer, it returns cid.Undef without error
+// if the client asked not to announce the deal
 func (w *Wrapper) AnnounceDeal(ctx context.Context, deal *types.MinerDeal) (cid.Cid, error) {
 	// Filter out deals that should not be announced
-	// if !deal.AnnounceToIPNI {
-	// 	return cid.Undef, nil
-	// }
+	options, err := w.dealOptions.GetDealOptions(ctx, deal.ProposalCid)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return cid.Undef, fmt.Errorf("get options of deal %s: %w", deal.ProposalCid, err)
+	}
+	if err == nil && options.SkipIPNIAnnounce {
+		log.Infof("skip announcing deal %s to index provider as requested by client", deal.ProposalCid)
+		return cid.Undef, nil
+	}
 
 	md := metadata.GraphsyncFilecoinV1{
 		PieceCID:      deal.ClientDealProposal.Proposal.PieceCID,
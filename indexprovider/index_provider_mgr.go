@@ -41,6 +41,8 @@ import (
 
 type IndexProviderMgr struct {
 	cfg      *config.ProviderConfig
+	home     config.IHome
+	bitswap  *config.Bitswap
 	h        host.Host
 	r        repo.Repo
 	full     v1.FullNode
@@ -63,6 +65,8 @@ func NewIndexProviderMgr(lc fx.Lifecycle,
 ) (*IndexProviderMgr, error) {
 	mgr := &IndexProviderMgr{
 		cfg:      cfg.CommonProvider,
+		home:     cfg,
+		bitswap:  &cfg.Bitswap,
 		h:        h,
 		r:        r,
 		full:     full,
@@ -100,7 +104,7 @@ func (m *IndexProviderMgr) initAllIndexProviders(ctx context.Context, minerAddrs
 		if err != nil {
 			return fmt.Errorf("init index provider failed, miner addr: %s, err: %w", minerAddr, err)
 		}
-		wrapper, err := NewWrapper(m.h, m.cfg, m.full, m.r, m.dagStore, idxProv)
+		wrapper, err := NewWrapper(m.h, m.cfg, m.home, m.bitswap, m.full, m.r, m.dagStore, idxProv)
 		if err != nil {
 			return fmt.Errorf("new index provider wrapper failed, miner addr: %s, err: %w", minerAddr, err)
 		}
@@ -210,7 +214,7 @@ func (m *IndexProviderMgr) GetIndexProvider(minerAddr address.Address) (*Wrapper
 		if err != nil {
 			return nil, err
 		}
-		wrapper, err = NewWrapper(m.h, m.cfg, m.full, m.r, m.dagStore, idxProv)
+		wrapper, err = NewWrapper(m.h, m.cfg, m.home, m.bitswap, m.full, m.r, m.dagStore, idxProv)
 		if err != nil {
 			return nil, fmt.Errorf("new index provider wrapper failed, miner addr: %s, err: %w", minerAddr, err)
 		}
@@ -390,7 +394,7 @@ func (m *IndexProviderMgr) IndexAnnounceAllDeals(ctx context.Context, minerAddr
 			continue
 		}
 
-		_, err = w.AnnounceDeal(ctx, deal)
+		c, err := w.AnnounceDeal(ctx, deal)
 		if err != nil {
 			if strings.Contains(err.Error(), http.StatusText(http.StatusTooManyRequests)) {
 				log.Errorf("IndexAnnounceAllDeals: %s, err: %s", minerAddr, err.Error())
@@ -403,6 +407,10 @@ func (m *IndexProviderMgr) IndexAnnounceAllDeals(ctx context.Context, minerAddr
 			}
 			continue
 		}
+		if !c.Defined() {
+			// the client asked not to announce the deal
+			continue
+		}
 		time.Sleep(time.Second * 10)
 		success++
 	}
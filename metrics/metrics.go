@@ -14,6 +14,10 @@ var (
 	StatusTag, _      = tag.NewKey("status")
 
 	MinerAddressTag, _ = tag.NewKey("miner")
+
+	ScrubResultTag, _ = tag.NewKey("result")
+
+	HTTPPathTag, _ = tag.NewKey("path")
 )
 
 const (
@@ -57,6 +61,14 @@ var (
 
 	StorageRetrievalHitCount = stats.Int64("piecestorage/retrieval_hit", "PieceStorage hit count for retrieval", stats.UnitDimensionless)
 	StorageSaveHitCount      = stats.Int64("piecestorage/save_hit", "PieceStorage hit count for save piece data", stats.UnitDimensionless)
+	PieceScrubCount          = stats.Int64("piecestorage/scrub", "Pieces checked by the scrubber", stats.UnitDimensionless)
+	PieceScrubBytes          = stats.Int64("piecestorage/scrub_bytes", "Bytes read by the scrubber", stats.UnitBytes)
+
+	HTTPRetrievalCount    = stats.Int64("http_retrieval/count", "Requests served by the http retrieval server", stats.UnitDimensionless)
+	HTTPRetrievalBytes    = stats.Int64("http_retrieval/bytes", "Bytes sent by the http retrieval server", stats.UnitBytes)
+	HTTPRetrievalDuration = stats.Int64("http_retrieval/duration", "Duration of the requests served by the http retrieval server", stats.UnitMilliseconds)
+
+	SectorDealUtilization = stats.Float64("deal_assign/sector_utilization", "Ratio of sector space used by deals in the last assignment", stats.UnitDimensionless)
 )
 
 var (
@@ -159,6 +171,38 @@ var (
 		Aggregation: view.Count(),
 		TagKeys:     []tag.Key{StorageNameTag},
 	}
+	PieceScrubCountView = &view.View{
+		Measure:     PieceScrubCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{StorageNameTag, ScrubResultTag},
+	}
+	PieceScrubBytesView = &view.View{
+		Measure:     PieceScrubBytes,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{StorageNameTag},
+	}
+	// http retrieval
+	HTTPRetrievalCountView = &view.View{
+		Measure:     HTTPRetrievalCount,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{HTTPPathTag, StatusTag},
+	}
+	HTTPRetrievalBytesView = &view.View{
+		Measure:     HTTPRetrievalBytes,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{HTTPPathTag},
+	}
+	HTTPRetrievalDurationView = &view.View{
+		Measure:     HTTPRetrievalDuration,
+		Aggregation: defaultMillisecondsDistribution,
+		TagKeys:     []tag.Key{HTTPPathTag, StatusTag},
+	}
+	// deal assign
+	SectorDealUtilizationView = &view.View{
+		Measure:     SectorDealUtilization,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{MinerAddressTag},
+	}
 )
 
 var views = append([]*view.View{
@@ -186,6 +230,14 @@ var views = append([]*view.View{
 
 	StorageRetrievalHitCountView,
 	StorageSaveHitCountView,
+	PieceScrubCountView,
+	PieceScrubBytesView,
+
+	HTTPRetrievalCountView,
+	HTTPRetrievalBytesView,
+	HTTPRetrievalDurationView,
+
+	SectorDealUtilizationView,
 }, rpcMetrics.DefaultViews...)
 
 func init() {
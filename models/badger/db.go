@@ -2,6 +2,7 @@ package badger
 
 import (
 	"context"
+	"fmt"
 	"path"
 
 	"github.com/ipfs-force-community/droplet/v2/models/badger/migrate"
@@ -22,6 +23,7 @@ const (
 	fundmgr           = "/fundmgr/"
 	piecemeta         = "/storagemarket"
 	cidinfo           = "/cid-infos"
+	pieceVerify       = "/piece-verifications"
 	retrievalProvider = "/retrievals/provider"
 	retrievalAsk      = "/retrieval-ask"
 	retrievalDeals    = "/deals"
@@ -30,6 +32,10 @@ const (
 	storageAsk        = "/storage-ask"
 	paych             = "/paych/"
 	directDeals       = "/direct-deals"
+	dealTransfers     = "/deal-transfers"
+	dealOptions       = "/deal-options"
+	httpRetrievals    = "/http-retrievals"
+	publishMessages   = "/publish-messages"
 
 	// client
 	dealClient      = "/deals/client"
@@ -51,6 +57,9 @@ type PieceMetaDs datastore.Batching
 // /metadata/storagemarket/cid-infos
 type CIDInfoDS datastore.Batching
 
+// /metadata/storagemarket/piece-verifications
+type PieceVerifyDS datastore.Batching
+
 // /metadata/storagemarket/pieces
 type PieceInfoDS datastore.Batching
 
@@ -60,6 +69,9 @@ type RetrievalProviderDS datastore.Batching
 // /metadata/retrievals/provider/deals
 type RetrievalDealsDS datastore.Batching
 
+// /metadata/retrievals/provider/http-retrievals
+type HTTPRetrievalDS datastore.Batching
+
 // /metadata/retrievals/provider/retrieval-ask
 type RetrievalAskDS datastore.Batching // key = latest
 
@@ -78,6 +90,15 @@ type StorageAskDS datastore.Batching // key = latest
 // /metadata/storage/provider/direct-deals
 type DirectDealsDS datastore.Batching
 
+// /metadata/storage/provider/deal-transfers
+type DealTransfersDS datastore.Batching
+
+// /metadata/storage/provider/deal-options
+type DealOptionsDS datastore.Batching
+
+// /metadata/storage/provider/publish-messages
+type PublishMessageDS datastore.Batching
+
 // /metadata/paych/
 type PayChanDS datastore.Batching
 
@@ -132,6 +153,10 @@ func NewCidInfoDs(ds PieceMetaDs) CIDInfoDS {
 	return namespace.Wrap(ds, datastore.NewKey(cidinfo))
 }
 
+func NewPieceVerifyDS(ds PieceMetaDs) PieceVerifyDS {
+	return namespace.Wrap(ds, datastore.NewKey(pieceVerify))
+}
+
 func NewRetrievalProviderDS(ds MetadataDS) RetrievalProviderDS {
 	return namespace.Wrap(ds, datastore.NewKey(retrievalProvider))
 }
@@ -140,6 +165,10 @@ func NewRetrievalDealsDS(ds RetrievalProviderDS) RetrievalDealsDS {
 	return namespace.Wrap(ds, datastore.NewKey(retrievalDeals))
 }
 
+func NewHTTPRetrievalDS(ds RetrievalProviderDS) HTTPRetrievalDS {
+	return namespace.Wrap(ds, datastore.NewKey(httpRetrievals))
+}
+
 func NewRetrievalAskDS(ds RetrievalProviderDS) RetrievalAskDS {
 	return namespace.Wrap(ds, datastore.NewKey(retrievalAsk))
 }
@@ -156,6 +185,18 @@ func NewDirectDealsDS(ds StorageProviderDS) DirectDealsDS {
 	return namespace.Wrap(ds, datastore.NewKey(directDeals))
 }
 
+func NewDealTransfersDS(ds StorageProviderDS) DealTransfersDS {
+	return namespace.Wrap(ds, datastore.NewKey(dealTransfers))
+}
+
+func NewDealOptionsDS(ds StorageProviderDS) DealOptionsDS {
+	return namespace.Wrap(ds, datastore.NewKey(dealOptions))
+}
+
+func NewPublishMessageDS(ds StorageProviderDS) PublishMessageDS {
+	return namespace.Wrap(ds, datastore.NewKey(publishMessages))
+}
+
 func NewStorageAskDS(ds StorageProviderDS) StorageAskDS {
 	return namespace.Wrap(ds, datastore.NewKey(storageAsk))
 }
@@ -212,6 +253,11 @@ type BadgerDSParams struct {
 	CidInfoDs        CIDInfoDS        `optional:"true"`
 	RetrievalDealsDs RetrievalDealsDS `optional:"true"`
 	DirectDealsDs    DirectDealsDS    `optional:"true"`
+	DealTransfersDs  DealTransfersDS  `optional:"true"`
+	PieceVerifyDs    PieceVerifyDS    `optional:"true"`
+	DealOptionsDs    DealOptionsDS    `optional:"true"`
+	HTTPRetrievalDs  HTTPRetrievalDS  `optional:"true"`
+	PublishMsgDs     PublishMessageDS `optional:"true"`
 }
 
 func NewBadgerRepo(params BadgerDSParams) repo.Repo {
@@ -237,6 +283,26 @@ func (r *BadgerRepo) DirectDealRepo() repo.DirectDealRepo {
 	return NewDirectDealRepo(r.dsParams.DirectDealsDs)
 }
 
+func (r *BadgerRepo) DealTransferRepo() repo.DealTransferRepo {
+	return NewDealTransferRepo(r.dsParams.DealTransfersDs)
+}
+
+func (r *BadgerRepo) PieceVerifyRepo() repo.PieceVerifyRepo {
+	return NewPieceVerifyRepo(r.dsParams.PieceVerifyDs)
+}
+
+func (r *BadgerRepo) DealOptionsRepo() repo.DealOptionsRepo {
+	return NewDealOptionsRepo(r.dsParams.DealOptionsDs)
+}
+
+func (r *BadgerRepo) HTTPRetrievalRepo() repo.HTTPRetrievalRepo {
+	return NewHTTPRetrievalRepo(r.dsParams.HTTPRetrievalDs)
+}
+
+func (r *BadgerRepo) PublishMessageRepo() repo.PublishMessageRepo {
+	return NewPublishMessageRepo(r.dsParams.PublishMsgDs)
+}
+
 func (r *BadgerRepo) PaychMsgInfoRepo() repo.PaychMsgInfoRepo {
 	return NewPayMsgRepo(r.dsParams.PaychMsgDS)
 }
@@ -297,24 +363,36 @@ func (r *BadgerRepo) Migrate() error {
 	r.dsParams.RetrAskDs = newDss[migrate.DsNameRetrievalAskDs]
 	r.dsParams.CidInfoDs = newDss[migrate.DsNameCidInfoDs]
 	r.dsParams.RetrievalDealsDs = newDss[migrate.DsNameRetrievalDealsDs]
-	return nil
+
+	return migrateDealOptions(ctx, r.dsParams.StorageDealsDS, r.dsParams.DealOptionsDs)
 }
 
-// Not a real transaction
+// Transaction runs cb in a badger transaction, all writes in cb are committed if cb returns nil, otherwise discarded
 func (r *BadgerRepo) Transaction(cb func(txRepo repo.TxRepo) error) error {
-	return cb(&txRepo{dsParams: r.dsParams})
+	ctx := context.TODO()
+	tx, err := newBadgerTxn(ctx, r.dsParams.StorageDealsDS, r.dsParams.DirectDealsDs)
+	if err != nil {
+		return fmt.Errorf("open transaction: %w", err)
+	}
+	defer tx.Discard(ctx)
+
+	if err := cb(&txRepo{storageDealsDS: tx.dss[0], directDealsDS: tx.dss[1]}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 type txRepo struct {
-	dsParams *BadgerDSParams
+	storageDealsDS datastore.Batching
+	directDealsDS  datastore.Batching
 }
 
 func (r txRepo) StorageDealRepo() repo.StorageDealRepo {
-	return NewStorageDealRepo(r.dsParams.StorageDealsDS)
+	return NewStorageDealRepo(r.storageDealsDS)
 }
 
 func (r txRepo) DirectDealRepo() repo.DirectDealRepo {
-	return NewDirectDealRepo(r.dsParams.DirectDealsDs)
+	return NewDirectDealRepo(r.directDealsDS)
 }
 
 // not metadata, just raw data between file transfer
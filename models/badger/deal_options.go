@@ -0,0 +1,84 @@
+package badger
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+
+	mtypes "github.com/filecoin-project/venus/venus-shared/types/market"
+)
+
+func NewDealOptionsRepo(ds DealOptionsDS) repo.DealOptionsRepo {
+	return &dealOptionsRepo{ds: ds}
+}
+
+type dealOptionsRepo struct {
+	ds datastore.Batching
+}
+
+func (r *dealOptionsRepo) SaveDealOptions(ctx context.Context, options *types.DealOptions) error {
+	options.TimeStamp = makeRefreshedTimeStamp(&options.TimeStamp)
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	return r.ds.Put(ctx, keyFromProposalCID(options.ProposalCid), data)
+}
+
+func (r *dealOptionsRepo) GetDealOptions(ctx context.Context, proposalCid cid.Cid) (*types.DealOptions, error) {
+	data, err := r.ds.Get(ctx, keyFromProposalCID(proposalCid))
+	if err != nil {
+		return nil, err
+	}
+	var options types.DealOptions
+	if err := json.Unmarshal(data, &options); err != nil {
+		return nil, err
+	}
+
+	return &options, nil
+}
+
+var _ repo.DealOptionsRepo = (*dealOptionsRepo)(nil)
+
+// migrateDealOptions saves the options of the deals made before the options are recorded,
+// it only runs when no options is saved, the unsealed copy of a deal is kept if it's fast retrieval
+func migrateDealOptions(ctx context.Context, dealsDS StorageDealsDS, optionsDS DealOptionsDS) error {
+	if dealsDS == nil || optionsDS == nil {
+		return nil
+	}
+	res, err := optionsDS.Query(ctx, query.Query{KeysOnly: true, Limit: 1})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return nil
+	}
+
+	var deals []*mtypes.MinerDeal
+	if err := travelCborAbleDS(ctx, dealsDS, func(deal *mtypes.MinerDeal) (bool, error) {
+		deals = append(deals, deal)
+		return false, nil
+	}); err != nil {
+		return err
+	}
+
+	r := NewDealOptionsRepo(optionsDS)
+	for _, deal := range deals {
+		options := types.DefaultDealOptions(deal.ProposalCid)
+		options.RemoveUnsealedCopy = !deal.FastRetrieval
+		if err := r.SaveDealOptions(ctx, options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package badger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+
+	markettypes "github.com/filecoin-project/venus/venus-shared/types/market"
+)
+
+func TestDealOptions(t *testing.T) {
+	ctx := context.Background()
+	r := setup(t).DealOptionsRepo()
+
+	var options types.DealOptions
+	testutil.Provide(t, &options)
+	options.SkipIPNIAnnounce = true
+
+	assert.NoError(t, r.SaveDealOptions(ctx, &options))
+	res, err := r.GetDealOptions(ctx, options.ProposalCid)
+	assert.NoError(t, err)
+	assert.Equal(t, &options, res)
+
+	var other types.DealOptions
+	testutil.Provide(t, &other)
+	_, err = r.GetDealOptions(ctx, other.ProposalCid)
+	assert.ErrorIs(t, err, repo.ErrNotFound)
+}
+
+func TestMigrateDealOptions(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewDatastore("")
+	assert.NoError(t, err)
+	dealsDS := NewStorageDealsDS(NewStorageProviderDS(db))
+	optionsDS := NewDealOptionsDS(NewStorageProviderDS(db))
+
+	deals := make([]*markettypes.MinerDeal, 4)
+	testutil.Provide(t, &deals)
+	dealRepo := NewStorageDealRepo(dealsDS)
+	for i, deal := range deals {
+		deal.FastRetrieval = i%2 == 0
+		assert.NoError(t, dealRepo.SaveDeal(ctx, deal))
+	}
+
+	assert.NoError(t, migrateDealOptions(ctx, dealsDS, optionsDS))
+	r := NewDealOptionsRepo(optionsDS)
+	for _, deal := range deals {
+		options, err := r.GetDealOptions(ctx, deal.ProposalCid)
+		assert.NoError(t, err)
+		assert.False(t, options.SkipIPNIAnnounce)
+		assert.Equal(t, !deal.FastRetrieval, options.RemoveUnsealedCopy)
+	}
+
+	// the saved options are not overwritten by migrating again
+	options := types.DefaultDealOptions(deals[0].ProposalCid)
+	options.SkipIPNIAnnounce = true
+	assert.NoError(t, r.SaveDealOptions(ctx, options))
+	assert.NoError(t, migrateDealOptions(ctx, dealsDS, optionsDS))
+	res, err := r.GetDealOptions(ctx, deals[0].ProposalCid)
+	assert.NoError(t, err)
+	assert.True(t, res.SkipIPNIAnnounce)
+}
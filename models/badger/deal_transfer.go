@@ -0,0 +1,76 @@
+package badger
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func NewDealTransferRepo(ds DealTransfersDS) repo.DealTransferRepo {
+	return &dealTransferRepo{ds: ds}
+}
+
+type dealTransferRepo struct {
+	ds datastore.Batching
+}
+
+func (r *dealTransferRepo) SaveTransfer(ctx context.Context, transfer *types.DealTransfer) error {
+	transfer.TimeStamp = makeRefreshedTimeStamp(&transfer.TimeStamp)
+	data, err := json.Marshal(transfer)
+	if err != nil {
+		return err
+	}
+	return r.ds.Put(ctx, keyFromProposalCID(transfer.ProposalCid), data)
+}
+
+func (r *dealTransferRepo) GetTransfer(ctx context.Context, proposalCid cid.Cid) (*types.DealTransfer, error) {
+	data, err := r.ds.Get(ctx, keyFromProposalCID(proposalCid))
+	if err != nil {
+		return nil, err
+	}
+	var transfer types.DealTransfer
+	if err := json.Unmarshal(data, &transfer); err != nil {
+		return nil, err
+	}
+
+	return &transfer, nil
+}
+
+func (r *dealTransferRepo) UpdateBytesReceived(ctx context.Context, proposalCid cid.Cid, received uint64) error {
+	transfer, err := r.GetTransfer(ctx, proposalCid)
+	if err != nil {
+		return err
+	}
+	transfer.NBytesReceived = received
+
+	return r.SaveTransfer(ctx, transfer)
+}
+
+func (r *dealTransferRepo) ListTransfer(ctx context.Context, states ...types.TransferState) ([]*types.DealTransfer, error) {
+	var transfers []*types.DealTransfer
+	err := travelJSONAbleDS(ctx, r.ds, func(transfer *types.DealTransfer) (bool, error) {
+		if len(states) == 0 {
+			transfers = append(transfers, transfer)
+			return false, nil
+		}
+		for _, state := range states {
+			if transfer.State == state {
+				transfers = append(transfers, transfer)
+				break
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+var _ repo.DealTransferRepo = (*dealTransferRepo)(nil)
@@ -0,0 +1,61 @@
+package badger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func TestDealTransfer(t *testing.T) {
+	ds, err := NewDatastore("")
+	assert.NoError(t, err)
+	r := NewDealTransferRepo(ds)
+
+	transfers := make([]*types.DealTransfer, 10)
+	testutil.Provide(t, &transfers)
+	for i, transfer := range transfers {
+		transfer.State = types.TransferState(i % 4)
+	}
+
+	ctx := context.Background()
+
+	t.Run("save transfer", func(t *testing.T) {
+		for _, transfer := range transfers {
+			assert.NoError(t, r.SaveTransfer(ctx, transfer))
+		}
+	})
+
+	t.Run("get transfer", func(t *testing.T) {
+		for _, transfer := range transfers {
+			res, err := r.GetTransfer(ctx, transfer.ProposalCid)
+			assert.NoError(t, err)
+			assert.Equal(t, transfer, res)
+		}
+	})
+
+	t.Run("update bytes received", func(t *testing.T) {
+		transfer := transfers[0]
+		assert.NoError(t, r.UpdateBytesReceived(ctx, transfer.ProposalCid, transfer.NBytesReceived+10))
+
+		res, err := r.GetTransfer(ctx, transfer.ProposalCid)
+		assert.NoError(t, err)
+		assert.Equal(t, transfer.NBytesReceived+10, res.NBytesReceived)
+	})
+
+	t.Run("list transfer", func(t *testing.T) {
+		res, err := r.ListTransfer(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, res, len(transfers))
+
+		res, err = r.ListTransfer(ctx, types.TransferWaiting, types.TransferTransferring)
+		assert.NoError(t, err)
+		assert.Len(t, res, 6)
+		for _, transfer := range res {
+			assert.Contains(t, []types.TransferState{types.TransferWaiting, types.TransferTransferring}, transfer.State)
+		}
+	})
+}
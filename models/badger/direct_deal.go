@@ -93,6 +93,26 @@ func (r *directDealRepo) GetDealsByMinerAndState(ctx context.Context, miner addr
 	return deals, nil
 }
 
+func (r *directDealRepo) GetDealsByPieceAndState(ctx context.Context, pieceCID cid.Cid, states ...types.DirectDealState) ([]*types.DirectDeal, error) {
+	filter := map[types.DirectDealState]struct{}{}
+	for _, state := range states {
+		filter[state] = struct{}{}
+	}
+
+	var deals []*types.DirectDeal
+	err := travelJSONAbleDS(ctx, r.ds, func(deal *types.DirectDeal) (bool, error) {
+		if _, ok := filter[deal.State]; ok && deal.PieceCID.Equals(pieceCID) {
+			deals = append(deals, deal)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deals, nil
+}
+
 func (r *directDealRepo) GetPieceInfo(ctx context.Context, pieceCID cid.Cid) (*piecestore.PieceInfo, error) {
 	pieceInfo := piecestore.PieceInfo{
 		PieceCID: pieceCID,
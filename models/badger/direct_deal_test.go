@@ -79,6 +79,21 @@ func TestDirectDeal(t *testing.T) {
 		assert.Len(t, res, 0)
 	})
 
+	t.Run("get deal by piece and state", func(t *testing.T) {
+		deal := *deals[1]
+		deal.State = types.DealActive
+		assert.NoError(t, r.SaveDeal(ctx, &deal))
+
+		res, err := r.GetDealsByPieceAndState(ctx, deal.PieceCID, types.DealActive)
+		assert.NoError(t, err)
+		assert.Len(t, res, 1)
+		assert.Equal(t, deal.ID, res[0].ID)
+
+		res, err = r.GetDealsByPieceAndState(ctx, deal.PieceCID, types.DealExpired)
+		assert.NoError(t, err)
+		assert.Len(t, res, 0)
+	})
+
 	t.Run("list deal", func(t *testing.T) {
 		var err error
 		firstDeal := deals[0]
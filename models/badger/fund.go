@@ -3,16 +3,22 @@ package badger
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/filecoin-project/go-address"
 	cborrpc "github.com/filecoin-project/go-cbor-util"
 	types "github.com/filecoin-project/venus/venus-shared/types/market"
 	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
 	"github.com/ipfs/go-datastore"
 	dsq "github.com/ipfs/go-datastore/query"
 )
 
-const dsKeyAddr = "Addr"
+const (
+	dsKeyAddr  = "Addr"
+	dsKeyTopUp = "TopUp"
+)
 
 type fundRepo struct {
 	ds datastore.Batching
@@ -86,3 +92,41 @@ func (fr *fundRepo) ListFundedAddressState(ctx context.Context) ([]*types.Funded
 func dskeyForAddr(addr address.Address) datastore.Key {
 	return datastore.KeyWithNamespaces([]string{dsKeyAddr, addr.String()})
 }
+
+// SaveEscrowTopUp save the top-up of the escrow policy to the datastore
+func (fr *fundRepo) SaveEscrowTopUp(ctx context.Context, topUp *types2.EscrowTopUp) error {
+	topUp.TimeStamp = makeRefreshedTimeStamp(&topUp.TimeStamp)
+	b, err := json.Marshal(topUp)
+	if err != nil {
+		return err
+	}
+
+	return fr.ds.Put(ctx, datastore.KeyWithNamespaces([]string{dsKeyTopUp, topUp.Addr.String(), topUp.MsgCid.String()}), b)
+}
+
+// ListEscrowTopUp get the top-ups of the address created at or after since
+func (fr *fundRepo) ListEscrowTopUp(ctx context.Context, addr address.Address, since time.Time) ([]*types2.EscrowTopUp, error) {
+	res, err := fr.ds.Query(ctx, dsq.Query{Prefix: datastore.KeyWithNamespaces([]string{dsKeyTopUp, addr.String()}).String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close() //nolint:errcheck
+
+	topUps := make([]*types2.EscrowTopUp, 0)
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return nil, entry.Error
+		}
+
+		var topUp types2.EscrowTopUp
+		if err := json.Unmarshal(entry.Value, &topUp); err != nil {
+			return nil, err
+		}
+		if int64(topUp.CreatedAt) < since.Unix() {
+			continue
+		}
+		topUps = append(topUps, &topUp)
+	}
+
+	return topUps, nil
+}
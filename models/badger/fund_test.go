@@ -3,10 +3,12 @@ package badger
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/filecoin-project/venus/venus-shared/testutil"
 	types "github.com/filecoin-project/venus/venus-shared/types/market"
 	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -58,6 +60,30 @@ func TestListFundedAddressState(t *testing.T) {
 	})
 }
 
+func TestEscrowTopUp(t *testing.T) {
+	ctx, r, _ := prepareFundTest(t)
+
+	topUps := make([]types2.EscrowTopUp, 4)
+	testutil.Provide(t, &topUps)
+	now := time.Now()
+	for i := range topUps {
+		topUps[i].Addr = topUps[0].Addr
+		topUps[i].CreatedAt = uint64(now.Add(-time.Duration(i) * 10 * time.Hour).Unix())
+		assert.NoError(t, r.SaveEscrowTopUp(ctx, &topUps[i]))
+	}
+	var other types2.EscrowTopUp
+	testutil.Provide(t, &other)
+	assert.NoError(t, r.SaveEscrowTopUp(ctx, &other))
+
+	// the top-ups of 0, 10 and 20 hours ago
+	res, err := r.ListEscrowTopUp(ctx, topUps[0].Addr, now.Add(-24*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, res, 3)
+	for _, topUp := range res {
+		assert.Contains(t, topUps[:3], *topUp)
+	}
+}
+
 func prepareFundTest(t *testing.T) (context.Context, repo.FundRepo, []types.FundedAddressState) {
 	ctx := context.Background()
 	repo := setup(t)
@@ -0,0 +1,190 @@
+package badger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+// the records are keyed by /records/{max uint64 - created at}/{id} to be listed from the latest one,
+// and /ids/{id} keeps the key of the record to get it by id
+const (
+	httpRetrievalRecords = "records"
+	httpRetrievalIDs     = "ids"
+)
+
+func NewHTTPRetrievalRepo(ds HTTPRetrievalDS) repo.HTTPRetrievalRepo {
+	return &httpRetrievalRepo{ds: ds}
+}
+
+type httpRetrievalRepo struct {
+	ds datastore.Batching
+}
+
+func httpRetrievalKey(createdAt uint64, id uuid.UUID) datastore.Key {
+	// the time is inverted because the prefixed queries of badger can't iterate the keys in the descending order,
+	// and it's padded to keep the lexicographical order of the keys the same as the numeric order
+	return datastore.KeyWithNamespaces([]string{httpRetrievalRecords, fmt.Sprintf("%020d", math.MaxUint64-createdAt), id.String()})
+}
+
+func httpRetrievalIDKey(id uuid.UUID) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{httpRetrievalIDs, id.String()})
+}
+
+func (r *httpRetrievalRepo) SaveRetrieval(ctx context.Context, retrieval *types.HTTPRetrieval) error {
+	retrieval.TimeStamp = makeRefreshedTimeStamp(&retrieval.TimeStamp)
+	data, err := json.Marshal(retrieval)
+	if err != nil {
+		return err
+	}
+
+	key := httpRetrievalKey(retrieval.CreatedAt, retrieval.ID)
+	idKey := httpRetrievalIDKey(retrieval.ID)
+	batch, err := r.ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	// the record is moved if its created time is changed
+	oldKey, err := r.ds.Get(ctx, idKey)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return err
+	}
+	if err == nil && string(oldKey) != key.String() {
+		if err := batch.Delete(ctx, datastore.NewKey(string(oldKey))); err != nil {
+			return err
+		}
+	}
+	if err := batch.Put(ctx, key, data); err != nil {
+		return err
+	}
+	if err := batch.Put(ctx, idKey, []byte(key.String())); err != nil {
+		return err
+	}
+
+	return batch.Commit(ctx)
+}
+
+func (r *httpRetrievalRepo) GetRetrieval(ctx context.Context, id uuid.UUID) (*types.HTTPRetrieval, error) {
+	key, err := r.ds.Get(ctx, httpRetrievalIDKey(id))
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.ds.Get(ctx, datastore.NewKey(string(key)))
+	if err != nil {
+		return nil, err
+	}
+	var retrieval types.HTTPRetrieval
+	if err := json.Unmarshal(data, &retrieval); err != nil {
+		return nil, err
+	}
+
+	return &retrieval, nil
+}
+
+func (r *httpRetrievalRepo) ListRetrieval(ctx context.Context, params *types.HTTPRetrievalQueryParams) ([]*types.HTTPRetrieval, error) {
+	// the latest records come first in the order of the keys, so the iteration stops at the end of the page
+	res, err := r.ds.Query(ctx, query.Query{
+		Prefix: datastore.NewKey(httpRetrievalRecords).String(),
+		Orders: []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close() //nolint:errcheck
+
+	var retrievals []*types.HTTPRetrieval
+	skipped := 0
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return nil, entry.Error
+		}
+		var retrieval types.HTTPRetrieval
+		if err := json.Unmarshal(entry.Value, &retrieval); err != nil {
+			return nil, err
+		}
+		if len(params.Client) > 0 && retrieval.Client != params.Client {
+			continue
+		}
+		if len(params.Path) > 0 && retrieval.Path != params.Path {
+			continue
+		}
+		if len(params.PieceCID) > 0 && retrieval.PieceCID.String() != params.PieceCID {
+			continue
+		}
+		if len(params.PayloadCID) > 0 && retrieval.PayloadCID.String() != params.PayloadCID {
+			continue
+		}
+		if skipped < params.Offset {
+			skipped++
+			continue
+		}
+		retrievals = append(retrievals, &retrieval)
+		if params.Limit > 0 && len(retrievals) >= params.Limit {
+			break
+		}
+	}
+
+	return retrievals, nil
+}
+
+func (r *httpRetrievalRepo) RemoveRetrievalBefore(ctx context.Context, before time.Time) (int, error) {
+	res, err := r.ds.Query(ctx, query.Query{
+		Prefix:   datastore.NewKey(httpRetrievalRecords).String(),
+		Orders:   []query.Order{query.OrderByKey{}},
+		KeysOnly: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close() //nolint:errcheck
+
+	batch, err := r.ds.Batch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return 0, entry.Error
+		}
+		// the key is /records/{max uint64 - created at}/{id}
+		key := datastore.NewKey(entry.Key)
+		namespaces := key.Namespaces()
+		if len(namespaces) != 3 {
+			return 0, fmt.Errorf("unexpected key of http retrieval: %s", key)
+		}
+		invertedTime, err := strconv.ParseUint(namespaces[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected key of http retrieval: %s: %w", key, err)
+		}
+		// the latest records come first, they are skipped until the old ones
+		if math.MaxUint64-invertedTime >= uint64(before.Unix()) {
+			continue
+		}
+		if err := batch.Delete(ctx, key); err != nil {
+			return 0, err
+		}
+		if err := batch.Delete(ctx, datastore.KeyWithNamespaces([]string{httpRetrievalIDs, namespaces[2]})); err != nil {
+			return 0, err
+		}
+		removed++
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+var _ repo.HTTPRetrievalRepo = (*httpRetrievalRepo)(nil)
@@ -0,0 +1,115 @@
+package badger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func TestHTTPRetrieval(t *testing.T) {
+	ds, err := NewDatastore("")
+	assert.NoError(t, err)
+	r := NewHTTPRetrievalRepo(ds)
+
+	retrievals := make([]*types.HTTPRetrieval, 10)
+	testutil.Provide(t, &retrievals)
+	for i, retrieval := range retrievals {
+		retrieval.Path = []string{types.HTTPRetrievalPiece, types.HTTPRetrievalIPFS}[i%2]
+	}
+
+	ctx := context.Background()
+
+	t.Run("save retrieval", func(t *testing.T) {
+		for _, retrieval := range retrievals {
+			assert.NoError(t, r.SaveRetrieval(ctx, retrieval))
+		}
+	})
+
+	t.Run("get retrieval", func(t *testing.T) {
+		for _, retrieval := range retrievals {
+			res, err := r.GetRetrieval(ctx, retrieval.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, retrieval, res)
+		}
+	})
+
+	t.Run("list retrieval", func(t *testing.T) {
+		res, err := r.ListRetrieval(ctx, &types.HTTPRetrievalQueryParams{})
+		assert.NoError(t, err)
+		assert.Len(t, res, len(retrievals))
+		for i := 1; i < len(res); i++ {
+			assert.GreaterOrEqual(t, res[i-1].CreatedAt, res[i].CreatedAt)
+		}
+
+		res, err = r.ListRetrieval(ctx, &types.HTTPRetrievalQueryParams{Path: types.HTTPRetrievalPiece})
+		assert.NoError(t, err)
+		assert.Len(t, res, 5)
+		for _, retrieval := range res {
+			assert.Equal(t, types.HTTPRetrievalPiece, retrieval.Path)
+		}
+
+		res, err = r.ListRetrieval(ctx, &types.HTTPRetrievalQueryParams{PieceCID: retrievals[0].PieceCID.String()})
+		assert.NoError(t, err)
+		assert.Len(t, res, 1)
+		assert.Equal(t, retrievals[0], res[0])
+
+		res, err = r.ListRetrieval(ctx, &types.HTTPRetrievalQueryParams{Page: market.Page{Offset: 8, Limit: 5}})
+		assert.NoError(t, err)
+		assert.Len(t, res, 2)
+	})
+
+	// the records of the following cases are created in different minutes
+	timedDS, err := NewDatastore("")
+	assert.NoError(t, err)
+	timedRepo := NewHTTPRetrievalRepo(timedDS)
+
+	t.Run("list retrieval by page", func(t *testing.T) {
+		r := timedRepo
+		now := time.Now()
+		for i := 0; i < 10; i++ {
+			var retrieval types.HTTPRetrieval
+			testutil.Provide(t, &retrieval)
+			retrieval.CreatedAt = uint64(now.Add(time.Duration(i) * time.Minute).Unix())
+			assert.NoError(t, r.SaveRetrieval(ctx, &retrieval))
+		}
+
+		var pages []*types.HTTPRetrieval
+		for offset := 0; offset < 10; offset += 3 {
+			res, err := r.ListRetrieval(ctx, &types.HTTPRetrievalQueryParams{Page: market.Page{Offset: offset, Limit: 3}})
+			assert.NoError(t, err)
+			pages = append(pages, res...)
+		}
+		assert.Len(t, pages, 10)
+		for i := 1; i < len(pages); i++ {
+			assert.Greater(t, pages[i-1].CreatedAt, pages[i].CreatedAt)
+		}
+	})
+
+	t.Run("remove retrieval", func(t *testing.T) {
+		r := timedRepo
+		all, err := r.ListRetrieval(ctx, &types.HTTPRetrievalQueryParams{})
+		assert.NoError(t, err)
+		assert.Len(t, all, 10)
+
+		// the records of the first 4 minutes are removed
+		before := time.Unix(int64(all[len(all)-1].CreatedAt), 0).Add(4 * time.Minute)
+		removed, err := r.RemoveRetrievalBefore(ctx, before)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, removed)
+
+		res, err := r.ListRetrieval(ctx, &types.HTTPRetrievalQueryParams{})
+		assert.NoError(t, err)
+		assert.Equal(t, all[:6], res)
+		for _, retrieval := range all[6:] {
+			_, err := r.GetRetrieval(ctx, retrieval.ID)
+			assert.ErrorIs(t, err, repo.ErrNotFound)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package badger
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func NewPieceVerifyRepo(ds PieceVerifyDS) repo.PieceVerifyRepo {
+	return &pieceVerifyRepo{ds: ds}
+}
+
+type pieceVerifyRepo struct {
+	ds datastore.Batching
+}
+
+func (r *pieceVerifyRepo) SaveVerification(ctx context.Context, verification *types.PieceVerification) error {
+	verification.TimeStamp = makeRefreshedTimeStamp(&verification.TimeStamp)
+	data, err := json.Marshal(verification)
+	if err != nil {
+		return err
+	}
+	return r.ds.Put(ctx, verificationKey(verification.PieceCID, verification.Storage), data)
+}
+
+func (r *pieceVerifyRepo) GetVerification(ctx context.Context, pieceCid cid.Cid, storage string) (*types.PieceVerification, error) {
+	data, err := r.ds.Get(ctx, verificationKey(pieceCid, storage))
+	if err != nil {
+		return nil, err
+	}
+	var verification types.PieceVerification
+	if err := json.Unmarshal(data, &verification); err != nil {
+		return nil, err
+	}
+
+	return &verification, nil
+}
+
+func (r *pieceVerifyRepo) ListVerification(ctx context.Context, storage string) ([]*types.PieceVerification, error) {
+	var verifications []*types.PieceVerification
+	err := travelJSONAbleDS(ctx, r.ds, func(verification *types.PieceVerification) (bool, error) {
+		if len(storage) == 0 || verification.Storage == storage {
+			verifications = append(verifications, verification)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return verifications, nil
+}
+
+// verificationKey keys the verification by the piece and the storage, the piece may be kept in several storages
+func verificationKey(pieceCid cid.Cid, storage string) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{pieceCid.String(), storage})
+}
+
+var _ repo.PieceVerifyRepo = (*pieceVerifyRepo)(nil)
@@ -0,0 +1,75 @@
+package badger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func TestPieceVerification(t *testing.T) {
+	ds, err := NewDatastore("")
+	assert.NoError(t, err)
+	r := NewPieceVerifyRepo(ds)
+
+	verifications := make([]*types.PieceVerification, 10)
+	testutil.Provide(t, &verifications)
+	for i, verification := range verifications {
+		verification.Storage = []string{"fs", "s3"}[i%2]
+		verification.State = types.PieceVerified
+	}
+
+	ctx := context.Background()
+
+	t.Run("save verification", func(t *testing.T) {
+		for _, verification := range verifications {
+			assert.NoError(t, r.SaveVerification(ctx, verification))
+		}
+	})
+
+	t.Run("get verification", func(t *testing.T) {
+		for _, verification := range verifications {
+			res, err := r.GetVerification(ctx, verification.PieceCID, verification.Storage)
+			assert.NoError(t, err)
+			assert.Equal(t, verification, res)
+		}
+
+		verification := verifications[0]
+		verification.State = types.PieceCorrupted
+		assert.NoError(t, r.SaveVerification(ctx, verification))
+		res, err := r.GetVerification(ctx, verification.PieceCID, verification.Storage)
+		assert.NoError(t, err)
+		assert.Equal(t, types.PieceCorrupted, res.State)
+	})
+
+	t.Run("same piece in another storage", func(t *testing.T) {
+		verification := *verifications[1]
+		verification.Storage = "other"
+		verification.State = types.PieceCorrupted
+		assert.NoError(t, r.SaveVerification(ctx, &verification))
+
+		// the verification of the piece in the first storage is kept
+		res, err := r.GetVerification(ctx, verification.PieceCID, verifications[1].Storage)
+		assert.NoError(t, err)
+		assert.Equal(t, types.PieceVerified, res.State)
+		res, err = r.GetVerification(ctx, verification.PieceCID, "other")
+		assert.NoError(t, err)
+		assert.Equal(t, types.PieceCorrupted, res.State)
+	})
+
+	t.Run("list verification", func(t *testing.T) {
+		res, err := r.ListVerification(ctx, "")
+		assert.NoError(t, err)
+		assert.Len(t, res, len(verifications)+1)
+
+		res, err = r.ListVerification(ctx, "fs")
+		assert.NoError(t, err)
+		assert.Len(t, res, 5)
+		for _, verification := range res {
+			assert.Equal(t, "fs", verification.Storage)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package badger
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func NewPublishMessageRepo(ds PublishMessageDS) repo.PublishMessageRepo {
+	return &publishMessageRepo{ds: ds}
+}
+
+type publishMessageRepo struct {
+	ds datastore.Batching
+}
+
+func (r *publishMessageRepo) SavePublishMessage(ctx context.Context, msg *types.PublishMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return r.ds.Put(ctx, datastore.NewKey(msg.MsgCid.String()), data)
+}
+
+func (r *publishMessageRepo) ListPublishMessage(ctx context.Context, updatedAfter time.Time) ([]*types.PublishMessage, error) {
+	var msgs []*types.PublishMessage
+	err := travelJSONAbleDS(ctx, r.ds, func(msg *types.PublishMessage) (bool, error) {
+		if msg.State == types.PublishMsgPending || msg.UpdatedAt.After(updatedAfter) {
+			msgs = append(msgs, msg)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].PushedAt.Before(msgs[j].PushedAt)
+	})
+
+	return msgs, nil
+}
+
+var _ repo.PublishMessageRepo = (*publishMessageRepo)(nil)
@@ -0,0 +1,59 @@
+package badger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func TestPublishMessage(t *testing.T) {
+	ds, err := NewDatastore("")
+	assert.NoError(t, err)
+	r := NewPublishMessageRepo(ds)
+
+	var miner address.Address
+	testutil.Provide(t, &miner)
+	now := time.Now()
+	msgs := make([]*types.PublishMessage, 6)
+	for i := range msgs {
+		var msgCid cid.Cid
+		deals := make([]cid.Cid, 2)
+		testutil.Provide(t, &msgCid)
+		testutil.Provide(t, &deals)
+		msgs[i] = &types.PublishMessage{
+			Miner:        miner,
+			MsgCid:       msgCid,
+			Deals:        deals,
+			BaseFee:      big.NewInt(100),
+			EstimatedFee: big.NewInt(1000),
+			State:        types.PublishMsgOnChain,
+			PushedAt:     now.Add(time.Duration(i) * time.Minute),
+			UpdatedAt:    now.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	// the pending message is listed even if it is not updated for a long time
+	msgs[0].State = types.PublishMsgPending
+	msgs[0].UpdatedAt = now.Add(-48 * time.Hour)
+	msgs[1].UpdatedAt = now.Add(-48 * time.Hour)
+
+	ctx := context.Background()
+	for _, msg := range msgs {
+		assert.NoError(t, r.SavePublishMessage(ctx, msg))
+	}
+
+	res, err := r.ListPublishMessage(ctx, now.Add(-24*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, res, 5)
+	assert.Equal(t, msgs[0].MsgCid, res[0].MsgCid)
+	for i := 1; i < len(res); i++ {
+		assert.Equal(t, msgs[i+1].MsgCid, res[i].MsgCid)
+	}
+}
@@ -191,6 +191,42 @@ func (sdr *storageDealRepo) GetDealsByDataCidAndDealStatus(ctx context.Context,
 	return storageDeals, err
 }
 
+func (sdr *storageDealRepo) GetDealsBySectors(ctx context.Context, addr address.Address, sectors []abi.SectorNumber, statues ...storagemarket.StorageDealStatus) ([]*types.MinerDeal, error) {
+	sectorFilter := make(map[abi.SectorNumber]struct{}, len(sectors))
+	for _, sector := range sectors {
+		sectorFilter[sector] = struct{}{}
+	}
+	filter := map[storagemarket.StorageDealStatus]struct{}{}
+	for _, status := range statues {
+		filter[status] = struct{}{}
+	}
+
+	var storageDeals []*types.MinerDeal
+	var err error
+	if err = travelCborAbleDS(ctx, sdr.ds,
+		func(deal *types.MinerDeal) (stop bool, err error) {
+			if deal.ClientDealProposal.Proposal.Provider != addr || deal.PieceStatus == types.Undefine {
+				return
+			}
+			if _, ok := sectorFilter[deal.SectorNumber]; !ok {
+				return
+			}
+			if _, ok := filter[deal.State]; len(filter) > 0 && !ok {
+				return
+			}
+			storageDeals = append(storageDeals, deal)
+			return
+		}); err != nil {
+		return nil, err
+	}
+
+	if len(storageDeals) == 0 {
+		err = repo.ErrNotFound
+	}
+
+	return storageDeals, err
+}
+
 func (sdr *storageDealRepo) GetDealByAddrAndStatus(ctx context.Context, addr address.Address, statues ...storagemarket.StorageDealStatus) ([]*types.MinerDeal, error) {
 	filter := map[storagemarket.StorageDealStatus]struct{}{}
 	for _, status := range statues {
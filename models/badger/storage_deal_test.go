@@ -13,6 +13,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/ipfs-force-community/droplet/v2/models/repo"
 	"github.com/stretchr/testify/assert"
 
@@ -273,6 +274,40 @@ func TestGetStorageDealByAddrAndStatus(t *testing.T) {
 	})
 }
 
+func TestGetStorageDealsBySectors(t *testing.T) {
+	ctx, r, dealCases := prepareStorageDealTest(t)
+
+	miner := dealCases[0].Proposal.Provider
+	for i := range dealCases[:4] {
+		dealCases[i].Proposal.Provider = miner
+		dealCases[i].SectorNumber = abi.SectorNumber(10 + i%2)
+		dealCases[i].PieceStatus = markettypes.Assigned
+		dealCases[i].State = storagemarket.StorageDealAwaitingPreCommit
+	}
+	dealCases[3].State = storagemarket.StorageDealActive
+	// the deal is not assigned to any sector
+	dealCases[4].Proposal.Provider = miner
+	dealCases[4].SectorNumber = 10
+	dealCases[4].PieceStatus = markettypes.Undefine
+	for _, deal := range dealCases {
+		assert.NoError(t, r.SaveDeal(ctx, &deal))
+	}
+
+	res, err := r.GetDealsBySectors(ctx, miner, []abi.SectorNumber{10})
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+	for _, deal := range res {
+		assert.Equal(t, abi.SectorNumber(10), deal.SectorNumber)
+	}
+
+	res, err = r.GetDealsBySectors(ctx, miner, []abi.SectorNumber{10, 11}, storagemarket.StorageDealAwaitingPreCommit)
+	assert.NoError(t, err)
+	assert.Len(t, res, 3)
+
+	_, err = r.GetDealsBySectors(ctx, miner, []abi.SectorNumber{12})
+	assert.ErrorIs(t, err, repo.ErrNotFound)
+}
+
 func TestListStorageDealByAddr(t *testing.T) {
 	ctx, r, dealCases := prepareStorageDealTest(t)
 
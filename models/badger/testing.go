@@ -36,6 +36,11 @@ func WrapDbToRepo(db datastore.Batching) repo.Repo {
 		CidInfoDs:        NewCidInfoDs(NewPieceMetaDs(db)),
 		RetrievalDealsDs: NewRetrievalDealsDS(NewRetrievalProviderDS(db)),
 		DirectDealsDs:    NewDirectDealsDS(db),
+		DealTransfersDs:  NewDealTransfersDS(NewStorageProviderDS(db)),
+		PieceVerifyDs:    NewPieceVerifyDS(NewPieceMetaDs(db)),
+		DealOptionsDs:    NewDealOptionsDS(NewStorageProviderDS(db)),
+		HTTPRetrievalDs:  NewHTTPRetrievalDS(NewRetrievalProviderDS(db)),
+		PublishMsgDs:     NewPublishMessageDS(NewStorageProviderDS(db)),
 	})
 }
 
@@ -0,0 +1,108 @@
+package badger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/keytransform"
+)
+
+// badgerTxn is a transaction over several datastores which are wrapped from the same root datastore,
+// the writes on all datastores are committed or discarded together
+type badgerTxn struct {
+	txn datastore.Txn
+	dss []datastore.Batching
+}
+
+// newBadgerTxn opens a transaction on the root datastore of dss, the datastores bound to the transaction
+// have the same namespaces as dss
+func newBadgerTxn(ctx context.Context, dss ...datastore.Batching) (*badgerTxn, error) {
+	var root datastore.TxnDatastore
+	transforms := make([][]keytransform.KeyTransform, len(dss))
+	for i, ds := range dss {
+		dsRoot, kts, err := unwrapDatastore(ds)
+		if err != nil {
+			return nil, err
+		}
+		if root == nil {
+			root = dsRoot
+		} else if root != dsRoot {
+			return nil, fmt.Errorf("datastores in a transaction must share the same root datastore")
+		}
+		transforms[i] = kts
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no datastore in transaction")
+	}
+
+	txn, err := root.NewTransaction(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &badgerTxn{txn: txn, dss: make([]datastore.Batching, len(dss))}
+	for i, kts := range transforms {
+		var ds datastore.Batching = &txnDatastore{Txn: txn}
+		// the innermost key transform is applied first
+		for j := len(kts) - 1; j >= 0; j-- {
+			ds = keytransform.Wrap(ds, kts[j])
+		}
+		tx.dss[i] = ds
+	}
+
+	return tx, nil
+}
+
+// unwrapDatastore returns the root datastore of ds and the key transforms from outside to inside
+func unwrapDatastore(ds datastore.Datastore) (datastore.TxnDatastore, []keytransform.KeyTransform, error) {
+	var kts []keytransform.KeyTransform
+	for {
+		switch d := ds.(type) {
+		case *keytransform.Datastore:
+			kts = append(kts, d.KeyTransform)
+			ds = d.Children()[0]
+		case datastore.TxnDatastore:
+			return d, kts, nil
+		default:
+			return nil, nil, fmt.Errorf("datastore %T does not support transaction", ds)
+		}
+	}
+}
+
+func (tx *badgerTxn) Commit(ctx context.Context) error {
+	return tx.txn.Commit(ctx)
+}
+
+func (tx *badgerTxn) Discard(ctx context.Context) {
+	tx.txn.Discard(ctx)
+}
+
+var _ datastore.Batching = (*txnDatastore)(nil)
+
+// txnDatastore reads and writes in the transaction, it is not committed until the transaction is committed
+type txnDatastore struct {
+	datastore.Txn
+}
+
+func (d *txnDatastore) Sync(context.Context, datastore.Key) error {
+	return nil
+}
+
+func (d *txnDatastore) Close() error {
+	return nil
+}
+
+// Batch writes to the transaction directly, the transaction is atomic already
+func (d *txnDatastore) Batch(context.Context) (datastore.Batch, error) {
+	return &txnBatch{Txn: d.Txn}, nil
+}
+
+type txnBatch struct {
+	datastore.Txn
+}
+
+// Commit does nothing, the writes are committed with the transaction
+func (b *txnBatch) Commit(context.Context) error {
+	return nil
+}
@@ -43,6 +43,11 @@ var DBOptions = func(server bool, mysqlCfg *config.Mysql) builder.Option {
 					builder.Override(new(badger2.FundMgrDS), badger2.NewFundMgrDS),
 					builder.Override(new(badger2.RetrievalDealsDS), badger2.NewRetrievalDealsDS),
 					builder.Override(new(badger2.DirectDealsDS), badger2.NewDirectDealsDS),
+					builder.Override(new(badger2.DealTransfersDS), badger2.NewDealTransfersDS),
+					builder.Override(new(badger2.PieceVerifyDS), badger2.NewPieceVerifyDS),
+					builder.Override(new(badger2.DealOptionsDS), badger2.NewDealOptionsDS),
+					builder.Override(new(badger2.HTTPRetrievalDS), badger2.NewHTTPRetrievalDS),
+					builder.Override(new(badger2.PublishMessageDS), badger2.NewPublishMessageDS),
 					builder.Override(new(repo.Repo), badger2.NewMigratedBadgerRepo),
 				),
 			),
@@ -70,6 +70,26 @@ func (r MysqlRepo) DirectDealRepo() repo.DirectDealRepo {
 	return NewDirectDealRepo(r.GetDb())
 }
 
+func (r MysqlRepo) DealTransferRepo() repo.DealTransferRepo {
+	return NewDealTransferRepo(r.GetDb())
+}
+
+func (r MysqlRepo) PieceVerifyRepo() repo.PieceVerifyRepo {
+	return NewPieceVerifyRepo(r.GetDb())
+}
+
+func (r MysqlRepo) DealOptionsRepo() repo.DealOptionsRepo {
+	return NewDealOptionsRepo(r.GetDb())
+}
+
+func (r MysqlRepo) HTTPRetrievalRepo() repo.HTTPRetrievalRepo {
+	return NewHTTPRetrievalRepo(r.GetDb())
+}
+
+func (r MysqlRepo) PublishMessageRepo() repo.PublishMessageRepo {
+	return NewPublishMessageRepo(r.GetDb())
+}
+
 func (r MysqlRepo) Close() error {
 	db, err := r.DB.DB()
 	if err != nil {
@@ -79,8 +99,17 @@ func (r MysqlRepo) Close() error {
 }
 
 func (r MysqlRepo) Migrate() error {
-	return r.AutoMigrate(retrievalAsk{}, cidInfo{}, storageAsk{}, fundedAddressState{}, storageDeal{},
-		channelInfo{}, msgInfo{}, retrievalDeal{}, shard{}, directDeal{})
+	// the options of the existing deals are saved when the table is created
+	newDealOptions := !r.Migrator().HasTable(&dealOptions{})
+	if err := r.AutoMigrate(retrievalAsk{}, cidInfo{}, storageAsk{}, fundedAddressState{}, storageDeal{},
+		channelInfo{}, msgInfo{}, retrievalDeal{}, shard{}, directDeal{}, dealTransfer{}, pieceVerification{},
+		dealOptions{}, httpRetrieval{}, publishMessage{}, escrowTopUp{}); err != nil {
+		return err
+	}
+	if newDealOptions {
+		return migrateDealOptions(r.GetDb())
+	}
+	return nil
 }
 
 func (r MysqlRepo) Transaction(cb func(txRepo repo.TxRepo) error) error {
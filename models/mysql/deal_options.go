@@ -0,0 +1,86 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const dealOptionsTableName = "storage_deal_options"
+
+type dealOptions struct {
+	ProposalCid        DBCid `gorm:"column:proposal_cid;type:varchar(256);primary_key"`
+	SkipIPNIAnnounce   bool  `gorm:"column:skip_ipni_announce;NOT NULL"`
+	RemoveUnsealedCopy bool  `gorm:"column:remove_unsealed_copy;NOT NULL"`
+
+	TimeStampOrm
+}
+
+func (do *dealOptions) TableName() string {
+	return dealOptionsTableName
+}
+
+func (do *dealOptions) toDealOptions() *types.DealOptions {
+	return &types.DealOptions{
+		ProposalCid:        do.ProposalCid.cid(),
+		SkipIPNIAnnounce:   do.SkipIPNIAnnounce,
+		RemoveUnsealedCopy: do.RemoveUnsealedCopy,
+		TimeStamp:          do.Timestamp(),
+	}
+}
+
+func fromDealOptions(options *types.DealOptions) *dealOptions {
+	return &dealOptions{
+		ProposalCid:        DBCid(options.ProposalCid),
+		SkipIPNIAnnounce:   options.SkipIPNIAnnounce,
+		RemoveUnsealedCopy: options.RemoveUnsealedCopy,
+		TimeStampOrm: TimeStampOrm{
+			CreatedAt: options.CreatedAt,
+			UpdatedAt: options.UpdatedAt,
+		},
+	}
+}
+
+type dealOptionsRepo struct {
+	*gorm.DB
+}
+
+func NewDealOptionsRepo(db *gorm.DB) repo.DealOptionsRepo {
+	return &dealOptionsRepo{DB: db}
+}
+
+func (dor *dealOptionsRepo) SaveDealOptions(ctx context.Context, options *types.DealOptions) error {
+	do := fromDealOptions(options)
+	do.TimeStampOrm.Refresh()
+
+	return dor.DB.WithContext(ctx).Save(do).Error
+}
+
+func (dor *dealOptionsRepo) GetDealOptions(ctx context.Context, proposalCid cid.Cid) (*types.DealOptions, error) {
+	var do dealOptions
+	if err := dor.DB.WithContext(ctx).Take(&do, "proposal_cid = ?", DBCid(proposalCid).String()).Error; err != nil {
+		return nil, err
+	}
+
+	return do.toDealOptions(), nil
+}
+
+var _ repo.DealOptionsRepo = (*dealOptionsRepo)(nil)
+
+// migrateDealOptions saves the options of the deals made before the options are recorded,
+// the unsealed copy of a deal is kept if it's fast retrieval
+func migrateDealOptions(db *gorm.DB) error {
+	now := time.Now().Unix()
+	err := db.Exec(fmt.Sprintf("INSERT INTO `%s` (proposal_cid, skip_ipni_announce, remove_unsealed_copy, created_at, updated_at) "+
+		"SELECT proposal_cid, false, NOT fast_retrieval, ?, ? FROM `%s`", dealOptionsTableName, storageDealTableName), now, now).Error
+	if err != nil {
+		return fmt.Errorf("migrate deal options: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package mysql
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func TestSaveDealOptions(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var options types.DealOptions
+	testutil.Provide(t, &options)
+
+	fixedTs := uint64(time.Now().Unix())
+	options.CreatedAt = fixedTs
+	options.UpdatedAt = fixedTs
+
+	dbOptions := fromDealOptions(&options)
+
+	db, err := getMysqlDryrunDB()
+	assert.NoError(t, err)
+	sql, vars, err := getSQL(db.WithContext(ctx).Save(dbOptions))
+	assert.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(sql)).WithArgs(vars...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = r.DealOptionsRepo().SaveDealOptions(ctx, &options)
+	assert.Nil(t, err)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
+
+func TestGetDealOptions(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var options types.DealOptions
+	testutil.Provide(t, &options)
+	options.RemoveUnsealedCopy = true
+	dbOptions := fromDealOptions(&options)
+
+	rows, err := getFullRows(dbOptions)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `storage_deal_options` WHERE proposal_cid = ? LIMIT 1")).
+		WithArgs(dbOptions.ProposalCid.String()).WillReturnRows(rows)
+
+	res, err := r.DealOptionsRepo().GetDealOptions(ctx, options.ProposalCid)
+	assert.Nil(t, err)
+	assert.Equal(t, options.ProposalCid, res.ProposalCid)
+	assert.True(t, res.RemoveUnsealedCopy)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
+
+func TestMigrateDealOptions(t *testing.T) {
+	r, mock, sqlDB := setup(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `storage_deal_options` (proposal_cid, skip_ipni_announce, remove_unsealed_copy, created_at, updated_at) "+
+		"SELECT proposal_cid, false, NOT fast_retrieval, ?, ? FROM `storage_deals`")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	assert.NoError(t, migrateDealOptions(r.(MysqlRepo).GetDb()))
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
@@ -0,0 +1,135 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ipfs/go-cid"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const dealTransferTableName = "deal_transfers"
+
+type dealTransfer struct {
+	ProposalCid DBCid     `gorm:"column:proposal_cid;type:varchar(256);primary_key"`
+	DealUUID    string    `gorm:"column:deal_uuid;type:varchar(128);"`
+	Provider    DBAddress `gorm:"column:provider;type:varchar(256);index"`
+
+	Type           string `gorm:"column:type;type:varchar(32);"`
+	Params         []byte `gorm:"column:params;type:blob;"`
+	Size           uint64 `gorm:"column:size;type:bigint unsigned;NOT NULL"`
+	NBytesReceived uint64 `gorm:"column:n_bytes_received;type:bigint unsigned;NOT NULL"`
+	Path           string `gorm:"column:path;type:varchar(256);"`
+
+	State   types.TransferState `gorm:"column:state;type:int;index;NOT NULL"`
+	Retry   uint64              `gorm:"column:retry;type:bigint unsigned;NOT NULL"`
+	Message string              `gorm:"column:message;type:varchar(256)"`
+
+	TimeStampOrm
+}
+
+func (dt *dealTransfer) TableName() string {
+	return dealTransferTableName
+}
+
+func (dt *dealTransfer) toDealTransfer() (*types.DealTransfer, error) {
+	transfer := &types.DealTransfer{
+		ProposalCid:    dt.ProposalCid.cid(),
+		Provider:       dt.Provider.addr(),
+		Type:           dt.Type,
+		Params:         dt.Params,
+		Size:           dt.Size,
+		NBytesReceived: dt.NBytesReceived,
+		Path:           dt.Path,
+		State:          dt.State,
+		Retry:          dt.Retry,
+		Message:        dt.Message,
+		TimeStamp:      dt.Timestamp(),
+	}
+	if len(dt.DealUUID) > 0 {
+		id, err := uuid.Parse(dt.DealUUID)
+		if err != nil {
+			return nil, err
+		}
+		transfer.DealUUID = id
+	}
+
+	return transfer, nil
+}
+
+func fromDealTransfer(transfer *types.DealTransfer) *dealTransfer {
+	return &dealTransfer{
+		ProposalCid:    DBCid(transfer.ProposalCid),
+		DealUUID:       transfer.DealUUID.String(),
+		Provider:       DBAddress(transfer.Provider),
+		Type:           transfer.Type,
+		Params:         transfer.Params,
+		Size:           transfer.Size,
+		NBytesReceived: transfer.NBytesReceived,
+		Path:           transfer.Path,
+		State:          transfer.State,
+		Retry:          transfer.Retry,
+		Message:        transfer.Message,
+		TimeStampOrm: TimeStampOrm{
+			CreatedAt: transfer.CreatedAt,
+			UpdatedAt: transfer.UpdatedAt,
+		},
+	}
+}
+
+type dealTransferRepo struct {
+	*gorm.DB
+}
+
+func NewDealTransferRepo(db *gorm.DB) repo.DealTransferRepo {
+	return &dealTransferRepo{DB: db}
+}
+
+func (dtr *dealTransferRepo) SaveTransfer(ctx context.Context, transfer *types.DealTransfer) error {
+	dt := fromDealTransfer(transfer)
+	dt.TimeStampOrm.Refresh()
+
+	return dtr.DB.WithContext(ctx).Save(dt).Error
+}
+
+func (dtr *dealTransferRepo) GetTransfer(ctx context.Context, proposalCid cid.Cid) (*types.DealTransfer, error) {
+	var dt dealTransfer
+	if err := dtr.DB.WithContext(ctx).Take(&dt, "proposal_cid = ?", DBCid(proposalCid).String()).Error; err != nil {
+		return nil, err
+	}
+
+	return dt.toDealTransfer()
+}
+
+func (dtr *dealTransferRepo) UpdateBytesReceived(ctx context.Context, proposalCid cid.Cid, received uint64) error {
+	return dtr.DB.WithContext(ctx).Model(&dealTransfer{}).Where("proposal_cid = ?", DBCid(proposalCid).String()).
+		UpdateColumns(map[string]interface{}{"n_bytes_received": received, "updated_at": time.Now().Unix()}).Error
+}
+
+func (dtr *dealTransferRepo) ListTransfer(ctx context.Context, states ...types.TransferState) ([]*types.DealTransfer, error) {
+	var dts []dealTransfer
+	query := dtr.DB.WithContext(ctx)
+	if len(states) > 0 {
+		query = query.Where("state in ?", states)
+	}
+	if err := query.Find(&dts).Error; err != nil {
+		return nil, err
+	}
+
+	out := make([]*types.DealTransfer, 0, len(dts))
+	for _, dt := range dts {
+		transfer, err := dt.toDealTransfer()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, transfer)
+	}
+
+	return out, nil
+}
+
+var _ repo.DealTransferRepo = (*dealTransferRepo)(nil)
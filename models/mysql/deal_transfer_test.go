@@ -0,0 +1,109 @@
+package mysql
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func TestSaveDealTransfer(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var transfer types.DealTransfer
+	testutil.Provide(t, &transfer)
+	fixUint64Fields(&transfer)
+
+	fixedTs := uint64(time.Now().Unix())
+	transfer.CreatedAt = fixedTs
+	transfer.UpdatedAt = fixedTs
+
+	dbTransfer := fromDealTransfer(&transfer)
+
+	db, err := getMysqlDryrunDB()
+	assert.NoError(t, err)
+	sql, vars, err := getSQL(db.WithContext(ctx).Save(dbTransfer))
+	assert.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(sql)).WithArgs(vars...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = r.DealTransferRepo().SaveTransfer(ctx, &transfer)
+	assert.Nil(t, err)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
+
+func TestGetDealTransfer(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var transfer types.DealTransfer
+	testutil.Provide(t, &transfer)
+	fixUint64Fields(&transfer)
+	dbTransfer := fromDealTransfer(&transfer)
+
+	rows, err := getFullRows(dbTransfer)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `deal_transfers` WHERE proposal_cid = ? LIMIT 1")).
+		WithArgs(dbTransfer.ProposalCid.String()).WillReturnRows(rows)
+
+	res, err := r.DealTransferRepo().GetTransfer(ctx, transfer.ProposalCid)
+	assert.Nil(t, err)
+	assert.Equal(t, transfer.DealUUID, res.DealUUID)
+	assert.Equal(t, transfer.NBytesReceived, res.NBytesReceived)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
+
+func TestUpdateDealTransferBytesReceived(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var transfer types.DealTransfer
+	testutil.Provide(t, &transfer)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `deal_transfers` SET `n_bytes_received`=?,`updated_at`=? WHERE proposal_cid = ?")).
+		WithArgs(uint64(100), sqlmock.AnyArg(), DBCid(transfer.ProposalCid).String()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := r.DealTransferRepo().UpdateBytesReceived(ctx, transfer.ProposalCid, 100)
+	assert.Nil(t, err)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
+
+func TestListDealTransfer(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var transfer types.DealTransfer
+	testutil.Provide(t, &transfer)
+	fixUint64Fields(&transfer)
+	transfer.State = types.TransferTransferring
+	dbTransfer := fromDealTransfer(&transfer)
+
+	rows, err := getFullRows(dbTransfer)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `deal_transfers` WHERE state in (?,?)")).
+		WithArgs(types.TransferWaiting, types.TransferTransferring).WillReturnRows(rows)
+
+	res, err := r.DealTransferRepo().ListTransfer(ctx, types.TransferWaiting, types.TransferTransferring)
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, transfer.ProposalCid, res[0].ProposalCid)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
@@ -153,6 +153,24 @@ func (ddr *directDealRepo) GetDealsByMinerAndState(ctx context.Context, miner ad
 	return out, nil
 }
 
+func (ddr *directDealRepo) GetDealsByPieceAndState(ctx context.Context, pieceCID cid.Cid, states ...types.DirectDealState) ([]*types.DirectDeal, error) {
+	var deals []directDeal
+	if err := ddr.DB.WithContext(ctx).Find(&deals, "piece_cid = ? and state in ?", pieceCID.String(), states).Error; err != nil {
+		return nil, err
+	}
+
+	out := make([]*types.DirectDeal, 0, len(deals))
+	for _, deal := range deals {
+		d, err := deal.toDirectDeal()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+
+	return out, nil
+}
+
 func (ddr *directDealRepo) GetPieceInfo(ctx context.Context, pieceCID cid.Cid) (*piecestore.PieceInfo, error) {
 	var deals []*directDeal
 	if err := ddr.DB.WithContext(ctx).Table(directDealTableName).Find(&deals, "piece_cid = ?", pieceCID.String()).Error; err != nil {
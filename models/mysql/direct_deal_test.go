@@ -137,6 +137,28 @@ func TestGetDirectDealMinerAndState(t *testing.T) {
 	assert.NoError(t, closeDB(mock, sqlDB))
 }
 
+func TestGetDirectDealsByPieceAndState(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var deal types.DirectDeal
+	testutil.Provide(t, &deal)
+	fixUint64Fields(&deal)
+	dbDeal := fromDirectDeal(&deal)
+
+	rows, err := getFullRows(dbDeal)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `direct_deals` WHERE piece_cid = ? and state in (?,?)")).
+		WithArgs(deal.PieceCID.String(), types.DealSealing, types.DealActive).WillReturnRows(rows)
+
+	res, err := r.DirectDealRepo().GetDealsByPieceAndState(ctx, deal.PieceCID, types.DealSealing, types.DealActive)
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
+
 func TestListDirectDeal(t *testing.T) {
 	ctx := context.Background()
 	r, mock, sqlDB := setup(t)
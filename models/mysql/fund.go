@@ -2,17 +2,22 @@ package mysql
 
 import (
 	"context"
+	"time"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
 	types "github.com/filecoin-project/venus/venus-shared/types/market"
 	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
 	"github.com/ipfs-force-community/sophon-messager/models/mtypes"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-const fundedAddressStateTableName = "funded_address_state"
+const (
+	fundedAddressStateTableName = "funded_address_state"
+	escrowTopUpTableName        = "escrow_top_ups"
+)
 
 type fundedAddressState struct {
 	Addr        DBAddress  `gorm:"column:addr;type:varchar(256);primary_key"`
@@ -91,3 +96,56 @@ func (far *fundedAddressStateRepo) ListFundedAddressState(ctx context.Context) (
 
 	return list, nil
 }
+
+type escrowTopUp struct {
+	MsgCid DBCid      `gorm:"column:msg_cid;type:varchar(256);primary_key"`
+	Addr   DBAddress  `gorm:"column:addr;type:varchar(256);index"`
+	Wallet DBAddress  `gorm:"column:wallet;type:varchar(256)"`
+	Amount mtypes.Int `gorm:"column:amount;type:varchar(256);default:0"`
+	TimeStampOrm
+}
+
+func (etu *escrowTopUp) TableName() string {
+	return escrowTopUpTableName
+}
+
+func fromEscrowTopUp(src *types2.EscrowTopUp) *escrowTopUp {
+	return &escrowTopUp{
+		MsgCid:       DBCid(src.MsgCid),
+		Addr:         DBAddress(src.Addr),
+		Wallet:       DBAddress(src.Wallet),
+		Amount:       mtypes.SafeFromGo(src.Amount.Int),
+		TimeStampOrm: TimeStampOrm{CreatedAt: src.CreatedAt, UpdatedAt: src.UpdatedAt},
+	}
+}
+
+func toEscrowTopUp(src *escrowTopUp) *types2.EscrowTopUp {
+	return &types2.EscrowTopUp{
+		MsgCid:    src.MsgCid.cid(),
+		Addr:      src.Addr.addr(),
+		Wallet:    src.Wallet.addr(),
+		Amount:    abi.TokenAmount(mtypes.SafeFromGo(src.Amount.Int)),
+		TimeStamp: src.Timestamp(),
+	}
+}
+
+func (far *fundedAddressStateRepo) SaveEscrowTopUp(ctx context.Context, topUp *types2.EscrowTopUp) error {
+	etu := fromEscrowTopUp(topUp)
+	etu.TimeStampOrm.Refresh()
+	return far.WithContext(ctx).Save(etu).Error
+}
+
+func (far *fundedAddressStateRepo) ListEscrowTopUp(ctx context.Context, addr address.Address, since time.Time) ([]*types2.EscrowTopUp, error) {
+	var etus []*escrowTopUp
+	err := far.WithContext(ctx).Where("addr = ? AND created_at >= ?", DBAddress(addr).String(), since.Unix()).Find(&etus).Error
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*types2.EscrowTopUp, 0, len(etus))
+	for _, etu := range etus {
+		list = append(list, toEscrowTopUp(etu))
+	}
+
+	return list, nil
+}
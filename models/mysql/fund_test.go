@@ -11,6 +11,7 @@ import (
 	"github.com/filecoin-project/go-state-types/abi"
 	market_types "github.com/filecoin-project/venus/venus-shared/types/market"
 	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -78,3 +79,28 @@ func TestListFundedAddressState(t *testing.T) {
 	assert.Equal(t, fundedAddressStatesCase[0], res[0])
 	assert.Equal(t, fundedAddressStatesCase[1], res[1])
 }
+
+func TestListEscrowTopUp(t *testing.T) {
+	r, mock, _, done := prepareFundAddrStateTest(t)
+	defer done()
+
+	msgCid, err := getTestCid()
+	assert.NoError(t, err)
+	now := uint64(time.Now().Unix())
+	topUp := &types.EscrowTopUp{
+		MsgCid:    msgCid,
+		Addr:      address.TestAddress,
+		Wallet:    address.TestAddress2,
+		Amount:    abi.NewTokenAmount(100),
+		TimeStamp: market_types.TimeStamp{CreatedAt: now, UpdatedAt: now},
+	}
+	since := time.Now().Add(-24 * time.Hour)
+
+	rows, err := getFullRows(fromEscrowTopUp(topUp))
+	assert.NoError(t, err)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `escrow_top_ups` WHERE addr = ? AND created_at >= ?")).
+		WithArgs(topUp.Addr.String(), since.Unix()).WillReturnRows(rows)
+	res, err := r.FundRepo().ListEscrowTopUp(context.Background(), topUp.Addr, since)
+	assert.NoError(t, err)
+	assert.Equal(t, []*types.EscrowTopUp{topUp}, res)
+}
@@ -0,0 +1,146 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const httpRetrievalTableName = "http_retrievals"
+
+type httpRetrieval struct {
+	ID         string `gorm:"column:id;type:varchar(128);primary_key"`
+	Client     string `gorm:"column:client;type:varchar(128);index"`
+	Path       string `gorm:"column:path;type:varchar(16)"`
+	PieceCID   DBCid  `gorm:"column:piece_cid;type:varchar(256);index"`
+	PayloadCID DBCid  `gorm:"column:payload_cid;type:varchar(256);index"`
+	Range      string `gorm:"column:byte_range;type:varchar(128)"`
+	Status     int    `gorm:"column:status;type:int;NOT NULL"`
+	Sent       uint64 `gorm:"column:sent;type:bigint unsigned;NOT NULL"`
+	Duration   int64  `gorm:"column:duration;type:bigint;NOT NULL"`
+	Message    string `gorm:"column:message;type:varchar(512)"`
+
+	TimeStampOrm
+}
+
+func (hr *httpRetrieval) TableName() string {
+	return httpRetrievalTableName
+}
+
+func (hr *httpRetrieval) toHTTPRetrieval() (*types.HTTPRetrieval, error) {
+	retrieval := &types.HTTPRetrieval{
+		Client:     hr.Client,
+		Path:       hr.Path,
+		PieceCID:   hr.PieceCID.cid(),
+		PayloadCID: hr.PayloadCID.cid(),
+		Range:      hr.Range,
+		Status:     hr.Status,
+		Sent:       hr.Sent,
+		Duration:   time.Duration(hr.Duration),
+		Message:    hr.Message,
+		TimeStamp:  hr.Timestamp(),
+	}
+	id, err := uuid.Parse(hr.ID)
+	if err != nil {
+		return nil, err
+	}
+	retrieval.ID = id
+
+	return retrieval, nil
+}
+
+func fromHTTPRetrieval(retrieval *types.HTTPRetrieval) *httpRetrieval {
+	return &httpRetrieval{
+		ID:         retrieval.ID.String(),
+		Client:     retrieval.Client,
+		Path:       retrieval.Path,
+		PieceCID:   DBCid(retrieval.PieceCID),
+		PayloadCID: DBCid(retrieval.PayloadCID),
+		Range:      retrieval.Range,
+		Status:     retrieval.Status,
+		Sent:       retrieval.Sent,
+		Duration:   int64(retrieval.Duration),
+		Message:    retrieval.Message,
+		TimeStampOrm: TimeStampOrm{
+			CreatedAt: retrieval.CreatedAt,
+			UpdatedAt: retrieval.UpdatedAt,
+		},
+	}
+}
+
+type httpRetrievalRepo struct {
+	*gorm.DB
+}
+
+func NewHTTPRetrievalRepo(db *gorm.DB) repo.HTTPRetrievalRepo {
+	return &httpRetrievalRepo{DB: db}
+}
+
+func (hrr *httpRetrievalRepo) SaveRetrieval(ctx context.Context, retrieval *types.HTTPRetrieval) error {
+	hr := fromHTTPRetrieval(retrieval)
+	hr.TimeStampOrm.Refresh()
+
+	return hrr.DB.WithContext(ctx).Save(hr).Error
+}
+
+func (hrr *httpRetrievalRepo) GetRetrieval(ctx context.Context, id uuid.UUID) (*types.HTTPRetrieval, error) {
+	var hr httpRetrieval
+	if err := hrr.DB.WithContext(ctx).Take(&hr, "id = ?", id.String()).Error; err != nil {
+		return nil, err
+	}
+
+	return hr.toHTTPRetrieval()
+}
+
+func (hrr *httpRetrievalRepo) ListRetrieval(ctx context.Context, params *types.HTTPRetrievalQueryParams) ([]*types.HTTPRetrieval, error) {
+	var hrs []*httpRetrieval
+
+	query := hrr.DB.WithContext(ctx).Offset(params.Offset)
+	if params.Limit > 0 {
+		query = query.Limit(params.Limit)
+	}
+	if len(params.Client) > 0 {
+		query = query.Where("client = ?", params.Client)
+	}
+	if len(params.Path) > 0 {
+		query = query.Where("path = ?", params.Path)
+	}
+	if len(params.PieceCID) > 0 {
+		query = query.Where("piece_cid = ?", params.PieceCID)
+	}
+	if len(params.PayloadCID) > 0 {
+		query = query.Where("payload_cid = ?", params.PayloadCID)
+	}
+	query = query.Order("created_at desc")
+
+	if err := query.Find(&hrs).Error; err != nil {
+		return nil, err
+	}
+
+	out := make([]*types.HTTPRetrieval, 0, len(hrs))
+	for _, hr := range hrs {
+		retrieval, err := hr.toHTTPRetrieval()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, retrieval)
+	}
+
+	return out, nil
+}
+
+func (hrr *httpRetrievalRepo) RemoveRetrievalBefore(ctx context.Context, before time.Time) (int, error) {
+	res := hrr.DB.WithContext(ctx).Where("created_at < ?", before.Unix()).Delete(&httpRetrieval{})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	return int(res.RowsAffected), nil
+}
+
+var _ repo.HTTPRetrievalRepo = (*httpRetrievalRepo)(nil)
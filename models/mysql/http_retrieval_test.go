@@ -0,0 +1,114 @@
+package mysql
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func TestSaveHTTPRetrieval(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var retrieval types.HTTPRetrieval
+	testutil.Provide(t, &retrieval)
+	fixUint64Fields(&retrieval)
+
+	fixedTs := uint64(time.Now().Unix())
+	retrieval.CreatedAt = fixedTs
+	retrieval.UpdatedAt = fixedTs
+
+	dbRetrieval := fromHTTPRetrieval(&retrieval)
+
+	db, err := getMysqlDryrunDB()
+	assert.NoError(t, err)
+	sql, vars, err := getSQL(db.WithContext(ctx).Save(dbRetrieval))
+	assert.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(sql)).WithArgs(vars...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = r.HTTPRetrievalRepo().SaveRetrieval(ctx, &retrieval)
+	assert.Nil(t, err)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
+
+func TestGetHTTPRetrieval(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var retrieval types.HTTPRetrieval
+	testutil.Provide(t, &retrieval)
+	fixUint64Fields(&retrieval)
+	dbRetrieval := fromHTTPRetrieval(&retrieval)
+
+	rows, err := getFullRows(dbRetrieval)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `http_retrievals` WHERE id = ? LIMIT 1")).
+		WithArgs(dbRetrieval.ID).WillReturnRows(rows)
+
+	res, err := r.HTTPRetrievalRepo().GetRetrieval(ctx, retrieval.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, retrieval.ID, res.ID)
+	assert.Equal(t, retrieval.PieceCID, res.PieceCID)
+	assert.Equal(t, retrieval.Sent, res.Sent)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
+
+func TestListHTTPRetrieval(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var retrieval types.HTTPRetrieval
+	testutil.Provide(t, &retrieval)
+	fixUint64Fields(&retrieval)
+	retrieval.Path = types.HTTPRetrievalPiece
+	dbRetrieval := fromHTTPRetrieval(&retrieval)
+
+	rows, err := getFullRows(dbRetrieval)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `http_retrievals` WHERE client = ? AND path = ? ORDER BY created_at desc LIMIT 10")).
+		WithArgs(retrieval.Client, retrieval.Path).WillReturnRows(rows)
+
+	res, err := r.HTTPRetrievalRepo().ListRetrieval(ctx, &types.HTTPRetrievalQueryParams{
+		Client: retrieval.Client,
+		Path:   retrieval.Path,
+		Page:   market.Page{Limit: 10},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, retrieval.ID, res[0].ID)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
+
+func TestRemoveHTTPRetrievalBefore(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	before := time.Now().Add(-time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `http_retrievals` WHERE created_at < ?")).
+		WithArgs(before.Unix()).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	removed, err := r.HTTPRetrievalRepo().RemoveRetrievalBefore(ctx, before)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
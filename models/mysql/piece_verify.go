@@ -0,0 +1,96 @@
+package mysql
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const pieceVerificationTableName = "piece_verifications"
+
+type pieceVerification struct {
+	PieceCID DBCid                  `gorm:"column:piece_cid;type:varchar(256);primary_key"`
+	Storage  string                 `gorm:"column:storage;type:varchar(128);primary_key"`
+	State    types.PieceVerifyState `gorm:"column:state;type:int;NOT NULL"`
+	Size     int64                  `gorm:"column:size;type:bigint;NOT NULL"`
+	Message  string                 `gorm:"column:message;type:varchar(256)"`
+
+	TimeStampOrm
+}
+
+func (pv *pieceVerification) TableName() string {
+	return pieceVerificationTableName
+}
+
+func (pv *pieceVerification) toPieceVerification() *types.PieceVerification {
+	return &types.PieceVerification{
+		PieceCID:  pv.PieceCID.cid(),
+		Storage:   pv.Storage,
+		State:     pv.State,
+		Size:      pv.Size,
+		Message:   pv.Message,
+		TimeStamp: pv.Timestamp(),
+	}
+}
+
+func fromPieceVerification(verification *types.PieceVerification) *pieceVerification {
+	return &pieceVerification{
+		PieceCID: DBCid(verification.PieceCID),
+		Storage:  verification.Storage,
+		State:    verification.State,
+		Size:     verification.Size,
+		Message:  verification.Message,
+		TimeStampOrm: TimeStampOrm{
+			CreatedAt: verification.CreatedAt,
+			UpdatedAt: verification.UpdatedAt,
+		},
+	}
+}
+
+type pieceVerifyRepo struct {
+	*gorm.DB
+}
+
+func NewPieceVerifyRepo(db *gorm.DB) repo.PieceVerifyRepo {
+	return &pieceVerifyRepo{DB: db}
+}
+
+func (pvr *pieceVerifyRepo) SaveVerification(ctx context.Context, verification *types.PieceVerification) error {
+	pv := fromPieceVerification(verification)
+	pv.TimeStampOrm.Refresh()
+
+	return pvr.DB.WithContext(ctx).Save(pv).Error
+}
+
+func (pvr *pieceVerifyRepo) GetVerification(ctx context.Context, pieceCid cid.Cid, storage string) (*types.PieceVerification, error) {
+	var pv pieceVerification
+	if err := pvr.DB.WithContext(ctx).Take(&pv, "piece_cid = ? AND storage = ?", DBCid(pieceCid).String(), storage).Error; err != nil {
+		return nil, err
+	}
+
+	return pv.toPieceVerification(), nil
+}
+
+func (pvr *pieceVerifyRepo) ListVerification(ctx context.Context, storage string) ([]*types.PieceVerification, error) {
+	var pvs []pieceVerification
+	query := pvr.DB.WithContext(ctx)
+	if len(storage) > 0 {
+		query = query.Where("storage = ?", storage)
+	}
+	if err := query.Find(&pvs).Error; err != nil {
+		return nil, err
+	}
+
+	out := make([]*types.PieceVerification, 0, len(pvs))
+	for _, pv := range pvs {
+		out = append(out, pv.toPieceVerification())
+	}
+
+	return out, nil
+}
+
+var _ repo.PieceVerifyRepo = (*pieceVerifyRepo)(nil)
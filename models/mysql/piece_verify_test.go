@@ -0,0 +1,87 @@
+package mysql
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func TestSavePieceVerification(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var verification types.PieceVerification
+	testutil.Provide(t, &verification)
+
+	fixedTs := uint64(time.Now().Unix())
+	verification.CreatedAt = fixedTs
+	verification.UpdatedAt = fixedTs
+
+	dbVerification := fromPieceVerification(&verification)
+
+	db, err := getMysqlDryrunDB()
+	assert.NoError(t, err)
+	sql, vars, err := getSQL(db.WithContext(ctx).Save(dbVerification))
+	assert.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(sql)).WithArgs(vars...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = r.PieceVerifyRepo().SaveVerification(ctx, &verification)
+	assert.Nil(t, err)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
+
+func TestGetPieceVerification(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var verification types.PieceVerification
+	testutil.Provide(t, &verification)
+	dbVerification := fromPieceVerification(&verification)
+
+	rows, err := getFullRows(dbVerification)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `piece_verifications` WHERE piece_cid = ? AND storage = ? LIMIT 1")).
+		WithArgs(dbVerification.PieceCID.String(), dbVerification.Storage).WillReturnRows(rows)
+
+	res, err := r.PieceVerifyRepo().GetVerification(ctx, verification.PieceCID, verification.Storage)
+	assert.Nil(t, err)
+	assert.Equal(t, verification.PieceCID, res.PieceCID)
+	assert.Equal(t, verification.State, res.State)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
+
+func TestListPieceVerification(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	var verification types.PieceVerification
+	testutil.Provide(t, &verification)
+	verification.Storage = "fs"
+	dbVerification := fromPieceVerification(&verification)
+
+	rows, err := getFullRows(dbVerification)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `piece_verifications` WHERE storage = ?")).
+		WithArgs("fs").WillReturnRows(rows)
+
+	res, err := r.PieceVerifyRepo().ListVerification(ctx, "fs")
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, verification.PieceCID, res[0].PieceCID)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
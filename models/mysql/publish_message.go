@@ -0,0 +1,126 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/ipfs-force-community/sophon-messager/models/mtypes"
+	"github.com/ipfs/go-cid"
+	"gorm.io/gorm"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const publishMessageTableName = "publish_messages"
+
+// DBCids is a list of cid stored as json
+type DBCids []cid.Cid
+
+func (c *DBCids) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("cids should be a `[]byte`")
+	}
+	return json.Unmarshal(b, c)
+}
+
+func (c DBCids) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+type publishMessage struct {
+	MsgCid       DBCid      `gorm:"column:msg_cid;type:varchar(256);primary_key"`
+	Miner        DBAddress  `gorm:"column:miner;type:varchar(256);index"`
+	SignedCid    DBCid      `gorm:"column:signed_cid;type:varchar(256)"`
+	ReplacedCids DBCids     `gorm:"column:replaced_cids;type:text"`
+	FinalCid     DBCid      `gorm:"column:final_cid;type:varchar(256)"`
+	Deals        DBCids     `gorm:"column:deals;type:mediumtext"`
+	BaseFee      mtypes.Int `gorm:"column:base_fee;type:varchar(256);default:0"`
+	EstimatedFee mtypes.Int `gorm:"column:estimated_fee;type:varchar(256);default:0"`
+	State        string     `gorm:"column:state;type:varchar(16);index"`
+	ExitCode     int64      `gorm:"column:exit_code;type:bigint;NOT NULL"`
+	Height       int64      `gorm:"column:height;type:bigint;NOT NULL"`
+	Error        string     `gorm:"column:error;type:varchar(512)"`
+
+	// CreatedAt is the time of pushing the message
+	TimeStampOrm
+}
+
+func (pm *publishMessage) TableName() string {
+	return publishMessageTableName
+}
+
+func (pm *publishMessage) toPublishMessage() *types.PublishMessage {
+	return &types.PublishMessage{
+		Miner:        pm.Miner.addr(),
+		MsgCid:       pm.MsgCid.cid(),
+		SignedCid:    pm.SignedCid.cid(),
+		ReplacedCids: pm.ReplacedCids,
+		FinalCid:     pm.FinalCid.cid(),
+		Deals:        pm.Deals,
+		BaseFee:      abi.TokenAmount(mtypes.SafeFromGo(pm.BaseFee.Int)),
+		EstimatedFee: abi.TokenAmount(mtypes.SafeFromGo(pm.EstimatedFee.Int)),
+		State:        pm.State,
+		ExitCode:     exitcode.ExitCode(pm.ExitCode),
+		Height:       abi.ChainEpoch(pm.Height),
+		Error:        pm.Error,
+		PushedAt:     time.Unix(int64(pm.CreatedAt), 0),
+		UpdatedAt:    time.Unix(int64(pm.UpdatedAt), 0),
+	}
+}
+
+func fromPublishMessage(msg *types.PublishMessage) *publishMessage {
+	return &publishMessage{
+		MsgCid:       DBCid(msg.MsgCid),
+		Miner:        DBAddress(msg.Miner),
+		SignedCid:    DBCid(msg.SignedCid),
+		ReplacedCids: msg.ReplacedCids,
+		FinalCid:     DBCid(msg.FinalCid),
+		Deals:        msg.Deals,
+		BaseFee:      mtypes.SafeFromGo(msg.BaseFee.Int),
+		EstimatedFee: mtypes.SafeFromGo(msg.EstimatedFee.Int),
+		State:        msg.State,
+		ExitCode:     int64(msg.ExitCode),
+		Height:       int64(msg.Height),
+		Error:        msg.Error,
+		TimeStampOrm: TimeStampOrm{
+			CreatedAt: uint64(msg.PushedAt.Unix()),
+			UpdatedAt: uint64(msg.UpdatedAt.Unix()),
+		},
+	}
+}
+
+type publishMessageRepo struct {
+	*gorm.DB
+}
+
+func NewPublishMessageRepo(db *gorm.DB) repo.PublishMessageRepo {
+	return &publishMessageRepo{DB: db}
+}
+
+func (pmr *publishMessageRepo) SavePublishMessage(ctx context.Context, msg *types.PublishMessage) error {
+	return pmr.DB.WithContext(ctx).Save(fromPublishMessage(msg)).Error
+}
+
+func (pmr *publishMessageRepo) ListPublishMessage(ctx context.Context, updatedAfter time.Time) ([]*types.PublishMessage, error) {
+	var pms []*publishMessage
+	if err := pmr.DB.WithContext(ctx).Where("state = ? or updated_at > ?", types.PublishMsgPending, updatedAfter.Unix()).
+		Order("created_at").Find(&pms).Error; err != nil {
+		return nil, err
+	}
+
+	out := make([]*types.PublishMessage, 0, len(pms))
+	for _, pm := range pms {
+		out = append(out, pm.toPublishMessage())
+	}
+
+	return out, nil
+}
+
+var _ repo.PublishMessageRepo = (*publishMessageRepo)(nil)
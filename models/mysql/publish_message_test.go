@@ -0,0 +1,84 @@
+package mysql
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func newPublishMessage(t *testing.T) *types.PublishMessage {
+	var miner address.Address
+	var msgCid, signedCid cid.Cid
+	deals := make([]cid.Cid, 3)
+	testutil.Provide(t, &miner)
+	testutil.Provide(t, &msgCid)
+	testutil.Provide(t, &signedCid)
+	testutil.Provide(t, &deals)
+
+	now := time.Unix(time.Now().Unix(), 0)
+	return &types.PublishMessage{
+		Miner:        miner,
+		MsgCid:       msgCid,
+		SignedCid:    signedCid,
+		Deals:        deals,
+		BaseFee:      big.NewInt(100),
+		EstimatedFee: big.NewInt(1000),
+		State:        types.PublishMsgPending,
+		PushedAt:     now,
+		UpdatedAt:    now,
+	}
+}
+
+func TestSavePublishMessage(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	msg := newPublishMessage(t)
+	dbMsg := fromPublishMessage(msg)
+
+	db, err := getMysqlDryrunDB()
+	assert.NoError(t, err)
+	sql, vars, err := getSQL(db.WithContext(ctx).Save(dbMsg))
+	assert.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(sql)).WithArgs(vars...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = r.PublishMessageRepo().SavePublishMessage(ctx, msg)
+	assert.Nil(t, err)
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
+
+func TestListPublishMessage(t *testing.T) {
+	ctx := context.Background()
+	r, mock, sqlDB := setup(t)
+
+	msg := newPublishMessage(t)
+	dbMsg := fromPublishMessage(msg)
+
+	rows, err := getFullRows(dbMsg)
+	assert.NoError(t, err)
+
+	updatedAfter := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `publish_messages` WHERE state = ? or updated_at > ? ORDER BY created_at")).
+		WithArgs(types.PublishMsgPending, updatedAfter.Unix()).WillReturnRows(rows)
+
+	res, err := r.PublishMessageRepo().ListPublishMessage(ctx, updatedAfter)
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, msg, res[0])
+
+	assert.NoError(t, closeDB(mock, sqlDB))
+}
@@ -431,6 +431,35 @@ func (sdr *storageDealRepo) GetDealsByDataCidAndDealStatus(ctx context.Context,
 	return deals, nil
 }
 
+func (sdr *storageDealRepo) GetDealsBySectors(ctx context.Context, mAddr address.Address, sectors []abi.SectorNumber, status ...storagemarket.StorageDealStatus) ([]*types.MinerDeal, error) {
+	var md []storageDeal
+
+	query := sdr.WithContext(ctx).Table((&storageDeal{}).TableName()).
+		Where("cdp_provider = ? and sector_number in ? and piece_status != ?", DBAddress(mAddr).String(), sectors, types.Undefine)
+	if len(status) > 0 {
+		query = query.Where("state in ?", status)
+	}
+
+	err := query.Find(&md).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(md) == 0 {
+		return nil, repo.ErrNotFound
+	}
+
+	deals := make([]*types.MinerDeal, len(md))
+	for idx, deal := range md {
+		if deals[idx], err = toStorageDeal(&deal); err != nil {
+			return nil, fmt.Errorf("convert StorageDeal(%s) to a types.MinerDeal failed:%w",
+				deal.ProposalCid, err)
+		}
+	}
+
+	return deals, nil
+}
+
 func (sdr *storageDealRepo) GetDealByAddrAndStatus(ctx context.Context, mAddr address.Address, status ...storagemarket.StorageDealStatus) ([]*types.MinerDeal, error) {
 	var md []storageDeal
 
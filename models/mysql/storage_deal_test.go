@@ -148,6 +148,34 @@ func TestGetDealByAddrAndStatus(t *testing.T) {
 	assert.Equal(t, deal, res[0])
 }
 
+func TestGetDealsBySectors(t *testing.T) {
+	r, mock, dbStorageDealCases, storageDealCases, done := prepareStorageDealRepoTest(t)
+	defer done()
+
+	deal := storageDealCases[0]
+	dbDeal := dbStorageDealCases[0]
+
+	db, err := getMysqlDryrunDB()
+	assert.NoError(t, err)
+
+	rows, err := getFullRows(dbDeal)
+	assert.NoError(t, err)
+
+	sectors := []abi.SectorNumber{deal.SectorNumber}
+	var md []storageDeal
+	sql, vars, err := getSQL(db.Table((&storageDeal{}).TableName()).
+		Where("cdp_provider = ? and sector_number in ? and piece_status != ?", DBAddress(deal.Proposal.Provider).String(), sectors, types.Undefine).
+		Where("state in ?", []storagemarket.StorageDealStatus{storagemarket.StorageDealSealing}).Find(&md))
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sql)).WithArgs(vars...).WillReturnRows(rows)
+
+	res, err := r.StorageDealRepo().GetDealsBySectors(context.Background(), deal.Proposal.Provider, sectors, storagemarket.StorageDealSealing)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, deal, res[0])
+}
+
 func TestGetGetDealByDealID(t *testing.T) {
 	r, mock, dbStorageDealCases, storageDealCases, done := prepareStorageDealRepoTest(t)
 	defer done()
@@ -3,6 +3,7 @@ package repo
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/ipfs/go-datastore"
@@ -21,12 +22,17 @@ import (
 	types2 "github.com/filecoin-project/venus/venus-shared/types/market/client"
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p/core/peer"
+
+	dtypes "github.com/ipfs-force-community/droplet/v2/types"
 )
 
 type FundRepo interface {
 	GetFundedAddressState(ctx context.Context, addr address.Address) (*types.FundedAddressState, error)
 	SaveFundedAddressState(ctx context.Context, fds *types.FundedAddressState) error
 	ListFundedAddressState(ctx context.Context) ([]*types.FundedAddressState, error)
+	SaveEscrowTopUp(ctx context.Context, topUp *dtypes.EscrowTopUp) error
+	// ListEscrowTopUp lists the top-ups of the address created at or after the given time
+	ListEscrowTopUp(ctx context.Context, addr address.Address, since time.Time) ([]*dtypes.EscrowTopUp, error)
 }
 
 type StorageDealRepo interface {
@@ -47,6 +53,8 @@ type StorageDealRepo interface {
 	GetDealsByDataCidAndDealStatus(ctx context.Context, mAddr address.Address, dataCid cid.Cid, pieceStatuss []types.PieceStatus) ([]*types.MinerDeal, error)
 	GetDealsByPieceCidAndStatus(ctx context.Context, piececid cid.Cid, statues ...storagemarket.StorageDealStatus) ([]*types.MinerDeal, error)
 	GetDealByAddrAndStatus(ctx context.Context, addr address.Address, status ...storagemarket.StorageDealStatus) ([]*types.MinerDeal, error)
+	// GetDealsBySectors list the deals assigned to the sectors of the miner, only the deals in the given status are returned if any status is given
+	GetDealsBySectors(ctx context.Context, addr address.Address, sectors []abi.SectorNumber, status ...storagemarket.StorageDealStatus) ([]*types.MinerDeal, error)
 	ListDealByAddr(ctx context.Context, mAddr address.Address) ([]*types.MinerDeal, error)
 	ListDeal(ctx context.Context, params *types.StorageDealQueryParams) ([]*types.MinerDeal, error)
 	GroupStorageDealNumberByStatus(ctx context.Context, mAddr address.Address) (map[storagemarket.StorageDealStatus]int64, error)
@@ -57,6 +65,43 @@ type StorageDealRepo interface {
 	ListPieceInfoKeys(ctx context.Context) ([]cid.Cid, error)
 }
 
+type DealTransferRepo interface {
+	SaveTransfer(ctx context.Context, transfer *dtypes.DealTransfer) error
+	GetTransfer(ctx context.Context, proposalCid cid.Cid) (*dtypes.DealTransfer, error)
+	UpdateBytesReceived(ctx context.Context, proposalCid cid.Cid, received uint64) error
+	// ListTransfer list transfers by state, if no state is given, return all transfers
+	ListTransfer(ctx context.Context, states ...dtypes.TransferState) ([]*dtypes.DealTransfer, error)
+}
+
+type DealOptionsRepo interface {
+	SaveDealOptions(ctx context.Context, options *dtypes.DealOptions) error
+	// GetDealOptions returns ErrNotFound if the options of the deal are not saved
+	GetDealOptions(ctx context.Context, proposalCid cid.Cid) (*dtypes.DealOptions, error)
+}
+
+type HTTPRetrievalRepo interface {
+	SaveRetrieval(ctx context.Context, retrieval *dtypes.HTTPRetrieval) error
+	GetRetrieval(ctx context.Context, id uuid.UUID) (*dtypes.HTTPRetrieval, error)
+	// ListRetrieval lists the records matching the params, the latest records come first
+	ListRetrieval(ctx context.Context, params *dtypes.HTTPRetrievalQueryParams) ([]*dtypes.HTTPRetrieval, error)
+	// RemoveRetrievalBefore removes the records created before the given time, and returns the number of removed records
+	RemoveRetrievalBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+type PublishMessageRepo interface {
+	SavePublishMessage(ctx context.Context, msg *dtypes.PublishMessage) error
+	// ListPublishMessage lists the pending messages and the messages updated after the given time in the order of pushing
+	ListPublishMessage(ctx context.Context, updatedAfter time.Time) ([]*dtypes.PublishMessage, error)
+}
+
+type PieceVerifyRepo interface {
+	SaveVerification(ctx context.Context, verification *dtypes.PieceVerification) error
+	// GetVerification get the verification of the piece in the storage, a piece may be verified in several storages
+	GetVerification(ctx context.Context, pieceCid cid.Cid, storage string) (*dtypes.PieceVerification, error)
+	// ListVerification list the verifications of the pieces in storage, if storage is empty, return all verifications
+	ListVerification(ctx context.Context, storage string) ([]*dtypes.PieceVerification, error)
+}
+
 type IRetrievalDealRepo interface {
 	SaveDeal(context.Context, *types.ProviderDealState) error
 	GetDeal(context.Context, peer.ID, retrievalmarket.DealID) (*types.ProviderDealState, error)
@@ -118,6 +163,11 @@ type Repo interface {
 	RetrievalDealRepo() IRetrievalDealRepo
 	ShardRepo() IShardRepo
 	DirectDealRepo() DirectDealRepo
+	DealTransferRepo() DealTransferRepo
+	PieceVerifyRepo() PieceVerifyRepo
+	DealOptionsRepo() DealOptionsRepo
+	HTTPRetrievalRepo() HTTPRetrievalRepo
+	PublishMessageRepo() PublishMessageRepo
 	Close() error
 	Migrate() error
 	Transaction(func(txRepo TxRepo) error) error
@@ -140,6 +190,7 @@ type DirectDealRepo interface {
 	GetDeal(ctx context.Context, id uuid.UUID) (*types.DirectDeal, error)
 	GetDealByAllocationID(ctx context.Context, id uint64) (*types.DirectDeal, error)
 	GetDealsByMinerAndState(ctx context.Context, miner address.Address, state types.DirectDealState) ([]*types.DirectDeal, error)
+	GetDealsByPieceAndState(ctx context.Context, pieceCID cid.Cid, states ...types.DirectDealState) ([]*types.DirectDeal, error)
 	GetPieceInfo(ctx context.Context, pieceCID cid.Cid) (*piecestore.PieceInfo, error)
 	GetPieceSize(ctx context.Context, pieceCID cid.Cid) (uint64, abi.PaddedPieceSize, error)
 	ListDeal(ctx context.Context, params types.DirectDealQueryParams) ([]*types.DirectDeal, error)
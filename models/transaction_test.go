@@ -0,0 +1,112 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/droplet/v2/models/badger"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+)
+
+func TestTransactionMysql(t *testing.T) {
+	r := MysqlDB(t)
+	defer func() {
+		_ = r.Close()
+	}()
+	testTransaction(t, r)
+}
+
+func TestTransactionBadger(t *testing.T) {
+	testTransaction(t, badger.WrapDbToRepo(BadgerDB(t)))
+}
+
+func getTestDirectDeal(t *testing.T) *types.DirectDeal {
+	return &types.DirectDeal{
+		ID:           uuid.New(),
+		PieceCID:     randCid(t),
+		PieceSize:    1024,
+		Client:       randAddress(t),
+		Provider:     randAddress(t),
+		PayloadSize:  100,
+		PayloadCID:   randCid(t),
+		State:        types.DealAllocated,
+		AllocationID: 10,
+		StartEpoch:   100,
+		EndEpoch:     200,
+	}
+}
+
+func testTransaction(t *testing.T, r repo.Repo) {
+	ctx := context.TODO()
+	errRollback := errors.New("rollback")
+
+	deal := getTestMinerDeal(t)
+	directDeal := getTestDirectDeal(t)
+
+	// all writes are discarded if the callback fails
+	err := r.Transaction(func(txRepo repo.TxRepo) error {
+		require.NoError(t, txRepo.StorageDealRepo().SaveDeal(ctx, deal))
+		require.NoError(t, txRepo.DirectDealRepo().SaveDeal(ctx, directDeal))
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+	_, err = r.StorageDealRepo().GetDeal(ctx, deal.ProposalCid)
+	require.ErrorIs(t, err, repo.ErrNotFound)
+	_, err = r.DirectDealRepo().GetDeal(ctx, directDeal.ID)
+	require.ErrorIs(t, err, repo.ErrNotFound)
+
+	// all writes are committed if the callback succeeds, and they can be read in the transaction
+	err = r.Transaction(func(txRepo repo.TxRepo) error {
+		if err := txRepo.StorageDealRepo().SaveDeal(ctx, deal); err != nil {
+			return err
+		}
+		if err := txRepo.DirectDealRepo().SaveDeal(ctx, directDeal); err != nil {
+			return err
+		}
+		got, err := txRepo.StorageDealRepo().GetDeal(ctx, deal.ProposalCid)
+		if err != nil {
+			return err
+		}
+		require.Equal(t, deal.ProposalCid, got.ProposalCid)
+		return nil
+	})
+	require.NoError(t, err)
+	_, err = r.StorageDealRepo().GetDeal(ctx, deal.ProposalCid)
+	require.NoError(t, err)
+	_, err = r.DirectDealRepo().GetDeal(ctx, directDeal.ID)
+	require.NoError(t, err)
+
+	// the updates of existing deals are rolled back too
+	err = r.Transaction(func(txRepo repo.TxRepo) error {
+		require.NoError(t, txRepo.StorageDealRepo().UpdateDealStatus(ctx, deal.ProposalCid, storagemarket.StorageDealError, ""))
+		require.NoError(t, txRepo.DirectDealRepo().SaveDealWithState(ctx, &types.DirectDeal{
+			ID:           directDeal.ID,
+			PieceCID:     directDeal.PieceCID,
+			PieceSize:    directDeal.PieceSize,
+			Client:       directDeal.Client,
+			Provider:     directDeal.Provider,
+			PayloadSize:  directDeal.PayloadSize,
+			PayloadCID:   directDeal.PayloadCID,
+			State:        types.DealError,
+			AllocationID: directDeal.AllocationID,
+			StartEpoch:   directDeal.StartEpoch,
+			EndEpoch:     directDeal.EndEpoch,
+		}, types.DealAllocated))
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	gotDeal, err := r.StorageDealRepo().GetDeal(ctx, deal.ProposalCid)
+	require.NoError(t, err)
+	require.Equal(t, deal.State, gotDeal.State)
+	gotDirectDeal, err := r.DirectDealRepo().GetDeal(ctx, directDeal.ID)
+	require.NoError(t, err)
+	require.Equal(t, types.DealAllocated, gotDirectDeal.State)
+}
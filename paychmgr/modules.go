@@ -1,7 +1,14 @@
 package paychmgr
 
 import (
+	"go.uber.org/fx"
+
+	"github.com/ipfs-force-community/metrics"
 	"github.com/ipfs-force-community/venus-common-utils/builder"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+
+	v1api "github.com/filecoin-project/venus/venus-shared/api/chain/v1"
 )
 
 var PaychOpts = builder.Options(
@@ -10,3 +17,10 @@ var PaychOpts = builder.Options(
 		return NewPaychAPI(p)
 	}),
 )
+
+// PaychRedeemOpts provides the voucher redeemer of inbound channels, it is only used by droplet
+var PaychRedeemOpts = func(cfg *config.PaychRedeem) builder.Option {
+	return builder.Override(new(*Redeemer), func(mctx metrics.MetricsCtx, lc fx.Lifecycle, mgr *Manager, fullNode v1api.FullNode) *Redeemer {
+		return NewRedeemer(mctx, lc, cfg, mgr, fullNode)
+	})
+}
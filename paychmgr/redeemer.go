@@ -0,0 +1,376 @@
+package paychmgr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/ipfs-force-community/metrics"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+
+	lpaych "github.com/filecoin-project/venus/venus-shared/actors/builtin/paych"
+	v1api "github.com/filecoin-project/venus/venus-shared/api/chain/v1"
+	types2 "github.com/filecoin-project/venus/venus-shared/types"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	types3 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+// paychRedeemCheckInterval is the interval to check whether the vouchers of inbound channels should be redeemed
+const paychRedeemCheckInterval = 10 * time.Minute
+
+const (
+	redeemReasonSettling  = "settling"
+	redeemReasonThreshold = "threshold"
+	redeemReasonSchedule  = "schedule"
+)
+
+type redeemerAPI interface {
+	ChainHead(context.Context) (*types2.TipSet, error)
+	GasEstimateMessageGas(context.Context, *types2.Message, *types2.MessageSendSpec, types2.TipSetKey) (*types2.Message, error)
+}
+
+// Redeemer submits the best voucher of each lane of the inbound channels, when the unredeemed value of a channel
+// passes the threshold, the channel is settling or the redeem interval elapses.
+// A voucher is only submitted if its value covers the estimated gas fee by GasRatio times.
+type Redeemer struct {
+	cfg *config.PaychRedeem
+	mgr *Manager
+	api redeemerAPI
+
+	// lk makes sure only one round of redeem is running
+	lk sync.Mutex
+
+	statusLk   sync.Mutex
+	started    time.Time
+	lastRedeem map[address.Address]time.Time
+	lastError  map[address.Address]string
+}
+
+func NewRedeemer(mctx metrics.MetricsCtx, lc fx.Lifecycle, cfg *config.PaychRedeem, mgr *Manager, fullNode v1api.FullNode) *Redeemer {
+	r := &Redeemer{
+		cfg:        cfg,
+		mgr:        mgr,
+		api:        fullNode,
+		started:    time.Now(),
+		lastRedeem: make(map[address.Address]time.Time),
+		lastError:  make(map[address.Address]string),
+	}
+
+	if cfg.Enable {
+		ctx := metrics.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go r.loop(ctx)
+				return nil
+			},
+		})
+	}
+	return r
+}
+
+func (r *Redeemer) loop(ctx context.Context) {
+	ticker := time.NewTicker(paychRedeemCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.redeemAll(ctx); err != nil {
+				log.Errorf("redeem vouchers: %v", err)
+			}
+		case <-ctx.Done():
+			log.Warnf("exit voucher redeemer by context")
+			return
+		}
+	}
+}
+
+// Status returns the unredeemed value of the inbound channels
+func (r *Redeemer) Status(ctx context.Context) ([]types3.PaychRedeemStatus, error) {
+	channels, err := r.inboundChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]types3.PaychRedeemStatus, 0, len(channels))
+	for _, ci := range channels {
+		status, _, err := r.channelStatus(ctx, ci)
+		if err != nil {
+			return nil, fmt.Errorf("get redeem status of channel %s: %w", ci.Channel, err)
+		}
+		out = append(out, *status)
+	}
+	return out, nil
+}
+
+// Redeem submits the best vouchers of the channel regardless of the policy, the vouchers which don't cover the gas fee are skipped
+func (r *Redeemer) Redeem(ctx context.Context, ch address.Address) (*types3.PaychRedeemResult, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	ci, err := r.mgr.GetChannelInfo(ctx, ch)
+	if err != nil {
+		return nil, err
+	}
+	if ci.Direction != types.DirInbound {
+		return nil, fmt.Errorf("channel %s is not an inbound channel", ch)
+	}
+
+	_, vouchers, err := r.channelStatus(ctx, ci)
+	if err != nil {
+		return nil, err
+	}
+	return r.redeemChannel(ctx, ci, vouchers, 1)
+}
+
+func (r *Redeemer) redeemAll(ctx context.Context) error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	head, err := r.api.ChainHead(ctx)
+	if err != nil {
+		return err
+	}
+
+	channels, err := r.inboundChannels(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, ci := range channels {
+		status, vouchers, err := r.channelStatus(ctx, ci)
+		if err != nil {
+			log.Errorf("get redeem status of channel %s: %v", ci.Channel, err)
+			continue
+		}
+
+		reason := redeemReason(r.cfg, status, head.Height(), time.Now())
+		if len(reason) == 0 {
+			continue
+		}
+
+		ratio := r.cfg.GasRatio
+		// the vouchers are lost after settlement, redeem them as long as they cover the gas fee
+		if reason == redeemReasonSettling || ratio < 1 {
+			ratio = 1
+		}
+		res, err := r.redeemChannel(ctx, ci, vouchers, ratio)
+		if err != nil {
+			log.Errorf("redeem vouchers of channel %s by %s: %v", ci.Channel, reason, err)
+			continue
+		}
+		log.Infow("redeem vouchers", "channel", ci.Channel, "reason", reason, "messages", len(res.Messages),
+			"redeemed", types2.FIL(res.Redeemed).Short(), "skipped", res.Skipped)
+	}
+
+	return nil
+}
+
+// redeemReason returns why the vouchers of the channel should be redeemed now, empty if they should not
+func redeemReason(cfg *config.PaychRedeem, status *types3.PaychRedeemStatus, height abi.ChainEpoch, now time.Time) string {
+	if len(status.Lanes) == 0 {
+		return ""
+	}
+	if status.SettlingAt > 0 && height < status.SettlingAt {
+		return redeemReasonSettling
+	}
+	threshold := abi.TokenAmount(cfg.Threshold)
+	if !threshold.Nil() && threshold.GreaterThan(big.Zero()) && status.Unredeemed.GreaterThanEqual(threshold) {
+		return redeemReasonThreshold
+	}
+	if cfg.Interval > 0 && now.Sub(status.LastRedeem) >= time.Duration(cfg.Interval) {
+		return redeemReasonSchedule
+	}
+	return ""
+}
+
+// worthRedeeming returns true if the value of voucher is at least ratio times the gas fee
+func worthRedeeming(value, fee abi.TokenAmount, ratio float64) bool {
+	minValue := big.Div(big.Mul(fee, big.NewInt(int64(ratio*100))), big.NewInt(100))
+	return value.GreaterThanEqual(minValue)
+}
+
+func (r *Redeemer) redeemChannel(ctx context.Context,
+	ci *types.ChannelInfo,
+	vouchers map[uint64]*types2.SignedVoucher,
+	ratio float64,
+) (*types3.PaychRedeemResult, error) {
+	ch := *ci.Channel
+	res := &types3.PaychRedeemResult{Channel: ch, Redeemed: big.Zero()}
+
+	ca, err := r.mgr.accessorByAddress(ctx, ch)
+	if err != nil {
+		return nil, err
+	}
+	mb, err := ca.messageBuilder(ctx, ci.Control)
+	if err != nil {
+		return nil, err
+	}
+
+	lanes := make([]uint64, 0, len(vouchers))
+	for lane := range vouchers {
+		lanes = append(lanes, lane)
+	}
+	sort.Slice(lanes, func(i, j int) bool { return lanes[i] < lanes[j] })
+
+	_, st, err := ca.sa.loadPaychActorState(ctx, ch)
+	if err != nil {
+		return nil, err
+	}
+	redeemed, err := redeemedByLane(st)
+	if err != nil {
+		return nil, err
+	}
+
+	var redeemErr error
+	for _, lane := range lanes {
+		sv := vouchers[lane]
+		value := big.Sub(sv.Amount, laneRedeemed(redeemed, lane))
+
+		msg, err := mb.Update(ch, sv, nil)
+		if err != nil {
+			redeemErr = err
+			break
+		}
+		estimated, err := r.api.GasEstimateMessageGas(ctx, msg, nil, types2.EmptyTSK)
+		if err != nil {
+			redeemErr = fmt.Errorf("estimate gas of voucher on lane %d: %w", lane, err)
+			break
+		}
+		fee := big.Mul(estimated.GasFeeCap, big.NewInt(estimated.GasLimit))
+		if !worthRedeeming(value, fee, ratio) {
+			log.Debugf("skip voucher on lane %d of channel %s, value %s, estimated fee %s",
+				lane, ch, types2.FIL(value).Short(), types2.FIL(fee).Short())
+			res.Skipped++
+			continue
+		}
+
+		msgCid, err := r.mgr.SubmitVoucher(ctx, ch, sv, nil, nil)
+		if err != nil {
+			redeemErr = fmt.Errorf("submit voucher on lane %d: %w", lane, err)
+			break
+		}
+		res.Messages = append(res.Messages, msgCid)
+		res.Redeemed = big.Add(res.Redeemed, value)
+	}
+
+	r.statusLk.Lock()
+	defer r.statusLk.Unlock()
+	if redeemErr != nil {
+		r.lastError[ch] = redeemErr.Error()
+		return res, redeemErr
+	}
+	delete(r.lastError, ch)
+	r.lastRedeem[ch] = time.Now()
+	return res, nil
+}
+
+func (r *Redeemer) inboundChannels(ctx context.Context) ([]*types.ChannelInfo, error) {
+	addrs, err := r.mgr.ListChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*types.ChannelInfo, 0, len(addrs))
+	for _, addr := range addrs {
+		ci, err := r.mgr.GetChannelInfo(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		if ci.Direction != types.DirInbound || ci.Channel == nil {
+			continue
+		}
+		out = append(out, ci)
+	}
+	return out, nil
+}
+
+// channelStatus returns the unredeemed value of each lane and the best spendable vouchers to redeem it
+func (r *Redeemer) channelStatus(ctx context.Context, ci *types.ChannelInfo) (*types3.PaychRedeemStatus, map[uint64]*types2.SignedVoucher, error) {
+	ch := *ci.Channel
+	ca, err := r.mgr.accessorByAddress(ctx, ch)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, st, err := ca.sa.loadPaychActorState(ctx, ch)
+	if err != nil {
+		return nil, nil, err
+	}
+	settlingAt, err := st.SettlingAt()
+	if err != nil {
+		return nil, nil, err
+	}
+	redeemed, err := redeemedByLane(st)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bestByLane, err := BestSpendableByLane(ctx, NewPaychAPI(r.mgr), ch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	status := &types3.PaychRedeemStatus{
+		Channel:    ch,
+		From:       ci.Target,
+		To:         ci.Control,
+		Unredeemed: big.Zero(),
+		SettlingAt: settlingAt,
+	}
+	vouchers := make(map[uint64]*types2.SignedVoucher, len(bestByLane))
+	for lane, sv := range bestByLane {
+		laneRedeemed := laneRedeemed(redeemed, lane)
+		value := big.Sub(sv.Amount, laneRedeemed)
+		if value.LessThanEqual(big.Zero()) {
+			continue
+		}
+		vouchers[lane] = sv
+		status.Lanes = append(status.Lanes, types3.PaychLaneRedeem{
+			Lane:       lane,
+			Redeemed:   laneRedeemed,
+			Best:       sv.Amount,
+			Unredeemed: value,
+		})
+		status.Unredeemed = big.Add(status.Unredeemed, value)
+	}
+	sort.Slice(status.Lanes, func(i, j int) bool { return status.Lanes[i].Lane < status.Lanes[j].Lane })
+
+	r.statusLk.Lock()
+	status.LastRedeem = r.started
+	if last, ok := r.lastRedeem[ch]; ok {
+		status.LastRedeem = last
+	}
+	status.LastError = r.lastError[ch]
+	r.statusLk.Unlock()
+
+	return status, vouchers, nil
+}
+
+// redeemedByLane returns the amount redeemed on chain of each lane
+func redeemedByLane(st lpaych.State) (map[uint64]abi.TokenAmount, error) {
+	redeemed := make(map[uint64]abi.TokenAmount)
+	err := st.ForEachLaneState(func(idx uint64, ls lpaych.LaneState) error {
+		amt, err := ls.Redeemed()
+		if err != nil {
+			return err
+		}
+		redeemed[idx] = amt
+		return nil
+	})
+	return redeemed, err
+}
+
+func laneRedeemed(redeemed map[uint64]abi.TokenAmount, lane uint64) abi.TokenAmount {
+	if amt, ok := redeemed[lane]; ok {
+		return amt
+	}
+	return big.Zero()
+}
@@ -0,0 +1,63 @@
+package paychmgr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+
+	types2 "github.com/filecoin-project/venus/venus-shared/types"
+	types3 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func TestRedeemReason(t *testing.T) {
+	now := time.Now()
+	cfg := &config.PaychRedeem{
+		Enable:    true,
+		Threshold: types2.MustParseFIL("1"),
+		Interval:  config.Duration(time.Hour),
+		GasRatio:  2,
+	}
+	newStatus := func(unredeemed string, settlingAt abi.ChainEpoch, lastRedeem time.Time) *types3.PaychRedeemStatus {
+		amt := abi.TokenAmount(types2.MustParseFIL(unredeemed))
+		return &types3.PaychRedeemStatus{
+			Lanes:      []types3.PaychLaneRedeem{{Lane: 0, Best: amt, Redeemed: big.Zero(), Unredeemed: amt}},
+			Unredeemed: amt,
+			SettlingAt: settlingAt,
+			LastRedeem: lastRedeem,
+		}
+	}
+
+	cases := []struct {
+		status *types3.PaychRedeemStatus
+		height abi.ChainEpoch
+		reason string
+	}{
+		{status: newStatus("0.1", 0, now), height: 100, reason: ""},
+		{status: newStatus("0.1", 200, now), height: 100, reason: redeemReasonSettling},
+		// the channel is settled, the vouchers can't be redeemed
+		{status: newStatus("0.1", 200, now), height: 300, reason: ""},
+		{status: newStatus("1", 0, now), height: 100, reason: redeemReasonThreshold},
+		{status: newStatus("0.1", 0, now.Add(-2*time.Hour)), height: 100, reason: redeemReasonSchedule},
+		{status: &types3.PaychRedeemStatus{Unredeemed: big.Zero(), SettlingAt: 200}, height: 100, reason: ""},
+	}
+	for i, c := range cases {
+		require.Equal(t, c.reason, redeemReason(cfg, c.status, c.height, now), "case %d", i)
+	}
+
+	// no threshold and schedule
+	require.Empty(t, redeemReason(&config.PaychRedeem{}, newStatus("100", 0, now.Add(-time.Hour)), 100, now))
+}
+
+func TestWorthRedeeming(t *testing.T) {
+	fee := big.NewInt(100)
+	require.True(t, worthRedeeming(big.NewInt(200), fee, 2))
+	require.False(t, worthRedeeming(big.NewInt(199), fee, 2))
+	require.True(t, worthRedeeming(big.NewInt(150), fee, 1.5))
+	require.True(t, worthRedeeming(big.NewInt(100), fee, 1))
+	require.False(t, worthRedeeming(big.NewInt(99), fee, 1))
+}
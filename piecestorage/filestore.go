@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"time"
 
 	"github.com/filecoin-project/dagstore/mount"
 
@@ -13,15 +14,30 @@ import (
 	"github.com/filecoin-project/venus/venus-shared/types/market"
 
 	"github.com/ipfs-force-community/droplet/v2/config"
-	"github.com/ipfs-force-community/droplet/v2/utils"
+)
+
+const (
+	// tempDir is the directory of a fs storage where the resources are written before renamed to the final path
+	tempDir = ".tmp"
+	// staleTempAge is the age of a temp file which is treated as left by a crashed write
+	staleTempAge = 24 * time.Hour
 )
 
 type fsPieceStorage struct {
 	baseUrl string
 	fsCfg   *config.FsPieceStorage
+	// locker is set in shared mode
+	locker *fsLocker
+}
+
+func (f *fsPieceStorage) Len(ctx context.Context, resourceId string) (int64, error) {
+	if err := f.waitUnlocked(ctx, resourceId); err != nil {
+		return 0, err
+	}
+	return f.len(resourceId)
 }
 
-func (f *fsPieceStorage) Len(_ context.Context, resourceId string) (int64, error) {
+func (f *fsPieceStorage) len(resourceId string) (int64, error) {
 	st, err := os.Stat(path.Join(f.baseUrl, resourceId))
 	if err != nil {
 		return 0, err
@@ -47,27 +63,57 @@ func (f *fsPieceStorage) ListResourceIds(_ context.Context) ([]string, error) {
 	return resources, nil
 }
 
-func (f *fsPieceStorage) SaveTo(_ context.Context, resourceId string, r io.Reader) (int64, error) {
+func (f *fsPieceStorage) SaveTo(ctx context.Context, resourceId string, r io.Reader) (int64, error) {
 	if f.fsCfg.ReadOnly {
 		return 0, fmt.Errorf("do not write to a 'readonly' piece store")
 	}
 
+	lk, err := f.lock(ctx, resourceId)
+	if err != nil {
+		return 0, err
+	}
+	defer lk.Unlock()
+
+	// write to a temp file in the storage and rename it, so that a partial resource is never seen by the readers
 	dstPath := path.Join(f.baseUrl, resourceId)
-	tempFile, err := os.CreateTemp("", "piece-*")
+	tempFile, err := os.CreateTemp(path.Join(f.baseUrl, tempDir), resourceId+"-*")
 	if err != nil {
 		return 0, err
 	}
+	defer func() {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+	}()
 
-	defer func() { _ = tempFile.Close() }()
 	wlen, err := io.Copy(tempFile, r)
 	if err != nil {
 		return -1, fmt.Errorf("unable to write file to %s  %w", dstPath, err)
 	}
-	err = utils.Move(tempFile.Name(), dstPath)
-	return wlen, err
+	if err := tempFile.Sync(); err != nil {
+		return -1, fmt.Errorf("unable to sync file %s %w", tempFile.Name(), err)
+	}
+	if lk.Lost() {
+		return -1, fmt.Errorf("lost lock while writing %s: %w", resourceId, ErrResourceLocked)
+	}
+	if err := os.Rename(tempFile.Name(), dstPath); err != nil {
+		return -1, err
+	}
+
+	// a network filesystem may lose or truncate the data silently, check what the readers see
+	l, err := f.len(resourceId)
+	if err != nil {
+		return -1, err
+	}
+	if l != wlen {
+		return -1, fmt.Errorf("length of %s is %d after write, expect %d", resourceId, l, wlen)
+	}
+	return wlen, nil
 }
 
-func (f *fsPieceStorage) GetReaderCloser(_ context.Context, resourceId string) (io.ReadCloser, error) {
+func (f *fsPieceStorage) GetReaderCloser(ctx context.Context, resourceId string) (io.ReadCloser, error) {
+	if err := f.waitUnlocked(ctx, resourceId); err != nil {
+		return nil, err
+	}
 	dstPath := path.Join(f.baseUrl, resourceId)
 	fs, err := os.Open(dstPath)
 	if err != nil {
@@ -76,7 +122,10 @@ func (f *fsPieceStorage) GetReaderCloser(_ context.Context, resourceId string) (
 	return fs, nil
 }
 
-func (f *fsPieceStorage) GetMountReader(_ context.Context, resourceId string) (mount.Reader, error) {
+func (f *fsPieceStorage) GetMountReader(ctx context.Context, resourceId string) (mount.Reader, error) {
+	if err := f.waitUnlocked(ctx, resourceId); err != nil {
+		return nil, err
+	}
 	dstPath := path.Join(f.baseUrl, resourceId)
 	fs, err := os.Open(dstPath)
 	if err != nil {
@@ -85,6 +134,22 @@ func (f *fsPieceStorage) GetMountReader(_ context.Context, resourceId string) (m
 	return fs, nil
 }
 
+// lock takes the lock of the resource in shared mode, it returns a nil lock otherwise
+func (f *fsPieceStorage) lock(ctx context.Context, resourceId string) (*fsLock, error) {
+	if f.locker == nil {
+		return nil, nil
+	}
+	return f.locker.Lock(ctx, resourceId)
+}
+
+// waitUnlocked waits until the resource is not being written or removed by others in shared mode
+func (f *fsPieceStorage) waitUnlocked(ctx context.Context, resourceId string) error {
+	if f.locker == nil {
+		return nil
+	}
+	return f.locker.WaitUnlocked(ctx, resourceId)
+}
+
 func (f *fsPieceStorage) GetRedirectUrl(_ context.Context, _ string) (string, error) {
 	return "", ErrUnsupportRedirect
 }
@@ -142,6 +207,76 @@ func (f *fsPieceStorage) GetStorageStatus() (market.StorageStatus, error) {
 	}, nil
 }
 
+func (f *fsPieceStorage) Quarantine(ctx context.Context, resourceId string) error {
+	if f.fsCfg.ReadOnly {
+		return fmt.Errorf("do not quarantine resource of a 'readonly' piece store")
+	}
+
+	lk, err := f.lock(ctx, resourceId)
+	if err != nil {
+		return err
+	}
+	defer lk.Unlock()
+
+	dir := path.Join(f.baseUrl, quarantineDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	dstPath := path.Join(dir, resourceId)
+	if err := os.Rename(path.Join(f.baseUrl, resourceId), dstPath); err != nil {
+		return err
+	}
+	// the modify time of quarantined file is the time it was quarantined
+	now := time.Now()
+	return os.Chtimes(dstPath, now, now)
+}
+
+func (f *fsPieceStorage) ListQuarantined(_ context.Context) (map[string]time.Time, error) {
+	entries, err := os.ReadDir(path.Join(f.baseUrl, quarantineDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]time.Time{}, nil
+		}
+		return nil, err
+	}
+	resources := make(map[string]time.Time, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		resources[entry.Name()] = info.ModTime()
+	}
+	return resources, nil
+}
+
+func (f *fsPieceStorage) Restore(ctx context.Context, resourceId string) error {
+	lk, err := f.lock(ctx, resourceId)
+	if err != nil {
+		return err
+	}
+	defer lk.Unlock()
+
+	dstPath := path.Join(f.baseUrl, resourceId)
+	if _, err := os.Stat(dstPath); err == nil {
+		return fmt.Errorf("resource %s already exists", resourceId)
+	}
+	return os.Rename(path.Join(f.baseUrl, quarantineDir, resourceId), dstPath)
+}
+
+func (f *fsPieceStorage) RemoveQuarantined(ctx context.Context, resourceId string) error {
+	lk, err := f.lock(ctx, resourceId)
+	if err != nil {
+		return err
+	}
+	defer lk.Unlock()
+
+	return os.Remove(path.Join(f.baseUrl, quarantineDir, resourceId))
+}
+
 func (f *fsPieceStorage) Type() Protocol {
 	return FS
 }
@@ -159,5 +294,35 @@ func NewFsPieceStorage(fsCfg *config.FsPieceStorage) (IPieceStorage, error) {
 	if err := fs.Validate(fsCfg.Path); err != nil {
 		return nil, err
 	}
+	if fsCfg.Shared {
+		fs.locker = newFsLocker(fsCfg.Path, time.Duration(fsCfg.LockLease))
+	}
+	if !fsCfg.ReadOnly {
+		for _, dir := range []string{tempDir, lockDir} {
+			if err := os.MkdirAll(path.Join(fsCfg.Path, dir), 0o755); err != nil {
+				return nil, err
+			}
+		}
+		fs.removeStaleTemp()
+	}
 	return fs, nil
 }
+
+// removeStaleTemp removes the temp files left by the crashed writes,
+// the temp files being written by other instances in shared mode are kept by the modify time
+func (f *fsPieceStorage) removeStaleTemp() {
+	entries, err := os.ReadDir(path.Join(f.baseUrl, tempDir))
+	if err != nil {
+		log.Warnf("unable to list temp files of %s: %v", f.baseUrl, err)
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < staleTempAge {
+			continue
+		}
+		if err := os.Remove(path.Join(f.baseUrl, tempDir, entry.Name())); err != nil {
+			log.Warnf("unable to remove stale temp file %s: %v", entry.Name(), err)
+		}
+	}
+}
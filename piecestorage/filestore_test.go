@@ -7,6 +7,7 @@ import (
 	"os"
 	path2 "path"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -67,3 +68,101 @@ func TestReWrite(t *testing.T) {
 	require.Error(t, err)
 	assert.Nil(t, mounterReader)
 }
+
+func TestFsQuarantine(t *testing.T) {
+	ctx := context.TODO()
+	path := t.TempDir()
+	ifs, err := NewFsPieceStorage(&config.FsPieceStorage{ReadOnly: false, Path: path})
+	require.NoError(t, err)
+
+	name := "piece"
+	_, err = ifs.SaveTo(ctx, name, io.LimitReader(rand.Reader, 100))
+	require.NoError(t, err)
+
+	require.NoError(t, ifs.Quarantine(ctx, name))
+	has, err := ifs.Has(ctx, name)
+	require.NoError(t, err)
+	require.False(t, has)
+	resources, err := ifs.ListResourceIds(ctx)
+	require.NoError(t, err)
+	require.Empty(t, resources)
+
+	quarantined, err := ifs.ListQuarantined(ctx)
+	require.NoError(t, err)
+	require.Len(t, quarantined, 1)
+	require.WithinDuration(t, time.Now(), quarantined[name], time.Minute)
+
+	require.NoError(t, ifs.Restore(ctx, name))
+	l, err := ifs.Len(ctx, name)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), l)
+
+	require.NoError(t, ifs.Quarantine(ctx, name))
+	require.NoError(t, ifs.RemoveQuarantined(ctx, name))
+	quarantined, err = ifs.ListQuarantined(ctx)
+	require.NoError(t, err)
+	require.Empty(t, quarantined)
+}
+
+func TestFsSharedLock(t *testing.T) {
+	ctx := context.TODO()
+	path := t.TempDir()
+	newStorage := func() *fsPieceStorage {
+		ifs, err := NewFsPieceStorage(&config.FsPieceStorage{Path: path, Shared: true, LockLease: config.Duration(300 * time.Millisecond)})
+		require.NoError(t, err)
+		return ifs.(*fsPieceStorage)
+	}
+	a, b := newStorage(), newStorage()
+
+	name := "piece"
+	wlen, err := a.SaveTo(ctx, name, io.LimitReader(rand.Reader, 100))
+	require.NoError(t, err)
+	require.Equal(t, int64(100), wlen)
+	l, err := b.Len(ctx, name)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), l)
+	// the temp file and the lock are removed after write
+	entries, err := os.ReadDir(path2.Join(path, tempDir))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	locked, err := a.locker.Locked(name)
+	require.NoError(t, err)
+	require.False(t, locked)
+
+	// the writes and reads wait for the lock held by another instance
+	lk, err := b.locker.Lock(ctx, name)
+	require.NoError(t, err)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	_, err = a.SaveTo(timeoutCtx, name, io.LimitReader(rand.Reader, 100))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = a.GetReaderCloser(timeoutCtx, name)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	cancel()
+	require.False(t, lk.Lost())
+	lk.Unlock()
+
+	rc, err := a.GetReaderCloser(ctx, name)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+
+	// a stale lock left by a crashed instance is taken over
+	lockPath := a.locker.lockPath(name)
+	require.NoError(t, os.WriteFile(lockPath, []byte("crashed"), 0o644))
+	past := time.Now().Add(-time.Minute)
+	require.NoError(t, os.Chtimes(lockPath, past, past))
+	_, err = a.SaveTo(ctx, name, io.LimitReader(rand.Reader, 200))
+	require.NoError(t, err)
+	l, err = b.Len(ctx, name)
+	require.NoError(t, err)
+	require.Equal(t, int64(200), l)
+
+	// the holder finds the lock lost if it is taken over
+	lk, err = a.locker.Lock(ctx, name)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(lockPath, []byte("other"), 0o644))
+	require.Eventually(t, lk.Lost, time.Second, 10*time.Millisecond)
+	lk.Unlock()
+	content, err := os.ReadFile(lockPath)
+	require.NoError(t, err)
+	require.Equal(t, "other", string(content))
+}
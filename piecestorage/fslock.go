@@ -0,0 +1,231 @@
+package piecestorage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// lockDir is the directory of a shared fs storage where the lock files of the resources are created
+	lockDir = ".lock"
+
+	defaultLockLease = time.Minute
+	// lockWaitTimeout is the max time to wait for a lock held by others
+	lockWaitTimeout  = 5 * time.Minute
+	lockPollInterval = time.Second
+)
+
+// fsLocker protects the writes and removals of the resources in a directory shared by multiple droplet instances.
+// A resource is locked by creating its lock file exclusively, the holder refreshes the modify time of the lock file,
+// and a lock which is not refreshed in the lease is treated as stale and taken over.
+type fsLocker struct {
+	dir   string
+	lease time.Duration
+	owner string
+}
+
+func newFsLocker(baseDir string, lease time.Duration) *fsLocker {
+	if lease <= 0 {
+		lease = defaultLockLease
+	}
+	host, _ := os.Hostname()
+	return &fsLocker{dir: path.Join(baseDir, lockDir), lease: lease, owner: fmt.Sprintf("%s-%d", host, os.Getpid())}
+}
+
+func (l *fsLocker) lockPath(resourceId string) string {
+	return path.Join(l.dir, resourceId+".lock")
+}
+
+// Lock takes the lock of the resource, it waits until the lock is released by others or lockWaitTimeout elapses
+func (l *fsLocker) Lock(ctx context.Context, resourceId string) (*fsLock, error) {
+	lk := &fsLock{
+		path:  l.lockPath(resourceId),
+		token: fmt.Sprintf("%s-%s", l.owner, uuid.NewString()),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	err := l.wait(ctx, resourceId, func() (bool, error) {
+		return l.tryLock(lk.path, lk.token)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go lk.refresh(l.lease / 3)
+	return lk, nil
+}
+
+// WaitUnlocked waits until the resource is not locked, so that the reads don't see a resource being written or removed
+func (l *fsLocker) WaitUnlocked(ctx context.Context, resourceId string) error {
+	return l.wait(ctx, resourceId, func() (bool, error) {
+		locked, err := l.Locked(resourceId)
+		return !locked, err
+	})
+}
+
+// Locked returns whether the resource is locked by a holder within the lease
+func (l *fsLocker) Locked(resourceId string) (bool, error) {
+	_, modTime, err := readLock(l.lockPath(resourceId))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return time.Since(modTime) <= l.lease, nil
+}
+
+func (l *fsLocker) wait(ctx context.Context, resourceId string, try func() (bool, error)) error {
+	timer := time.NewTimer(lockWaitTimeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			return fmt.Errorf("wait for lock of %s: %w", resourceId, ErrResourceLocked)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *fsLocker) tryLock(lockPath, token string) (bool, error) {
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err == nil {
+		_, err = f.WriteString(token)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(lockPath)
+			return false, err
+		}
+		return true, nil
+	}
+	if !os.IsExist(err) {
+		return false, err
+	}
+
+	holder, modTime, err := readLock(lockPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if time.Since(modTime) <= l.lease {
+		return false, nil
+	}
+
+	// move the stale lock aside, only one of the instances taking over the lock succeeds
+	aside := fmt.Sprintf("%s.stale-%s", lockPath, token)
+	if err := os.Rename(lockPath, aside); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	moved, err := os.ReadFile(aside)
+	if err != nil || string(moved) != holder {
+		// the stale lock was replaced by a new holder after the check, give it back
+		_ = os.Link(aside, lockPath)
+		_ = os.Remove(aside)
+		return false, nil
+	}
+	log.Warnf("take over the stale lock %s held by %s since %s", lockPath, holder, modTime)
+	if err := os.Remove(aside); err != nil {
+		return false, err
+	}
+	return l.tryLock(lockPath, token)
+}
+
+// readLock returns the holder and the last refresh time of the lock,
+// the holder is read first so that a replaced lock is never treated as stale
+func readLock(lockPath string) (string, time.Time, error) {
+	holder, err := os.ReadFile(lockPath)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	st, err := os.Stat(lockPath)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return string(holder), st.ModTime(), nil
+}
+
+type fsLock struct {
+	path  string
+	token string
+	lost  atomic.Bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (lk *fsLock) refresh(interval time.Duration) {
+	defer close(lk.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			holder, err := os.ReadFile(lk.path)
+			if err != nil && !os.IsNotExist(err) {
+				log.Warnf("read the lock %s: %v", lk.path, err)
+				continue
+			}
+			if string(holder) != lk.token {
+				log.Errorf("lost the lock %s, it is held by %q now", lk.path, holder)
+				lk.lost.Store(true)
+				return
+			}
+			now := time.Now()
+			if err := os.Chtimes(lk.path, now, now); err != nil {
+				log.Warnf("refresh the lock %s: %v", lk.path, err)
+			}
+		case <-lk.stop:
+			return
+		}
+	}
+}
+
+// Lost returns whether the lock was taken over by others, e.g. the refresh was blocked longer than the lease.
+// It is safe to call on a nil lock, which is returned by a storage not in shared mode.
+func (lk *fsLock) Lost() bool {
+	return lk != nil && lk.lost.Load()
+}
+
+// Unlock stops refreshing the lock and removes the lock file if it is still held
+func (lk *fsLock) Unlock() {
+	if lk == nil {
+		return
+	}
+	close(lk.stop)
+	<-lk.done
+
+	holder, err := os.ReadFile(lk.path)
+	if err != nil || string(holder) != lk.token {
+		return
+	}
+	if err := os.Remove(lk.path); err != nil {
+		log.Errorf("remove the lock %s: %v", lk.path, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/filecoin-project/venus/venus-shared/types/market"
 
@@ -17,6 +18,7 @@ var _ IPieceStorage = (*MemPieceStore)(nil)
 type MemPieceStore struct {
 	Name              string
 	data              map[string][]byte
+	quarantined       map[string]quarantinedData
 	dataLk            *sync.RWMutex
 	status            *market.StorageStatus // status for testing
 	RedirectResources map[string]bool
@@ -25,6 +27,7 @@ type MemPieceStore struct {
 func NewMemPieceStore(name string, status *market.StorageStatus) *MemPieceStore {
 	return &MemPieceStore{
 		data:              make(map[string][]byte),
+		quarantined:       make(map[string]quarantinedData),
 		dataLk:            &sync.RWMutex{},
 		status:            status,
 		Name:              name,
@@ -112,6 +115,53 @@ func (m *MemPieceStore) GetPieceTransfer(context.Context, string) (string, error
 	return "", nil
 }
 
+func (m *MemPieceStore) Quarantine(_ context.Context, resourceId string) error {
+	m.dataLk.Lock()
+	defer m.dataLk.Unlock()
+	data, ok := m.data[resourceId]
+	if !ok {
+		return fmt.Errorf("unable to find resource %s", resourceId)
+	}
+	delete(m.data, resourceId)
+	m.quarantined[resourceId] = quarantinedData{data: data, at: time.Now()}
+	return nil
+}
+
+func (m *MemPieceStore) ListQuarantined(_ context.Context) (map[string]time.Time, error) {
+	m.dataLk.RLock()
+	defer m.dataLk.RUnlock()
+	resources := make(map[string]time.Time, len(m.quarantined))
+	for key, q := range m.quarantined {
+		resources[key] = q.at
+	}
+	return resources, nil
+}
+
+func (m *MemPieceStore) Restore(_ context.Context, resourceId string) error {
+	m.dataLk.Lock()
+	defer m.dataLk.Unlock()
+	q, ok := m.quarantined[resourceId]
+	if !ok {
+		return fmt.Errorf("unable to find quarantined resource %s", resourceId)
+	}
+	if _, ok := m.data[resourceId]; ok {
+		return fmt.Errorf("resource %s already exists", resourceId)
+	}
+	delete(m.quarantined, resourceId)
+	m.data[resourceId] = q.data
+	return nil
+}
+
+func (m *MemPieceStore) RemoveQuarantined(_ context.Context, resourceId string) error {
+	m.dataLk.Lock()
+	defer m.dataLk.Unlock()
+	if _, ok := m.quarantined[resourceId]; !ok {
+		return fmt.Errorf("unable to find quarantined resource %s", resourceId)
+	}
+	delete(m.quarantined, resourceId)
+	return nil
+}
+
 func (m *MemPieceStore) Validate(s string) error {
 	return nil
 }
@@ -120,6 +170,11 @@ func (m *MemPieceStore) ReadOnly() bool {
 	return false
 }
 
+type quarantinedData struct {
+	data []byte
+	at   time.Time
+}
+
 type wraperCloser struct {
 	io.ReadSeeker
 	io.ReaderAt
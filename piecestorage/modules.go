@@ -1,9 +1,11 @@
 package piecestorage
 
 import (
+	"github.com/ipfs-force-community/metrics"
 	"github.com/ipfs-force-community/venus-common-utils/builder"
 
 	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
 )
 
 var SetupPieceStorageMetricsKey = builder.NextInvoke()
@@ -11,8 +13,15 @@ var SetupPieceStorageMetricsKey = builder.NextInvoke()
 var PieceStorageOpts = func(cfg *config.PieceStorage) builder.Option {
 	return builder.Options(
 		// piece
-		builder.Override(new(*PieceStorageManager), func() (*PieceStorageManager, error) {
-			return NewPieceStorageManager(cfg)
+		builder.Override(new(*PieceStorageManager), func(mctx metrics.MetricsCtx, r repo.Repo) (*PieceStorageManager, error) {
+			psm, err := NewPieceStorageManager(cfg)
+			if err != nil {
+				return nil, err
+			}
+			if err := psm.setVerifyRepo(mctx, r.PieceVerifyRepo()); err != nil {
+				return nil, err
+			}
+			return psm, nil
 		}),
 	)
 }
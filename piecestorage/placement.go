@@ -0,0 +1,218 @@
+package piecestorage
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/filecoin-project/go-address"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+)
+
+// PlacementTag is the deal info used by the affinity placement
+type PlacementTag struct {
+	Miner  address.Address
+	Client address.Address
+}
+
+// reservation is the space of a storage promised to a piece which is not written yet
+type reservation struct {
+	storage string
+	size    int64
+}
+
+type placementCandidate struct {
+	storage  IPieceStorage
+	capacity int64
+	free     int64
+	opts     config.StoragePlacement
+}
+
+func checkPlacement(policy string) error {
+	switch policy {
+	case "", config.PlacementRandom, config.PlacementWeighted, config.PlacementLeastUsed, config.PlacementAffinity:
+		return nil
+	default:
+		return fmt.Errorf("unknown piece storage placement %s", policy)
+	}
+}
+
+// Reserve selects a writable storage for the piece with the placement policy and reserves size bytes of it,
+// the space is not available for other pieces until Release is called with the same key
+func (p *PieceStorageManager) Reserve(key string, size int64, tag PlacementTag) (IPieceStorage, error) {
+	p.resLk.Lock()
+	defer p.resLk.Unlock()
+
+	delete(p.reservations, key)
+	st, err := p.selectStorage(size, tag)
+	if err != nil {
+		return nil, err
+	}
+	p.reservations[key] = &reservation{storage: st.GetName(), size: size}
+
+	return st, nil
+}
+
+// ReserveForWrite returns the storage reserved for the key, or reserves size bytes of a storage selected with the
+// placement policy if the key has no reservation. Release must be called with the key after the data is written.
+func (p *PieceStorageManager) ReserveForWrite(key string, size int64, tag PlacementTag) (IPieceStorage, error) {
+	if st, ok := p.ReservedStorage(key); ok {
+		return st, nil
+	}
+	return p.Reserve(key, size, tag)
+}
+
+// ReservedStorage returns the storage reserved for the key
+func (p *PieceStorageManager) ReservedStorage(key string) (IPieceStorage, bool) {
+	p.resLk.Lock()
+	res, ok := p.reservations[key]
+	p.resLk.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	st, err := p.GetPieceStorageByName(res.storage)
+	if err != nil {
+		return nil, false
+	}
+	return st, true
+}
+
+// Release releases the space reserved for the key, it is fine to release a key which is not reserved
+func (p *PieceStorageManager) Release(key string) {
+	p.resLk.Lock()
+	defer p.resLk.Unlock()
+
+	delete(p.reservations, key)
+}
+
+// reservedSpace returns the reserved space of each storage, resLk must be held
+func (p *PieceStorageManager) reservedSpace() map[string]int64 {
+	reserved := make(map[string]int64)
+	for _, res := range p.reservations {
+		reserved[res.storage] += res.size
+	}
+	return reserved
+}
+
+// selectStorage picks a writable storage which has enough space besides the reserved space, resLk must be held
+func (p *PieceStorageManager) selectStorage(size int64, tag PlacementTag) (IPieceStorage, error) {
+	reserved := p.reservedSpace()
+
+	var candidates []*placementCandidate
+	_ = p.EachPieceStorage(func(st IPieceStorage) error {
+		if st.ReadOnly() {
+			return nil
+		}
+		storageSt, err := st.GetStorageStatus()
+		if err != nil {
+			log.Errorf("get available bytes from storage(%s)", st.GetName())
+			return nil
+		}
+		free := storageSt.Available - reserved[st.GetName()]
+		if free > size {
+			candidates = append(candidates, &placementCandidate{
+				storage:  st,
+				capacity: storageSt.Capacity,
+				free:     free,
+				opts:     p.placements[st.GetName()],
+			})
+		}
+		return nil
+	})
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("unable to select a piece storage that have enough space for piece(%d)", size)
+	}
+
+	switch p.placement {
+	case config.PlacementWeighted:
+		return weightedSelector(candidates), nil
+	case config.PlacementLeastUsed:
+		return leastUsedSelector(candidates), nil
+	case config.PlacementAffinity:
+		return leastUsedSelector(affinityFilter(candidates, tag)), nil
+	default:
+		storages := make([]IPieceStorage, 0, len(candidates))
+		for _, c := range candidates {
+			storages = append(storages, c.storage)
+		}
+		return randStorageSelector(storages)
+	}
+}
+
+func weightedSelector(candidates []*placementCandidate) IPieceStorage {
+	weight := func(c *placementCandidate) uint64 {
+		if c.opts.Weight == 0 {
+			return 1
+		}
+		return c.opts.Weight
+	}
+
+	var total uint64
+	for _, c := range candidates {
+		total += weight(c)
+	}
+	n := rand.Uint64() % total
+	for _, c := range candidates {
+		if n < weight(c) {
+			return c.storage
+		}
+		n -= weight(c)
+	}
+	return candidates[len(candidates)-1].storage
+}
+
+// leastUsedSelector picks the storage with the lowest ratio of used space, the storage without capacity
+// such as object storage is treated as unused
+func leastUsedSelector(candidates []*placementCandidate) IPieceStorage {
+	usedRatio := func(c *placementCandidate) float64 {
+		if c.capacity <= 0 {
+			return 0
+		}
+		return float64(c.capacity-c.free) / float64(c.capacity)
+	}
+
+	selected := candidates[0]
+	for _, c := range candidates[1:] {
+		if usedRatio(c) < usedRatio(selected) {
+			selected = c
+		}
+	}
+	return selected.storage
+}
+
+// affinityFilter returns the storages which prefer the miner or client of the deal,
+// then the storages which prefer nobody, then all storages
+func affinityFilter(candidates []*placementCandidate, tag PlacementTag) []*placementCandidate {
+	var matched, general []*placementCandidate
+	for _, c := range candidates {
+		if len(c.opts.Miners) == 0 && len(c.opts.Clients) == 0 {
+			general = append(general, c)
+			continue
+		}
+		if containsAddress(c.opts.Miners, tag.Miner) || containsAddress(c.opts.Clients, tag.Client) {
+			matched = append(matched, c)
+		}
+	}
+
+	if len(matched) != 0 {
+		return matched
+	}
+	if len(general) != 0 {
+		return general
+	}
+	return candidates
+}
+
+func containsAddress(addrs []config.Address, addr address.Address) bool {
+	if addr.Empty() {
+		return false
+	}
+	for _, a := range addrs {
+		if address.Address(a) == addr {
+			return true
+		}
+	}
+	return false
+}
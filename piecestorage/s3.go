@@ -161,6 +161,9 @@ func (s *s3PieceStorage) ListResourceIds(_ context.Context) ([]string, error) {
 	var pieces []string
 	for _, obj := range result.Contents {
 		name := *obj.Key
+		if strings.HasPrefix(name, s.quarantinePrefix()) {
+			continue
+		}
 		if name[len(name)-1] != '/' && obj.Size != nil && *obj.Size != 0 {
 			pieces = append(pieces, strings.TrimPrefix(name, s.subdir))
 		}
@@ -263,6 +266,141 @@ func (s *s3PieceStorage) Validate(_ string) error {
 	return err
 }
 
+// maxCopySize is the max size of object which can be copied in a single operation
+const maxCopySize = 5 << 30
+
+// copyPartSize is the size of each part to copy the object larger than maxCopySize
+const copyPartSize = 1 << 30
+
+func (s *s3PieceStorage) quarantinePrefix() string {
+	return s.subdir + quarantineDir + "/"
+}
+
+func (s *s3PieceStorage) Quarantine(_ context.Context, resourceId string) error {
+	if s.s3Cfg.ReadOnly {
+		return fmt.Errorf("do not quarantine resource of a 'readonly' piece store")
+	}
+	return s.moveObject(s.subdirWrapper(resourceId), s.quarantinePrefix()+resourceId)
+}
+
+func (s *s3PieceStorage) ListQuarantined(_ context.Context) (map[string]time.Time, error) {
+	params := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.quarantinePrefix()),
+	}
+
+	resources := make(map[string]time.Time)
+	err := s.s3Client.ListObjectsV2Pages(params, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			name := strings.TrimPrefix(*obj.Key, s.quarantinePrefix())
+			if len(name) == 0 || strings.Contains(name, "/") || obj.LastModified == nil {
+				continue
+			}
+			// the object is copied to quarantine area, so the last modified time is the time it was quarantined
+			resources[name] = *obj.LastModified
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+func (s *s3PieceStorage) Restore(ctx context.Context, resourceId string) error {
+	if has, err := s.Has(ctx, resourceId); err != nil {
+		return err
+	} else if has {
+		return fmt.Errorf("object %s already exists", s.subdirWrapper(resourceId))
+	}
+	return s.moveObject(s.quarantinePrefix()+resourceId, s.subdirWrapper(resourceId))
+}
+
+func (s *s3PieceStorage) RemoveQuarantined(_ context.Context, resourceId string) error {
+	_, err := s.s3Client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.quarantinePrefix() + resourceId),
+	})
+	return err
+}
+
+// moveObject copies the object to the new key then deletes the old one, s3 has no rename
+func (s *s3PieceStorage) moveObject(src, dst string) error {
+	head, err := s.s3Client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(src),
+	})
+	if err != nil {
+		return fmt.Errorf("head object %s: %w", src, err)
+	}
+
+	copySource := s.bucket + "/" + url.PathEscape(src)
+	if aws.Int64Value(head.ContentLength) <= maxCopySize {
+		_, err = s.s3Client.CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(dst),
+			CopySource: aws.String(copySource),
+		})
+	} else {
+		err = s.multipartCopy(copySource, dst, aws.Int64Value(head.ContentLength))
+	}
+	if err != nil {
+		return fmt.Errorf("copy object %s to %s: %w", src, dst, err)
+	}
+
+	_, err = s.s3Client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(src),
+	})
+	if err != nil {
+		return fmt.Errorf("delete object %s: %w", src, err)
+	}
+	return nil
+}
+
+func (s *s3PieceStorage) multipartCopy(copySource, dst string, size int64) error {
+	upload, err := s.s3Client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(dst),
+	})
+	if err != nil {
+		return err
+	}
+
+	var parts []*s3.CompletedPart
+	for offset, num := int64(0), int64(1); offset < size; offset, num = offset+copyPartSize, num+1 {
+		end := offset + copyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		part, err := s.s3Client.UploadPartCopy(&s3.UploadPartCopyInput{
+			Bucket:          aws.String(s.bucket),
+			Key:             aws.String(dst),
+			UploadId:        upload.UploadId,
+			PartNumber:      aws.Int64(num),
+			CopySource:      aws.String(copySource),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		})
+		if err != nil {
+			_, _ = s.s3Client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(s.bucket),
+				Key:      aws.String(dst),
+				UploadId: upload.UploadId,
+			})
+			return err
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: part.CopyPartResult.ETag, PartNumber: aws.Int64(num)})
+	}
+
+	_, err = s.s3Client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(dst),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	return err
+}
+
 func (s *s3PieceStorage) Type() Protocol {
 	return S3
 }
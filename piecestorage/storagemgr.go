@@ -8,6 +8,8 @@ import (
 
 	types "github.com/filecoin-project/venus/venus-shared/types/market"
 	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs/go-cid"
 )
 
 var ErrorNotFoundForRead = fmt.Errorf("not found for read")
@@ -15,12 +17,38 @@ var ErrorNotFoundForRead = fmt.Errorf("not found for read")
 type PieceStorageManager struct {
 	lk       sync.RWMutex
 	storages map[string]IPieceStorage
+
+	// placement is the policy to choose the storage for write, placements are the options of each storage
+	placement  string
+	placements map[string]config.StoragePlacement
+
+	// resLk must be acquired before lk if both are needed
+	resLk        sync.Mutex
+	reservations map[string]*reservation
+
+	// verifyOnWrite checks the data written against the piece cid, the results are saved to verifyRepo if it is set
+	verifyOnWrite bool
+	verifyRepo    repo.PieceVerifyRepo
+	// corruptedPieces are the storages of the pieces found corrupted, the pieces are not found for read in the storages,
+	// a piece may be corrupted in several storages
+	corruptedLk     sync.RWMutex
+	corruptedPieces map[cid.Cid]map[string]struct{}
 }
 
 func NewPieceStorageManager(cfg *config.PieceStorage) (*PieceStorageManager, error) {
+	if err := checkPlacement(cfg.Placement); err != nil {
+		return nil, err
+	}
+
 	psm := &PieceStorageManager{
-		lk:       sync.RWMutex{},
-		storages: make(map[string]IPieceStorage),
+		lk:           sync.RWMutex{},
+		storages:     make(map[string]IPieceStorage),
+		placement:    cfg.Placement,
+		placements:   make(map[string]config.StoragePlacement),
+		reservations: make(map[string]*reservation),
+
+		verifyOnWrite:   cfg.VerifyOnWrite,
+		corruptedPieces: make(map[cid.Cid]map[string]struct{}),
 	}
 
 	// todo: extract name check logic to a function and check blank in name
@@ -39,6 +67,7 @@ func NewPieceStorageManager(cfg *config.PieceStorage) (*PieceStorageManager, err
 		if err := psm.AddPieceStorage(st); err != nil {
 			return nil, err
 		}
+		psm.placements[fsCfg.Name] = fsCfg.StoragePlacement
 	}
 
 	for _, s3Cfg := range cfg.S3 {
@@ -55,6 +84,7 @@ func NewPieceStorageManager(cfg *config.PieceStorage) (*PieceStorageManager, err
 		if err := psm.AddPieceStorage(st); err != nil {
 			return nil, err
 		}
+		psm.placements[s3Cfg.Name] = s3Cfg.StoragePlacement
 	}
 
 	return psm, nil
@@ -68,7 +98,7 @@ func (p *PieceStorageManager) FindStorageForRead(ctx context.Context, s string)
 			log.Warnf("got error while check available in storage: %s", err.Error())
 			return nil
 		}
-		if has {
+		if has && !p.corrupted(s, st.GetName()) {
 			storages = append(storages, st)
 		}
 		return nil
@@ -81,28 +111,17 @@ func (p *PieceStorageManager) FindStorageForRead(ctx context.Context, s string)
 	return randStorageSelector(storages)
 }
 
+// FindStorageForWrite selects a writable storage with the placement policy, the space reserved by other pieces is excluded
 func (p *PieceStorageManager) FindStorageForWrite(size int64) (IPieceStorage, error) {
-	var storages []IPieceStorage
-	_ = p.EachPieceStorage(func(st IPieceStorage) error {
-		if st.ReadOnly() {
-			return nil
-		}
-		storageSt, err := st.GetStorageStatus()
-		if err != nil {
-			log.Errorf("get available bytes from storage(%s)", st.GetName())
-			return nil
-		}
-		if storageSt.Available > size {
-			storages = append(storages, st)
-		}
-		return nil
-	})
+	return p.FindStorageForWriteWithTag(size, PlacementTag{})
+}
 
-	if len(storages) == 0 {
-		return nil, fmt.Errorf("unable to select a piece storage that have enough space for piece(%d)", size)
-	}
-	// todo better to use argorithems base on stroage capacity and usage
-	return randStorageSelector(storages)
+// FindStorageForWriteWithTag is the same as FindStorageForWrite, and the miner and client of the deal are used by affinity placement
+func (p *PieceStorageManager) FindStorageForWriteWithTag(size int64, tag PlacementTag) (IPieceStorage, error) {
+	p.resLk.Lock()
+	defer p.resLk.Unlock()
+
+	return p.selectStorage(size, tag)
 }
 
 func (p *PieceStorageManager) GetPieceStorageByName(name string) (IPieceStorage, error) {
@@ -168,6 +187,7 @@ func (p *PieceStorageManager) RemovePieceStorage(name string) error {
 		return fmt.Errorf("storage %s not exist", name)
 	}
 	delete(p.storages, name)
+	delete(p.placements, name)
 	return nil
 }
 
@@ -175,12 +195,17 @@ func (p *PieceStorageManager) ListStorageInfos() types.PieceStorageInfos {
 	var fs []types.FsStorage
 	var s3 []types.S3Storage
 
+	p.resLk.Lock()
+	reserved := p.reservedSpace()
+	p.resLk.Unlock()
+
 	_ = p.EachPieceStorage(func(st IPieceStorage) error {
 		status, err := st.GetStorageStatus()
 		if err != nil {
 			log.Errorf("get storage status failed")
 			return nil
 		}
+		status.Reserved = reserved[st.GetName()]
 		switch st.Type() {
 		case S3:
 			cfg := st.(*storeWrapper).IPieceStorage.(*s3PieceStorage).s3Cfg
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/venus/venus-shared/types/market"
 
 	"github.com/ipfs-force-community/droplet/v2/config"
@@ -173,3 +174,107 @@ func TestMultiFormatFiles(t *testing.T) {
 		assert.NoError(t, err)
 	}
 }
+
+func TestReserve(t *testing.T) {
+	psm, err := NewPieceStorageManager(&config.PieceStorage{})
+	assert.Nil(t, err)
+	psm.AddMemPieceStorage(NewMemPieceStore("1", &market.StorageStatus{
+		Capacity:  100,
+		Available: 100,
+	}))
+
+	st, err := psm.Reserve("a", 60, PlacementTag{})
+	assert.Nil(t, err)
+	assert.Equal(t, "1", st.GetName())
+
+	// the reserved space can't be used by others
+	_, err = psm.Reserve("b", 60, PlacementTag{})
+	assert.NotNil(t, err)
+	_, err = psm.FindStorageForWrite(60)
+	assert.NotNil(t, err)
+
+	st, ok := psm.ReservedStorage("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", st.GetName())
+
+	psm.Release("a")
+	_, ok = psm.ReservedStorage("a")
+	assert.False(t, ok)
+	_, err = psm.Reserve("b", 60, PlacementTag{})
+	assert.Nil(t, err)
+
+	// the write of a reserved key uses its reservation, other writes reserve the space while writing
+	st, err = psm.ReserveForWrite("b", 60, PlacementTag{})
+	assert.Nil(t, err)
+	assert.Equal(t, "1", st.GetName())
+	_, err = psm.ReserveForWrite("c", 60, PlacementTag{})
+	assert.NotNil(t, err)
+	psm.Release("b")
+	_, err = psm.ReserveForWrite("c", 60, PlacementTag{})
+	assert.Nil(t, err)
+	_, ok = psm.ReservedStorage("c")
+	assert.True(t, ok)
+}
+
+func TestPlacement(t *testing.T) {
+	addrGetter := address.NewForTestGetter()
+	miner, client := addrGetter(), addrGetter()
+
+	newManager := func(placement string) *PieceStorageManager {
+		psm, err := NewPieceStorageManager(&config.PieceStorage{Placement: placement})
+		assert.Nil(t, err)
+		psm.AddMemPieceStorage(NewMemPieceStore("1", &market.StorageStatus{
+			Capacity:  1000,
+			Available: 800,
+		}))
+		psm.AddMemPieceStorage(NewMemPieceStore("2", &market.StorageStatus{
+			Capacity:  1000,
+			Available: 400,
+		}))
+		return psm
+	}
+
+	_, err := NewPieceStorageManager(&config.PieceStorage{Placement: "unknown"})
+	assert.NotNil(t, err)
+
+	t.Run("least used", func(t *testing.T) {
+		psm := newManager(config.PlacementLeastUsed)
+		st, err := psm.FindStorageForWrite(100)
+		assert.Nil(t, err)
+		assert.Equal(t, "1", st.GetName())
+
+		// storage 1 is used more than storage 2 after reserving
+		_, err = psm.Reserve("a", 500, PlacementTag{})
+		assert.Nil(t, err)
+		st, err = psm.FindStorageForWrite(100)
+		assert.Nil(t, err)
+		assert.Equal(t, "2", st.GetName())
+	})
+
+	t.Run("weighted", func(t *testing.T) {
+		psm := newManager(config.PlacementWeighted)
+		psm.placements["2"] = config.StoragePlacement{Weight: 1000}
+
+		count := map[string]int{}
+		for i := 0; i < 1000; i++ {
+			st, err := psm.FindStorageForWrite(100)
+			assert.Nil(t, err)
+			count[st.GetName()]++
+		}
+		assert.Greater(t, count["2"], count["1"])
+	})
+
+	t.Run("affinity", func(t *testing.T) {
+		psm := newManager(config.PlacementAffinity)
+		psm.placements["2"] = config.StoragePlacement{Miners: []config.Address{config.Address(miner)}}
+
+		st, err := psm.FindStorageForWriteWithTag(100, PlacementTag{Miner: miner, Client: client})
+		assert.Nil(t, err)
+		assert.Equal(t, "2", st.GetName())
+
+		// other miners use the storage without affinity
+		st, err = psm.FindStorageForWriteWithTag(100, PlacementTag{Miner: addrGetter(), Client: client})
+		assert.Nil(t, err)
+		assert.Equal(t, "1", st.GetName())
+	})
+}
@@ -2,8 +2,11 @@ package piecestorage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"time"
 
 	"github.com/filecoin-project/venus/venus-shared/types/market"
 
@@ -12,6 +15,22 @@ import (
 
 var ErrUnsupportRedirect = fmt.Errorf("this storage unsupport redirect url")
 
+// ErrResourceLocked is returned when the resource is being written or removed by another droplet instance
+var ErrResourceLocked = fmt.Errorf("resource is locked by another instance")
+
+// HTTPErrorCode returns the http status code of a piece storage error,
+// the client is asked to retry later if the resource is locked by another droplet instance
+func HTTPErrorCode(w http.ResponseWriter, err error) int {
+	if errors.Is(err, ErrResourceLocked) {
+		w.Header().Set("Retry-After", "60")
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// quarantineDir is the directory of a storage where the resources waiting to be deleted by GC are moved to
+const quarantineDir = ".quarantine"
+
 type Protocol string
 
 const (
@@ -39,4 +58,12 @@ type IPieceStorage interface {
 	Validate(string) error
 	GetStorageStatus() (market.StorageStatus, error)
 	GetPieceTransfer(context.Context, string) (string, error)
+	// Quarantine moves the resource to the quarantine area, it can not be read or listed until restored
+	Quarantine(context.Context, string) error
+	// ListQuarantined lists the quarantined resources and the time they were quarantined
+	ListQuarantined(context.Context) (map[string]time.Time, error)
+	// Restore moves the quarantined resource back
+	Restore(context.Context, string) error
+	// RemoveQuarantined deletes the quarantined resource
+	RemoveQuarantined(context.Context, string) error
 }
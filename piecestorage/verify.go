@@ -0,0 +1,246 @@
+package piecestorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/types"
+	"github.com/ipfs-force-community/droplet/v2/utils"
+)
+
+// ErrPieceMismatch is returned when the data written doesn't hash to the piece cid of the resource
+var ErrPieceMismatch = fmt.Errorf("data doesn't match piece cid")
+
+// verifyReader computes the CommP of the data read through it. It returns an error instead of io.EOF
+// if the data doesn't match the piece, so that the storage drops the data instead of keeping it.
+type verifyReader struct {
+	r         io.Reader
+	w         utils.CommPWriter
+	pieceCid  cid.Cid
+	pieceSize abi.PaddedPieceSize
+
+	n    int64
+	done bool
+	err  error
+}
+
+func newVerifyReader(r io.Reader, pieceCid cid.Cid, pieceSize abi.PaddedPieceSize) *verifyReader {
+	return &verifyReader{r: r, pieceCid: pieceCid, pieceSize: pieceSize}
+}
+
+func (vr *verifyReader) Read(p []byte) (int, error) {
+	if vr.done {
+		if vr.err != nil {
+			return 0, vr.err
+		}
+		return 0, io.EOF
+	}
+
+	n, err := vr.r.Read(p)
+	if n > 0 {
+		vr.n += int64(n)
+		if _, werr := vr.w.Write(p[:n]); werr != nil {
+			vr.done, vr.err = true, fmt.Errorf("%w: %v", ErrPieceMismatch, werr)
+			return n, vr.err
+		}
+	}
+	if err != io.EOF {
+		return n, err
+	}
+
+	vr.done = true
+	match, verr := vr.w.Matches(vr.pieceCid, vr.pieceSize)
+	if verr != nil {
+		vr.err = fmt.Errorf("%w %s: %v", ErrPieceMismatch, vr.pieceCid, verr)
+	} else if !match {
+		vr.err = fmt.Errorf("%w %s", ErrPieceMismatch, vr.pieceCid)
+	}
+	if vr.err != nil {
+		return n, vr.err
+	}
+	return n, io.EOF
+}
+
+// verified reports whether all the data was read and matches the piece
+func (vr *verifyReader) verified() bool {
+	return vr.done && vr.err == nil
+}
+
+// pieceCidOf returns the piece cid which the resource is named by
+func pieceCidOf(resourceId string) (cid.Cid, error) {
+	pieceCid, err := cid.Decode(strings.TrimSuffix(resourceId, carSuffix))
+	if err != nil {
+		return cid.Undef, err
+	}
+	if pieceCid.Prefix().Codec != cid.FilCommitmentUnsealed {
+		return cid.Undef, fmt.Errorf("%s is not a piece cid", pieceCid)
+	}
+	return pieceCid, nil
+}
+
+// SaveTo saves the resource to the storage. If VerifyOnWrite is enabled, the data is checked against the piece cid
+// which the resource is named by while streaming, a mismatched resource is dropped by the storage and rejected.
+// pieceSize is the padded size of the piece, 0 if unknown.
+func (p *PieceStorageManager) SaveTo(ctx context.Context, st IPieceStorage, resourceId string, pieceSize abi.PaddedPieceSize, r io.Reader) (int64, error) {
+	if !p.verifyOnWrite {
+		n, err := st.SaveTo(ctx, resourceId, r)
+		if err == nil {
+			p.clearVerification(ctx, resourceId, st.GetName())
+		}
+		return n, err
+	}
+
+	pieceCid, err := pieceCidOf(resourceId)
+	if err != nil {
+		return 0, fmt.Errorf("%w: resource %s can't be verified: %v", ErrPieceMismatch, resourceId, err)
+	}
+
+	vr := newVerifyReader(r, pieceCid, pieceSize)
+	n, err := st.SaveTo(ctx, resourceId, vr)
+	if vr.err != nil {
+		log.Errorf("reject piece %s written to %s: %v", pieceCid, st.GetName(), vr.err)
+		p.saveVerification(ctx, &types.PieceVerification{
+			PieceCID: pieceCid,
+			Storage:  st.GetName(),
+			State:    types.PieceCorrupted,
+			Size:     vr.n,
+			Message:  vr.err.Error(),
+		})
+		return n, vr.err
+	}
+	if err != nil {
+		return n, err
+	}
+	if !vr.verified() {
+		return n, fmt.Errorf("storage %s didn't read all data of piece %s", st.GetName(), pieceCid)
+	}
+
+	p.saveVerification(ctx, &types.PieceVerification{
+		PieceCID: pieceCid,
+		Storage:  st.GetName(),
+		State:    types.PieceVerified,
+		Size:     vr.n,
+	})
+	return n, nil
+}
+
+// setVerifyRepo sets the repo which the verifications are saved to, the pieces found corrupted before are loaded
+func (p *PieceStorageManager) setVerifyRepo(ctx context.Context, verifyRepo repo.PieceVerifyRepo) error {
+	verifications, err := verifyRepo.ListVerification(ctx, "")
+	if err != nil {
+		return fmt.Errorf("list piece verifications: %w", err)
+	}
+
+	p.corruptedLk.Lock()
+	defer p.corruptedLk.Unlock()
+	p.verifyRepo = verifyRepo
+	for _, verification := range verifications {
+		p.setCorrupted(verification)
+	}
+	return nil
+}
+
+// setCorrupted marks or unmarks the piece in the storage by the verification, corruptedLk must be held
+func (p *PieceStorageManager) setCorrupted(verification *types.PieceVerification) {
+	storages := p.corruptedPieces[verification.PieceCID]
+	if verification.State == types.PieceCorrupted {
+		if storages == nil {
+			storages = make(map[string]struct{})
+			p.corruptedPieces[verification.PieceCID] = storages
+		}
+		storages[verification.Storage] = struct{}{}
+		return
+	}
+
+	delete(storages, verification.Storage)
+	if len(storages) == 0 {
+		delete(p.corruptedPieces, verification.PieceCID)
+	}
+}
+
+// SaveVerification saves the result of checking a piece, a corrupted piece is not found for read in the storage
+// until it is verified again or rewritten
+func (p *PieceStorageManager) SaveVerification(ctx context.Context, verification *types.PieceVerification) error {
+	p.corruptedLk.Lock()
+	p.setCorrupted(verification)
+	p.corruptedLk.Unlock()
+
+	if p.verifyRepo == nil {
+		return nil
+	}
+	return p.verifyRepo.SaveVerification(ctx, verification)
+}
+
+// MarkCorrupted marks the piece in the storage corrupted when its data is found not matching the piece cid
+func (p *PieceStorageManager) MarkCorrupted(ctx context.Context, pieceCid cid.Cid, storage, reason string) {
+	log.Errorf("piece %s in %s is corrupted: %s", pieceCid, storage, reason)
+	p.saveVerification(ctx, &types.PieceVerification{
+		PieceCID: pieceCid,
+		Storage:  storage,
+		State:    types.PieceCorrupted,
+		Message:  reason,
+	})
+}
+
+func (p *PieceStorageManager) saveVerification(ctx context.Context, verification *types.PieceVerification) {
+	if err := p.SaveVerification(ctx, verification); err != nil {
+		log.Warnf("save verification of piece %s: %v", verification.PieceCID, err)
+	}
+}
+
+// corrupted reports whether the piece of the resource is found corrupted in the storage
+func (p *PieceStorageManager) corrupted(resourceId, storage string) bool {
+	pieceCid, err := pieceCidOf(resourceId)
+	if err != nil {
+		return false
+	}
+
+	p.corruptedLk.RLock()
+	defer p.corruptedLk.RUnlock()
+	_, ok := p.corruptedPieces[pieceCid][storage]
+	return ok
+}
+
+// clearVerification resets the verification of the piece which is rewritten without verification,
+// the result of checking the old data doesn't apply to the new data
+func (p *PieceStorageManager) clearVerification(ctx context.Context, resourceId, storage string) {
+	pieceCid, err := pieceCidOf(resourceId)
+	if err != nil {
+		return
+	}
+	if !p.corrupted(resourceId, storage) {
+		verification, err := p.GetVerification(ctx, pieceCid, storage)
+		if err != nil || verification == nil || verification.State != types.PieceVerified {
+			return
+		}
+	}
+	p.saveVerification(ctx, &types.PieceVerification{
+		PieceCID: pieceCid,
+		Storage:  storage,
+		State:    types.PieceUnverified,
+		Message:  "rewritten without verification",
+	})
+}
+
+// GetVerification returns the latest verification of the piece in the storage, repo.ErrNotFound is returned
+// if the piece has not been checked in the storage
+func (p *PieceStorageManager) GetVerification(ctx context.Context, pieceCid cid.Cid, storage string) (*types.PieceVerification, error) {
+	if p.verifyRepo == nil {
+		return nil, repo.ErrNotFound
+	}
+	return p.verifyRepo.GetVerification(ctx, pieceCid, storage)
+}
+
+// ListVerification lists the latest verification of the pieces in the storage, all pieces if storage is empty
+func (p *PieceStorageManager) ListVerification(ctx context.Context, storage string) ([]*types.PieceVerification, error) {
+	if p.verifyRepo == nil {
+		return nil, nil
+	}
+	return p.verifyRepo.ListVerification(ctx, storage)
+}
@@ -0,0 +1,207 @@
+package piecestorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/types"
+)
+
+type verificationKey struct {
+	pieceCid cid.Cid
+	storage  string
+}
+
+type memVerifyRepo struct {
+	verifications map[verificationKey]*types.PieceVerification
+}
+
+func (r *memVerifyRepo) SaveVerification(_ context.Context, verification *types.PieceVerification) error {
+	r.verifications[verificationKey{verification.PieceCID, verification.Storage}] = verification
+	return nil
+}
+
+func (r *memVerifyRepo) GetVerification(_ context.Context, pieceCid cid.Cid, storage string) (*types.PieceVerification, error) {
+	return r.verifications[verificationKey{pieceCid, storage}], nil
+}
+
+func (r *memVerifyRepo) ListVerification(_ context.Context, _ string) ([]*types.PieceVerification, error) {
+	var out []*types.PieceVerification
+	for _, verification := range r.verifications {
+		out = append(out, verification)
+	}
+	return out, nil
+}
+
+func pieceOf(t *testing.T, data []byte, pieceSize abi.PaddedPieceSize) cid.Cid {
+	var calc commp.Calc
+	_, err := calc.Write(data)
+	require.NoError(t, err)
+	rawCommP, paddedSize, err := calc.Digest()
+	require.NoError(t, err)
+	if uint64(pieceSize) > paddedSize {
+		rawCommP, err = commp.PadCommP(rawCommP, paddedSize, uint64(pieceSize))
+		require.NoError(t, err)
+	}
+	pieceCid, err := commcid.DataCommitmentV1ToCID(rawCommP)
+	require.NoError(t, err)
+	return pieceCid
+}
+
+func TestSaveToVerifyOnWrite(t *testing.T) {
+	ctx := context.Background()
+	psm, err := NewPieceStorageManager(&config.PieceStorage{VerifyOnWrite: true})
+	require.NoError(t, err)
+	verifyRepo := &memVerifyRepo{verifications: map[verificationKey]*types.PieceVerification{}}
+	psm.verifyRepo = verifyRepo
+
+	st, err := NewFsPieceStorage(&config.FsPieceStorage{Name: "fs", Path: t.TempDir()})
+	require.NoError(t, err)
+
+	data := make([]byte, 1000)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	t.Run("match", func(t *testing.T) {
+		pieceCid := pieceOf(t, data, 0)
+		n, err := psm.SaveTo(ctx, st, pieceCid.String(), 0, bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), n)
+		has, err := st.Has(ctx, pieceCid.String())
+		require.NoError(t, err)
+		require.True(t, has)
+		require.Equal(t, types.PieceVerified, verifyRepo.verifications[verificationKey{pieceCid, "fs"}].State)
+	})
+
+	t.Run("match padded piece", func(t *testing.T) {
+		pieceCid := pieceOf(t, data, 8<<10)
+		_, err := psm.SaveTo(ctx, st, pieceCid.String(), 8<<10, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		// the piece size is found if not given
+		_, err = psm.SaveTo(ctx, st, pieceCid.String(), 0, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		// the piece size doesn't match
+		_, err = psm.SaveTo(ctx, st, pieceCid.String(), 16<<10, bytes.NewReader(data))
+		require.ErrorIs(t, err, ErrPieceMismatch)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		pieceCid := pieceOf(t, data, 0)
+		corrupted := bytes.Clone(data)
+		corrupted[100]++
+		otherCid := pieceOf(t, corrupted, 0)
+
+		_, err := psm.SaveTo(ctx, st, otherCid.String()+carSuffix, 0, bytes.NewReader(data))
+		require.ErrorIs(t, err, ErrPieceMismatch)
+		has, err := st.Has(ctx, otherCid.String()+carSuffix)
+		require.NoError(t, err)
+		require.False(t, has)
+		require.Equal(t, types.PieceCorrupted, verifyRepo.verifications[verificationKey{otherCid, "fs"}].State)
+
+		// the existing piece is kept if the rewrite is rejected
+		_, err = psm.SaveTo(ctx, st, pieceCid.String(), 0, bytes.NewReader(corrupted))
+		require.ErrorIs(t, err, ErrPieceMismatch)
+		l, err := st.Len(ctx, pieceCid.String())
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), l)
+
+		// too little data to be a piece
+		_, err = psm.SaveTo(ctx, st, pieceCid.String(), 0, bytes.NewReader(data[:10]))
+		require.ErrorIs(t, err, ErrPieceMismatch)
+
+		// not named by a piece cid
+		_, err = psm.SaveTo(ctx, st, "resource", 0, bytes.NewReader(data))
+		require.ErrorIs(t, err, ErrPieceMismatch)
+	})
+}
+
+func TestCorruptedReplicas(t *testing.T) {
+	ctx := context.Background()
+	psm, err := NewPieceStorageManager(&config.PieceStorage{})
+	require.NoError(t, err)
+
+	data := make([]byte, 1000)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+	pieceCid := pieceOf(t, data, 0)
+
+	for _, name := range []string{"a", "b"} {
+		st := NewMemPieceStore(name, nil)
+		_, err := st.SaveTo(ctx, pieceCid.String(), bytes.NewReader(data))
+		require.NoError(t, err)
+		psm.AddMemPieceStorage(st)
+	}
+	mark := func(storage string, state types.PieceVerifyState) {
+		require.NoError(t, psm.SaveVerification(ctx, &types.PieceVerification{PieceCID: pieceCid, Storage: storage, State: state}))
+	}
+	readFrom := func() string {
+		st, err := psm.FindStorageForRead(ctx, pieceCid.String())
+		require.NoError(t, err)
+		return st.GetName()
+	}
+
+	mark("a", types.PieceCorrupted)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, "b", readFrom())
+	}
+
+	// the copy in a is still excluded after the copy in b is found corrupted
+	mark("b", types.PieceCorrupted)
+	_, err = psm.FindStorageForRead(ctx, pieceCid.String())
+	require.ErrorIs(t, err, ErrorNotFoundForRead)
+
+	mark("b", types.PieceVerified)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, "b", readFrom())
+	}
+	require.True(t, psm.corrupted(pieceCid.String(), "a"))
+
+	// a rewrite without verification clears the mark of the storage only
+	_, err = psm.SaveTo(ctx, psm.storages["a"], pieceCid.String(), 0, bytes.NewReader(data))
+	require.NoError(t, err)
+	require.False(t, psm.corrupted(pieceCid.String(), "a"))
+	require.Empty(t, psm.corruptedPieces)
+}
+
+func TestRewriteWithoutVerification(t *testing.T) {
+	ctx := context.Background()
+	psm, err := NewPieceStorageManager(&config.PieceStorage{})
+	require.NoError(t, err)
+	verifyRepo := &memVerifyRepo{verifications: map[verificationKey]*types.PieceVerification{}}
+	psm.verifyRepo = verifyRepo
+
+	st := NewMemPieceStore("mem", nil)
+	psm.AddMemPieceStorage(st)
+
+	data := make([]byte, 1000)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+	pieceCid := pieceOf(t, data, 0)
+
+	// the piece isn't checked yet, nothing is saved
+	_, err = psm.SaveTo(ctx, st, pieceCid.String(), 0, bytes.NewReader(data))
+	require.NoError(t, err)
+	_, err = psm.GetVerification(ctx, pieceCid, "mem")
+	require.NoError(t, err)
+	require.Empty(t, verifyRepo.verifications)
+
+	// the verified mark doesn't apply to the new data
+	require.NoError(t, psm.SaveVerification(ctx, &types.PieceVerification{PieceCID: pieceCid, Storage: "mem", State: types.PieceVerified}))
+	_, err = psm.SaveTo(ctx, st, pieceCid.String(), 0, bytes.NewReader(data))
+	require.NoError(t, err)
+	verification, err := psm.GetVerification(ctx, pieceCid, "mem")
+	require.NoError(t, err)
+	require.Equal(t, types.PieceUnverified, verification.State)
+}
@@ -0,0 +1,43 @@
+package bitswap
+
+import (
+	"context"
+	"errors"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	bstore "github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+// notFoundBlockstore returns ipld ErrNotFound for the blocks which are not indexed by the dagstore,
+// bitswap only answers DONT_HAVE for ErrNotFound. The other errors, eg. the piece can't be read, are returned as is.
+type notFoundBlockstore struct {
+	bstore.Blockstore
+}
+
+func (bs *notFoundBlockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := bs.Blockstore.Get(ctx, c)
+	if isNotFound(err) {
+		return nil, format.ErrNotFound{Cid: c}
+	}
+	return blk, err
+}
+
+func (bs *notFoundBlockstore) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	size, err := bs.Blockstore.GetSize(ctx, c)
+	if isNotFound(err) {
+		return 0, format.ErrNotFound{Cid: c}
+	}
+	return size, err
+}
+
+// isNotFound tells whether the error means the block is unknown to the dagstore
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	return format.IsNotFound(err) || errors.Is(err, ds.ErrNotFound) || errors.Is(err, retrievalmarket.ErrNotFound)
+}
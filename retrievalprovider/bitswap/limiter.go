@@ -0,0 +1,77 @@
+package bitswap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// maxIdlePeers is the number of peers kept by the limiter before the refilled buckets are dropped
+const maxIdlePeers = 1024
+
+// peerLimiter limits the blocks requested by each peer with a token bucket,
+// the blocks above the limit are answered with DONT_HAVE
+type peerLimiter struct {
+	rate  float64
+	burst float64
+
+	lk    sync.Mutex
+	peers map[peer.ID]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newPeerLimiter(rate float64, burst int) *peerLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &peerLimiter{rate: rate, burst: float64(burst), peers: make(map[peer.ID]*bucket)}
+}
+
+// Allow is the block request filter of bitswap server
+func (l *peerLimiter) Allow(p peer.ID, c cid.Cid) bool {
+	if l.allow(p, time.Now()) {
+		return true
+	}
+	log.Debugf("peer %s reached the rate limit, request of block %s is rejected", p, c)
+	return false
+}
+
+func (l *peerLimiter) allow(p peer.ID, now time.Time) bool {
+	if l.rate <= 0 {
+		return true
+	}
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	b, ok := l.peers[p]
+	if !ok {
+		if len(l.peers) >= maxIdlePeers {
+			l.dropRefilled(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.peers[p] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// dropRefilled removes the peers whose buckets are full again, they are the same as new peers
+func (l *peerLimiter) dropRefilled(now time.Time) {
+	for p, b := range l.peers {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.peers, p)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package bitswap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerLimiter(t *testing.T) {
+	now := time.Now()
+	p1, p2 := peer.ID("p1"), peer.ID("p2")
+
+	// no limit
+	l := newPeerLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		require.True(t, l.allow(p1, now))
+	}
+
+	l = newPeerLimiter(2, 3)
+	for i := 0; i < 3; i++ {
+		require.True(t, l.allow(p1, now))
+	}
+	require.False(t, l.allow(p1, now))
+	// the peers are limited separately
+	require.True(t, l.allow(p2, now))
+
+	// 2 tokens are refilled in a second
+	now = now.Add(time.Second)
+	require.True(t, l.allow(p1, now))
+	require.True(t, l.allow(p1, now))
+	require.False(t, l.allow(p1, now))
+
+	// the bucket is never above the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		require.True(t, l.allow(p1, now))
+	}
+	require.False(t, l.allow(p1, now))
+
+	l.dropRefilled(now)
+	require.Len(t, l.peers, 1)
+	l.dropRefilled(now.Add(2 * time.Second))
+	require.Empty(t, l.peers)
+}
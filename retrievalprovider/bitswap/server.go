@@ -0,0 +1,131 @@
+package bitswap
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/filecoin-project/go-fil-markets/stores"
+	bsnetwork "github.com/ipfs/boxo/bitswap/network"
+	"github.com/ipfs/boxo/bitswap/network/bsnet"
+	"github.com/ipfs/boxo/bitswap/server"
+	bstore "github.com/ipfs/boxo/blockstore"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"go.uber.org/fx"
+
+	"github.com/ipfs-force-community/metrics"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/retrievalprovider/httpretrieval"
+	"github.com/ipfs-force-community/droplet/v2/version"
+)
+
+var log = logging.Logger("bitswap-server")
+
+// Server serves the blocks of the deals in the dagstore over bitswap,
+// it runs with the droplet peer or a separate peer if ListenAddresses is configured
+type Server struct {
+	cfg     *config.Bitswap
+	bstore  bstore.Blockstore
+	limiter *peerLimiter
+
+	key      crypto.PrivKey
+	h        host.Host
+	separate bool
+	network  bsnetwork.BitSwapNetwork
+	server   *server.Server
+}
+
+func NewServer(mctx metrics.MetricsCtx,
+	lc fx.Lifecycle,
+	home config.IHome,
+	cfg *config.MarketConfig,
+	h host.Host,
+	dagStore stores.DAGStoreWrapper,
+) (*Server, error) {
+	bcfg := &cfg.Bitswap
+	s := &Server{
+		cfg:     bcfg,
+		bstore:  &notFoundBlockstore{Blockstore: httpretrieval.NewDAGStoreBlockstore(mctx, dagStore)},
+		limiter: newPeerLimiter(bcfg.PeerRateLimit, bcfg.PeerRateBurst),
+		h:       h,
+	}
+	if !bcfg.Enable {
+		return s, nil
+	}
+
+	if len(bcfg.ListenAddresses) > 0 {
+		key, err := PeerKey(home)
+		if err != nil {
+			return nil, err
+		}
+		s.key = key
+	}
+
+	ctx := metrics.LifecycleCtx(mctx, lc)
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			return s.start(ctx)
+		},
+		OnStop: func(context.Context) error {
+			return s.stop()
+		},
+	})
+
+	return s, nil
+}
+
+// GenerateKey generates the marshaled private key of the separate bitswap peer, it's saved in the key file of the repo
+func GenerateKey() ([]byte, error) {
+	pk, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.MarshalPrivateKey(pk)
+}
+
+// PeerKey reads the private key of the separate bitswap peer from the key file of the repo
+func PeerKey(home config.IHome) (crypto.PrivKey, error) {
+	kbytes, err := config.ReadKeyFile(home, config.BitswapKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read the private key of bitswap peer: %w", err)
+	}
+	return crypto.UnmarshalPrivateKey(kbytes)
+}
+
+func (s *Server) start(ctx context.Context) error {
+	if len(s.cfg.ListenAddresses) > 0 {
+		h, err := libp2p.New(
+			libp2p.Identity(s.key),
+			libp2p.ListenAddrStrings(s.cfg.ListenAddresses...),
+			libp2p.UserAgent("droplet-bitswap"+version.UserVersion()),
+		)
+		if err != nil {
+			return fmt.Errorf("create bitswap peer: %w", err)
+		}
+		s.h = h
+		s.separate = true
+	}
+
+	s.network = bsnet.NewFromIpfsHost(s.h)
+	s.server = server.New(ctx, s.network, s.bstore, server.WithPeerBlockRequestFilter(s.limiter.Allow))
+	s.network.Start(s.server)
+	log.Infof("bitswap server started with peer %s on %v", s.h.ID(), s.h.Addrs())
+
+	return nil
+}
+
+func (s *Server) stop() error {
+	if s.server == nil {
+		return nil
+	}
+	s.network.Stop()
+	s.server.Close()
+	if s.separate {
+		return s.h.Close()
+	}
+	return nil
+}
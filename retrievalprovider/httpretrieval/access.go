@@ -0,0 +1,186 @@
+package httpretrieval
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+// the query parameters of the signed urls
+const (
+	signedClientParam    = "client"
+	signedExpiresParam   = "expires"
+	signedSignatureParam = "signature"
+)
+
+var (
+	errNoCredential     = errors.New("a bearer token or a signed url is required")
+	errInvalidSignature = errors.New("invalid signature")
+	errURLExpired       = errors.New("signed url expired")
+	errClientNotAllowed = errors.New("client not allowed")
+)
+
+// PieceAccess authorizes the downloads of pieces when piece access control is enabled,
+// a request is allowed with a bearer token verified by the auth mux of the rpc server,
+// or with a signed url of a deal client of the piece
+type PieceAccess struct {
+	cfg *config.PieceAccess
+	key []byte
+	r   repo.Repo
+}
+
+func NewPieceAccess(home config.IHome, cfg *config.MarketConfig, r repo.Repo) (*PieceAccess, error) {
+	acfg := &cfg.PieceAccess
+	a := &PieceAccess{cfg: acfg, r: r}
+	if !acfg.Enable {
+		return a, nil
+	}
+
+	// the key file is created at startup, see config.InitKeyFile
+	key, err := config.ReadKeyFile(home, config.PieceAccessKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read the sign key of piece access: %w", err)
+	}
+	a.key = key
+
+	return a, nil
+}
+
+// Enabled returns whether the access control is enabled, it's disabled if a is nil
+func (a *PieceAccess) Enabled() bool {
+	return a != nil && a.cfg.Enable
+}
+
+// SignURL mints a signed url of the piece for the client, the lifetime is SignedURLTTL if ttl is 0
+func (a *PieceAccess) SignURL(ctx context.Context, piece cid.Cid, client address.Address, ttl time.Duration) (*types2.SignedPieceURL, error) {
+	if !a.Enabled() {
+		return nil, errors.New("piece access control is disabled")
+	}
+	if err := a.checkClient(ctx, piece, client); err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		ttl = time.Duration(a.cfg.SignedURLTTL)
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	query := url.Values{}
+	query.Set(signedClientParam, client.String())
+	query.Set(signedExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	query.Set(signedSignatureParam, a.sign(piece, client, expires.Unix()))
+	encoded := query.Encode()
+
+	return &types2.SignedPieceURL{
+		PieceCID: piece,
+		Client:   client,
+		Expires:  expires,
+		Query:    encoded,
+		Path:     pieceBasePath + piece.String() + "?" + encoded,
+	}, nil
+}
+
+// Authorize checks the credential of a request of the piece, all requests are allowed if the access control is disabled
+func (a *PieceAccess) Authorize(r *http.Request, piece cid.Cid) error {
+	if !a.Enabled() {
+		return nil
+	}
+	// the auth mux sets the permission of the bearer token after it's verified
+	if core.HasPerm(r.Context(), nil, core.PermRead) {
+		return nil
+	}
+
+	query := r.URL.Query()
+	signature := query.Get(signedSignatureParam)
+	if len(signature) == 0 {
+		return errNoCredential
+	}
+	client, err := address.NewFromString(query.Get(signedClientParam))
+	if err != nil {
+		return fmt.Errorf("%w: parse client: %v", errInvalidSignature, err)
+	}
+	expires, err := strconv.ParseInt(query.Get(signedExpiresParam), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: parse expires: %v", errInvalidSignature, err)
+	}
+	if !hmac.Equal([]byte(signature), []byte(a.sign(piece, client, expires))) {
+		return errInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return errURLExpired
+	}
+
+	// the deals may be terminated or the allowed clients may be changed after the url is signed
+	return a.checkClient(r.Context(), piece, client)
+}
+
+// AuthorizeGateway checks the credential of a request of the trustless gateway, a bearer token is required if the
+// access control is enabled, because the gateway serves the blocks of any piece and the signed urls are only for pieces
+func (a *PieceAccess) AuthorizeGateway(r *http.Request) error {
+	if !a.Enabled() || core.HasPerm(r.Context(), nil, core.PermRead) {
+		return nil
+	}
+	return errNoCredential
+}
+
+// checkClient checks the client is allowed and it's the client of an active storage or direct deal of the piece
+func (a *PieceAccess) checkClient(ctx context.Context, piece cid.Cid, client address.Address) error {
+	if len(a.cfg.AllowedClients) > 0 && !slices.Contains(a.cfg.AllowedClients, config.Address(client)) {
+		return fmt.Errorf("%w: %s is not in the allowed clients", errClientNotAllowed, client)
+	}
+
+	deals, err := a.r.StorageDealRepo().GetDealsByPieceCidAndStatus(ctx, piece, storagemarket.StorageDealActive)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return fmt.Errorf("get storage deals of piece %s: %w", piece, err)
+	}
+	for _, deal := range deals {
+		if deal.Proposal.Client == client {
+			return nil
+		}
+	}
+	directDeals, err := a.r.DirectDealRepo().GetDealsByPieceAndState(ctx, piece, types.DealActive)
+	if err != nil {
+		return fmt.Errorf("get direct deals of piece %s: %w", piece, err)
+	}
+	for _, deal := range directDeals {
+		if deal.Client == client {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s has no active deal of piece %s", errClientNotAllowed, client, piece)
+}
+
+func (a *PieceAccess) sign(piece cid.Cid, client address.Address, expires int64) string {
+	mac := hmac.New(sha256.New, a.key)
+	_, _ = fmt.Fprintf(mac, "%s\n%s\n%d", piece, client, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AccessErrorCode returns the status code of an error of Authorize
+func AccessErrorCode(err error) int {
+	switch {
+	case errors.Is(err, errNoCredential), errors.Is(err, errInvalidSignature), errors.Is(err, errURLExpired):
+		return http.StatusUnauthorized
+	case errors.Is(err, errClientNotAllowed):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,120 @@
+package httpretrieval
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/badger"
+)
+
+func TestPieceAccess(t *testing.T) {
+	ctx := context.Background()
+	r, err := badger.NewMemRepo()
+	assert.NoError(t, err)
+
+	var deal market.MinerDeal
+	testutil.Provide(t, &deal)
+	deal.State = storagemarket.StorageDealActive
+	assert.NoError(t, r.StorageDealRepo().SaveDeal(ctx, &deal))
+	piece, client := deal.Proposal.PieceCID, deal.Proposal.Client
+
+	var other market.MinerDeal
+	testutil.Provide(t, &other)
+	other.State = storagemarket.StorageDealActive
+	assert.NoError(t, r.StorageDealRepo().SaveDeal(ctx, &other))
+
+	cfg := *config.DefaultMarketConfig
+	cfg.HomeDir = t.TempDir()
+	cfg.PieceAccess = config.PieceAccess{
+		Enable:       true,
+		SignedURLTTL: config.Duration(time.Hour),
+	}
+	// the key file is created at startup rather than by the constructor
+	_, err = NewPieceAccess(&cfg, &cfg, r)
+	assert.Error(t, err)
+	assert.NoError(t, config.InitKeyFile(&cfg, config.PieceAccessKeyFile, config.RandKey(32)))
+	a, err := NewPieceAccess(&cfg, &cfg, r)
+	assert.NoError(t, err)
+
+	get := func(ctx context.Context, path string) error {
+		req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+		return a.Authorize(req, piece)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		var disabled *PieceAccess
+		assert.False(t, disabled.Enabled())
+		assert.NoError(t, disabled.Authorize(httptest.NewRequest(http.MethodGet, "/piece/"+piece.String(), nil), piece))
+	})
+
+	t.Run("token", func(t *testing.T) {
+		err := get(ctx, "/piece/"+piece.String())
+		assert.ErrorIs(t, err, errNoCredential)
+		assert.Equal(t, http.StatusUnauthorized, AccessErrorCode(err))
+
+		assert.NoError(t, get(core.CtxWithPerm(ctx, core.PermRead), "/piece/"+piece.String()))
+	})
+
+	t.Run("signed url", func(t *testing.T) {
+		signed, err := a.SignURL(ctx, piece, client, 0)
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), signed.Expires, time.Minute)
+		assert.NoError(t, get(ctx, signed.Path))
+		assert.NoError(t, get(ctx, "/resource?resource-id="+piece.String()+"&"+signed.Query))
+
+		// the signed url of a piece is not valid for other pieces
+		req := httptest.NewRequest(http.MethodGet, signed.Path, nil)
+		assert.ErrorIs(t, a.Authorize(req, other.Proposal.PieceCID), errInvalidSignature)
+
+		query, err := url.ParseQuery(signed.Query)
+		assert.NoError(t, err)
+		query.Set(signedExpiresParam, strconv.FormatInt(signed.Expires.Add(time.Hour).Unix(), 10))
+		assert.ErrorIs(t, get(ctx, "/piece/"+piece.String()+"?"+query.Encode()), errInvalidSignature)
+
+		expires := time.Now().Add(-time.Minute).Unix()
+		query.Set(signedExpiresParam, strconv.FormatInt(expires, 10))
+		query.Set(signedSignatureParam, a.sign(piece, client, expires))
+		assert.ErrorIs(t, get(ctx, "/piece/"+piece.String()+"?"+query.Encode()), errURLExpired)
+	})
+
+	t.Run("client", func(t *testing.T) {
+		// the client of another deal
+		_, err := a.SignURL(ctx, piece, other.Proposal.Client, time.Minute)
+		assert.ErrorIs(t, err, errClientNotAllowed)
+		assert.Equal(t, http.StatusForbidden, AccessErrorCode(err))
+
+		signed, err := a.SignURL(ctx, piece, client, time.Minute)
+		assert.NoError(t, err)
+		cfg.PieceAccess.AllowedClients = []config.Address{config.Address(other.Proposal.Client)}
+		defer func() { cfg.PieceAccess.AllowedClients = nil }()
+		assert.ErrorIs(t, get(ctx, signed.Path), errClientNotAllowed)
+	})
+
+	t.Run("server", func(t *testing.T) {
+		s, err := NewServer(ctx, nil, nil, nil, gzip.NoCompression, ServerOptions{Repo: r, Access: a})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/piece/"+piece.String(), nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// the trustless gateway requires a bearer token too
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ipfs/"+piece.String(), nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NoError(t, a.AuthorizeGateway(httptest.NewRequest(http.MethodGet, "/ipfs/"+piece.String(), nil).WithContext(core.CtxWithPerm(ctx, core.PermRead))))
+	})
+}
@@ -0,0 +1,157 @@
+package httpretrieval
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// maxIdleClients is the number of clients kept by the limiter before the refilled limiters are dropped
+const maxIdleClients = 1024
+
+// clientLimiter limits the bytes sent to each client per second, the requests of a client share its limit
+type clientLimiter struct {
+	bandwidth int64
+
+	lk      sync.Mutex
+	clients map[string]*rate.Limiter
+}
+
+func newClientLimiter(bandwidth int64) *clientLimiter {
+	return &clientLimiter{bandwidth: bandwidth, clients: make(map[string]*rate.Limiter)}
+}
+
+// limiter returns the limiter of the client, nil means no limit
+func (l *clientLimiter) limiter(client string) *rate.Limiter {
+	if l.bandwidth <= 0 {
+		return nil
+	}
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	lim, ok := l.clients[client]
+	if !ok {
+		if len(l.clients) >= maxIdleClients {
+			l.dropRefilled()
+		}
+		// a client can send at most one second of bytes at once
+		burst := int(min(l.bandwidth, math.MaxInt32))
+		lim = rate.NewLimiter(rate.Limit(l.bandwidth), burst)
+		l.clients[client] = lim
+	}
+
+	return lim
+}
+
+// dropRefilled removes the clients whose limiters are full again, they are the same as new clients
+func (l *clientLimiter) dropRefilled() {
+	for client, lim := range l.clients {
+		if lim.Tokens() >= float64(lim.Burst()) {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// responseWriter throttles the response with the limiter of the client if it's set,
+// and keeps the status, the number of bytes sent and the error of the response
+type responseWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *rate.Limiter
+
+	status  int
+	written uint64
+	// cutOff is set if the response is terminated early after the body was written
+	cutOff bool
+	err    error
+	// onHeader corrects the headers of a successful response before they are written, it can be nil
+	onHeader func(http.Header)
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.setStatus(status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) setStatus(status int) {
+	w.status = status
+	if w.onHeader != nil && status < http.StatusMultipleChoices {
+		w.onHeader(w.Header())
+	}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.setStatus(http.StatusOK)
+	}
+	n, err := w.write(p)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *responseWriter) write(p []byte) (int, error) {
+	if w.limiter == nil {
+		n, err := w.ResponseWriter.Write(p)
+		w.written += uint64(n)
+		return n, err
+	}
+
+	var total int
+	for len(p) > 0 {
+		chunk := min(len(p), w.limiter.Burst())
+		if err := w.limiter.WaitN(w.ctx, chunk); err != nil {
+			return total, err
+		}
+		n, err := w.ResponseWriter.Write(p[:chunk])
+		total += n
+		w.written += uint64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[chunk:]
+	}
+
+	return total, nil
+}
+
+func (w *responseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// LogError implements frisbii.ErrorLogger, it's called with the errors replied to the client
+func (w *responseWriter) LogError(status int, err error) {
+	w.err = err
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack is used by frisbii to terminate the response when it fails after the body was written
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijack")
+	}
+	w.cutOff = true
+	if w.err == nil {
+		w.err = errors.New("response terminated early")
+	}
+	return hj.Hijack()
+}
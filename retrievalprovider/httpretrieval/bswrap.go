@@ -21,6 +21,8 @@ var _ bstore.Blockstore = (*bsWrap)(nil)
 
 type bsWrap struct {
 	dagStoreWrapper stores.DAGStoreWrapper
+	// pieceFilter tells whether the blocks of a piece can be served, all pieces are served if it's nil
+	pieceFilter func(ctx context.Context, pieceCID cid.Cid) (bool, error)
 }
 
 func newBSWrap(_ context.Context, dagStoreWrapper stores.DAGStoreWrapper) *bsWrap {
@@ -29,8 +31,41 @@ func newBSWrap(_ context.Context, dagStoreWrapper stores.DAGStoreWrapper) *bsWra
 	}
 }
 
-func (bs *bsWrap) Has(ctx context.Context, blockCID cid.Cid) (bool, error) {
+// NewDAGStoreBlockstore returns a read only blockstore over the pieces in the dagstore
+func NewDAGStoreBlockstore(ctx context.Context, dagStoreWrapper stores.DAGStoreWrapper) bstore.Blockstore {
+	return newBSWrap(ctx, dagStoreWrapper)
+}
+
+// withPieceFilter returns a blockstore which only reads the blocks from the pieces passing the filter
+func (bs *bsWrap) withPieceFilter(filter func(ctx context.Context, pieceCID cid.Cid) (bool, error)) *bsWrap {
+	return &bsWrap{
+		dagStoreWrapper: bs.dagStoreWrapper,
+		pieceFilter:     filter,
+	}
+}
+
+// piecesContainingBlock returns the pieces containing the block which pass the piece filter
+func (bs *bsWrap) piecesContainingBlock(ctx context.Context, blockCID cid.Cid) ([]cid.Cid, error) {
 	pieces, err := bs.dagStoreWrapper.GetPiecesContainingBlock(blockCID)
+	if err != nil || bs.pieceFilter == nil {
+		return pieces, err
+	}
+
+	allowed := make([]cid.Cid, 0, len(pieces))
+	for _, piece := range pieces {
+		ok, err := bs.pieceFilter(ctx, piece)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			allowed = append(allowed, piece)
+		}
+	}
+	return allowed, nil
+}
+
+func (bs *bsWrap) Has(ctx context.Context, blockCID cid.Cid) (bool, error) {
+	pieces, err := bs.piecesContainingBlock(ctx, blockCID)
 	if err != nil {
 		return false, err
 	}
@@ -39,7 +74,7 @@ func (bs *bsWrap) Has(ctx context.Context, blockCID cid.Cid) (bool, error) {
 }
 
 func (bs *bsWrap) Get(ctx context.Context, blockCID cid.Cid) (blocks.Block, error) {
-	pieces, err := bs.dagStoreWrapper.GetPiecesContainingBlock(blockCID)
+	pieces, err := bs.piecesContainingBlock(ctx, blockCID)
 	log.Debugf("retrieval get %s, %v", blockCID, pieces)
 
 	// Check if it's an identity cid, if it is, return its digest
@@ -52,7 +87,7 @@ func (bs *bsWrap) Get(ctx context.Context, blockCID cid.Cid) (blocks.Block, erro
 	}
 
 	if len(pieces) == 0 {
-		return nil, fmt.Errorf("no pieces with cid %s found", blockCID)
+		return nil, format.ErrNotFound{Cid: blockCID}
 	}
 
 	// Get a reader over one of the pieces and extract the block
@@ -90,7 +125,7 @@ func (bs *bsWrap) Get(ctx context.Context, blockCID cid.Cid) (blocks.Block, erro
 
 func (bs *bsWrap) GetSize(ctx context.Context, blockCID cid.Cid) (int, error) {
 	// Get the pieces that contain the cid
-	pieces, err := bs.dagStoreWrapper.GetPiecesContainingBlock(blockCID)
+	pieces, err := bs.piecesContainingBlock(ctx, blockCID)
 	if err != nil {
 		return 0, fmt.Errorf("getting pieces containing cid %s: %w", blockCID, err)
 	}
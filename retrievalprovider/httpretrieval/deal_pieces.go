@@ -0,0 +1,123 @@
+package httpretrieval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs/go-cid"
+)
+
+// dealPiecesTTL is how long the deals of a piece are cached, the deals rarely change
+// and the pieces are looked up for every block of a retrieval
+const dealPiecesTTL = time.Minute
+
+// maxCachedPieces is the number of pieces cached before the expired ones are dropped
+const maxCachedPieces = 1024
+
+// pieceDeal is a piece and whether it has active deals
+type pieceDeal struct {
+	piece  cid.Cid
+	active bool
+	// proposal is an active storage deal of the piece, it's undefined if the piece only has direct deals
+	proposal cid.Cid
+
+	expire time.Time
+}
+
+// dealPieces looks up the active storage and direct deals of the pieces
+type dealPieces struct {
+	r repo.Repo
+
+	lk    sync.Mutex
+	cache map[cid.Cid]pieceDeal
+
+	// directPieces are the pieces of the active direct deals, they are listed at once rather than for each piece,
+	// because the direct deals are not indexed by piece in badger
+	directLk     sync.Mutex
+	directPieces map[cid.Cid]struct{}
+	directExpire time.Time
+}
+
+func newDealPieces(r repo.Repo) *dealPieces {
+	return &dealPieces{r: r, cache: make(map[cid.Cid]pieceDeal)}
+}
+
+// active is the piece filter of the blockstore
+func (p *dealPieces) active(ctx context.Context, piece cid.Cid) (bool, error) {
+	pd, err := p.lookup(ctx, piece)
+	if err != nil {
+		return false, err
+	}
+	return pd.active, nil
+}
+
+func (p *dealPieces) lookup(ctx context.Context, piece cid.Cid) (pieceDeal, error) {
+	now := time.Now()
+	p.lk.Lock()
+	pd, ok := p.cache[piece]
+	p.lk.Unlock()
+	if ok && now.Before(pd.expire) {
+		return pd, nil
+	}
+
+	pd = pieceDeal{piece: piece, expire: now.Add(dealPiecesTTL)}
+	deals, err := p.r.StorageDealRepo().GetDealsByPieceCidAndStatus(ctx, piece, storagemarket.StorageDealActive)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return pieceDeal{}, fmt.Errorf("get storage deals of piece %s: %w", piece, err)
+	}
+	if len(deals) > 0 {
+		pd.active = true
+		pd.proposal = deals[0].ProposalCid
+	} else {
+		pd.active, err = p.hasDirectDeal(ctx, piece)
+		if err != nil {
+			return pieceDeal{}, err
+		}
+	}
+
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	if len(p.cache) >= maxCachedPieces {
+		for c, cached := range p.cache {
+			if now.After(cached.expire) {
+				delete(p.cache, c)
+			}
+		}
+	}
+	p.cache[piece] = pd
+
+	return pd, nil
+}
+
+// hasDirectDeal tells whether the piece has active direct deals, the pieces are listed again after dealPiecesTTL
+func (p *dealPieces) hasDirectDeal(ctx context.Context, piece cid.Cid) (bool, error) {
+	p.directLk.Lock()
+	defer p.directLk.Unlock()
+
+	now := time.Now()
+	if p.directPieces == nil || now.After(p.directExpire) {
+		state := types.DealActive
+		deals, err := p.r.DirectDealRepo().ListDeal(ctx, types.DirectDealQueryParams{
+			State: &state,
+			Page:  types.Page{Limit: math.MaxInt32},
+		})
+		if err != nil && !errors.Is(err, repo.ErrNotFound) {
+			return false, fmt.Errorf("list active direct deals: %w", err)
+		}
+		p.directPieces = make(map[cid.Cid]struct{}, len(deals))
+		for _, deal := range deals {
+			p.directPieces[deal.PieceCID] = struct{}{}
+		}
+		p.directExpire = now.Add(dealPiecesTTL)
+	}
+
+	_, ok := p.directPieces[piece]
+	return ok, nil
+}
@@ -0,0 +1,89 @@
+package httpretrieval
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+
+	"github.com/ipfs-force-community/droplet/v2/metrics"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+// recordPruneInterval is the interval of removing the expired records
+const recordPruneInterval = time.Hour
+
+// recorder saves the requests of the http retrieval server, and aggregates them into the metrics
+type recorder struct {
+	// records is nil if the requests are only aggregated into the metrics
+	records repo.HTTPRetrievalRepo
+	// the records older than retention are removed, they are kept forever if it's 0
+	retention time.Duration
+}
+
+func newRecorder(ctx context.Context, r repo.Repo, retention time.Duration) *recorder {
+	rec := &recorder{retention: retention}
+	if r != nil {
+		rec.records = r.HTTPRetrievalRepo()
+	}
+	if rec.records != nil && rec.retention > 0 {
+		go rec.pruneLoop(ctx)
+	}
+	return rec
+}
+
+func (rec *recorder) pruneLoop(ctx context.Context) {
+	ticker := time.NewTicker(recordPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		rec.prune(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// prune removes the records older than the retention
+func (rec *recorder) prune(ctx context.Context) {
+	removed, err := rec.records.RemoveRetrievalBefore(ctx, time.Now().Add(-rec.retention))
+	if err != nil {
+		log.Warnf("remove expired http retrievals: %v", err)
+		return
+	}
+	if removed > 0 {
+		log.Infof("removed %d http retrievals older than %v", removed, rec.retention)
+	}
+}
+
+func (rec *recorder) record(ctx context.Context, retrieval *types2.HTTPRetrieval) {
+	retrieval.ID = uuid.New()
+	ctx = context.WithoutCancel(ctx)
+	rec.count(ctx, retrieval)
+
+	if rec.records == nil {
+		return
+	}
+	if err := rec.records.SaveRetrieval(ctx, retrieval); err != nil {
+		log.Warnf("save http retrieval %s/%s from %s: %v", retrieval.Path, retrieval.PieceCID, retrieval.Client, err)
+	}
+}
+
+// count only aggregates the request into the metrics
+func (rec *recorder) count(ctx context.Context, retrieval *types2.HTTPRetrieval) {
+	mutators := []tag.Mutator{
+		tag.Upsert(metrics.HTTPPathTag, retrieval.Path),
+		tag.Upsert(metrics.StatusTag, strconv.Itoa(retrieval.Status)),
+	}
+	_ = stats.RecordWithTags(ctx, mutators,
+		metrics.HTTPRetrievalCount.M(1),
+		metrics.HTTPRetrievalBytes.M(int64(retrieval.Sent)),
+		metrics.HTTPRetrievalDuration.M(retrieval.Duration.Milliseconds()),
+	)
+}
@@ -13,14 +13,19 @@ import (
 	"time"
 
 	"github.com/NYTimes/gziphandler"
+	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
 	"github.com/filecoin-project/go-fil-markets/stores"
 	"github.com/filecoin-project/go-padreader"
 	"github.com/filecoin-project/go-state-types/abi"
+	gatewayAPIV2 "github.com/filecoin-project/venus/venus-shared/api/gateway/v2"
 	marketAPI "github.com/filecoin-project/venus/venus-shared/api/market/v1"
 	"github.com/filecoin-project/venus/venus-shared/types"
 	marketTypes "github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
 	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
 	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
 	"go.uber.org/zap"
@@ -37,31 +42,130 @@ var errNoOverlap = errors.New("invalid range: failed to overlap")
 
 var log = logging.Logger("httpserver")
 
+// LoadTracker tracks the number of http retrievals being served
+type LoadTracker interface {
+	HTTPStarted()
+	HTTPFinished()
+}
+
 type Server struct {
 	pieceMgr         *piecestorage.PieceStorageManager
 	api              marketAPI.IMarket
 	trustlessHandler *trustlessHandler
+	recorder         *recorder
+	access           *PieceAccess
+	unsealer         *unsealer
+	rdf              config.RetrievalDealFilter
+	loadTracker      LoadTracker
 	compressionLevel int
 }
 
+// ServerOptions are the optional dependencies of the http retrieval server, the zero value disables all of them
+type ServerOptions struct {
+	// GatewayMarketClient unseals the pieces not found in piece storage, unseal is disabled if it's nil
+	GatewayMarketClient gatewayAPIV2.IMarketClient
+	// RetrievalFilter filters the retrievals, they are not filtered if it's nil
+	RetrievalFilter config.RetrievalDealFilter
+	LoadTracker     LoadTracker
+	// Repo saves the records of the requests, they are only aggregated into the metrics if it's nil
+	Repo repo.Repo
+	// Config is the config of the /ipfs/ path, the default one is used if it's nil
+	Config *config.HTTPRetrieval
+	// Access authorizes the requests, the pieces are public if it's nil or disabled
+	Access *PieceAccess
+}
+
 func NewServer(ctx context.Context,
 	pieceMgr *piecestorage.PieceStorageManager,
 	api marketAPI.IMarket,
 	dagStoreWrapper stores.DAGStoreWrapper,
 	compressionLevel int,
+	opts ServerOptions,
 ) (*Server, error) {
-	tlHandler := newTrustlessHandler(ctx, newBSWrap(ctx, dagStoreWrapper), gzip.BestSpeed)
-	return &Server{pieceMgr: pieceMgr, api: api, trustlessHandler: tlHandler, compressionLevel: compressionLevel}, nil
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = &config.HTTPRetrieval{}
+	}
+	rec := newRecorder(ctx, opts.Repo, time.Duration(cfg.RecordRetention))
+	tlHandler := newTrustlessHandler(ctx, dagStoreWrapper, opts.Repo, rec, cfg, gzip.BestSpeed)
+	s := &Server{
+		pieceMgr:         pieceMgr,
+		api:              api,
+		trustlessHandler: tlHandler,
+		recorder:         rec,
+		access:           opts.Access,
+		rdf:              opts.RetrievalFilter,
+		loadTracker:      opts.LoadTracker,
+		compressionLevel: compressionLevel,
+	}
+	if opts.GatewayMarketClient != nil {
+		s.unsealer = newUnsealer(pieceMgr, opts.GatewayMarketClient)
+	}
+	return s, nil
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.loadTracker != nil {
+		s.loadTracker.HTTPStarted()
+		defer s.loadTracker.HTTPFinished()
+	}
+
 	if strings.HasPrefix(r.URL.Path, ipfsBasePath) {
 		log.Debugf("http retrieval by ipfs, path: %s", r.URL.Path)
+		if err := s.access.AuthorizeGateway(r); err != nil {
+			log.Warnf("unauthorized http retrieval from %s: %v", clientAddr(r), err)
+			badResponse(w, AccessErrorCode(err), err)
+			return
+		}
+		if err := s.filterIPFSRetrieval(r); err != nil {
+			log.Warnf("reject http retrieval %s: %v", r.URL.Path, err)
+			badResponse(w, http.StatusForbidden, err)
+			return
+		}
 		s.retrievalByIPFS(w, r)
 		return
 	}
 
-	s.pieceHandler()(w, r)
+	start := time.Now()
+	rw := &responseWriter{ResponseWriter: w, ctx: r.Context()}
+	found := false
+	r = r.WithContext(context.WithValue(r.Context(), pieceFoundKey{}, &found))
+	s.pieceHandler()(rw, r)
+	s.recordPieceRetrieval(r, rw, found, time.Since(start))
+}
+
+// pieceFoundKey is the context key of the flag set by retrievalByPieceCID once the request is authorized and the piece is found,
+// the handler may get a response writer wrapped by the gzip handler, so the flag is passed through the context
+type pieceFoundKey struct{}
+
+func markPieceFound(ctx context.Context) {
+	if found, ok := ctx.Value(pieceFoundKey{}).(*bool); ok {
+		*found = true
+	}
+}
+
+// recordPieceRetrieval records a request on the /piece/ path, the piece is undefined if the path is invalid.
+// Only the requests which are authorized and find the piece are saved, otherwise anyone could grow the records
+// without bound with invalid requests, the others are only counted in the metrics.
+func (s *Server) recordPieceRetrieval(r *http.Request, w *responseWriter, found bool, took time.Duration) {
+	pieceCID, _ := convertPieceCID(r.URL.Path)
+	retrieval := &types2.HTTPRetrieval{
+		Client:   clientAddr(r),
+		Path:     types2.HTTPRetrievalPiece,
+		PieceCID: pieceCID,
+		Range:    r.Header.Get("Range"),
+		Status:   w.statusCode(),
+		Sent:     w.written,
+		Duration: took,
+	}
+	if w.err != nil {
+		retrieval.Message = w.err.Error()
+	}
+	if !found {
+		s.recorder.count(r.Context(), retrieval)
+		return
+	}
+	s.recorder.record(r.Context(), retrieval)
 }
 
 func (s *Server) pieceHandler() http.HandlerFunc {
@@ -89,9 +193,14 @@ func (s *Server) retrievalByPieceCID(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	pieceCIDStr := pieceCID.String()
 	log := log.With("piece cid", pieceCIDStr)
+	if err := s.access.Authorize(r, pieceCID); err != nil {
+		log.Warnf("unauthorized http retrieval from %s: %v", clientAddr(r), err)
+		badResponse(w, AccessErrorCode(err), err)
+		return
+	}
 	log.Infof("start retrieval deal, Range: %s", r.Header.Get("Range"))
 
-	_, err = s.listDealsByPiece(ctx, pieceCIDStr)
+	deals, err := s.listDealsByPiece(ctx, pieceCIDStr)
 	if err != nil {
 		log.Warn(err)
 		// todo: reject request?
@@ -100,18 +209,41 @@ func (s *Server) retrievalByPieceCID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	store, err := s.pieceMgr.FindStorageForRead(ctx, pieceCIDStr)
+	if filterErr := s.filterPieceRetrieval(r, pieceCID, deals, err == nil); filterErr != nil {
+		log.Warnf("reject http retrieval: %v", filterErr)
+		badResponse(w, http.StatusForbidden, filterErr)
+		return
+	}
 	if err != nil {
 		log.Warn(err)
-		// if errors.Is(err, piecestorage.ErrorNotFoundForRead) {
-		// todo: unseal data
-		// }
-		badResponse(w, http.StatusNotFound, err)
-		return
+		if s.unsealer == nil || len(deals) == 0 {
+			badResponse(w, http.StatusNotFound, err)
+			return
+		}
+
+		// unseal the piece to piece storage, then serve the request
+		if err := s.unsealer.Unseal(ctx, pieceCID, deals); err != nil {
+			if errors.Is(err, errUnsealing) {
+				w.Header().Set("Retry-After", strconv.Itoa(int(unsealRetryAfter.Seconds())))
+				badResponse(w, http.StatusServiceUnavailable, err)
+				return
+			}
+			log.Warn(err)
+			badResponse(w, http.StatusInternalServerError, err)
+			return
+		}
+		store, err = s.pieceMgr.FindStorageForRead(ctx, pieceCIDStr)
+		if err != nil {
+			log.Warn(err)
+			badResponse(w, http.StatusNotFound, err)
+			return
+		}
 	}
+	markPieceFound(ctx)
 	len, err := store.Len(ctx, pieceCIDStr)
 	if err != nil {
 		log.Warn(err)
-		badResponse(w, http.StatusInternalServerError, err)
+		badResponse(w, piecestorage.HTTPErrorCode(w, err), err)
 		return
 	}
 	log.Infof("piece size: %v", len)
@@ -119,7 +251,7 @@ func (s *Server) retrievalByPieceCID(w http.ResponseWriter, r *http.Request) {
 	mountReader, err := store.GetMountReader(ctx, pieceCIDStr)
 	if err != nil {
 		log.Warn(err)
-		badResponse(w, http.StatusInternalServerError, err)
+		badResponse(w, piecestorage.HTTPErrorCode(w, err), err)
 		return
 	}
 	defer mountReader.Close() // nolint
@@ -153,6 +285,61 @@ func (s *Server) listDealsByPiece(ctx context.Context, piece string) ([]marketTy
 	return deals, nil
 }
 
+// filterPieceRetrieval runs the retrieval deal filter of the miner who has the piece
+func (s *Server) filterPieceRetrieval(r *http.Request, pieceCID cid.Cid, deals []marketTypes.MinerDeal, unsealed bool) error {
+	if s.rdf == nil {
+		return nil
+	}
+
+	mAddr := address.Undef
+	params := &types2.RetrievalDealParams{
+		Protocol: types2.RetrievalProtocolHTTP,
+		PieceCID: pieceCID,
+		Client:   r.RemoteAddr,
+		Unsealed: unsealed,
+	}
+	for i := range deals {
+		if mAddr.Empty() {
+			mAddr = deals[i].Proposal.Provider
+		}
+		params.Deals = append(params.Deals, types2.NewRetrievalPieceDeal(&deals[i]))
+	}
+
+	return s.runFilter(r.Context(), mAddr, params)
+}
+
+// filterIPFSRetrieval runs the common retrieval deal filter, the piece of the payload is unknown
+func (s *Server) filterIPFSRetrieval(r *http.Request) error {
+	if s.rdf == nil {
+		return nil
+	}
+
+	cidStr := strings.SplitN(strings.TrimPrefix(r.URL.Path, ipfsBasePath), "/", 2)[0]
+	payloadCID, err := cid.Parse(cidStr)
+	if err != nil {
+		// let trustless handler reply the bad request
+		return nil
+	}
+	params := &types2.RetrievalDealParams{
+		Protocol:   types2.RetrievalProtocolHTTP,
+		PayloadCID: payloadCID,
+		Client:     r.RemoteAddr,
+	}
+
+	return s.runFilter(r.Context(), address.Undef, params)
+}
+
+func (s *Server) runFilter(ctx context.Context, mAddr address.Address, params *types2.RetrievalDealParams) error {
+	accepted, reason, err := s.rdf(ctx, mAddr, params)
+	if err != nil {
+		return fmt.Errorf("run retrieval deal filter: %w", err)
+	}
+	if !accepted {
+		return fmt.Errorf("retrieval rejected: %s", reason)
+	}
+	return nil
+}
+
 func isGzipped(res http.ResponseWriter) bool {
 	switch res.(type) {
 	case *gziphandler.GzipResponseWriter, gziphandler.GzipResponseWriterWithCloseNotify:
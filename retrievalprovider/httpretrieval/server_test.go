@@ -8,22 +8,32 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	dagstore2 "github.com/filecoin-project/dagstore"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/filecoin-project/go-padreader"
+	"github.com/filecoin-project/go-state-types/abi"
+	gatewaymock "github.com/filecoin-project/venus/venus-shared/api/gateway/v2/mock"
 	"github.com/filecoin-project/venus/venus-shared/api/market/v1/mock"
 	"github.com/filecoin-project/venus/venus-shared/types"
+	gtypes "github.com/filecoin-project/venus/venus-shared/types/gateway"
 	"github.com/filecoin-project/venus/venus-shared/types/market"
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/ipfs-force-community/droplet/v2/config"
 	"github.com/ipfs-force-community/droplet/v2/dagstore"
+	"github.com/ipfs-force-community/droplet/v2/models/badger"
 	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
 	"github.com/ipfs/go-cid"
 	carindex "github.com/ipld/go-car/v2/index"
 	"github.com/multiformats/go-multihash"
@@ -103,7 +113,7 @@ func TestRetrievalByPiece(t *testing.T) {
 			return append([]market.MinerDeal{}, market.MinerDeal{ClientDealProposal: types.ClientDealProposal{Proposal: types.DealProposal{PieceCID: piece}}}), nil
 		}).AnyTimes()
 
-	s, err := NewServer(ctx, pieceStorage, m, nil, gzip.BestSpeed)
+	s, err := NewServer(ctx, pieceStorage, m, nil, gzip.BestSpeed, ServerOptions{})
 	assert.NoError(t, err)
 	port := "34897"
 	startHTTPServer(ctx, t, port, s)
@@ -197,7 +207,7 @@ func TestTrustless(t *testing.T) {
 	assert.NoError(t, err)
 	close(resch)
 
-	s, err := NewServer(ctx, nil, m, dagStoreWrapper, gzip.BestSpeed)
+	s, err := NewServer(ctx, nil, m, dagStoreWrapper, gzip.BestSpeed, ServerOptions{})
 	assert.NoError(t, err)
 	port := "34898"
 	startHTTPServer(ctx, t, port, s)
@@ -218,6 +228,169 @@ func TestTrustless(t *testing.T) {
 	}
 }
 
+func TestTrustlessActiveDeals(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	piece, err := cid.Decode("baga6ea4seaqa6u2eajfj57t2laudfkdmxmzv4nix255qytfgcr2uoexspketoda")
+	assert.NoError(t, err)
+
+	var blocks []cid.Cid
+	dagStoreWrapper := dagstore.NewMockDagStoreWrapper()
+	f, err := os.Open("./testdata/baga6ea4seaqa6u2eajfj57t2laudfkdmxmzv4nix255qytfgcr2uoexspketoda.full.idx")
+	assert.NoError(t, err)
+	idx, err := carindex.ReadFrom(f)
+	assert.NoError(t, err)
+	err = idx.(carindex.IterableIndex).ForEach(func(mh multihash.Multihash, offset uint64) error {
+		blockCid := cid.NewCidV1(cid.Raw, mh)
+		blocks = append(blocks, blockCid)
+		dagStoreWrapper.AddBlockToPieceIndex(blockCid, piece)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	resch := make(chan dagstore2.ShardResult, 1)
+	err = dagStoreWrapper.RegisterShardWithIndex(ctx, piece, "./testdata/baga6ea4seaqa6u2eajfj57t2laudfkdmxmzv4nix255qytfgcr2uoexspketoda", true, resch, idx)
+	assert.NoError(t, err)
+	close(resch)
+
+	r, err := badger.NewMemRepo()
+	assert.NoError(t, err)
+	cfg := &config.HTTPRetrieval{ActiveDealsOnly: true}
+
+	doAccept := func(port, method, path, accept string) *http.Response {
+		req, err := http.NewRequest(method, fmt.Sprintf("http://127.0.0.1:%s/ipfs/%s", port, path), nil)
+		assert.NoError(t, err)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Body.Close())
+		return resp
+	}
+	do := func(port, method, query string) *http.Response {
+		return doAccept(port, method, blocks[0].String()+query, "application/vnd.ipld.car; version=1; order=dfs; dups=n")
+	}
+
+	// the piece has no active deal
+	s, err := NewServer(ctx, nil, nil, dagStoreWrapper, gzip.BestSpeed, ServerOptions{Repo: r, Config: cfg})
+	assert.NoError(t, err)
+	startHTTPServer(ctx, t, "34902", s)
+	resp := do("34902", http.MethodGet, "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	deal := market.DirectDeal{ID: uuid.New(), PieceCID: piece, PayloadCID: blocks[0], State: market.DealActive}
+	assert.NoError(t, r.DirectDealRepo().SaveDeal(ctx, &deal))
+
+	s, err = NewServer(ctx, nil, nil, dagStoreWrapper, gzip.BestSpeed, ServerOptions{Repo: r, Config: cfg})
+	assert.NoError(t, err)
+	startHTTPServer(ctx, t, "34903", s)
+	resp = do("34903", http.MethodHead, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "application/vnd.ipld.car")
+	assert.NotEmpty(t, resp.Header.Get("Etag"))
+
+	resp = do("34903", http.MethodGet, "?dag-scope=block&entity-bytes=0:*")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the raw block responses have their own filename and etag
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		resp = doAccept("34903", method, blocks[0].String(), "application/vnd.ipld.raw")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("Content-Type"), "application/vnd.ipld.raw")
+		assert.Equal(t, fmt.Sprintf("%q", blocks[0].String()+".raw"), resp.Header.Get("Etag"))
+		assert.Contains(t, resp.Header.Get("Content-Disposition"), blocks[0].String()+".bin")
+	}
+
+	// bad requests, HEAD requests and the requests of unknown roots are not recorded
+	resp = do("34903", http.MethodGet, "?dag-scope=unknown")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	unknown, err := blocks[0].Prefix().Sum([]byte("unknown"))
+	assert.NoError(t, err)
+	resp = doAccept("34903", http.MethodGet, unknown.String(), "application/vnd.ipld.car")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	all, err := r.HTTPRetrievalRepo().ListRetrieval(ctx, &types2.HTTPRetrievalQueryParams{})
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	records, err := r.RetrievalDealRepo().ListDeals(ctx, &market.RetrievalDealQueryParams{
+		PayloadCID: blocks[0].String(),
+		Page:       market.Page{Limit: 10},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	status := map[retrievalmarket.DealStatus]int{}
+	for _, record := range records {
+		status[record.Status]++
+		assert.Equal(t, clientPeerID("127.0.0.1"), record.Receiver)
+		assert.Equal(t, piece, *record.PieceCID)
+	}
+	assert.Equal(t, 1, status[retrievalmarket.DealStatusRejected])
+	assert.Equal(t, 2, status[retrievalmarket.DealStatusCompleted])
+
+	retrievals, err := r.HTTPRetrievalRepo().ListRetrieval(ctx, &types2.HTTPRetrievalQueryParams{
+		PayloadCID: blocks[0].String(),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, retrievals, 3)
+	codes := map[int]int{}
+	for _, retrieval := range retrievals {
+		codes[retrieval.Status]++
+		assert.Equal(t, types2.HTTPRetrievalIPFS, retrieval.Path)
+		assert.Equal(t, "127.0.0.1", retrieval.Client)
+		assert.Equal(t, piece, retrieval.PieceCID)
+	}
+	assert.Equal(t, 1, codes[http.StatusForbidden])
+	assert.Equal(t, 2, codes[http.StatusOK])
+}
+
+func TestRecordPieceRetrieval(t *testing.T) {
+	ctx := context.Background()
+	r, err := badger.NewMemRepo()
+	assert.NoError(t, err)
+
+	tmpDri := t.TempDir()
+	pieceStr := "baga6ea4seaqpzcr744w2rvqhkedfqbuqrbo7xtkde2ol6e26khu3wni64nbpaeq"
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDri, pieceStr), bytes.Repeat([]byte("TEST TEST\n"), 100), 0o644))
+	pieceStorage, err := piecestorage.NewPieceStorageManager(&config.PieceStorage{
+		Fs: []*config.FsPieceStorage{{Name: "test", Path: tmpDri}},
+	})
+	assert.NoError(t, err)
+	m := mock.NewMockIMarket(gomock.NewController(t))
+	m.EXPECT().MarketListIncompleteDeals(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+	s, err := NewServer(ctx, pieceStorage, m, nil, gzip.NoCompression, ServerOptions{Repo: r})
+	assert.NoError(t, err)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Range", "bytes=0-99")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	// the requests of invalid paths and unknown pieces are only counted in the metrics
+	assert.Equal(t, http.StatusBadRequest, serve("/piece/invalid").Code)
+	unknown := "baga6ea4seaqa6u2eajfj57t2laudfkdmxmzv4nix255qytfgcr2uoexspketoda"
+	assert.Equal(t, http.StatusNotFound, serve(pieceBasePath+unknown).Code)
+
+	w := serve(pieceBasePath + pieceStr)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+
+	retrievals, err := r.HTTPRetrievalRepo().ListRetrieval(ctx, &types2.HTTPRetrievalQueryParams{
+		Path: types2.HTTPRetrievalPiece,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, retrievals, 1)
+	assert.Equal(t, http.StatusPartialContent, retrievals[0].Status)
+	assert.Equal(t, "bytes=0-99", retrievals[0].Range)
+	assert.Equal(t, uint64(w.Body.Len()), retrievals[0].Sent)
+	assert.Equal(t, pieceStr, retrievals[0].PieceCID.String())
+}
+
 func TestRetrievalPaddingPiece(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -259,7 +432,7 @@ func TestRetrievalPaddingPiece(t *testing.T) {
 			return append([]market.MinerDeal{}, market.MinerDeal{ClientDealProposal: types.ClientDealProposal{Proposal: types.DealProposal{PieceCID: piece}}}), nil
 		}).AnyTimes()
 
-	s, err := NewServer(ctx, pieceStorage, m, nil, gzip.BestSpeed)
+	s, err := NewServer(ctx, pieceStorage, m, nil, gzip.BestSpeed, ServerOptions{})
 	assert.NoError(t, err)
 	port := "34897"
 	startHTTPServer(ctx, t, port, s)
@@ -303,3 +476,163 @@ func TestRetrievalPaddingPiece(t *testing.T) {
 		assert.Equal(t, c.expect, data)
 	}
 }
+
+func TestRetrievalUnsealPiece(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	oldWaitTimeout, oldCheckInterval := unsealWaitTimeout, unsealCheckInterval
+	unsealWaitTimeout, unsealCheckInterval = 200*time.Millisecond, 100*time.Millisecond
+	defer func() {
+		unsealWaitTimeout, unsealCheckInterval = oldWaitTimeout, oldCheckInterval
+	}()
+
+	tmpDri := t.TempDir()
+	pieceStorage, err := piecestorage.NewPieceStorageManager(&config.PieceStorage{
+		Fs: []*config.FsPieceStorage{{Name: "test", ReadOnly: false, Path: tmpDri}},
+	})
+	assert.NoError(t, err)
+
+	pieceStr := "baga6ea4seaqpzcr744w2rvqhkedfqbuqrbo7xtkde2ol6e26khu3wni64nbpaeq"
+	piece, err := cid.Decode(pieceStr)
+	assert.NoError(t, err)
+	buf := &bytes.Buffer{}
+	for i := 0; i < 100; i++ {
+		buf.WriteString("TEST TEST\n")
+	}
+
+	ctrl := gomock.NewController(t)
+	m := mock.NewMockIMarket(ctrl)
+	m.EXPECT().MarketListIncompleteDeals(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, p *market.StorageDealQueryParams) ([]market.MinerDeal, error) {
+			if p.PieceCID != pieceStr {
+				return nil, fmt.Errorf("not found deal")
+			}
+			deal := market.MinerDeal{ClientDealProposal: types.ClientDealProposal{Proposal: types.DealProposal{PieceCID: piece, PieceSize: 2048}}}
+			deal.SectorNumber = 10
+			return append([]market.MinerDeal{}, deal), nil
+		}).AnyTimes()
+
+	// the sealer finishes the unseal after release is closed
+	release := make(chan struct{})
+	var unsealCalls atomic.Int64
+	gatewayClient := gatewaymock.NewMockIGateway(ctrl)
+	gatewayClient.EXPECT().SectorsUnsealPiece(gomock.Any(), gomock.Any(), piece, abi.SectorNumber(10), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, miner address.Address, pieceCid cid.Cid, sid abi.SectorNumber, offset types.UnpaddedByteIndex, size abi.UnpaddedPieceSize, dest string) (gtypes.UnsealState, error) {
+			unsealCalls.Add(1)
+			<-release
+			assert.NoError(t, os.WriteFile(filepath.Join(tmpDri, pieceStr), buf.Bytes(), 0o644))
+			return gtypes.UnsealStateFinished, nil
+		}).Times(1)
+
+	s, err := NewServer(ctx, pieceStorage, m, nil, gzip.BestSpeed, ServerOptions{GatewayMarketClient: gatewayClient})
+	assert.NoError(t, err)
+	port := "34899"
+	startHTTPServer(ctx, t, port, s)
+
+	url := fmt.Sprintf("http://127.0.0.1:%s/piece/%s", port, pieceStr)
+	get := func() (*http.Response, []byte) {
+		resp, err := http.Get(url)
+		assert.NoError(t, err)
+		defer resp.Body.Close() // nolint
+		data, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp, data
+	}
+
+	// unseal in progress
+	resp, _ := get()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+
+	// requests join the running unseal task rather than asking the sealer again
+	resp, _ = get()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int64(1), unsealCalls.Load())
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		s.unsealer.lk.Lock()
+		defer s.unsealer.lk.Unlock()
+		return len(s.unsealer.tasks) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	resp, data := get()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, buf.Bytes(), data)
+}
+
+func TestRetrievalFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tmpDri := t.TempDir()
+	pieceStorage, err := piecestorage.NewPieceStorageManager(&config.PieceStorage{
+		Fs: []*config.FsPieceStorage{{Name: "test", ReadOnly: false, Path: tmpDri}},
+	})
+	assert.NoError(t, err)
+
+	pieceStr := "baga6ea4seaqpzcr744w2rvqhkedfqbuqrbo7xtkde2ol6e26khu3wni64nbpaeq"
+	piece, err := cid.Decode(pieceStr)
+	assert.NoError(t, err)
+	data := []byte("TEST TEST\n")
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDri, pieceStr), data, 0o644))
+
+	provider := address.NewForTestGetter()()
+	ctrl := gomock.NewController(t)
+	m := mock.NewMockIMarket(ctrl)
+	m.EXPECT().MarketListIncompleteDeals(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, p *market.StorageDealQueryParams) ([]market.MinerDeal, error) {
+			deal := market.MinerDeal{ClientDealProposal: types.ClientDealProposal{Proposal: types.DealProposal{PieceCID: piece, Provider: provider}}}
+			return append([]market.MinerDeal{}, deal), nil
+		}).AnyTimes()
+
+	var reject atomic.Bool
+	var load atomic.Int64
+	rdf := func(ctx context.Context, mAddr address.Address, params *types2.RetrievalDealParams) (bool, string, error) {
+		assert.Equal(t, provider, mAddr)
+		assert.Equal(t, types2.RetrievalProtocolHTTP, params.Protocol)
+		assert.Equal(t, piece, params.PieceCID)
+		assert.True(t, params.Unsealed)
+		assert.Len(t, params.Deals, 1)
+		assert.Equal(t, int64(1), load.Load())
+		if reject.Load() {
+			return false, "rejected by test", nil
+		}
+		return true, "", nil
+	}
+
+	s, err := NewServer(ctx, pieceStorage, m, nil, gzip.NoCompression, ServerOptions{RetrievalFilter: rdf, LoadTracker: &testLoadTracker{n: &load}})
+	assert.NoError(t, err)
+	port := "34900"
+	startHTTPServer(ctx, t, port, s)
+
+	get := func() (*http.Response, []byte) {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%s/piece/%s", port, pieceStr))
+		assert.NoError(t, err)
+		defer resp.Body.Close() // nolint
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp, body
+	}
+
+	resp, body := get()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, data, body[:len(data)])
+
+	reject.Store(true)
+	resp, body = get()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, string(body), "rejected by test")
+}
+
+type testLoadTracker struct {
+	n *atomic.Int64
+}
+
+func (l *testLoadTracker) HTTPStarted() {
+	l.n.Add(1)
+}
+
+func (l *testLoadTracker) HTTPFinished() {
+	l.n.Add(-1)
+}
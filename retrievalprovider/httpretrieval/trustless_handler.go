@@ -2,25 +2,344 @@ package httpretrieval
 
 import (
 	"context"
-	"net/url"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
 	"time"
 
-	bstore "github.com/ipfs/boxo/blockstore"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/stores"
+	"github.com/filecoin-project/go-state-types/big"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-graphsync/storeutil"
 	"github.com/ipld/frisbii"
+	trustlessutils "github.com/ipld/go-trustless-utils"
+	trustlesshttp "github.com/ipld/go-trustless-utils/http"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
 )
 
+var (
+	errNotFoundPiece = errors.New("not found the pieces containing the root")
+	errNoActiveDeal  = errors.New("no active deal of the pieces containing the root")
+)
+
+// trustlessHandler serves the /ipfs/ path according to the trustless gateway specification,
+// the GET requests of the roots in the dagstore are recorded as retrieval deals
 type trustlessHandler struct {
-	*frisbii.HttpIpfs
+	bs               *bsWrap
+	cfg              *config.HTTPRetrieval
+	compressionLevel int
+	bandwidth        *clientLimiter
+	// pieces is nil if the pieces without active deals are served too
+	pieces *dealPieces
+	// records is nil if the requests are not recorded as retrieval deals
+	records  repo.IRetrievalDealRepo
+	nextID   atomic.Uint64
+	recorder *recorder
+}
+
+func newTrustlessHandler(ctx context.Context,
+	dagStoreWrapper stores.DAGStoreWrapper,
+	r repo.Repo,
+	rec *recorder,
+	cfg *config.HTTPRetrieval,
+	compressionLevel int,
+) *trustlessHandler {
+	h := &trustlessHandler{
+		bs:               newBSWrap(ctx, dagStoreWrapper),
+		cfg:              cfg,
+		compressionLevel: compressionLevel,
+		bandwidth:        newClientLimiter(cfg.ClientBandwidth),
+		recorder:         rec,
+	}
+	if r != nil {
+		h.records = r.RetrievalDealRepo()
+		if cfg.ActiveDealsOnly {
+			h.pieces = newDealPieces(r)
+		}
+	}
+	// the ids of the records must not collide with the ones of previous runs
+	h.nextID.Store(uint64(time.Now().UnixNano()))
+
+	return h
+}
+
+// ipfsRequest is a trustless request parsed from the /ipfs/ path
+type ipfsRequest struct {
+	trustlessutils.Request
+	accept trustlesshttp.ContentType
+}
+
+func parseIPFSRequest(r *http.Request) (*ipfsRequest, error) {
+	root, path, err := trustlesshttp.ParseUrlPath(r.URL.Path)
+	if err != nil {
+		return nil, err
+	}
+	accepts, err := trustlesshttp.CheckFormat(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &ipfsRequest{
+		Request: trustlessutils.Request{
+			Root:  root,
+			Path:  path.String(),
+			Scope: trustlessutils.DagScopeAll,
+		},
+		accept: accepts[0],
+	}
+	if req.accept.IsRaw() {
+		if path.Len() > 0 {
+			return nil, errors.New("path not supported for raw requests")
+		}
+		return req, nil
+	}
+
+	// IPIP-402 parameters are only meaningful for car responses
+	req.accept = req.accept.WithMimeType(trustlesshttp.MimeTypeCar)
+	req.Duplicates = req.accept.Duplicates
+	if req.Scope, err = trustlesshttp.ParseScope(r); err != nil {
+		return nil, err
+	}
+	if req.Bytes, err = trustlesshttp.ParseByteRange(r); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func (h *trustlessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Add("Allow", http.MethodGet)
+		w.Header().Add("Allow", http.MethodHead)
+		badResponse(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	req, err := parseIPFSRequest(r)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, trustlesshttp.ErrPathNotFound) {
+			code = http.StatusNotFound
+		}
+		badResponse(w, code, err)
+		return
+	}
+
+	start := time.Now()
+	client := clientAddr(r)
+	rw := &responseWriter{
+		ResponseWriter: w,
+		ctx:            r.Context(),
+		limiter:        h.bandwidth.limiter(client),
+	}
+	piece, err := h.serve(rw, r, req)
+	if err != nil {
+		log.Warnf("http retrieval %s %s from %s failed: %v", r.Method, r.URL, client, err)
+	}
+	h.record(r, req, piece, client, rw, time.Since(start), err)
+}
+
+// serve authorizes the request against the pieces containing the root and streams the response,
+// it returns the first piece allowed to serve the request
+func (h *trustlessHandler) serve(w *responseWriter, r *http.Request, req *ipfsRequest) (pieceDeal, error) {
+	ctx := r.Context()
+	bs := h.bs
+	piece, err := h.authorize(ctx, req.Root)
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, errNoActiveDeal):
+			code = http.StatusForbidden
+		case errors.Is(err, errNotFoundPiece):
+			code = http.StatusNotFound
+		}
+		badResponse(w, code, err)
+		return piece, err
+	}
+	if h.pieces != nil {
+		bs = bs.withPieceFilter(h.pieces.active)
+	}
+
+	if r.Method == http.MethodHead {
+		setIPFSHeaders(w.Header(), r, req)
+		w.WriteHeader(http.StatusOK)
+		return piece, nil
+	}
+	if req.accept.IsRaw() {
+		// frisbii sets the headers of a car response for the raw blocks too
+		w.onHeader = func(header http.Header) { setIPFSHeaders(header, r, req) }
+	}
+
+	opts := []frisbii.HttpOption{
+		frisbii.WithCompressionLevel(h.compressionLevel),
+		frisbii.WithMaxResponseDuration(time.Duration(h.cfg.MaxResponseDuration)),
+		frisbii.WithMaxResponseBytes(h.cfg.MaxResponseBytes),
+	}
+	frisbii.NewHttpIpfs(ctx, storeutil.LinkSystemForBlockstore(bs), opts...).ServeHTTP(w, r)
+
+	return piece, w.err
+}
+
+// authorize finds the pieces containing the root, only the pieces with active deals are allowed if ActiveDealsOnly is set
+func (h *trustlessHandler) authorize(ctx context.Context, root cid.Cid) (pieceDeal, error) {
+	if _, ok, err := isIdentity(root); err == nil && ok {
+		return pieceDeal{}, nil
+	}
+
+	pieces, err := h.bs.dagStoreWrapper.GetPiecesContainingBlock(root)
+	if err != nil {
+		return pieceDeal{}, fmt.Errorf("%w: %v", errNotFoundPiece, err)
+	}
+	if len(pieces) == 0 {
+		return pieceDeal{}, errNotFoundPiece
+	}
+	if h.pieces == nil {
+		return pieceDeal{piece: pieces[0]}, nil
+	}
+
+	for _, piece := range pieces {
+		pd, err := h.pieces.lookup(ctx, piece)
+		if err != nil {
+			return pieceDeal{}, err
+		}
+		if pd.active {
+			return pd, nil
+		}
+	}
+
+	return pieceDeal{piece: pieces[0]}, errNoActiveDeal
+}
+
+// filenameExtRaw is the file extension of a raw block response, as the one of the ipfs path gateway
+const filenameExtRaw = ".bin"
+
+func setIPFSHeaders(header http.Header, r *http.Request, req *ipfsRequest) {
+	fileName := req.Root.String() + trustlesshttp.FilenameExtCar
+	etag := req.Etag()
+	if req.accept.IsRaw() {
+		// the filename parameter only accepts the car extension
+		fileName = req.Root.String() + filenameExtRaw
+		etag = fmt.Sprintf("%q", req.Root.String()+".raw")
+	} else if name, _ := trustlesshttp.ParseFilename(r); name != "" {
+		fileName = name
+	}
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	header.Set("Cache-Control", trustlesshttp.ResponseCacheControlHeader)
+	header.Set("Content-Type", req.accept.WithQuality(1).String())
+	header.Set("Etag", etag)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("X-Ipfs-Path", r.URL.Path)
+	header.Set("Vary", "Accept, Accept-Encoding")
 }
 
-func newTrustlessHandler(ctx context.Context, bs bstore.Blockstore, compressionLevel int) *trustlessHandler {
-	lsys := storeutil.LinkSystemForBlockstore(bs)
+// record saves the request as a retrieval deal and as a http retrieval. Both are written on purpose:
+// the retrieval deal keeps the /ipfs/ requests listed by `MarketListRetrievalDeals` with the graphsync retrievals,
+// while the http retrieval keeps the http specific fields, eg. the range, the status and the duration,
+// and is listed by `HTTPRetrievalList` together with the /piece/ requests which have no retrieval deal.
+func (h *trustlessHandler) record(r *http.Request,
+	req *ipfsRequest,
+	piece pieceDeal,
+	client string,
+	w *responseWriter,
+	took time.Duration,
+	serveErr error,
+) {
+	status := retrievalmarket.DealStatusCompleted
+	switch {
+	case w.status == http.StatusForbidden:
+		status = retrievalmarket.DealStatusRejected
+	case serveErr != nil || w.status >= http.StatusBadRequest || w.cutOff:
+		status = retrievalmarket.DealStatusErrored
+	}
+
+	msg := fmt.Sprintf("http %s %s from %s, status: %d, dag-scope: %s, took: %v", r.Method, r.URL.Path, client,
+		w.statusCode(), req.Scope, took)
+	if req.Bytes != nil {
+		msg += fmt.Sprintf(", entity-bytes: %s", req.Bytes)
+	}
+	if serveErr != nil {
+		msg += fmt.Sprintf(", error: %v", serveErr)
+	}
+	log.Debug(msg)
+
+	retrieval := &types2.HTTPRetrieval{
+		Client:     client,
+		Path:       types2.HTTPRetrievalIPFS,
+		PieceCID:   piece.piece,
+		PayloadCID: req.Root,
+		Status:     w.statusCode(),
+		Sent:       w.written,
+		Duration:   took,
+	}
+	if req.Bytes != nil {
+		retrieval.Range = req.Bytes.String()
+	}
+	if serveErr != nil {
+		retrieval.Message = serveErr.Error()
+	}
+	// the requests of unknown roots and the HEAD requests are anonymous and cheap, saving them would let
+	// anyone grow the records without bound, so they are only counted in the metrics
+	if errors.Is(serveErr, errNotFoundPiece) || r.Method == http.MethodHead {
+		h.recorder.count(r.Context(), retrieval)
+		return
+	}
+	h.recorder.record(r.Context(), retrieval)
+
+	if h.records == nil {
+		return
+	}
+
+	deal := &types.ProviderDealState{
+		DealProposal: retrievalmarket.DealProposal{
+			PayloadCID: req.Root,
+			ID:         retrievalmarket.DealID(h.nextID.Add(1)),
+			Params: retrievalmarket.Params{
+				PricePerByte: big.Zero(),
+				UnsealPrice:  big.Zero(),
+			},
+		},
+		SelStorageProposalCid: req.Root,
+		Status:                status,
+		Receiver:              clientPeerID(client),
+		TotalSent:             w.written,
+		FundsReceived:         big.Zero(),
+		Message:               msg,
+	}
+	if piece.piece.Defined() {
+		deal.PieceCID = &piece.piece
+		deal.SelStorageProposalCid = piece.piece
+	}
+	if piece.proposal.Defined() {
+		deal.SelStorageProposalCid = piece.proposal
+	}
+	if err := h.records.SaveDeal(context.WithoutCancel(r.Context()), deal); err != nil {
+		log.Warnf("save record of http retrieval %s from %s: %v", r.URL.Path, client, err)
+	}
+}
+
+// clientAddr returns the host of the client, the requests from the same host share the bandwidth
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
 
-	return &trustlessHandler{frisbii.NewHttpIpfs(ctx, lsys, frisbii.WithCompressionLevel(compressionLevel),
-		frisbii.WithLogHandler(func(time time.Time, remoteAddr, method string, url url.URL, status int,
-			duration time.Duration, bytes int, compressionRatio, userAgent, msg string) {
-			log.Debugf("trustless handle %s %s %s %s %d %s %d %f %s %s", time, remoteAddr, method, url, status, duration,
-				bytes, compressionRatio, userAgent, msg)
-		}))}
+// clientPeerID returns an identity peer id of the client address, it's the receiver of the retrieval record,
+// as http clients have no libp2p peer id
+func clientPeerID(client string) peer.ID {
+	mh, err := multihash.Sum([]byte(client), multihash.IDENTITY, -1)
+	if err != nil {
+		return ""
+	}
+	return peer.ID(mh)
 }
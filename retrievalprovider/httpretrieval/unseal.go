@@ -0,0 +1,141 @@
+package httpretrieval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	gatewayAPIV2 "github.com/filecoin-project/venus/venus-shared/api/gateway/v2"
+	vtypes "github.com/filecoin-project/venus/venus-shared/types"
+	gtypes "github.com/filecoin-project/venus/venus-shared/types/gateway"
+	marketTypes "github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+)
+
+var (
+	// unsealWaitTimeout is how long a request waits for the unseal, when exceeded, the client is told to retry later
+	unsealWaitTimeout = 10 * time.Second
+	// unsealCheckInterval is the interval to check the unseal state from sealer
+	unsealCheckInterval = time.Minute
+	// unsealTimeout is the max time of an unseal task
+	unsealTimeout = 12 * time.Hour
+	// unsealRetryAfter is the Retry-After returned to client while unsealing
+	unsealRetryAfter = time.Minute
+)
+
+var errUnsealing = errors.New("piece is unsealing")
+
+type unsealTask struct {
+	done chan struct{}
+	err  error
+}
+
+// unsealer asks sealer to unseal piece to piece storage, requests for the same piece share one unseal task
+type unsealer struct {
+	pieceMgr            *piecestorage.PieceStorageManager
+	gatewayMarketClient gatewayAPIV2.IMarketClient
+
+	lk    sync.Mutex
+	tasks map[cid.Cid]*unsealTask
+}
+
+func newUnsealer(pieceMgr *piecestorage.PieceStorageManager, gatewayMarketClient gatewayAPIV2.IMarketClient) *unsealer {
+	return &unsealer{
+		pieceMgr:            pieceMgr,
+		gatewayMarketClient: gatewayMarketClient,
+		tasks:               make(map[cid.Cid]*unsealTask),
+	}
+}
+
+// Unseal starts an unseal task for the piece if there isn't one, and waits for it at most unsealWaitTimeout,
+// errUnsealing is returned if the task is still running.
+func (u *unsealer) Unseal(ctx context.Context, pieceCid cid.Cid, deals []marketTypes.MinerDeal) error {
+	u.lk.Lock()
+	task, ok := u.tasks[pieceCid]
+	if !ok {
+		task = &unsealTask{done: make(chan struct{})}
+		u.tasks[pieceCid] = task
+		go u.run(pieceCid, deals, task)
+	}
+	u.lk.Unlock()
+
+	select {
+	case <-task.done:
+		return task.err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(unsealWaitTimeout):
+		return errUnsealing
+	}
+}
+
+func (u *unsealer) run(pieceCid cid.Cid, deals []marketTypes.MinerDeal, task *unsealTask) {
+	ctx, cancel := context.WithTimeout(context.Background(), unsealTimeout)
+	defer cancel()
+
+	for _, deal := range deals {
+		if task.err = u.unsealDeal(ctx, pieceCid, &deal); task.err == nil {
+			break
+		}
+		log.Warnf("unseal piece %s from sector %d of %s failed: %v", pieceCid, deal.SectorNumber, deal.Proposal.Provider, task.err)
+	}
+
+	// remove the task, so the piece will be unsealed again if it is removed from piece storage or the task failed
+	u.lk.Lock()
+	delete(u.tasks, pieceCid)
+	u.lk.Unlock()
+	close(task.done)
+}
+
+func (u *unsealer) unsealDeal(ctx context.Context, pieceCid cid.Cid, deal *marketTypes.MinerDeal) error {
+	// the space is reserved until the sealer finishes uploading the unsealed piece
+	wps, err := u.pieceMgr.Reserve(pieceCid.String(), int64(deal.Proposal.PieceSize), piecestorage.PlacementTag{Miner: deal.Proposal.Provider})
+	if err != nil {
+		return fmt.Errorf("failed to find storage to write %s: %w", pieceCid, err)
+	}
+	defer u.pieceMgr.Release(pieceCid.String())
+	pieceTransfer, err := wps.GetPieceTransfer(ctx, pieceCid.String())
+	if err != nil {
+		return fmt.Errorf("get piece transfer for %s: %w", pieceCid, err)
+	}
+
+	log.Infof("try to unseal piece %s from sector %d of %s", pieceCid, deal.SectorNumber, deal.Proposal.Provider)
+	ticker := time.NewTicker(unsealCheckInterval)
+	defer ticker.Stop()
+	for {
+		state, err := u.gatewayMarketClient.SectorsUnsealPiece(
+			ctx,
+			deal.Proposal.Provider,
+			pieceCid,
+			deal.SectorNumber,
+			vtypes.UnpaddedByteIndex(deal.Offset.Unpadded()),
+			deal.Proposal.PieceSize.Unpadded(),
+			pieceTransfer,
+		)
+		if err != nil {
+			return fmt.Errorf("unseal piece %s: %w", pieceCid, err)
+		}
+		log.Debugf("unseal piece %s: %s", pieceCid, state)
+
+		switch state {
+		case gtypes.UnsealStateFailed:
+			return fmt.Errorf("unseal piece %s failed", pieceCid)
+		case gtypes.UnsealStateFinished:
+			if _, err := u.pieceMgr.FindStorageForRead(ctx, pieceCid.String()); err != nil {
+				return fmt.Errorf("piece %s not found in piece storage after unseal: %w", pieceCid, err)
+			}
+			log.Infof("unseal piece %s success", pieceCid)
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package retrievalprovider
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+
+	"github.com/ipfs-force-community/droplet/v2/dealfilter"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+)
+
+// ongoingDealStatus are the status of graphsync retrieval deals which are transferring data or about to
+var ongoingDealStatus = []retrievalmarket.DealStatus{
+	retrievalmarket.DealStatusUnsealing,
+	retrievalmarket.DealStatusUnsealed,
+	retrievalmarket.DealStatusOngoing,
+	retrievalmarket.DealStatusFundsNeeded,
+	retrievalmarket.DealStatusFundsNeededLastPayment,
+}
+
+var _ dealfilter.RetrievalLoadProvider = (*RetrievalLoad)(nil)
+
+// RetrievalLoad tracks the number of retrievals being served by graphsync and http
+type RetrievalLoad struct {
+	retrievalDeals repo.IRetrievalDealRepo
+	http           int64
+}
+
+func NewRetrievalLoad(r repo.Repo) *RetrievalLoad {
+	return &RetrievalLoad{retrievalDeals: r.RetrievalDealRepo()}
+}
+
+// HTTPStarted is called when a http retrieval starts
+func (l *RetrievalLoad) HTTPStarted() {
+	atomic.AddInt64(&l.http, 1)
+}
+
+// HTTPFinished is called when a http retrieval finishes
+func (l *RetrievalLoad) HTTPFinished() {
+	atomic.AddInt64(&l.http, -1)
+}
+
+func (l *RetrievalLoad) TransferLoad(ctx context.Context) (*dealfilter.TransferLoad, error) {
+	counts, err := l.retrievalDeals.GroupRetrievalDealNumberByStatus(ctx, address.Undef)
+	if err != nil {
+		return nil, err
+	}
+
+	load := &dealfilter.TransferLoad{HTTP: atomic.LoadInt64(&l.http)}
+	for _, status := range ongoingDealStatus {
+		load.Graphsync += counts[status]
+	}
+	return load, nil
+}
@@ -16,19 +16,27 @@ import (
 	"github.com/ipfs-force-community/droplet/v2/config"
 	"github.com/ipfs-force-community/droplet/v2/dealfilter"
 	_ "github.com/ipfs-force-community/droplet/v2/network"
+	"github.com/ipfs-force-community/droplet/v2/retrievalprovider/bitswap"
+	"github.com/ipfs-force-community/droplet/v2/retrievalprovider/httpretrieval"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
 
 	gatewayAPIV2 "github.com/filecoin-project/venus/venus-shared/api/gateway/v2"
-	types "github.com/filecoin-project/venus/venus-shared/types/market"
 )
 
-var HandleRetrievalKey = builder.NextInvoke()
+var (
+	HandleRetrievalKey = builder.NextInvoke()
+	StartBitswapKey    = builder.NextInvoke()
+)
 
-func RetrievalDealFilter(userFilter config.RetrievalDealFilter) func(onlineOk config.ConsiderOnlineRetrievalDealsConfigFunc,
-	offlineOk config.ConsiderOfflineRetrievalDealsConfigFunc) config.RetrievalDealFilter {
+func RetrievalDealFilter(cfg *config.MarketConfig) func(onlineOk config.ConsiderOnlineRetrievalDealsConfigFunc,
+	offlineOk config.ConsiderOfflineRetrievalDealsConfigFunc,
+	loadProvider dealfilter.RetrievalLoadProvider) config.RetrievalDealFilter {
 	return func(onlineOk config.ConsiderOnlineRetrievalDealsConfigFunc,
 		offlineOk config.ConsiderOfflineRetrievalDealsConfigFunc,
+		loadProvider dealfilter.RetrievalLoadProvider,
 	) config.RetrievalDealFilter {
-		return func(ctx context.Context, mAddr address.Address, state types.ProviderDealState) (bool, string, error) {
+		userFilter := dealfilter.NewRetrievalDealFilter(cfg, loadProvider)
+		return func(ctx context.Context, mAddr address.Address, params *types2.RetrievalDealParams) (bool, string, error) {
 			b, err := onlineOk(mAddr)
 			if err != nil {
 				return false, "miner error", err
@@ -48,7 +56,7 @@ func RetrievalDealFilter(userFilter config.RetrievalDealFilter) func(onlineOk co
 			}
 
 			// user never will be nil?
-			return userFilter(ctx, mAddr, state)
+			return userFilter(ctx, mAddr, params)
 		}
 	}
 }
@@ -78,10 +86,15 @@ var RetrievalProviderOpts = func(cfg *config.MarketConfig) builder.Option {
 		builder.Override(new(rmnet.RetrievalMarketNetwork), RetrievalNetwork),
 		builder.Override(new(IRetrievalProvider), NewProvider), // save to metadata /retrievals/provider
 		builder.Override(HandleRetrievalKey, HandleRetrieval),
-		builder.Override(new(config.RetrievalDealFilter), RetrievalDealFilter(dealfilter.CliRetrievalDealFilter(cfg))),
+		builder.Override(new(config.RetrievalDealFilter), RetrievalDealFilter(cfg)),
+		builder.Override(new(*RetrievalLoad), NewRetrievalLoad),
+		builder.Override(new(dealfilter.RetrievalLoadProvider), builder.From(new(*RetrievalLoad))),
 		builder.Override(new(gatewayAPIV2.IMarketEvent), NewMarketEventStream),
 		builder.Override(new(gatewayAPIV2.IMarketClient), builder.From(new(gatewayAPIV2.IMarketEvent))),
 		builder.Override(new(gatewayAPIV2.IMarketServiceProvider), builder.From(new(gatewayAPIV2.IMarketEvent))),
 		builder.Override(new(*TransportsListener), NewTransportsListener),
+		builder.Override(new(*bitswap.Server), bitswap.NewServer),
+		builder.Override(StartBitswapKey, func(*bitswap.Server) {}),
+		builder.Override(new(*httpretrieval.PieceAccess), httpretrieval.NewPieceAccess),
 	)
 }
@@ -0,0 +1,143 @@
+package retrievalprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+)
+
+// Ask is the retrieval price the external pricing script receives and returns
+type Ask struct {
+	PricePerByte            abi.TokenAmount
+	UnsealPrice             abi.TokenAmount
+	PaymentInterval         uint64
+	PaymentIntervalIncrease uint64
+}
+
+// PricingInput is the json passed to the external pricing script through stdin, same as lotus
+type PricingInput struct {
+	// PayloadCID is the cid of the payload to retrieve
+	PayloadCID cid.Cid
+	// PieceCID is the cid of the piece containing the payload
+	PieceCID cid.Cid
+	// PieceSize is the size of the piece
+	PieceSize abi.UnpaddedPieceSize
+	// Client is the peer id of the retrieval client
+	Client peer.ID
+	// VerifiedDeal is true if the payload is in a verified storage deal
+	VerifiedDeal bool
+	// Unsealed is true if there is an unsealed copy of the piece in piece storage
+	Unsealed bool
+	// CurrentAsk is the ask set with `droplet retrieval ask set`
+	CurrentAsk Ask
+}
+
+// RetrievalPricer computes the retrieval ask of a storage deal by the pricing strategy of the miner
+type RetrievalPricer struct {
+	cfg             *config.MarketConfig
+	askRepo         repo.IRetrievalAskRepo
+	pieceStorageMgr *piecestorage.PieceStorageManager
+}
+
+func NewRetrievalPricer(cfg *config.MarketConfig, askRepo repo.IRetrievalAskRepo, pieceStorageMgr *piecestorage.PieceStorageManager) *RetrievalPricer {
+	return &RetrievalPricer{cfg: cfg, askRepo: askRepo, pieceStorageMgr: pieceStorageMgr}
+}
+
+// GetAsk returns the ask for retrieving payloadCID from the deal
+func (p *RetrievalPricer) GetAsk(ctx context.Context, deal *types.MinerDeal, payloadCID cid.Cid, client peer.ID) (*types.RetrievalAsk, error) {
+	mAddr := deal.Proposal.Provider
+	ask, err := p.askRepo.GetAsk(ctx, mAddr)
+	if err != nil {
+		return nil, fmt.Errorf("got %s ask failed: %w", mAddr, err)
+	}
+
+	pCfg, err := p.cfg.MinerProviderConfig(mAddr, true)
+	if err != nil {
+		return nil, err
+	}
+	pricing := pCfg.RetrievalPricing
+	if pricing == nil {
+		return ask, nil
+	}
+
+	switch pricing.Strategy {
+	case config.RetrievalPricingDefaultMode, "":
+		if pricing.Default != nil && pricing.Default.VerifiedDealsFreeTransfer && deal.Proposal.VerifiedDeal {
+			newAsk := *ask
+			newAsk.PricePerByte = big.Zero()
+			return &newAsk, nil
+		}
+		return ask, nil
+	case config.RetrievalPricingExternalMode:
+		if pricing.External == nil || len(pricing.External.Path) == 0 {
+			return nil, fmt.Errorf("external retrieval pricing of %s must set path", mAddr)
+		}
+		_, err := p.pieceStorageMgr.FindStorageForRead(ctx, deal.Proposal.PieceCID.String())
+		input := PricingInput{
+			PayloadCID:   payloadCID,
+			PieceCID:     deal.Proposal.PieceCID,
+			PieceSize:    deal.Proposal.PieceSize.Unpadded(),
+			Client:       client,
+			VerifiedDeal: deal.Proposal.VerifiedDeal,
+			Unsealed:     err == nil,
+			CurrentAsk: Ask{
+				PricePerByte:            ask.PricePerByte,
+				UnsealPrice:             ask.UnsealPrice,
+				PaymentInterval:         ask.PaymentInterval,
+				PaymentIntervalIncrease: ask.PaymentIntervalIncrease,
+			},
+		}
+		out, err := runPricingScript(ctx, pricing.External.Path, &input)
+		if err != nil {
+			return nil, fmt.Errorf("run external retrieval pricing of %s: %w", mAddr, err)
+		}
+
+		newAsk := *ask
+		newAsk.PricePerByte = out.PricePerByte
+		newAsk.UnsealPrice = out.UnsealPrice
+		newAsk.PaymentInterval = out.PaymentInterval
+		newAsk.PaymentIntervalIncrease = out.PaymentIntervalIncrease
+		return &newAsk, nil
+	default:
+		return nil, fmt.Errorf("unknown retrieval pricing strategy %s", pricing.Strategy)
+	}
+}
+
+func runPricingScript(ctx context.Context, cmd string, input *PricingInput) (*Ask, error) {
+	j, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, "sh", "-c", cmd)
+	c.Stdin = bytes.NewReader(j)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+
+	if err := c.Run(); err != nil {
+		return nil, fmt.Errorf("%w, stderr: %s", err, stderr.String())
+	}
+
+	var ask Ask
+	if err := json.Unmarshal(stdout.Bytes(), &ask); err != nil {
+		return nil, fmt.Errorf("unmarshal output %q: %w", stdout.String(), err)
+	}
+	if ask.PricePerByte.Nil() || ask.UnsealPrice.Nil() {
+		return nil, fmt.Errorf("PricePerByte and UnsealPrice must be set, output: %q", stdout.String())
+	}
+
+	return &ask, nil
+}
@@ -0,0 +1,92 @@
+package retrievalprovider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models"
+	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+)
+
+func TestRetrievalPricer(t *testing.T) {
+	ctx := context.Background()
+	mAddr, err := address.NewIDAddress(1000)
+	assert.NoError(t, err)
+
+	pricing := &config.RetrievalPricing{
+		Strategy: config.RetrievalPricingDefaultMode,
+		Default:  &config.RetrievalPricingDefault{VerifiedDealsFreeTransfer: true},
+		External: &config.RetrievalPricingExternal{},
+	}
+	cfg := &config.MarketConfig{
+		Miners: []*config.MinerConfig{{Addr: config.Address(mAddr), ProviderConfig: &config.ProviderConfig{RetrievalPricing: pricing}}},
+	}
+
+	askRepo := models.NewInMemoryRepo(t).RetrievalAskRepo()
+	storedAsk := &market.RetrievalAsk{
+		Miner:                   mAddr,
+		PricePerByte:            big.NewInt(10),
+		UnsealPrice:             big.NewInt(100),
+		PaymentInterval:         1 << 20,
+		PaymentIntervalIncrease: 1 << 20,
+	}
+	assert.NoError(t, askRepo.SetAsk(ctx, storedAsk))
+
+	pieceStorageMgr, err := piecestorage.NewPieceStorageManager(&config.PieceStorage{})
+	assert.NoError(t, err)
+	pricer := NewRetrievalPricer(cfg, askRepo, pieceStorageMgr)
+
+	payloadCid := randCid(t)
+	deal := getTestMinerDeal(t, payloadCid, randCid(t))
+	deal.Proposal.Provider = mAddr
+
+	t.Run("default", func(t *testing.T) {
+		deal.Proposal.VerifiedDeal = false
+		ask, err := pricer.GetAsk(ctx, deal, payloadCid, peer.ID(""))
+		assert.NoError(t, err)
+		assert.Equal(t, storedAsk.PricePerByte, ask.PricePerByte)
+		assert.Equal(t, storedAsk.UnsealPrice, ask.UnsealPrice)
+
+		deal.Proposal.VerifiedDeal = true
+		ask, err = pricer.GetAsk(ctx, deal, payloadCid, peer.ID(""))
+		assert.NoError(t, err)
+		assert.True(t, ask.PricePerByte.IsZero())
+		assert.Equal(t, storedAsk.UnsealPrice, ask.UnsealPrice)
+
+		pricing.Default.VerifiedDealsFreeTransfer = false
+		ask, err = pricer.GetAsk(ctx, deal, payloadCid, peer.ID(""))
+		assert.NoError(t, err)
+		assert.Equal(t, storedAsk.PricePerByte, ask.PricePerByte)
+	})
+
+	t.Run("external", func(t *testing.T) {
+		pricing.Strategy = config.RetrievalPricingExternalMode
+
+		pricing.External.Path = ""
+		_, err := pricer.GetAsk(ctx, deal, payloadCid, peer.ID(""))
+		assert.Error(t, err)
+
+		pricing.External.Path = `grep -q '"VerifiedDeal":true' && echo '{"PricePerByte":"1","UnsealPrice":"2","PaymentInterval":3,"PaymentIntervalIncrease":4}'`
+		ask, err := pricer.GetAsk(ctx, deal, payloadCid, peer.ID(""))
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewInt(1), ask.PricePerByte)
+		assert.Equal(t, big.NewInt(2), ask.UnsealPrice)
+		assert.Equal(t, uint64(3), ask.PaymentInterval)
+		assert.Equal(t, uint64(4), ask.PaymentIntervalIncrease)
+
+		pricing.External.Path = "echo 'no price' >&2; exit 1"
+		_, err = pricer.GetAsk(ctx, deal, payloadCid, peer.ID(""))
+		assert.Error(t, err)
+
+		pricing.External.Path = "echo '{}'"
+		_, err = pricer.GetAsk(ctx, deal, payloadCid, peer.ID(""))
+		assert.Error(t, err)
+	})
+}
@@ -69,6 +69,7 @@ func NewProvider(
 	retrievalAskRepo := repo.RetrievalAskRepo()
 
 	pieceInfo := &PieceInfo{dagStore, storageDealsRepo}
+	pricer := NewRetrievalPricer(cfg, retrievalAskRepo, pieceStorageMgr)
 	p := &RetrievalProvider{
 		dataTransfer:           dataTransfer,
 		network:                network,
@@ -76,12 +77,12 @@ func NewProvider(
 		retrievalDealRepo:      retrievalDealRepo,
 		storageDealRepo:        storageDealsRepo,
 		stores:                 stores.NewReadOnlyBlockstores(),
-		retrievalStreamHandler: NewRetrievalStreamHandler(cfg, retrievalAskRepo, retrievalDealRepo, storageDealsRepo, pieceInfo),
+		retrievalStreamHandler: NewRetrievalStreamHandler(cfg, pricer, retrievalDealRepo, storageDealsRepo, pieceInfo),
 		transportListener:      transportLister,
 	}
 
 	retrievalHandler := NewRetrievalDealHandler(newProviderDealEnvironment(p, fullNode, payAPI), retrievalDealRepo, storageDealsRepo, gatewayMarketClient, pieceStorageMgr)
-	p.requestValidator = NewProviderRequestValidator(cfg, storageDealsRepo, retrievalDealRepo, retrievalAskRepo, pieceInfo, rdf)
+	p.requestValidator = NewProviderRequestValidator(cfg, storageDealsRepo, retrievalDealRepo, pricer, pieceInfo, pieceStorageMgr, rdf)
 	transportConfigurer := dtutils.TransportConfigurer(network.ID(), &providerStoreGetter{retrievalDealRepo, p.stores})
 
 	err := p.dataTransfer.RegisterVoucherType(retrievalmarket.DealProposalType, p.requestValidator)
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"time"
 
-	"github.com/filecoin-project/go-address"
 	datatransfer "github.com/filecoin-project/go-data-transfer/v2"
 	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/filecoin-project/go-state-types/big"
@@ -18,6 +17,8 @@ import (
 
 	"github.com/ipfs-force-community/droplet/v2/config"
 	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
 
 	types "github.com/filecoin-project/venus/venus-shared/types/market"
 )
@@ -32,7 +33,8 @@ type ProviderRequestValidator struct {
 	storageDeals  repo.StorageDealRepo
 	pieceInfo     *PieceInfo
 	retrievalDeal repo.IRetrievalDealRepo
-	retrievalAsk  repo.IRetrievalAskRepo
+	pricer        *RetrievalPricer
+	pieceStorage  *piecestorage.PieceStorageManager
 	rdf           config.RetrievalDealFilter
 	psub          *pubsub.PubSub
 }
@@ -42,16 +44,18 @@ func NewProviderRequestValidator(
 	cfg *config.MarketConfig,
 	storageDeals repo.StorageDealRepo,
 	retrievalDeal repo.IRetrievalDealRepo,
-	retrievalAsk repo.IRetrievalAskRepo,
+	pricer *RetrievalPricer,
 	pieceInfo *PieceInfo,
+	pieceStorage *piecestorage.PieceStorageManager,
 	rdf config.RetrievalDealFilter,
 ) *ProviderRequestValidator {
 	return &ProviderRequestValidator{
 		cfg:           cfg,
 		storageDeals:  storageDeals,
 		retrievalDeal: retrievalDeal,
-		retrievalAsk:  retrievalAsk,
+		pricer:        pricer,
 		pieceInfo:     pieceInfo,
+		pieceStorage:  pieceStorage,
 		rdf:           rdf,
 		psub:          pubsub.New(queryValidationDispatcher),
 	}
@@ -164,11 +168,28 @@ func (rv *ProviderRequestValidator) validatePull(ctx context.Context, receiver p
 	return result, nil
 }
 
-func (rv *ProviderRequestValidator) runDealDecisionLogic(ctx context.Context, deal *types.ProviderDealState) (bool, string, error) {
+func (rv *ProviderRequestValidator) runDealDecisionLogic(ctx context.Context, deal *types.ProviderDealState, minerDeal *types.MinerDeal, minerDeals []*types.MinerDeal) (bool, string, error) {
 	if rv.rdf == nil {
 		return true, "", nil
 	}
-	return rv.rdf(ctx, address.Undef, *deal)
+
+	pieceCID := minerDeal.Proposal.PieceCID
+	_, err := rv.pieceStorage.FindStorageForRead(ctx, pieceCID.String())
+	params := &types2.RetrievalDealParams{
+		ProviderDealState: deal,
+		Protocol:          types2.RetrievalProtocolGraphsync,
+		PayloadCID:        deal.PayloadCID,
+		PieceCID:          pieceCID,
+		Client:            deal.Receiver.String(),
+		Unsealed:          err == nil,
+	}
+	for _, d := range minerDeals {
+		if d.Proposal.PieceCID.Equals(pieceCID) {
+			params.Deals = append(params.Deals, types2.NewRetrievalPieceDeal(d))
+		}
+	}
+
+	return rv.rdf(ctx, minerDeal.Proposal.Provider, params)
 }
 
 func (rv *ProviderRequestValidator) acceptDeal(ctx context.Context, deal *types.ProviderDealState) (retrievalmarket.DealStatus, error) {
@@ -185,6 +206,7 @@ func (rv *ProviderRequestValidator) acceptDeal(ctx context.Context, deal *types.
 
 	//todo this deal may not match with query ask, no way to get miner id in current protocol
 	var ask *types.RetrievalAsk
+	var selDeal *types.MinerDeal
 	for _, minerDeal := range minerDeals {
 		minerCfg, err := rv.cfg.MinerProviderConfig(minerDeal.Proposal.Provider, true)
 		if err != nil {
@@ -194,10 +216,11 @@ func (rv *ProviderRequestValidator) acceptDeal(ctx context.Context, deal *types.
 			continue
 		}
 		deal.SelStorageProposalCid = minerDeal.ProposalCid
-		ask, err = rv.retrievalAsk.GetAsk(ctx, minerDeal.Proposal.Provider)
+		ask, err = rv.pricer.GetAsk(ctx, minerDeal, deal.PayloadCID, deal.Receiver)
 		if err != nil {
-			log.Warnf("got %s ask failed: %v", minerDeal.Proposal.Provider, err)
+			log.Warn(err)
 		} else {
+			selDeal = minerDeal
 			break
 		}
 	}
@@ -212,8 +235,7 @@ func (rv *ProviderRequestValidator) acceptDeal(ctx context.Context, deal *types.
 		return retrievalmarket.DealStatusRejected, err
 	}
 
-	// todo: 检索订单的 `miner` 从哪里来?
-	accepted, reason, err := rv.runDealDecisionLogic(ctx, deal)
+	accepted, reason, err := rv.runDealDecisionLogic(ctx, deal, selDeal, minerDeals)
 	if err != nil {
 		return retrievalmarket.DealStatusErrored, err
 	}
@@ -77,11 +77,13 @@ func (p *RetrievalDealHandler) UnsealData(ctx context.Context, providerDeal *mkt
 	} else {
 		// try unseal
 		var wps piecestorage.IPieceStorage
-		wps, err = p.pieceStorageMgr.FindStorageForWrite(int64(deal.Proposal.PieceSize))
+		// the space is reserved until the sealer finishes uploading the unsealed piece
+		wps, err = p.pieceStorageMgr.Reserve(pieceCid.String(), int64(deal.Proposal.PieceSize), piecestorage.PlacementTag{Miner: deal.Proposal.Provider})
 		if err != nil {
 			err = fmt.Errorf("failed to find storage to write %s: %w", deal.Proposal.PieceCID, err)
 			return
 		}
+		defer p.pieceStorageMgr.Release(pieceCid.String())
 
 		var pieceTransfer string
 		pieceTransfer, err = wps.GetPieceTransfer(ctx, pieceCid.String())
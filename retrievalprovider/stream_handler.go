@@ -26,14 +26,14 @@ var _ IRetrievalStream = (*RetrievalStreamHandler)(nil)
 
 type RetrievalStreamHandler struct {
 	cfg                *config.MarketConfig
-	askRepo            repo.IRetrievalAskRepo
+	pricer             *RetrievalPricer
 	retrievalDealStore repo.IRetrievalDealRepo
 	storageDealStore   repo.StorageDealRepo
 	pieceInfo          *PieceInfo
 }
 
-func NewRetrievalStreamHandler(cfg *config.MarketConfig, askRepo repo.IRetrievalAskRepo, retrievalDealStore repo.IRetrievalDealRepo, storageDealStore repo.StorageDealRepo, pieceInfo *PieceInfo) *RetrievalStreamHandler {
-	return &RetrievalStreamHandler{cfg: cfg, askRepo: askRepo, retrievalDealStore: retrievalDealStore, storageDealStore: storageDealStore, pieceInfo: pieceInfo}
+func NewRetrievalStreamHandler(cfg *config.MarketConfig, pricer *RetrievalPricer, retrievalDealStore repo.IRetrievalDealRepo, storageDealStore repo.StorageDealRepo, pieceInfo *PieceInfo) *RetrievalStreamHandler {
+	return &RetrievalStreamHandler{cfg: cfg, pricer: pricer, retrievalDealStore: retrievalDealStore, storageDealStore: storageDealStore, pieceInfo: pieceInfo}
 }
 
 /*
@@ -118,9 +118,9 @@ func (p *RetrievalStreamHandler) HandleQueryStream(stream rmnet.RetrievalQuerySt
 		}
 		answer.PaymentAddress = paymentAddr
 
-		ask, err := p.askRepo.GetAsk(ctx, deal.Proposal.Provider)
+		ask, err := p.pricer.GetAsk(ctx, deal, query.PayloadCID, stream.RemotePeer())
 		if err != nil {
-			log.Warnf("got %s ask failed: %v", deal.Proposal.Provider, err)
+			log.Warn(err)
 			continue
 		}
 		answer.MinPricePerByte = ask.PricePerByte
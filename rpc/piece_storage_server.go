@@ -1,12 +1,16 @@
 package rpc
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+	"github.com/ipfs-force-community/droplet/v2/retrievalprovider/httpretrieval"
+	"github.com/ipfs-force-community/sophon-auth/core"
+	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
 )
 
@@ -16,10 +20,12 @@ var _ http.Handler = (*PieceStorageServer)(nil)
 
 type PieceStorageServer struct {
 	pieceStorageMgr *piecestorage.PieceStorageManager
+	// access authorizes the downloads of pieces, the requests are only checked by the auth mux if it's disabled
+	access *httpretrieval.PieceAccess
 }
 
-func NewPieceStorageServer(pieceStorageMgr *piecestorage.PieceStorageManager) *PieceStorageServer {
-	return &PieceStorageServer{pieceStorageMgr: pieceStorageMgr}
+func NewPieceStorageServer(pieceStorageMgr *piecestorage.PieceStorageManager, access *httpretrieval.PieceAccess) *PieceStorageServer {
+	return &PieceStorageServer{pieceStorageMgr: pieceStorageMgr, access: access}
 }
 
 func (p *PieceStorageServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
@@ -43,6 +49,18 @@ func (p *PieceStorageServer) handleGet(res http.ResponseWriter, req *http.Reques
 	}
 	ctx := req.Context()
 
+	if p.access.Enabled() {
+		pieceCID, err := cid.Decode(resourceID)
+		if err != nil {
+			logErrorAndResonse(res, fmt.Sprintf("resource %s is not a piece cid: %s", resourceID, err), http.StatusUnauthorized)
+			return
+		}
+		if err := p.access.Authorize(req, pieceCID); err != nil {
+			logErrorAndResonse(res, fmt.Sprintf("unauthorized request of resource %s: %s", resourceID, err), httpretrieval.AccessErrorCode(err))
+			return
+		}
+	}
+
 	// todo consider priority strategy, priority oss, priority market transfer directly
 	pieceStorage, err := p.pieceStorageMgr.FindStorageForRead(ctx, resourceID)
 	if err != nil {
@@ -64,14 +82,14 @@ func (p *PieceStorageServer) handleGet(res http.ResponseWriter, req *http.Reques
 
 	flen, err := pieceStorage.Len(req.Context(), resourceID)
 	if err != nil {
-		logErrorAndResonse(res, fmt.Sprintf("call piecestore.Len for %s: %s", resourceID, err), http.StatusInternalServerError)
+		logErrorAndResonse(res, fmt.Sprintf("call piecestore.Len for %s: %s", resourceID, err), piecestorage.HTTPErrorCode(res, err))
 		return
 	}
 	res.Header().Set("Content-Length", strconv.FormatInt(flen, 10))
 
 	r, err := pieceStorage.GetReaderCloser(req.Context(), resourceID)
 	if err != nil {
-		logErrorAndResonse(res, fmt.Sprintf("failed to open reader for %s: %s", resourceID, err), http.StatusInternalServerError)
+		logErrorAndResonse(res, fmt.Sprintf("failed to open reader for %s: %s", resourceID, err), piecestorage.HTTPErrorCode(res, err))
 		return
 	}
 
@@ -97,6 +115,12 @@ func (p *PieceStorageServer) handlePut(res http.ResponseWriter, req *http.Reques
 		return
 	}
 
+	// a signed url only grants the download of a piece, and a read token only grants the downloads
+	if p.access.Enabled() && !core.HasPerm(ctx, nil, core.PermWrite) {
+		logErrorAndResonse(res, "a bearer token with write permission is required to upload resource", http.StatusUnauthorized)
+		return
+	}
+
 	if req.Body == nil {
 		logErrorAndResonse(res, "body is empty", http.StatusBadRequest)
 		return
@@ -125,16 +149,22 @@ func (p *PieceStorageServer) handlePut(res http.ResponseWriter, req *http.Reques
 			logErrorAndResonse(res, fmt.Sprintf("size %s is invalid", sizeStr), http.StatusBadRequest)
 			return
 		}
-		store, err = p.pieceStorageMgr.FindStorageForWrite(size)
+		// the storage reserved for the resource is used, e.g. the one selected to unseal the piece
+		store, err = p.pieceStorageMgr.ReserveForWrite(resourceID, size, piecestorage.PlacementTag{})
 		if err != nil {
 			logErrorAndResonse(res, fmt.Sprintf("fail to find store for write: %s", err), http.StatusInternalServerError)
 			return
 		}
+		defer p.pieceStorageMgr.Release(resourceID)
 	}
 
-	_, err := store.SaveTo(ctx, resourceID, req.Body)
+	_, err := p.pieceStorageMgr.SaveTo(ctx, store, resourceID, 0, req.Body)
+	if errors.Is(err, piecestorage.ErrPieceMismatch) {
+		logErrorAndResonse(res, fmt.Sprintf("reject resource %s: %s", resourceID, err), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		logErrorAndResonse(res, fmt.Sprintf("fail to save resource %s to store %s: %s", resourceID, store.GetName(), err), http.StatusInternalServerError)
+		logErrorAndResonse(res, fmt.Sprintf("fail to save resource %s to store %s: %s", resourceID, store.GetName(), err), piecestorage.HTTPErrorCode(res, err))
 		return
 	}
 
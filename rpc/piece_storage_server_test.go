@@ -11,6 +11,8 @@ import (
 
 	"github.com/ipfs-force-community/droplet/v2/config"
 	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+	"github.com/ipfs-force-community/droplet/v2/retrievalprovider/httpretrieval"
+	"github.com/ipfs-force-community/sophon-auth/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -20,7 +22,7 @@ func setupTestServer(t *testing.T) (*piecestorage.MemPieceStore, http.Handler) {
 	require.NoError(t, err)
 	ps := piecestorage.NewMemPieceStore("memtest", nil)
 	pm.AddMemPieceStorage(ps)
-	pss := NewPieceStorageServer(pm)
+	pss := NewPieceStorageServer(pm, nil)
 	return ps, pss
 }
 
@@ -64,3 +66,41 @@ func TestResouceDownload(t *testing.T) {
 		assert.Equal(t, "mock resource2 content", string(result))
 	})
 }
+
+func TestResourceAccess(t *testing.T) {
+	ctx := context.Background()
+	pm, err := piecestorage.NewPieceStorageManager(&config.PieceStorage{})
+	require.NoError(t, err)
+
+	cfg := *config.DefaultMarketConfig
+	cfg.HomeDir = t.TempDir()
+	cfg.PieceAccess = config.PieceAccess{Enable: true}
+	require.NoError(t, config.InitKeyFile(&cfg, config.PieceAccessKeyFile, config.RandKey(32)))
+	access, err := httpretrieval.NewPieceAccess(&cfg, &cfg, nil)
+	require.NoError(t, err)
+	pss := NewPieceStorageServer(pm, access)
+
+	pieceCID := "baga6ea4seaqpyzrxp423g6akmu3i2dnd7ymgf37z7m3nwhkbntt3stbocbroqdq"
+	serve := func(ctx context.Context, method, path string) int {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString("mock resource content")).WithContext(ctx)
+		w := httptest.NewRecorder()
+		pss.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("download", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve(ctx, http.MethodGet, "/resource?resource-id=s1"))
+		assert.Equal(t, http.StatusUnauthorized, serve(ctx, http.MethodGet, "/resource?resource-id="+pieceCID))
+		assert.Equal(t, http.StatusUnauthorized, serve(ctx, http.MethodGet, "/resource?resource-id="+pieceCID+"&client=f01000&expires=1&signature=00"))
+		// the token is verified, the piece is not found in the piece storage
+		assert.Equal(t, http.StatusNotFound, serve(core.CtxWithPerm(ctx, core.PermRead), http.MethodGet, "/resource?resource-id="+pieceCID))
+	})
+
+	t.Run("upload", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve(ctx, http.MethodPut, "/resource?resource-id="+pieceCID+"&size=100"))
+		// a read token can download the pieces but can't upload them
+		assert.Equal(t, http.StatusUnauthorized, serve(core.CtxWithPerm(ctx, core.PermRead), http.MethodPut, "/resource?resource-id="+pieceCID+"&size=100"))
+		// the token is verified, the request is rejected for the missing store and size
+		assert.Equal(t, http.StatusBadRequest, serve(core.CtxWithPerm(ctx, core.PermWrite), http.MethodPut, "/resource?resource-id="+pieceCID))
+	})
+}
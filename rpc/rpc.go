@@ -43,6 +43,7 @@ func ServeRPC(
 	apiHandles []APIHandle,
 	shutdownCh <-chan struct{},
 	httpRetrievalServer *httpretrieval.Server,
+	pieceAccess *httpretrieval.PieceAccess,
 ) error {
 	serverOptions := make([]jsonrpc.ServerOption, 0)
 	if maxRequestSize != 0 { // config set
@@ -59,6 +60,11 @@ func ServeRPC(
 		serveRpc(apiHnd.Path, apiHnd.API)
 	}
 
+	// the requests of pieces and the trustless gateway with a bearer token are passed to the router after the token is verified
+	if httpRetrievalServer != nil && pieceAccess.Enabled() {
+		mux.PathPrefix("/piece/").Handler(httpRetrievalServer)
+		mux.PathPrefix("/ipfs/").Handler(httpRetrievalServer)
+	}
 	mux.PathPrefix("/").Handler(http.DefaultServeMux)
 
 	localJwtClient, err := getLocalJwtClient(home, apiCfg)
@@ -73,9 +79,18 @@ func ServeRPC(
 	}
 	authMux.TrustHandle("/healthcheck", healthcheck.Handler())
 	authMux.TrustHandle("/debug/pprof/", http.DefaultServeMux)
+	if pieceAccess.Enabled() {
+		// the signed urls are verified by the servers themselves
+		authMux.TrustHandle("/resource", mux, jwtclient.RegexpOption(regexp.MustCompile(`^/resource\?(.*&)?signature=`)))
+	}
 	if httpRetrievalServer != nil {
-		authMux.TrustHandle("/piece/", httpRetrievalServer, jwtclient.RegexpOption(regexp.MustCompile(`/piece/[a-z0-9]+`)))
-		authMux.TrustHandle("/ipfs/", httpRetrievalServer, jwtclient.RegexpOption(regexp.MustCompile(`/ipfs/[a-z0-9]+`)))
+		// the trustless gateway serves the blocks of any piece, so it isn't trusted when the piece access is controlled
+		if pieceAccess.Enabled() {
+			authMux.TrustHandle("/piece", httpRetrievalServer, jwtclient.RegexpOption(regexp.MustCompile(`^/piece/[a-zA-Z0-9]+\?(.*&)?signature=`)))
+		} else {
+			authMux.TrustHandle("/piece/", httpRetrievalServer, jwtclient.RegexpOption(regexp.MustCompile(`/piece/[a-z0-9]+`)))
+			authMux.TrustHandle("/ipfs/", httpRetrievalServer, jwtclient.RegexpOption(regexp.MustCompile(`/ipfs/[a-z0-9]+`)))
+		}
 	}
 
 	srv := &http.Server{Handler: authMux}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"math/bits"
 
-	"github.com/filecoin-project/go-commp-utils/zerocomm"
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/builtin/v9/market"
 
@@ -19,13 +18,28 @@ var (
 	errDealsUnOrdered       = fmt.Errorf("deals un-ordered")
 )
 
-func pickAndAlign(deals []*mtypes.DealInfoIncludePath, ssize abi.SectorSize, currentHeight abi.ChainEpoch, spec *mtypes.GetDealSpec) ([]*mtypes.DealInfoIncludePath, error) {
+func pickAndAlign(deals []*mtypes.DealInfoIncludePath, ssize abi.SectorSize, currentHeight abi.ChainEpoch, spec *dealSpec) (*packResult, error) {
 	space := abi.PaddedPieceSize(ssize)
 
 	if err := space.Validate(); err != nil {
 		return nil, fmt.Errorf("%w: %d", errInvalidSpaceSize, space)
 	}
 
+	deals, err := filterDeals(deals, currentHeight, spec.GetDealSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	pieces := make([]*packingPiece, 0, len(deals))
+	for _, deal := range deals {
+		pieces = append(pieces, storageDealPiece(deal))
+	}
+
+	return packPieces(pieces, ssize, spec)
+}
+
+// filterDeals returns the storage deals matching the epochs and piece sizes in spec, deals must be sorted by size
+func filterDeals(deals []*mtypes.DealInfoIncludePath, currentHeight abi.ChainEpoch, spec *mtypes.GetDealSpec) ([]*mtypes.DealInfoIncludePath, error) {
 	// 为了方便测试，将此过滤置于此位置
 	// 如果为了考虑效率，且有合适的方式进行测试，则可以移动到前置逻辑中进行过滤
 	// 确保订单在:
@@ -105,104 +119,7 @@ func pickAndAlign(deals []*mtypes.DealInfoIncludePath, ssize abi.SectorSize, cur
 		deals = deals[:last]
 	}
 
-	// only the deals left
-	dealCount := len(deals)
-	if dealCount == 0 {
-		return nil, nil
-	}
-
-	res := make([]*mtypes.DealInfoIncludePath, 0)
-	di := 0
-	checked := 0
-
-	pickedDeals := 0
-	pickedSpace := abi.PaddedPieceSize(0)
-
-	var offset abi.UnpaddedPieceSize
-	for di < dealCount {
-		deal := deals[di]
-		if di != checked {
-			if psize := deal.PieceSize; psize.Validate() != nil {
-				return nil, fmt.Errorf("%w: #%d deal size: %d", errInvalidDealPieceSize, di, psize)
-			}
-
-			// deals unordered
-			if di > 0 && deal.PieceSize < deals[di-1].PieceSize {
-				return nil, errDealsUnOrdered
-			}
-
-			checked = di
-		}
-
-		// deal limit
-		if spec != nil && spec.MaxPiece > 0 && pickedDeals >= spec.MaxPiece {
-			break
-		}
-
-		// not enough for next deal
-		if deal.PieceSize > space {
-			break
-		}
-
-		nextPiece := nextAlignedPiece(space)
-		// next piece cantainer is not enough, we should put a zeroed-piece
-		if deal.PieceSize > nextPiece {
-			res = append(res, &mtypes.DealInfoIncludePath{
-				DealProposal: types.DealProposal{
-					PieceSize: nextPiece,
-					PieceCID:  zerocomm.ZeroPieceCommitment(nextPiece.Unpadded()),
-				},
-			})
-
-			space -= nextPiece
-			offset += nextPiece.Unpadded()
-			continue
-		}
-
-		deal.Offset = offset.Padded()
-		res = append(res, deal)
-
-		pickedDeals++
-		pickedSpace += deal.PieceSize
-
-		space -= deal.PieceSize
-		offset += deal.PieceSize.Unpadded()
-		di++
-	}
-
-	// no deals picked, we just do nothing here
-	if len(res) == 0 {
-		return nil, nil
-	}
-
-	// not enough deals
-	if spec != nil && spec.MinPiece > 0 && pickedDeals < spec.MinPiece {
-		return nil, nil
-	}
-
-	// not enough space for deals
-	if spec != nil && spec.MinUsedSpace > 0 && uint64(pickedSpace) < spec.MinUsedSpace {
-		return nil, nil
-	}
-
-	// still have space left, we should fill in more zeroed-pieces
-	if space > 0 {
-		fillers, err := fillersFromRem(space)
-		if err != nil {
-			return nil, fmt.Errorf("get filler pieces for the remaining space %d: %w", space, err)
-		}
-
-		for _, fillSize := range fillers {
-			res = append(res, &mtypes.DealInfoIncludePath{
-				DealProposal: types.DealProposal{
-					PieceSize: fillSize,
-					PieceCID:  zerocomm.ZeroPieceCommitment(fillSize.Unpadded()),
-				},
-			})
-		}
-	}
-
-	return res, nil
+	return deals, nil
 }
 
 func nextAlignedPiece(space abi.PaddedPieceSize) abi.PaddedPieceSize {
@@ -234,13 +151,8 @@ func fillersFromRem(in abi.PaddedPieceSize) ([]abi.PaddedPieceSize, error) {
 	return out, nil
 }
 
-func (ps *dealAssigner) pickAndAlignDirectDeal(ctx context.Context, deals []*mtypes.DirectDealInfo, ssize abi.SectorSize, currentHeight abi.ChainEpoch, spec *mtypes.GetDealSpec) ([]*mtypes.DirectDealInfo, error) {
-	space := abi.PaddedPieceSize(ssize)
-
-	if err := space.Validate(); err != nil {
-		return nil, fmt.Errorf("%w: %d", errInvalidSpaceSize, space)
-	}
-
+// filterDirectDeals returns the direct deals matching the epochs and piece sizes in spec, deals must be sorted by size
+func (ps *dealAssigner) filterDirectDeals(ctx context.Context, deals []*mtypes.DirectDealInfo, currentHeight abi.ChainEpoch, spec *mtypes.GetDealSpec) ([]*mtypes.DirectDealInfo, error) {
 	// 为了方便测试，将此过滤置于此位置
 	// 如果为了考虑效率，且有合适的方式进行测试，则可以移动到前置逻辑中进行过滤
 	// 确保订单在:
@@ -316,98 +228,5 @@ func (ps *dealAssigner) pickAndAlignDirectDeal(ctx context.Context, deals []*mty
 		deals = deals[:last]
 	}
 
-	// only the deals left
-	dealCount := len(deals)
-	if dealCount == 0 {
-		return nil, nil
-	}
-
-	res := make([]*mtypes.DirectDealInfo, 0)
-	di := 0
-	checked := 0
-
-	pickedDeals := 0
-	pickedSpace := abi.PaddedPieceSize(0)
-
-	var offset abi.UnpaddedPieceSize
-	for di < dealCount {
-		deal := deals[di]
-		if di != checked {
-			if psize := deal.PieceSize; psize.Validate() != nil {
-				return nil, fmt.Errorf("%w: #%d deal size: %d", errInvalidDealPieceSize, di, psize)
-			}
-
-			// deals unordered
-			if di > 0 && deal.PieceSize < deals[di-1].PieceSize {
-				return nil, errDealsUnOrdered
-			}
-
-			checked = di
-		}
-
-		// deal limit
-		if spec != nil && spec.MaxPiece > 0 && pickedDeals >= spec.MaxPiece {
-			break
-		}
-
-		// not enough for next deal
-		if deal.PieceSize > space {
-			break
-		}
-
-		nextPiece := nextAlignedPiece(space)
-		// next piece cantainer is not enough, we should put a zeroed-piece
-		if deal.PieceSize > nextPiece {
-			res = append(res, &mtypes.DirectDealInfo{
-				PieceSize: nextPiece,
-				PieceCID:  zerocomm.ZeroPieceCommitment(nextPiece.Unpadded()),
-			})
-
-			space -= nextPiece
-			offset += nextPiece.Unpadded()
-			continue
-		}
-
-		deal.Offset = offset.Padded()
-		res = append(res, deal)
-
-		pickedDeals++
-		pickedSpace += deal.PieceSize
-
-		space -= deal.PieceSize
-		offset += deal.PieceSize.Unpadded()
-		di++
-	}
-
-	// no deals picked, we just do nothing here
-	if len(res) == 0 {
-		return nil, nil
-	}
-
-	// not enough deals
-	if spec != nil && spec.MinPiece > 0 && pickedDeals < spec.MinPiece {
-		return nil, nil
-	}
-
-	// not enough space for deals
-	if spec != nil && spec.MinUsedSpace > 0 && uint64(pickedSpace) < spec.MinUsedSpace {
-		return nil, nil
-	}
-
-	// still have space left, we should fill in more zeroed-pieces
-	if space > 0 {
-		fillers, err := fillersFromRem(space)
-		if err != nil {
-			return nil, fmt.Errorf("get filler pieces for the remaining space %d: %w", space, err)
-		}
-
-		for _, fillSize := range fillers {
-			res = append(res, &mtypes.DirectDealInfo{
-				PieceSize: fillSize,
-				PieceCID:  zerocomm.ZeroPieceCommitment(fillSize.Unpadded()),
-			})
-		}
-	}
-
-	return res, nil
+	return deals, nil
 }
@@ -7,6 +7,8 @@ import (
 	"github.com/filecoin-project/venus/venus-shared/types"
 	mtypes "github.com/filecoin-project/venus/venus-shared/types/market"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
 )
 
 const (
@@ -444,7 +446,8 @@ func TestDealAssignPickAndAlign(t *testing.T) {
 		require.Lenf(t, c.expectedDealIDs, expectedPieceCount, "<%s> expected deal ids & piece sizes should be equal", c.name)
 
 		caseDeals := generateTestingDeals(c.sizes, c.lifetimes)
-		gotDeals, gotErr := pickAndAlign(caseDeals, c.sectorSize, 0, c.spec)
+		res, gotErr := pickAndAlign(caseDeals, c.sectorSize, 0, &dealSpec{GetDealSpec: c.spec, strategy: config.PackingGreedy})
+		gotDeals := res.storageDeals()
 
 		if c.expectedErr != nil {
 			require.ErrorIsf(t, gotErr, c.expectedErr, "<%s> expected a specified error", c.name)
@@ -11,12 +11,17 @@ import (
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/hashicorp/go-multierror"
 	"github.com/ipfs/go-cid"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 
 	"github.com/filecoin-project/venus/venus-shared/actors/builtin/verifreg"
 	v1api "github.com/filecoin-project/venus/venus-shared/api/chain/v1"
 	shared "github.com/filecoin-project/venus/venus-shared/types"
 	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/metrics"
 	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
 )
 
 type DealAssiger interface {
@@ -27,14 +32,18 @@ type DealAssiger interface {
 	GetUnPackedDeals(ctx context.Context, miner address.Address, spec *types.GetDealSpec) ([]*types.DealInfoIncludePath, error)
 	AssignUnPackedDeals(ctx context.Context, sid abi.SectorID, ssize abi.SectorSize, currentHeight abi.ChainEpoch, spec *types.GetDealSpec) ([]*types.DealInfoIncludePath, error)
 	ReleaseDeals(ctx context.Context, miner address.Address, deals []abi.DealID) error
-	AssignDeals(ctx context.Context, sid abi.SectorID, ssize abi.SectorSize, currentHeight abi.ChainEpoch, spec *types.GetDealSpec) ([]*types.DealInfoV2, error)
+	AssignDeals(ctx context.Context, sid abi.SectorID, ssize abi.SectorSize, currentHeight abi.ChainEpoch, spec *types.GetDealSpec) ([]*types2.AssignedDeal, error)
 	ReleaseDirectDeals(ctx context.Context, miner address.Address, allocationIDs []shared.AllocationId) error
 }
 
 var _ DealAssiger = (*dealAssigner)(nil)
 
-func NewDealAssigner(r repo.Repo, full v1api.FullNode) (DealAssiger, error) {
-	ps, err := newPieceStoreEx(r, full)
+func NewDealAssigner(cfg *config.MarketConfig, r repo.Repo, full v1api.FullNode) (DealAssiger, error) {
+	// an unknown strategy fails the start, rather than every sector the sealer asks deals for
+	if err := cfg.CheckPackingStrategy(); err != nil {
+		return nil, err
+	}
+	ps, err := newPieceStoreEx(cfg, r, full)
 	if err != nil {
 		return nil, fmt.Errorf("construct extend piece store %w", err)
 	}
@@ -42,18 +51,46 @@ func NewDealAssigner(r repo.Repo, full v1api.FullNode) (DealAssiger, error) {
 }
 
 type dealAssigner struct {
+	cfg  *config.MarketConfig
 	repo repo.Repo
 	full v1api.FullNode
 }
 
 // NewDsPieceStore returns a new piecestore based on the given datastore
-func newPieceStoreEx(r repo.Repo, full v1api.FullNode) (DealAssiger, error) {
+func newPieceStoreEx(cfg *config.MarketConfig, r repo.Repo, full v1api.FullNode) (DealAssiger, error) {
 	return &dealAssigner{
+		cfg:  cfg,
 		repo: r,
 		full: full,
 	}, nil
 }
 
+// packingSpec returns the spec to pack deals of the miner with its packing strategy,
+// the common one is used if the miner is not configured
+func (ps *dealAssigner) packingSpec(miner address.Address, spec *types.GetDealSpec) *dealSpec {
+	pCfg, err := ps.cfg.MinerProviderConfig(miner, true)
+	if err != nil {
+		pCfg = ps.cfg.CommonProvider
+	}
+	strategy := config.PackingGreedy
+	if pCfg != nil {
+		strategy = pCfg.PackingStrategy
+	}
+	return &dealSpec{GetDealSpec: spec, strategy: strategy}
+}
+
+// recordPacking reports the utilization of the sector packed with deals
+func recordPacking(ctx context.Context, sid abi.SectorID, strategy string, res *packResult) {
+	if res == nil {
+		return
+	}
+	maddr, _ := address.NewIDAddress(uint64(sid.Miner))
+	log.Infow("pack deals into sector", "miner", maddr, "sector", sid.Number, "strategy", strategy,
+		"deals", res.dealCount, "deal space", res.dealSpace, "utilization", res.utilization())
+	_ = stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(metrics.MinerAddressTag, maddr.String())},
+		metrics.SectorDealUtilization.M(res.utilization()))
+}
+
 func (ps *dealAssigner) MarkDealsAsPacking(ctx context.Context, miner address.Address, dealIDs []abi.DealID) error {
 	for _, dealID := range dealIDs {
 		md, err := ps.repo.StorageDealRepo().GetDealByDealID(ctx, miner, dealID)
@@ -202,76 +239,155 @@ func (ps *dealAssigner) AssignUnPackedDeals(ctx context.Context, sid abi.SectorI
 
 	// TODO: is this concurrent safe?
 	if err := ps.repo.Transaction(func(txRepo repo.TxRepo) error {
-		mds, err := txRepo.StorageDealRepo().GetDealsByPieceStatusAndDealStatus(ctx, maddr, types.Undefine, storagemarket.StorageDealAwaitingPreCommit)
+		deals, err := unPackedDeals(ctx, txRepo, maddr)
 		if err != nil {
 			return err
 		}
 
-		var deals []*types.DealInfoIncludePath
+		if len(deals) == 0 {
+			return nil
+		}
 
-		for _, md := range mds {
-			// 订单筛选和组合的逻辑完全由 pickAndAlign 完成
-			deals = append(deals, &types.DealInfoIncludePath{
-				DealProposal:    md.Proposal,
-				Offset:          md.Offset,
-				Length:          md.Proposal.PieceSize,
-				PayloadSize:     md.PayloadSize,
-				DealID:          md.DealID,
-				TotalStorageFee: md.Proposal.TotalStorageFee(),
-				FastRetrieval:   md.FastRetrieval,
-				PublishCid:      *md.PublishCid,
-			})
+		packSpec := ps.packingSpec(maddr, spec)
+		res, err := pickAndAlign(deals, ssize, currentHeight, packSpec)
+		if err != nil {
+			return fmt.Errorf("unable to pick and align pieces from deals: %w", err)
 		}
+		recordPacking(ctx, sid, packSpec.strategy, res)
+		pieces = res.storageDeals()
 
-		if len(deals) == 0 {
+		if len(pieces) == 0 {
 			return nil
 		}
 
-		// 按照尺寸, 时间, 价格排序
-		sort.Slice(deals, func(i, j int) bool {
-			left, right := deals[i], deals[j]
-			if left.PieceSize != right.PieceSize {
-				return left.PieceSize < right.PieceSize
-			}
+		return markPiecesAssigned(ctx, txRepo, sid, res)
+	}); err != nil {
+		return nil, err
+	}
 
-			if left.StartEpoch != right.StartEpoch {
-				return left.StartEpoch < right.StartEpoch
-			}
+	return pieces, nil
+}
+
+// unPackedDeals returns the storage deals waiting for a sector, sorted by size, start epoch and price
+func unPackedDeals(ctx context.Context, txRepo repo.TxRepo, maddr address.Address) ([]*types.DealInfoIncludePath, error) {
+	mds, err := txRepo.StorageDealRepo().GetDealsByPieceStatusAndDealStatus(ctx, maddr, types.Undefine, storagemarket.StorageDealAwaitingPreCommit)
+	if err != nil {
+		return nil, err
+	}
 
-			return left.StoragePricePerEpoch.GreaterThan(right.StoragePricePerEpoch)
+	var deals []*types.DealInfoIncludePath
+
+	for _, md := range mds {
+		// 订单筛选和组合的逻辑完全由 pickAndAlign 完成
+		// FastRetrieval tells the sealer to keep the unsealed copy, it's false if the client asked to remove it
+		deals = append(deals, &types.DealInfoIncludePath{
+			DealProposal:    md.Proposal,
+			Offset:          md.Offset,
+			Length:          md.Proposal.PieceSize,
+			PayloadSize:     md.PayloadSize,
+			DealID:          md.DealID,
+			TotalStorageFee: md.Proposal.TotalStorageFee(),
+			FastRetrieval:   md.FastRetrieval,
+			PublishCid:      *md.PublishCid,
 		})
+	}
 
-		pieces, err = pickAndAlign(deals, ssize, currentHeight, spec)
-		if err != nil {
-			return fmt.Errorf("unable to pick and align pieces from deals: %w", err)
+	// 按照尺寸, 时间, 价格排序
+	sort.Slice(deals, func(i, j int) bool {
+		left, right := deals[i], deals[j]
+		if left.PieceSize != right.PieceSize {
+			return left.PieceSize < right.PieceSize
 		}
 
-		if len(pieces) == 0 {
-			return nil
+		if left.StartEpoch != right.StartEpoch {
+			return left.StartEpoch < right.StartEpoch
 		}
 
-		for _, piece := range pieces {
-			if piece.DealID <= 0 || piece.PublishCid == cid.Undef {
+		return left.StoragePricePerEpoch.GreaterThan(right.StoragePricePerEpoch)
+	})
+
+	return deals, nil
+}
+
+// allocatedDirectDeals returns the direct deals waiting for a sector, sorted by size and start epoch
+func allocatedDirectDeals(ctx context.Context, txRepo repo.TxRepo, maddr address.Address) ([]*types.DirectDealInfo, error) {
+	mds, err := txRepo.DirectDealRepo().GetDealsByMinerAndState(ctx, maddr, types.DealAllocated)
+	if err != nil {
+		return nil, err
+	}
+
+	var deals []*types.DirectDealInfo
+
+	for _, md := range mds {
+		deals = append(deals, &types.DirectDealInfo{
+			AllocationID: verifreg.AllocationId(md.AllocationID),
+			Provider:     md.Provider,
+			Client:       md.Client,
+			PieceCID:     md.PieceCID,
+			PieceSize:    md.PieceSize,
+			Offset:       md.Offset,
+			Length:       md.PieceSize,
+			PayloadSize:  md.PayloadSize,
+			StartEpoch:   md.StartEpoch,
+			EndEpoch:     md.EndEpoch,
+		})
+	}
+
+	// 按照尺寸, 时间排序
+	sort.Slice(deals, func(i, j int) bool {
+		left, right := deals[i], deals[j]
+		if left.PieceSize != right.PieceSize {
+			return left.PieceSize < right.PieceSize
+		}
+
+		return left.StartEpoch < right.StartEpoch
+	})
+
+	return deals, nil
+}
+
+// markPiecesAssigned saves the sector and offset of the storage deals and direct deals packed into the sector
+func markPiecesAssigned(ctx context.Context, txRepo repo.TxRepo, sid abi.SectorID, res *packResult) error {
+	maddr, err := address.NewIDAddress(uint64(sid.Miner))
+	if err != nil {
+		return err
+	}
+
+	for _, piece := range res.pieces {
+		switch {
+		case piece.deal != nil:
+			if piece.deal.DealID <= 0 || piece.deal.PublishCid == cid.Undef {
 				continue
 			}
-			md, err := txRepo.StorageDealRepo().GetDealByDealID(ctx, maddr, piece.DealID)
+			md, err := txRepo.StorageDealRepo().GetDealByDealID(ctx, maddr, piece.deal.DealID)
 			if err != nil {
 				return err
 			}
 
 			md.PieceStatus = types.Assigned
-			md.Offset = piece.Offset
+			md.Offset = piece.offset
 			md.SectorNumber = sid.Number
 			if err := txRepo.StorageDealRepo().SaveDealWithStatus(ctx, md, []types.PieceStatus{types.Undefine}); err != nil {
 				return err
 			}
+		case piece.directDeal != nil:
+			if piece.directDeal.AllocationID <= 0 {
+				continue
+			}
+			md, err := txRepo.DirectDealRepo().GetDealByAllocationID(ctx, uint64(piece.directDeal.AllocationID))
+			if err != nil {
+				return err
+			}
+
+			md.Offset = piece.offset
+			md.SectorID = sid.Number
+			md.State = types.DealSealing
+			if err := txRepo.DirectDealRepo().SaveDealWithState(ctx, md, types.DealAllocated); err != nil {
+				return err
+			}
 		}
-		return nil
-	}); err != nil {
-		return nil, err
 	}
-
-	return pieces, nil
+	return nil
 }
 
 func (ps *dealAssigner) ReleaseDeals(ctx context.Context, miner address.Address, deals []abi.DealID) error {
@@ -338,7 +454,9 @@ func (ps *dealAssigner) ReleaseDirectDeals(ctx context.Context, miner address.Ad
 	})
 }
 
-func (ps *dealAssigner) assignDirectDeals(ctx context.Context, sid abi.SectorID, ssize abi.SectorSize, currentHeight abi.ChainEpoch, spec *types.GetDealSpec) ([]*types.DirectDealInfo, error) {
+// AssignDeals packs the storage deals and direct deals of the miner into one sector, the kind of each piece
+// is set in AssignedDeal.Kind, and AssignedDeal.KeepUnsealed tells the sealer whether to keep the unsealed copy.
+func (ps *dealAssigner) AssignDeals(ctx context.Context, sid abi.SectorID, ssize abi.SectorSize, currentHeight abi.ChainEpoch, spec *types.GetDealSpec) ([]*types2.AssignedDeal, error) {
 	maddr, err := address.NewIDAddress(uint64(sid.Miner))
 	if err != nil {
 		return nil, err
@@ -348,135 +466,73 @@ func (ps *dealAssigner) assignDirectDeals(ctx context.Context, sid abi.SectorID,
 		spec = defaultGetDealSpec
 	}
 
-	var pieces []*types.DirectDealInfo
+	var res *packResult
+	var errs *multierror.Error
+	packSpec := ps.packingSpec(maddr, spec)
 
 	// TODO: is this concurrent safe?
 	if err := ps.repo.Transaction(func(txRepo repo.TxRepo) error {
-		mds, err := txRepo.DirectDealRepo().GetDealsByMinerAndState(ctx, maddr, types.DealAllocated)
+		var pieces []*packingPiece
+
+		// a failure of one kind doesn't stop the other kind of deals to be assigned
+		deals, err := unPackedDeals(ctx, txRepo, maddr)
+		if err == nil {
+			deals, err = filterDeals(deals, currentHeight, spec)
+		}
 		if err != nil {
-			return err
+			log.Errorf("load unpacked deals failed: %v", err)
+			errs = multierror.Append(errs, err)
 		}
-
-		var deals []*types.DirectDealInfo
-
-		for _, md := range mds {
-			// 订单筛选和组合的逻辑完全由 pickAndAlign 完成
-			deals = append(deals, &types.DirectDealInfo{
-				AllocationID: verifreg.AllocationId(md.AllocationID),
-				Provider:     md.Provider,
-				Client:       md.Client,
-				PieceCID:     md.PieceCID,
-				PieceSize:    md.PieceSize,
-				Offset:       md.Offset,
-				Length:       md.PieceSize,
-				PayloadSize:  md.PayloadSize,
-				StartEpoch:   md.StartEpoch,
-				EndEpoch:     md.EndEpoch,
-			})
+		for _, deal := range deals {
+			pieces = append(pieces, storageDealPiece(deal))
 		}
 
-		if len(deals) == 0 {
-			return nil
+		directDeals, err := allocatedDirectDeals(ctx, txRepo, maddr)
+		if err == nil {
+			directDeals, err = ps.filterDirectDeals(ctx, directDeals, currentHeight, spec)
+		}
+		if err != nil {
+			directDealLog.Errorf("load direct deals failed: %v", err)
+			errs = multierror.Append(errs, err)
+		}
+		for _, deal := range directDeals {
+			pieces = append(pieces, directDealPiece(deal))
 		}
 
-		// 按照尺寸, 时间, 价格排序
-		sort.Slice(deals, func(i, j int) bool {
-			left, right := deals[i], deals[j]
-			if left.PieceSize != right.PieceSize {
-				return left.PieceSize < right.PieceSize
+		// 按照尺寸, 时间排序
+		sort.SliceStable(pieces, func(i, j int) bool {
+			left, right := pieces[i], pieces[j]
+			if left.size != right.size {
+				return left.size < right.size
 			}
 
-			return left.StartEpoch < right.StartEpoch
+			return left.startEpoch < right.startEpoch
 		})
 
-		pieces, err = ps.pickAndAlignDirectDeal(ctx, deals, ssize, currentHeight, spec)
+		res, err = packPieces(pieces, ssize, packSpec)
 		if err != nil {
 			return fmt.Errorf("unable to pick and align pieces from deals: %w", err)
 		}
 
-		if len(pieces) == 0 {
+		if res == nil {
 			return nil
 		}
 
-		for _, piece := range pieces {
-			if piece.AllocationID <= 0 {
-				continue
-			}
-			md, err := txRepo.DirectDealRepo().GetDealByAllocationID(ctx, uint64(piece.AllocationID))
-			if err != nil {
-				return err
-			}
-
-			md.Offset = piece.Offset
-			md.SectorID = sid.Number
-			md.State = types.DealSealing
-			if err := txRepo.DirectDealRepo().SaveDealWithState(ctx, md, types.DealAllocated); err != nil {
-				return err
-			}
-		}
-		return nil
+		return markPiecesAssigned(ctx, txRepo, sid, res)
 	}); err != nil {
 		return nil, err
 	}
 
-	return pieces, nil
-}
-
-func (ps *dealAssigner) AssignDeals(ctx context.Context, sid abi.SectorID, ssize abi.SectorSize, currentHeight abi.ChainEpoch, spec *types.GetDealSpec) ([]*types.DealInfoV2, error) {
-	var errs *multierror.Error
-
-	deals, err := ps.assignDirectDeals(ctx, sid, ssize, currentHeight, spec)
-	if err != nil {
-		directDealLog.Errorf("assign direct deals failed: %v", err)
-		errs = multierror.Append(errs, err)
-	}
-
-	var out []*types.DealInfoV2
-	for _, d := range deals {
-		out = append(out, &types.DealInfoV2{
-			AllocationID: d.AllocationID,
-			PieceCID:     d.PieceCID,
-			PieceSize:    d.PieceSize,
-			Client:       d.Client,
-			Provider:     d.Provider,
-			Offset:       d.Offset,
-			Length:       d.Length,
-			PayloadSize:  d.PayloadSize,
-			StartEpoch:   d.StartEpoch,
-			EndEpoch:     d.EndEpoch,
-		})
-	}
-	if len(out) > 0 {
-		log.Infof("assigned direct deals %d for miner %v", len(deals), sid.Miner)
-		return out, nil
-	}
-
-	oldDeals, err := ps.AssignUnPackedDeals(ctx, sid, ssize, currentHeight, spec)
-	if err == nil {
-		for _, d := range oldDeals {
-			out = append(out, &types.DealInfoV2{
-				DealID:      d.DealID,
-				PublishCid:  d.PublishCid,
-				PieceCID:    d.PieceCID,
-				PieceSize:   d.PieceSize,
-				Client:      d.Client,
-				Provider:    d.Provider,
-				Offset:      d.Offset,
-				Length:      d.Length,
-				PayloadSize: d.PayloadSize,
-				StartEpoch:  d.StartEpoch,
-				EndEpoch:    d.EndEpoch,
-			})
-		}
-	} else {
-		directDealLog.Errorf("assign unpacked deals failed: %v", err)
-		errs = multierror.Append(errs, err)
-	}
-
+	out := res.dealInfos()
 	if len(out) == 0 {
 		return out, errs.ErrorOrNil()
 	}
-	log.Infof("assigned deals %d for miner %v", len(oldDeals), sid.Miner)
+	recordPacking(ctx, sid, packSpec.strategy, res)
+	for _, d := range out {
+		log.Debugw("assign piece", "sector", sid, "kind", d.Kind, "piece", d.PieceCID, "size", d.PieceSize,
+			"offset", d.Offset, "deal", d.DealID, "allocation", d.AllocationID, "keep unsealed", d.KeepUnsealed)
+	}
+	log.Infof("assigned deals %d for miner %v", res.dealCount, sid.Miner)
 
 	return out, nil
 }
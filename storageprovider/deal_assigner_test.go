@@ -0,0 +1,130 @@
+package storageprovider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/badger"
+
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func TestAssignMixedDeals(t *testing.T) {
+	ctx := context.Background()
+	r, err := badger.NewMemRepo()
+	require.NoError(t, err)
+
+	sid := abi.SectorID{Miner: 1000, Number: 1}
+	mAddr, err := address.NewIDAddress(uint64(sid.Miner))
+	require.NoError(t, err)
+
+	var deal types.MinerDeal
+	testutil.Provide(t, &deal)
+	deal.Proposal.Provider = mAddr
+	deal.Proposal.PieceSize = 512
+	deal.Proposal.StartEpoch = 100
+	deal.Proposal.EndEpoch = 1000
+	deal.DealID = 1
+	deal.State = storagemarket.StorageDealAwaitingPreCommit
+	deal.PieceStatus = types.Undefine
+	require.NoError(t, r.StorageDealRepo().SaveDeal(ctx, &deal))
+
+	var directDeal types.DirectDeal
+	testutil.Provide(t, &directDeal)
+	directDeal.Provider = mAddr
+	directDeal.PieceSize = 256
+	directDeal.AllocationID = 10
+	directDeal.StartEpoch = 100
+	directDeal.EndEpoch = 1000
+	directDeal.State = types.DealAllocated
+	require.NoError(t, r.DirectDealRepo().SaveDeal(ctx, &directDeal))
+
+	ps := &dealAssigner{
+		cfg:  &config.MarketConfig{CommonProvider: &config.ProviderConfig{PackingStrategy: config.PackingGreedy}},
+		repo: r,
+	}
+
+	// both kinds of deals are packed into one sector
+	out, err := ps.AssignDeals(ctx, sid, 1024, 0, nil)
+	require.NoError(t, err)
+	require.Len(t, out, 3)
+	kinds := make([]string, 0, len(out))
+	offsets := make([]abi.PaddedPieceSize, 0, len(out))
+	for _, d := range out {
+		kinds = append(kinds, d.Kind)
+		offsets = append(offsets, d.Offset)
+	}
+	require.Equal(t, []string{types2.DealKindDirect, types2.DealKindFiller, types2.DealKindBuiltinMarket}, kinds)
+	require.Equal(t, []abi.PaddedPieceSize{0, 256, 512}, offsets)
+	require.Equal(t, directDeal.AllocationID, uint64(out[0].AllocationID))
+	require.Equal(t, deal.DealID, out[2].DealID)
+	// the unsealed copies of direct deals are kept, fillers have nothing to keep
+	require.True(t, out[0].KeepUnsealed)
+	require.False(t, out[1].KeepUnsealed)
+	require.Equal(t, deal.FastRetrieval, out[2].KeepUnsealed)
+
+	gotDeal, err := r.StorageDealRepo().GetDeal(ctx, deal.ProposalCid)
+	require.NoError(t, err)
+	require.Equal(t, types.Assigned, gotDeal.PieceStatus)
+	require.Equal(t, sid.Number, gotDeal.SectorNumber)
+	require.Equal(t, abi.PaddedPieceSize(512), gotDeal.Offset)
+
+	gotDirectDeal, err := r.DirectDealRepo().GetDeal(ctx, directDeal.ID)
+	require.NoError(t, err)
+	require.Equal(t, types.DealSealing, gotDirectDeal.State)
+	require.Equal(t, sid.Number, gotDirectDeal.SectorID)
+	require.Equal(t, abi.PaddedPieceSize(0), gotDirectDeal.Offset)
+
+	// no deal left
+	out, err = ps.AssignDeals(ctx, abi.SectorID{Miner: sid.Miner, Number: 2}, 1024, 0, nil)
+	require.NoError(t, err)
+	require.Empty(t, out)
+}
+
+func TestAssignDealsKeepUnsealed(t *testing.T) {
+	ctx := context.Background()
+	r, err := badger.NewMemRepo()
+	require.NoError(t, err)
+
+	sid := abi.SectorID{Miner: 1000, Number: 1}
+	mAddr, err := address.NewIDAddress(uint64(sid.Miner))
+	require.NoError(t, err)
+
+	// FastRetrieval of a storage deal is false if the client set RemoveUnsealedCopy
+	keepUnsealed := map[abi.DealID]bool{}
+	for i, removeUnsealedCopy := range []bool{false, true} {
+		var deal types.MinerDeal
+		testutil.Provide(t, &deal)
+		deal.Proposal.Provider = mAddr
+		deal.Proposal.PieceSize = 512
+		deal.Proposal.StartEpoch = 100
+		deal.Proposal.EndEpoch = 1000
+		deal.DealID = abi.DealID(i + 1)
+		deal.State = storagemarket.StorageDealAwaitingPreCommit
+		deal.PieceStatus = types.Undefine
+		deal.FastRetrieval = !removeUnsealedCopy
+		require.NoError(t, r.StorageDealRepo().SaveDeal(ctx, &deal))
+		keepUnsealed[deal.DealID] = !removeUnsealedCopy
+	}
+
+	ps := &dealAssigner{
+		cfg:  &config.MarketConfig{CommonProvider: &config.ProviderConfig{PackingStrategy: config.PackingGreedy}},
+		repo: r,
+	}
+
+	out, err := ps.AssignDeals(ctx, sid, 1024, 0, nil)
+	require.NoError(t, err)
+	require.Len(t, out, 2)
+	for _, d := range out {
+		require.Equal(t, types2.DealKindBuiltinMarket, d.Kind)
+		require.Equal(t, keepUnsealed[d.DealID], d.KeepUnsealed, "deal %d", d.DealID)
+	}
+}
@@ -50,6 +50,9 @@ import (
 // TODO: These are copied from spec-actors master, use spec-actors exports when we update
 const DealMaxLabelSize = 256
 
+// maxPublishRetries is how many times a deal is published again after the publish message failed on chain
+const maxPublishRetries = 2
+
 type StorageDealHandler interface {
 	AcceptDeal(ctx context.Context, minerDeal *types.MinerDeal, dealParams *types2.DealParams) error
 	HandleOff(ctx context.Context, deal *types.MinerDeal) error
@@ -74,7 +77,8 @@ type StorageDealProcessImpl struct {
 	minerMgr        minermgr.IMinerMgr
 	pieceStorageMgr *piecestorage.PieceStorageManager
 
-	sdf config.StorageDealFilter
+	sdf     config.StorageDealFilter
+	limiter *DealLimiter
 }
 
 // NewStorageDealProcessImpl returns a new deal process instance
@@ -91,6 +95,7 @@ func NewStorageDealProcessImpl(
 	dataTransfer network2.ProviderDataTransfer,
 	dagStore stores.DAGStoreWrapper,
 	sdf config.StorageDealFilter,
+	limiter *DealLimiter,
 	pb *EventPublishAdapter,
 ) (StorageDealHandler, error) {
 	err := dataTransfer.RegisterVoucherType(requestvalidation.StorageDataTransferVoucherType, requestvalidation.NewUnifiedRequestValidator(&providerPushDeals{deals}, nil))
@@ -120,6 +125,7 @@ func NewStorageDealProcessImpl(
 		dagStore:        dagStore,
 		eventPublisher:  pb,
 		sdf:             sdf,
+		limiter:         limiter,
 	}, nil
 }
 
@@ -261,6 +267,11 @@ func (storageDealPorcess *StorageDealProcessImpl) AcceptDeal(ctx context.Context
 		return errors.New(reason)
 	}
 
+	// count the deal in the rate limits of client and peer after all checks passed
+	if err := storageDealPorcess.limiter.Accept(ctx, minerDeal); err != nil {
+		return fmt.Errorf("deal rate limit: %w", err)
+	}
+
 	return nil
 }
 
@@ -275,13 +286,22 @@ func (storageDealPorcess *StorageDealProcessImpl) HandleOff(ctx context.Context,
 			return storageDealPorcess.HandleError(ctx, deal, err)
 		}
 
-		// finalize the blockstore as we're done writing deal data to it.
-		if err := storageDealPorcess.FinalizeBlockstore(deal.ProposalCid); err != nil {
-			err = fmt.Errorf("failed to finalize read/write blockstore: %w", err)
-			return handleErr(err)
-		}
+		var pieceCid cid.Cid
+		var metadataPath filestore.Path
+		var storage string
+		var err error
+		if IsOnlineTransfer(deal.Ref.TransferType) {
+			// data of online deal was written to piece storage directly
+			pieceCid, storage, err = storageDealPorcess.generatePieceCommitmentFromStorage(ctx, deal)
+		} else {
+			// finalize the blockstore as we're done writing deal data to it.
+			if err := storageDealPorcess.FinalizeBlockstore(deal.ProposalCid); err != nil {
+				err = fmt.Errorf("failed to finalize read/write blockstore: %w", err)
+				return handleErr(err)
+			}
 
-		pieceCid, metadataPath, err := storageDealPorcess.GeneratePieceCommitment(deal.ProposalCid, deal.InboundCAR, deal.Proposal.PieceSize)
+			pieceCid, metadataPath, err = storageDealPorcess.GeneratePieceCommitment(deal.ProposalCid, deal.InboundCAR, deal.Proposal.PieceSize)
+		}
 		if err != nil {
 			err = fmt.Errorf("error generating CommP: %w", err)
 			return handleErr(err)
@@ -289,8 +309,12 @@ func (storageDealPorcess *StorageDealProcessImpl) HandleOff(ctx context.Context,
 
 		// Verify CommP matches
 		if pieceCid != deal.Proposal.PieceCID {
-			err = fmt.Errorf("proposal CommP doesn't match calculated CommP")
-			return handleErr(err)
+			if len(storage) != 0 {
+				// the data in piece storage doesn't match its piece cid, stop serving it to the other deals of the piece,
+				// so their data is transferred again
+				storageDealPorcess.pieceStorageMgr.MarkCorrupted(ctx, deal.Proposal.PieceCID, storage, errCommPMismatch.Error())
+			}
+			return handleErr(errCommPMismatch)
 		}
 
 		deal.PiecePath = filestore.Path("")
@@ -378,57 +402,70 @@ func (storageDealPorcess *StorageDealProcessImpl) HandleOff(ctx context.Context,
 		}
 	}
 
-	if deal.State == storagemarket.StorageDealPublish {
-		log.Debugf("publish deal %s", deal.ProposalCid)
-		smDeal := types.MinerDeal{
-			Client:             deal.Client,
-			ClientDealProposal: deal.ClientDealProposal,
-			ProposalCid:        deal.ProposalCid,
-			State:              deal.State,
-			Ref:                deal.Ref,
-		}
-
-		pdMCid, err := node.PublishDeals(ctx, smDeal)
-		if err != nil {
-			storageDealPorcess.eventPublisher.Publish(storagemarket.ProviderEventNodeErrored, deal)
-			storageDealPorcess.eventPublisher.Publish(storagemarket.ProviderEventDealPublishError, deal)
-			return storageDealPorcess.HandleError(ctx, deal, fmt.Errorf("publishing deal: %w", err))
-		}
-		storageDealPorcess.eventPublisher.Publish(storagemarket.ProviderEventDealPublishInitiated, deal)
-		deal.PublishCid = &pdMCid
-
-		deal.State = storagemarket.StorageDealPublishing
-		err = storageDealPorcess.deals.SaveDeal(ctx, deal)
-		if err != nil {
-			return storageDealPorcess.HandleError(ctx, deal, fmt.Errorf("fail to save deal to database"))
-		}
-	}
+	for publishRetries := 0; deal.State == storagemarket.StorageDealPublish || deal.State == storagemarket.StorageDealPublishing; publishRetries++ {
+		if deal.State == storagemarket.StorageDealPublish {
+			log.Debugf("publish deal %s", deal.ProposalCid)
+			smDeal := types.MinerDeal{
+				Client:             deal.Client,
+				ClientDealProposal: deal.ClientDealProposal,
+				ProposalCid:        deal.ProposalCid,
+				State:              deal.State,
+				Ref:                deal.Ref,
+			}
 
-	if deal.State == storagemarket.StorageDealPublishing { // WaitForPublish
-		log.Debugf("wait for publish deal %s, publishCid: %s", deal.ProposalCid, deal.PublishCid)
-		if deal.PublishCid != nil {
-			res, err := storageDealPorcess.spn.WaitForPublishDeals(ctx, *deal.PublishCid, deal.Proposal)
+			pdMCid, err := node.PublishDeals(ctx, smDeal)
 			if err != nil {
 				storageDealPorcess.eventPublisher.Publish(storagemarket.ProviderEventNodeErrored, deal)
 				storageDealPorcess.eventPublisher.Publish(storagemarket.ProviderEventDealPublishError, deal)
-				return storageDealPorcess.HandleError(ctx, deal, fmt.Errorf("PublishStorageDeals errored: %w", err))
+				return storageDealPorcess.HandleError(ctx, deal, fmt.Errorf("publishing deal: %w", err))
 			}
-			storageDealPorcess.eventPublisher.Publish(storagemarket.ProviderEventDealPublished, deal)
-
-			// Once the deal has been published, release funds that were reserved
-			// for deal publishing
-			storageDealPorcess.releaseReservedFunds(ctx, deal)
-			storageDealPorcess.eventPublisher.Publish(storagemarket.ProviderEventFundsReleased, deal)
+			storageDealPorcess.eventPublisher.Publish(storagemarket.ProviderEventDealPublishInitiated, deal)
+			deal.PublishCid = &pdMCid
 
-			deal.DealID = res.DealID
-			deal.PublishCid = &res.FinalCid
-			deal.State = storagemarket.StorageDealStaged
+			deal.State = storagemarket.StorageDealPublishing
 			err = storageDealPorcess.deals.SaveDeal(ctx, deal)
 			if err != nil {
 				return storageDealPorcess.HandleError(ctx, deal, fmt.Errorf("fail to save deal to database"))
 			}
-		} else {
-			return storageDealPorcess.HandleError(ctx, deal, fmt.Errorf("state stop at StorageDealPublishing but not found publish cid"))
+		}
+
+		if deal.State == storagemarket.StorageDealPublishing { // WaitForPublish
+			log.Debugf("wait for publish deal %s, publishCid: %s", deal.ProposalCid, deal.PublishCid)
+			if deal.PublishCid != nil {
+				res, err := storageDealPorcess.spn.WaitForPublishDeals(ctx, *deal.PublishCid, deal.Proposal)
+				if err != nil {
+					// the message failed on chain is usually caused by some of the deals in the batch,
+					// publish the deal again and the invalid deals are bisected out by gas estimation
+					if errors.Is(err, errPublishMsgFailed) && publishRetries < maxPublishRetries {
+						log.Warnf("publish message %s of deal %s failed, publish again: %v", deal.PublishCid, deal.ProposalCid, err)
+						deal.PublishCid = nil
+						deal.State = storagemarket.StorageDealPublish
+						if err := storageDealPorcess.deals.SaveDeal(ctx, deal); err != nil {
+							return storageDealPorcess.HandleError(ctx, deal, fmt.Errorf("fail to save deal to database"))
+						}
+						continue
+					}
+					storageDealPorcess.eventPublisher.Publish(storagemarket.ProviderEventNodeErrored, deal)
+					storageDealPorcess.eventPublisher.Publish(storagemarket.ProviderEventDealPublishError, deal)
+					return storageDealPorcess.HandleError(ctx, deal, fmt.Errorf("PublishStorageDeals errored: %w", err))
+				}
+				storageDealPorcess.eventPublisher.Publish(storagemarket.ProviderEventDealPublished, deal)
+
+				// Once the deal has been published, release funds that were reserved
+				// for deal publishing
+				storageDealPorcess.releaseReservedFunds(ctx, deal)
+				storageDealPorcess.eventPublisher.Publish(storagemarket.ProviderEventFundsReleased, deal)
+
+				deal.DealID = res.DealID
+				deal.PublishCid = &res.FinalCid
+				deal.State = storagemarket.StorageDealStaged
+				err = storageDealPorcess.deals.SaveDeal(ctx, deal)
+				if err != nil {
+					return storageDealPorcess.HandleError(ctx, deal, fmt.Errorf("fail to save deal to database"))
+				}
+			} else {
+				return storageDealPorcess.HandleError(ctx, deal, fmt.Errorf("state stop at StorageDealPublishing but not found publish cid"))
+			}
 		}
 	}
 
@@ -549,11 +586,15 @@ func (storageDealPorcess *StorageDealProcessImpl) savePieceFile(ctx context.Cont
 
 	_, err := storageDealPorcess.pieceStorageMgr.FindStorageForRead(ctx, pieceCid.String())
 	if err != nil {
-		ps, err := storageDealPorcess.pieceStorageMgr.FindStorageForWrite(int64(payloadSize))
+		// reserve the space while writing, so the imports and transfers in parallel won't overfill a storage
+		key := deal.ProposalCid.String()
+		ps, err := storageDealPorcess.pieceStorageMgr.ReserveForWrite(key, int64(payloadSize), placementTag(deal))
 		if err != nil {
 			return err
 		}
-		_, err = ps.SaveTo(ctx, pieceCid.String(), reader)
+		defer storageDealPorcess.pieceStorageMgr.Release(key)
+
+		_, err = storageDealPorcess.pieceStorageMgr.SaveTo(ctx, ps, pieceCid.String(), deal.Proposal.PieceSize, reader)
 		if err != nil {
 			return err
 		}
@@ -758,18 +799,58 @@ func (storageDealPorcess *StorageDealProcessImpl) GeneratePieceCommitment(propos
 	if err != nil {
 		return cid.Undef, "", fmt.Errorf("failed to get car data reader: %w", err)
 	}
+
+	pieceCid, err := pieceCommitment(dr, rd.Header.DataSize, dealSize)
+	if err != nil {
+		return cid.Undef, "", err
+	}
+
+	return pieceCid, filestore.Path(""), nil
+}
+
+// generatePieceCommitmentFromStorage generates the pieceCid for the deal payload which had been saved to piece storage,
+// the name of the storage is returned too. The data verified since it was written is not read again.
+func (storageDealPorcess *StorageDealProcessImpl) generatePieceCommitmentFromStorage(ctx context.Context, deal *types.MinerDeal) (cid.Cid, string, error) {
+	pieceCid := deal.Proposal.PieceCID.String()
+	ps, err := storageDealPorcess.pieceStorageMgr.FindStorageForRead(ctx, pieceCid)
+	if err != nil {
+		return cid.Undef, "", err
+	}
+	verification, err := storageDealPorcess.pieceStorageMgr.GetVerification(ctx, deal.Proposal.PieceCID, ps.GetName())
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		log.Warnf("get verification of piece %s in %s: %v", pieceCid, ps.GetName(), err)
+	}
+	if err == nil && verification != nil && verification.State == types2.PieceVerified {
+		log.Debugf("piece %s in %s was verified at %d, skip generating CommP", pieceCid, ps.GetName(), verification.UpdatedAt)
+		return deal.Proposal.PieceCID, ps.GetName(), nil
+	}
+	size, err := ps.Len(ctx, pieceCid)
+	if err != nil {
+		return cid.Undef, "", fmt.Errorf("failed to get payload size: %w", err)
+	}
+	r, err := ps.GetReaderCloser(ctx, pieceCid)
+	if err != nil {
+		return cid.Undef, "", fmt.Errorf("failed to get reader from piece storage: %w", err)
+	}
+	defer r.Close() // nolint
+
+	commP, err := pieceCommitment(r, uint64(size), deal.Proposal.PieceSize)
+	return commP, ps.GetName(), err
+}
+
+func pieceCommitment(r io.Reader, payloadSize uint64, dealSize abi.PaddedPieceSize) (cid.Cid, error) {
 	w := &writer.Writer{}
-	written, err := io.Copy(w, dr)
+	written, err := io.Copy(w, r)
 	if err != nil {
-		return cid.Undef, "", fmt.Errorf("failed to write to CommP writer: %w", err)
+		return cid.Undef, fmt.Errorf("failed to write to CommP writer: %w", err)
 	}
-	if written != int64(rd.Header.DataSize) {
-		return cid.Undef, "", fmt.Errorf("number of bytes written to CommP writer %d not equal to the CARv1 payload size %d", written, rd.Header.DataSize)
+	if written != int64(payloadSize) {
+		return cid.Undef, fmt.Errorf("number of bytes written to CommP writer %d not equal to the payload size %d", written, payloadSize)
 	}
 
 	cidAndSize, err := w.Sum()
 	if err != nil {
-		return cid.Undef, "", fmt.Errorf("failed to get CommP: %w", err)
+		return cid.Undef, fmt.Errorf("failed to get CommP: %w", err)
 	}
 
 	if cidAndSize.PieceSize < dealSize {
@@ -781,10 +862,10 @@ func (storageDealPorcess *StorageDealProcessImpl) GeneratePieceCommitment(propos
 			uint64(dealSize),
 		)
 		if err != nil {
-			return cid.Undef, "", err
+			return cid.Undef, err
 		}
 		cidAndSize.PieceCID, _ = commcid.DataCommitmentV1ToCID(rawPaddedCommp)
 	}
 
-	return cidAndSize.PieceCID, filestore.Path(""), err
+	return cidAndSize.PieceCID, nil
 }
@@ -0,0 +1,216 @@
+package storageprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/dealfilter"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const hourWindow = time.Hour
+
+// DealLimiter limits the storage deals accepted from each client address and each peer of a miner.
+// The accepted deals are counted by the quota shared with the deal filter rules.
+type DealLimiter struct {
+	cfg   *config.MarketConfig
+	deals repo.StorageDealRepo
+	// quota counts the accepted deals for the rate limits and the client quotas of the deal filter rules
+	quota *dealfilter.Quota
+
+	// lk makes checking and counting an accepted deal atomic, the repo is never queried with it held
+	lk sync.Mutex
+}
+
+func NewDealLimiter(cfg *config.MarketConfig, r repo.Repo) *DealLimiter {
+	return &DealLimiter{
+		cfg:   cfg,
+		deals: r.StorageDealRepo(),
+		quota: dealfilter.NewQuota(r.StorageDealRepo()),
+	}
+}
+
+// CheckLimit returns an error if the client or the peer of the deal has reached the limits, the deal is not counted
+func (l *DealLimiter) CheckLimit(ctx context.Context, deal *types.MinerDeal) error {
+	limit, err := l.limit(deal.Proposal.Provider)
+	if err != nil || limit == nil {
+		return err
+	}
+	transfers, err := l.prepare(ctx, limit, deal)
+	if err != nil {
+		return err
+	}
+
+	return l.check(limit, deal, transfers)
+}
+
+// Accept checks the limits and counts the deal when it is accepted
+func (l *DealLimiter) Accept(ctx context.Context, deal *types.MinerDeal) error {
+	limit, err := l.limit(deal.Proposal.Provider)
+	if err != nil {
+		return err
+	}
+	transfers, err := l.prepare(ctx, limit, deal)
+	if err != nil {
+		return err
+	}
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if limit != nil {
+		if err := l.check(limit, deal, transfers); err != nil {
+			return err
+		}
+	}
+	l.quota.Record(deal, time.Now())
+
+	return nil
+}
+
+// Quota returns the accepted deals counted for the deal filter
+func (l *DealLimiter) Quota() *dealfilter.Quota {
+	return l.quota
+}
+
+// Usage lists the usage of the clients and peers which sent deals to the miner in the last day
+func (l *DealLimiter) Usage(ctx context.Context, mAddr address.Address) ([]types2.DealUsage, error) {
+	if err := l.quota.Load(ctx, mAddr); err != nil {
+		return nil, err
+	}
+	transfers, err := l.countTransfers(ctx, mAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[dealfilter.QuotaKey]struct{})
+	for _, key := range l.quota.Keys(mAddr) {
+		keys[key] = struct{}{}
+	}
+	for key := range transfers {
+		keys[key] = struct{}{}
+	}
+
+	out := make([]types2.DealUsage, 0, len(keys))
+	for key := range keys {
+		deals, _ := l.quota.Count(key, hourWindow)
+		_, size := l.quota.Count(key, dealfilter.QuotaWindow)
+		out = append(out, types2.DealUsage{
+			Miner:               key.Miner,
+			Kind:                key.Kind,
+			ID:                  key.ID,
+			DealsLastHour:       deals,
+			BytesLastDay:        size,
+			ConcurrentTransfers: transfers[key],
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].ID < out[j].ID
+	})
+
+	return out, nil
+}
+
+// Reset clears the counted deals of the client address or peer id, all usage of the miner is cleared if id is empty.
+// The transfers in progress are still counted.
+func (l *DealLimiter) Reset(ctx context.Context, mAddr address.Address, id string) error {
+	if err := l.quota.Load(ctx, mAddr); err != nil {
+		return err
+	}
+	l.quota.Reset(mAddr, id)
+
+	return nil
+}
+
+func (l *DealLimiter) limit(mAddr address.Address) (*config.DealRateLimit, error) {
+	pCfg, err := l.cfg.MinerProviderConfig(mAddr, true)
+	if err != nil {
+		return nil, err
+	}
+	if pCfg == nil || pCfg.DealRateLimit == nil {
+		return nil, nil
+	}
+	limit := pCfg.DealRateLimit
+	if limit.Client == (config.RateLimit{}) && limit.Peer == (config.RateLimit{}) {
+		return nil, nil
+	}
+
+	return limit, nil
+}
+
+// prepare loads the accepted deals of the miner, and counts the transfers if the deal is online and
+// the concurrent transfers are limited
+func (l *DealLimiter) prepare(ctx context.Context, limit *config.DealRateLimit, deal *types.MinerDeal) (map[dealfilter.QuotaKey]uint64, error) {
+	mAddr := deal.Proposal.Provider
+	if err := l.quota.Load(ctx, mAddr); err != nil {
+		return nil, err
+	}
+	if limit == nil || deal.Ref == nil || !IsOnlineTransfer(deal.Ref.TransferType) ||
+		(limit.Client.ConcurrentTransfers == 0 && limit.Peer.ConcurrentTransfers == 0) {
+		return nil, nil
+	}
+
+	return l.countTransfers(ctx, mAddr)
+}
+
+func (l *DealLimiter) check(limit *config.DealRateLimit, deal *types.MinerDeal, transfers map[dealfilter.QuotaKey]uint64) error {
+	mAddr := deal.Proposal.Provider
+	online := deal.Ref != nil && IsOnlineTransfer(deal.Ref.TransferType)
+	size := uint64(deal.Proposal.PieceSize)
+
+	for _, c := range []struct {
+		key   dealfilter.QuotaKey
+		limit config.RateLimit
+	}{
+		{key: dealfilter.ClientQuotaKey(mAddr, deal.Proposal.Client), limit: limit.Client},
+		{key: dealfilter.PeerQuotaKey(mAddr, deal.Client), limit: limit.Peer},
+	} {
+		deals, _ := l.quota.Count(c.key, hourWindow)
+		if c.limit.DealsPerHour != 0 && deals+1 > c.limit.DealsPerHour {
+			return fmt.Errorf("%s %s reached the limit of %d deals per hour", c.key.Kind, c.key.ID, c.limit.DealsPerHour)
+		}
+		_, bytes := l.quota.Count(c.key, dealfilter.QuotaWindow)
+		if c.limit.BytesPerDay != 0 && bytes+size > c.limit.BytesPerDay {
+			return fmt.Errorf("%s %s reached the limit of %d bytes per day", c.key.Kind, c.key.ID, c.limit.BytesPerDay)
+		}
+
+		if online && c.limit.ConcurrentTransfers != 0 && transfers[c.key]+1 > c.limit.ConcurrentTransfers {
+			return fmt.Errorf("%s %s reached the limit of %d concurrent transfers", c.key.Kind, c.key.ID, c.limit.ConcurrentTransfers)
+		}
+	}
+
+	return nil
+}
+
+// countTransfers counts the online deals which are waiting for or receiving data of each client and peer
+func (l *DealLimiter) countTransfers(ctx context.Context, mAddr address.Address) (map[dealfilter.QuotaKey]uint64, error) {
+	deals, err := l.deals.GetDealByAddrAndStatus(ctx, mAddr, storagemarket.StorageDealWaitingForData, storagemarket.StorageDealTransferring)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return nil, fmt.Errorf("list transferring deals of %s: %w", mAddr, err)
+	}
+
+	transfers := make(map[dealfilter.QuotaKey]uint64)
+	for _, deal := range deals {
+		if deal.Ref == nil || !IsOnlineTransfer(deal.Ref.TransferType) {
+			continue
+		}
+		transfers[dealfilter.ClientQuotaKey(mAddr, deal.Proposal.Client)]++
+		transfers[dealfilter.PeerQuotaKey(mAddr, deal.Client)]++
+	}
+
+	return transfers, nil
+}
@@ -0,0 +1,129 @@
+package storageprovider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/dealfilter"
+	"github.com/ipfs-force-community/droplet/v2/models/badger"
+
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	vTypes "github.com/filecoin-project/venus/venus-shared/types"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func init() {
+	testutil.MustRegisterDefaultValueProvier(func(t *testing.T) vTypes.DealLabel {
+		l, err := vTypes.NewLabelFromBytes([]byte{})
+		require.NoError(t, err)
+		return l
+	})
+}
+
+func TestDealLimiter(t *testing.T) {
+	ctx := context.Background()
+	r, err := badger.NewMemRepo()
+	require.NoError(t, err)
+
+	addrGetter := address.NewForTestGetter()
+	mAddr, client, client2 := addrGetter(), addrGetter(), addrGetter()
+	peer1, peer2 := peer.ID("peer1"), peer.ID("peer2")
+
+	cfg := &config.MarketConfig{
+		CommonProvider: &config.ProviderConfig{
+			DealRateLimit: &config.DealRateLimit{
+				Client: config.RateLimit{DealsPerHour: 2},
+				Peer:   config.RateLimit{BytesPerDay: 3 << 20, ConcurrentTransfers: 1},
+			},
+		},
+		Miners: []*config.MinerConfig{{Addr: config.Address(mAddr)}},
+	}
+	limiter := NewDealLimiter(cfg, r)
+
+	newDeal := func(client address.Address, p peer.ID, transferType string) *types.MinerDeal {
+		deal := &types.MinerDeal{Client: p, Ref: &storagemarket.DataRef{TransferType: transferType}}
+		deal.Proposal.Provider = mAddr
+		deal.Proposal.Client = client
+		deal.Proposal.PieceSize = abi.PaddedPieceSize(1 << 20)
+		return deal
+	}
+
+	// deals per hour of client
+	require.NoError(t, limiter.Accept(ctx, newDeal(client, peer1, storagemarket.TTManual)))
+	require.NoError(t, limiter.Accept(ctx, newDeal(client, peer1, storagemarket.TTManual)))
+	err = limiter.Accept(ctx, newDeal(client, peer1, storagemarket.TTManual))
+	require.ErrorContains(t, err, "deals per hour")
+
+	// the usage of peer is kept after resetting the client
+	require.NoError(t, limiter.Reset(ctx, mAddr, client.String()))
+	require.NoError(t, limiter.Accept(ctx, newDeal(client, peer1, storagemarket.TTManual)))
+	err = limiter.CheckLimit(ctx, newDeal(client, peer1, storagemarket.TTManual))
+	require.ErrorContains(t, err, "bytes per day")
+
+	usage, err := limiter.Usage(ctx, mAddr)
+	require.NoError(t, err)
+	require.Equal(t, []types2.DealUsage{
+		{Miner: mAddr, Kind: types2.DealUsageClient, ID: client.String(), DealsLastHour: 1, BytesLastDay: 1 << 20},
+		{Miner: mAddr, Kind: types2.DealUsagePeer, ID: peer1.String(), DealsLastHour: 3, BytesLastDay: 3 << 20},
+	}, usage)
+
+	// concurrent transfers of peer
+	var transferring types.MinerDeal
+	testutil.Provide(t, &transferring)
+	transferring.Client = peer2
+	transferring.Proposal.Provider = mAddr
+	transferring.Proposal.Client = client2
+	transferring.State = storagemarket.StorageDealTransferring
+	transferring.Ref = &storagemarket.DataRef{TransferType: TTHttp, Root: transferring.ProposalCid}
+	require.NoError(t, r.StorageDealRepo().SaveDeal(ctx, &transferring))
+
+	err = limiter.CheckLimit(ctx, newDeal(client2, peer2, TTHttp))
+	require.ErrorContains(t, err, "concurrent transfers")
+	require.NoError(t, limiter.CheckLimit(ctx, newDeal(client2, peer2, storagemarket.TTManual)))
+
+	// all usage of the miner is cleared
+	require.NoError(t, limiter.Reset(ctx, mAddr, ""))
+	usage, err = limiter.Usage(ctx, mAddr)
+	require.NoError(t, err)
+	require.Len(t, usage, 2)
+	for _, u := range usage {
+		require.Equal(t, uint64(0), u.DealsLastHour)
+		require.Equal(t, uint64(1), u.ConcurrentTransfers)
+	}
+}
+
+func TestDealLimiterCountsForDealFilter(t *testing.T) {
+	ctx := context.Background()
+	r, err := badger.NewMemRepo()
+	require.NoError(t, err)
+
+	addrGetter := address.NewForTestGetter()
+	mAddr, client := addrGetter(), addrGetter()
+	cfg := &config.MarketConfig{
+		CommonProvider: &config.ProviderConfig{},
+		Miners:         []*config.MinerConfig{{Addr: config.Address(mAddr)}},
+	}
+	limiter := NewDealLimiter(cfg, r)
+
+	// the deals are counted for the client quotas of the deal filter though no rate limit is set
+	deal := &types.MinerDeal{Client: peer.ID("peer1")}
+	deal.Proposal.Provider = mAddr
+	deal.Proposal.Client = client
+	deal.Proposal.PieceSize = abi.PaddedPieceSize(1 << 20)
+	require.NoError(t, limiter.CheckLimit(ctx, deal))
+	deals, _ := limiter.Quota().Count(dealfilter.ClientQuotaKey(mAddr, client), dealfilter.QuotaWindow)
+	require.Equal(t, uint64(0), deals)
+
+	require.NoError(t, limiter.Accept(ctx, deal))
+	deals, size := limiter.Quota().Count(dealfilter.ClientQuotaKey(mAddr, client), dealfilter.QuotaWindow)
+	require.Equal(t, uint64(1), deals)
+	require.Equal(t, uint64(1<<20), size)
+}
@@ -0,0 +1,415 @@
+package storageprovider
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-commp-utils/zerocomm"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+
+	"github.com/filecoin-project/venus/venus-shared/types"
+	mtypes "github.com/filecoin-project/venus/venus-shared/types/market"
+)
+
+var errUnknownPackingStrategy = fmt.Errorf("unknown packing strategy")
+
+// packingPiece is a piece to be packed into a sector, it is a storage deal, a direct deal or a filler
+type packingPiece struct {
+	size       abi.PaddedPieceSize
+	pieceCID   cid.Cid
+	startEpoch abi.ChainEpoch
+	client     address.Address
+	verified   bool
+	offset     abi.PaddedPieceSize
+	// keepUnsealed tells the sealer to keep an unsealed copy of the piece
+	keepUnsealed bool
+
+	deal       *mtypes.DealInfoIncludePath
+	directDeal *mtypes.DirectDealInfo
+}
+
+func (p *packingPiece) isFiller() bool {
+	return p.deal == nil && p.directDeal == nil
+}
+
+// storageDealPiece returns the piece of a storage deal, FastRetrieval of the deal is false
+// if the client set RemoveUnsealedCopy in the deal options
+func storageDealPiece(deal *mtypes.DealInfoIncludePath) *packingPiece {
+	return &packingPiece{
+		size:         deal.PieceSize,
+		pieceCID:     deal.PieceCID,
+		startEpoch:   deal.StartEpoch,
+		client:       deal.Client,
+		verified:     deal.VerifiedDeal,
+		keepUnsealed: deal.FastRetrieval,
+		deal:         deal,
+	}
+}
+
+// directDealPiece returns the piece of a direct deal, the data of direct deals are always verified.
+// A direct deal has no option to remove the unsealed copy, so it's always kept.
+func directDealPiece(deal *mtypes.DirectDealInfo) *packingPiece {
+	return &packingPiece{
+		size:         deal.PieceSize,
+		pieceCID:     deal.PieceCID,
+		startEpoch:   deal.StartEpoch,
+		client:       deal.Client,
+		verified:     true,
+		keepUnsealed: true,
+		directDeal:   deal,
+	}
+}
+
+func fillerPiece(size abi.PaddedPieceSize) *packingPiece {
+	return &packingPiece{
+		size:     size,
+		pieceCID: zerocomm.ZeroPieceCommitment(size.Unpadded()),
+	}
+}
+
+// dealSpec is the GetDealSpec of the sealer with the packing strategy of the miner, the strategy is resolved
+// from the miner config because GetDealSpec is shared with the sealers and has no field for it
+type dealSpec struct {
+	*mtypes.GetDealSpec
+	strategy string
+}
+
+// packResult is the pieces packed into a sector in order, including the fillers
+type packResult struct {
+	pieces     []*packingPiece
+	dealCount  int
+	dealSpace  abi.PaddedPieceSize
+	sectorSize abi.PaddedPieceSize
+}
+
+// utilization returns the ratio of the sector space used by deals
+func (r *packResult) utilization() float64 {
+	if r == nil || r.sectorSize == 0 {
+		return 0
+	}
+	return float64(r.dealSpace) / float64(r.sectorSize)
+}
+
+// storageDeals returns the storage deals and fillers, it is only used when no direct deal is packed
+func (r *packResult) storageDeals() []*mtypes.DealInfoIncludePath {
+	if r == nil {
+		return nil
+	}
+
+	out := make([]*mtypes.DealInfoIncludePath, 0, len(r.pieces))
+	for _, p := range r.pieces {
+		if p.isFiller() {
+			out = append(out, &mtypes.DealInfoIncludePath{
+				DealProposal: types.DealProposal{
+					PieceSize: p.size,
+					PieceCID:  p.pieceCID,
+				},
+			})
+			continue
+		}
+		p.deal.Offset = p.offset
+		out = append(out, p.deal)
+	}
+	return out
+}
+
+// directDeals returns the direct deals and fillers, it is only used when no storage deal is packed
+func (r *packResult) directDeals() []*mtypes.DirectDealInfo {
+	if r == nil {
+		return nil
+	}
+
+	out := make([]*mtypes.DirectDealInfo, 0, len(r.pieces))
+	for _, p := range r.pieces {
+		if p.isFiller() {
+			out = append(out, &mtypes.DirectDealInfo{
+				PieceSize: p.size,
+				PieceCID:  p.pieceCID,
+			})
+			continue
+		}
+		p.directDeal.Offset = p.offset
+		out = append(out, p.directDeal)
+	}
+	return out
+}
+
+// dealInfos returns all pieces in the sector with their kinds and whether to keep the unsealed copies,
+// storage deals have DealID and PublishCid, direct deals have AllocationID
+func (r *packResult) dealInfos() []*types2.AssignedDeal {
+	if r == nil {
+		return nil
+	}
+	out := make([]*types2.AssignedDeal, 0, len(r.pieces))
+	for _, p := range r.pieces {
+		info := &mtypes.DealInfoV2{
+			PieceCID:  p.pieceCID,
+			PieceSize: p.size,
+			Offset:    p.offset,
+		}
+		switch {
+		case p.deal != nil:
+			p.deal.Offset = p.offset
+			info.DealID = p.deal.DealID
+			info.PublishCid = p.deal.PublishCid
+			info.Client = p.deal.Client
+			info.Provider = p.deal.Provider
+			info.Length = p.deal.Length
+			info.PayloadSize = p.deal.PayloadSize
+			info.StartEpoch = p.deal.StartEpoch
+			info.EndEpoch = p.deal.EndEpoch
+		case p.directDeal != nil:
+			p.directDeal.Offset = p.offset
+			info.AllocationID = p.directDeal.AllocationID
+			info.Client = p.directDeal.Client
+			info.Provider = p.directDeal.Provider
+			info.Length = p.directDeal.Length
+			info.PayloadSize = p.directDeal.PayloadSize
+			info.StartEpoch = p.directDeal.StartEpoch
+			info.EndEpoch = p.directDeal.EndEpoch
+		}
+		out = append(out, types2.NewAssignedDeal(info, p.keepUnsealed))
+	}
+	return out
+}
+
+// packPieces packs the pieces into a sector with the strategy of spec, storage deals and direct deals can be packed in one pass.
+// The pieces must be sorted by size in ascending order and filtered by the epochs and piece sizes in spec.
+// It returns nil if the pieces don't match MinPiece or MinUsedSpace of spec.
+func packPieces(pieces []*packingPiece, ssize abi.SectorSize, spec *dealSpec) (*packResult, error) {
+	space := abi.PaddedPieceSize(ssize)
+	if err := space.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %d", errInvalidSpaceSize, space)
+	}
+
+	if len(pieces) == 0 {
+		return nil, nil
+	}
+
+	limits := spec.GetDealSpec
+	maxPiece := 0
+	if limits != nil {
+		maxPiece = limits.MaxPiece
+	}
+	strategy := spec.strategy
+
+	var res *packResult
+	var err error
+	switch strategy {
+	case "", config.PackingGreedy:
+		res, err = packGreedy(pieces, space, maxPiece)
+	case config.PackingBestFitDecreasing, config.PackingDeadlineFirst, config.PackingAffinity:
+		for i, p := range pieces {
+			if p.size.Validate() != nil {
+				return nil, fmt.Errorf("%w: #%d deal size: %d", errInvalidDealPieceSize, i, p.size)
+			}
+		}
+		res, err = packOrdered(orderPieces(pieces, strategy), space, maxPiece)
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnknownPackingStrategy, strategy)
+	}
+	if err != nil || res == nil {
+		return nil, err
+	}
+
+	// not enough deals
+	if limits != nil && limits.MinPiece > 0 && res.dealCount < limits.MinPiece {
+		return nil, nil
+	}
+
+	// not enough space for deals
+	if limits != nil && limits.MinUsedSpace > 0 && uint64(res.dealSpace) < limits.MinUsedSpace {
+		return nil, nil
+	}
+
+	return res, nil
+}
+
+// packGreedy picks the pieces in order, a filler is put before the piece which is not aligned with the offset
+func packGreedy(pieces []*packingPiece, space abi.PaddedPieceSize, maxPiece int) (*packResult, error) {
+	if pieces[0].size.Validate() != nil {
+		return nil, fmt.Errorf("%w: first deal size: %d", errInvalidDealPieceSize, pieces[0].size)
+	}
+
+	res := &packResult{sectorSize: space}
+	di := 0
+	checked := 0
+
+	var offset abi.PaddedPieceSize
+	for di < len(pieces) {
+		piece := pieces[di]
+		if di != checked {
+			if psize := piece.size; psize.Validate() != nil {
+				return nil, fmt.Errorf("%w: #%d deal size: %d", errInvalidDealPieceSize, di, psize)
+			}
+
+			// deals unordered
+			if di > 0 && piece.size < pieces[di-1].size {
+				return nil, errDealsUnOrdered
+			}
+
+			checked = di
+		}
+
+		// deal limit
+		if maxPiece > 0 && res.dealCount >= maxPiece {
+			break
+		}
+
+		// not enough for next deal
+		if piece.size > space {
+			break
+		}
+
+		nextPiece := nextAlignedPiece(space)
+		// next piece cantainer is not enough, we should put a zeroed-piece
+		if piece.size > nextPiece {
+			filler := fillerPiece(nextPiece)
+			filler.offset = offset
+			res.pieces = append(res.pieces, filler)
+
+			space -= nextPiece
+			offset += nextPiece
+			continue
+		}
+
+		piece.offset = offset
+		res.pieces = append(res.pieces, piece)
+		res.dealCount++
+		res.dealSpace += piece.size
+
+		space -= piece.size
+		offset += piece.size
+		di++
+	}
+
+	// no deals picked, we just do nothing here
+	if len(res.pieces) == 0 {
+		return nil, nil
+	}
+
+	return res, fillRemaining(res, space, offset)
+}
+
+// orderPieces returns the pieces in the order they are picked by the strategy
+func orderPieces(pieces []*packingPiece, strategy string) []*packingPiece {
+	ordered := make([]*packingPiece, len(pieces))
+	copy(ordered, pieces)
+
+	switch strategy {
+	case config.PackingBestFitDecreasing:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			if ordered[i].size != ordered[j].size {
+				return ordered[i].size > ordered[j].size
+			}
+			return ordered[i].startEpoch < ordered[j].startEpoch
+		})
+	case config.PackingDeadlineFirst:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			if ordered[i].startEpoch != ordered[j].startEpoch {
+				return ordered[i].startEpoch < ordered[j].startEpoch
+			}
+			return ordered[i].size > ordered[j].size
+		})
+	case config.PackingAffinity:
+		type group struct {
+			pieces   []*packingPiece
+			size     abi.PaddedPieceSize
+			minStart abi.ChainEpoch
+		}
+		type groupKey struct {
+			client   address.Address
+			verified bool
+		}
+		var groups []*group
+		groupOf := make(map[groupKey]*group)
+		for _, p := range pieces {
+			key := groupKey{client: p.client, verified: p.verified}
+			g, ok := groupOf[key]
+			if !ok {
+				g = &group{minStart: p.startEpoch}
+				groupOf[key] = g
+				groups = append(groups, g)
+			}
+			g.pieces = append(g.pieces, p)
+			g.size += p.size
+			if p.startEpoch < g.minStart {
+				g.minStart = p.startEpoch
+			}
+		}
+		// the group which fills most of the sector goes first
+		sort.SliceStable(groups, func(i, j int) bool {
+			if groups[i].size != groups[j].size {
+				return groups[i].size > groups[j].size
+			}
+			return groups[i].minStart < groups[j].minStart
+		})
+		ordered = ordered[:0]
+		for _, g := range groups {
+			sort.SliceStable(g.pieces, func(i, j int) bool {
+				return g.pieces[i].size > g.pieces[j].size
+			})
+			ordered = append(ordered, g.pieces...)
+		}
+	}
+
+	return ordered
+}
+
+// packOrdered picks the pieces which fit the remaining space in order, then lays them out from the largest,
+// the sizes of pieces are powers of 2, so all pieces are aligned without fillers between them.
+func packOrdered(ordered []*packingPiece, space abi.PaddedPieceSize, maxPiece int) (*packResult, error) {
+	res := &packResult{sectorSize: space}
+	for _, p := range ordered {
+		if maxPiece > 0 && res.dealCount >= maxPiece {
+			break
+		}
+		if p.size > space {
+			continue
+		}
+		res.pieces = append(res.pieces, p)
+		res.dealCount++
+		res.dealSpace += p.size
+		space -= p.size
+	}
+
+	if len(res.pieces) == 0 {
+		return nil, nil
+	}
+
+	sort.SliceStable(res.pieces, func(i, j int) bool {
+		return res.pieces[i].size > res.pieces[j].size
+	})
+	var offset abi.PaddedPieceSize
+	for _, p := range res.pieces {
+		p.offset = offset
+		offset += p.size
+	}
+
+	return res, fillRemaining(res, space, offset)
+}
+
+// fillRemaining appends zeroed-pieces to the remaining space of sector
+func fillRemaining(res *packResult, space, offset abi.PaddedPieceSize) error {
+	if space == 0 {
+		return nil
+	}
+
+	fillers, err := fillersFromRem(space)
+	if err != nil {
+		return fmt.Errorf("get filler pieces for the remaining space %d: %w", space, err)
+	}
+
+	for _, fillSize := range fillers {
+		filler := fillerPiece(fillSize)
+		filler.offset = offset
+		res.pieces = append(res.pieces, filler)
+		offset += fillSize
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package storageprovider
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+
+	"github.com/filecoin-project/venus/venus-shared/types"
+	mtypes "github.com/filecoin-project/venus/venus-shared/types/market"
+)
+
+func TestPackPieces(t *testing.T) {
+	clientA, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	clientB, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+
+	type dealCase struct {
+		id       abi.DealID
+		size     abi.PaddedPieceSize
+		start    abi.ChainEpoch
+		client   address.Address
+		verified bool
+	}
+	// sorted by size, as the deal assigner does
+	dealCases := []dealCase{
+		{id: 1, size: 128, start: 300, client: clientA},
+		{id: 2, size: 128, start: 100, client: clientB},
+		{id: 3, size: 256, start: 400, client: clientA},
+		{id: 4, size: 512, start: 200, client: clientB, verified: true},
+		{id: 5, size: 512, start: 500, client: clientA},
+	}
+	newPieces := func() []*packingPiece {
+		pieces := make([]*packingPiece, 0, len(dealCases)+1)
+		for _, c := range dealCases {
+			pieces = append(pieces, storageDealPiece(&mtypes.DealInfoIncludePath{
+				DealID: c.id,
+				DealProposal: types.DealProposal{
+					PieceSize:    c.size,
+					StartEpoch:   c.start,
+					Client:       c.client,
+					VerifiedDeal: c.verified,
+				},
+			}))
+		}
+		return pieces
+	}
+
+	type pieceInfo struct {
+		id     abi.DealID
+		size   abi.PaddedPieceSize
+		offset abi.PaddedPieceSize
+	}
+	infos := func(res *packResult) []pieceInfo {
+		var out []pieceInfo
+		for _, p := range res.pieces {
+			var id abi.DealID
+			if !p.isFiller() {
+				id = p.deal.DealID
+			}
+			out = append(out, pieceInfo{id: id, size: p.size, offset: p.offset})
+		}
+		return out
+	}
+
+	cases := []struct {
+		strategy    string
+		spec        *mtypes.GetDealSpec
+		expected    []pieceInfo
+		utilization float64
+	}{
+		{
+			strategy:    config.PackingGreedy,
+			expected:    []pieceInfo{{1, 128, 0}, {2, 128, 128}, {3, 256, 256}, {4, 512, 512}},
+			utilization: 1,
+		},
+		{
+			strategy:    config.PackingBestFitDecreasing,
+			expected:    []pieceInfo{{4, 512, 0}, {5, 512, 512}},
+			utilization: 1,
+		},
+		{
+			strategy:    config.PackingDeadlineFirst,
+			expected:    []pieceInfo{{4, 512, 0}, {3, 256, 512}, {2, 128, 768}, {1, 128, 896}},
+			utilization: 1,
+		},
+		{
+			// the deals of client A fill the sector first
+			strategy:    config.PackingAffinity,
+			expected:    []pieceInfo{{5, 512, 0}, {3, 256, 512}, {1, 128, 768}, {2, 128, 896}},
+			utilization: 1,
+		},
+		{
+			strategy:    config.PackingDeadlineFirst,
+			spec:        &mtypes.GetDealSpec{MaxPiece: 2},
+			expected:    []pieceInfo{{4, 512, 0}, {2, 128, 512}, {0, 128, 640}, {0, 256, 768}},
+			utilization: 0.625,
+		},
+	}
+
+	for _, c := range cases {
+		res, err := packPieces(newPieces(), 1024, &dealSpec{GetDealSpec: c.spec, strategy: c.strategy})
+		require.NoError(t, err, c.strategy)
+		require.Equal(t, c.expected, infos(res), c.strategy)
+		require.Equal(t, c.utilization, res.utilization(), c.strategy)
+	}
+
+	// direct deals are packed with storage deals in one pass
+	pieces := []*packingPiece{
+		directDealPiece(&mtypes.DirectDealInfo{AllocationID: 10, PieceSize: 256, StartEpoch: 100, Client: clientA}),
+		storageDealPiece(&mtypes.DealInfoIncludePath{DealID: 1, DealProposal: types.DealProposal{PieceSize: 512, StartEpoch: 200}}),
+	}
+	res, err := packPieces(pieces, 1024, &dealSpec{strategy: config.PackingBestFitDecreasing})
+	require.NoError(t, err)
+	require.Equal(t, abi.PaddedPieceSize(768), res.dealSpace)
+	require.Len(t, res.pieces, 3)
+	require.Equal(t, abi.PaddedPieceSize(512), pieces[0].offset)
+	require.Equal(t, abi.PaddedPieceSize(0), pieces[1].offset)
+
+	// not enough space used
+	res, err = packPieces(newPieces(), 2048, &dealSpec{GetDealSpec: &mtypes.GetDealSpec{MinUsedSpace: 2048}, strategy: config.PackingBestFitDecreasing})
+	require.NoError(t, err)
+	require.Nil(t, res)
+
+	_, err = packPieces(newPieces(), 1024, &dealSpec{strategy: "unknown"})
+	require.ErrorIs(t, err, errUnknownPackingStrategy)
+}
@@ -0,0 +1,219 @@
+package storageprovider
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/venus/pkg/constants"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const (
+	// publishMsgCheckInterval is the interval to check whether a pending publish message is replaced
+	publishMsgCheckInterval = time.Minute
+	// publishMsgKeepDuration is how long the finished publish messages are kept
+	publishMsgKeepDuration = 24 * time.Hour
+)
+
+type publishMsgTrackerAPI interface {
+	WaitMsg(ctx context.Context, mCid cid.Cid, confidence uint64, loopBackLimit abi.ChainEpoch, allowReplaced bool) (*types.MsgLookup, error)
+	GetMessageChainCid(ctx context.Context, mid cid.Cid) (*cid.Cid, error)
+}
+
+// publishMsgTracker tracks the PublishStorageDeals messages until they are on chain,
+// the messages replaced with higher fees are detected by the change of signed cid or the cid on chain.
+// The messages are persisted, so the pending ones are tracked again after restarting.
+type publishMsgTracker struct {
+	api  publishMsgTrackerAPI
+	repo repo.PublishMessageRepo
+
+	lk   sync.Mutex
+	msgs map[cid.Cid]*types2.PublishMessage
+}
+
+func newPublishMsgTracker(api publishMsgTrackerAPI, msgRepo repo.PublishMessageRepo) *publishMsgTracker {
+	return &publishMsgTracker{
+		api:  api,
+		repo: msgRepo,
+		msgs: make(map[cid.Cid]*types2.PublishMessage),
+	}
+}
+
+// load loads the messages saved before restarting and waits for the pending ones
+func (t *publishMsgTracker) load(ctx context.Context) error {
+	msgs, err := t.repo.ListPublishMessage(ctx, time.Now().Add(-publishMsgKeepDuration))
+	if err != nil {
+		return err
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	for _, msg := range msgs {
+		t.msgs[msg.MsgCid] = msg
+		if msg.State == types2.PublishMsgPending {
+			go t.wait(ctx, msg.MsgCid)
+		}
+	}
+	return nil
+}
+
+func (t *publishMsgTracker) track(ctx context.Context, msg *types2.PublishMessage) {
+	t.lk.Lock()
+	t.pruneLocked()
+	msg.State = types2.PublishMsgPending
+	msg.UpdatedAt = msg.PushedAt
+	t.msgs[msg.MsgCid] = msg
+	saved := copyPublishMessage(msg)
+	t.lk.Unlock()
+
+	t.save(ctx, saved)
+	go t.wait(ctx, msg.MsgCid)
+}
+
+// save persists the copy of a tracked message, it is called without holding the lock
+func (t *publishMsgTracker) save(ctx context.Context, msg *types2.PublishMessage) {
+	if err := t.repo.SavePublishMessage(ctx, msg); err != nil {
+		log.Errorf("save publish message %s of miner %s: %v", msg.MsgCid, msg.Miner, err)
+	}
+}
+
+func (t *publishMsgTracker) wait(ctx context.Context, msgCid cid.Cid) {
+	type waitResult struct {
+		lookup *types.MsgLookup
+		err    error
+	}
+	done := make(chan waitResult, 1)
+	go func() {
+		lookup, err := t.api.WaitMsg(ctx, msgCid, constants.MessageConfidence, constants.LookbackNoLimit, true)
+		done <- waitResult{lookup: lookup, err: err}
+	}()
+
+	ticker := time.NewTicker(publishMsgCheckInterval)
+	defer ticker.Stop()
+
+	t.checkSignedCid(ctx, msgCid)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.checkSignedCid(ctx, msgCid)
+		case res := <-done:
+			t.checkSignedCid(ctx, msgCid)
+			t.finish(ctx, msgCid, res.lookup, res.err)
+			return
+		}
+	}
+}
+
+// checkSignedCid records the signed message which is replaced by messager
+func (t *publishMsgTracker) checkSignedCid(ctx context.Context, msgCid cid.Cid) {
+	signedCid, err := t.api.GetMessageChainCid(ctx, msgCid)
+	if err != nil || signedCid == nil || !signedCid.Defined() {
+		return
+	}
+
+	t.lk.Lock()
+	msg, ok := t.msgs[msgCid]
+	if !ok || msg.SignedCid == *signedCid {
+		t.lk.Unlock()
+		return
+	}
+	if msg.SignedCid.Defined() {
+		log.Warnf("publish message %s of miner %s is replaced: %s -> %s", msgCid, msg.Miner, msg.SignedCid, signedCid)
+		msg.ReplacedCids = append(msg.ReplacedCids, msg.SignedCid)
+	}
+	msg.SignedCid = *signedCid
+	msg.UpdatedAt = time.Now()
+	saved := copyPublishMessage(msg)
+	t.lk.Unlock()
+
+	t.save(ctx, saved)
+}
+
+func (t *publishMsgTracker) finish(ctx context.Context, msgCid cid.Cid, lookup *types.MsgLookup, err error) {
+	t.lk.Lock()
+	msg, ok := t.msgs[msgCid]
+	if !ok {
+		t.lk.Unlock()
+		return
+	}
+	setPublishMsgResult(msg, lookup, err)
+	saved := copyPublishMessage(msg)
+	t.lk.Unlock()
+
+	t.save(ctx, saved)
+}
+
+// setPublishMsgResult updates the message with the result of waiting it
+func setPublishMsgResult(msg *types2.PublishMessage, lookup *types.MsgLookup, err error) {
+	msgCid := msg.MsgCid
+	msg.UpdatedAt = time.Now()
+
+	if err != nil {
+		log.Errorf("wait publish message %s of miner %s: %v", msgCid, msg.Miner, err)
+		msg.State = types2.PublishMsgFailed
+		msg.Error = err.Error()
+		return
+	}
+
+	msg.FinalCid = lookup.Message
+	msg.ExitCode = lookup.Receipt.ExitCode
+	msg.Height = lookup.Height
+	// the message on chain differs from the signed one if it was replaced in mpool
+	if msg.SignedCid.Defined() && msg.SignedCid != lookup.Message && msgCid != lookup.Message {
+		log.Warnf("publish message %s of miner %s is replaced: %s -> %s", msgCid, msg.Miner, msg.SignedCid, lookup.Message)
+		msg.ReplacedCids = append(msg.ReplacedCids, msg.SignedCid)
+		msg.SignedCid = lookup.Message
+	}
+	if lookup.Receipt.ExitCode != exitcode.Ok {
+		log.Errorf("publish message %s of miner %s failed with exit code %s", msgCid, msg.Miner, lookup.Receipt.ExitCode)
+		msg.State = types2.PublishMsgFailed
+		msg.Error = lookup.Receipt.ExitCode.String()
+		return
+	}
+	msg.State = types2.PublishMsgOnChain
+}
+
+// pruneLocked removes the finished messages which are kept long enough
+func (t *publishMsgTracker) pruneLocked() {
+	for msgCid, msg := range t.msgs {
+		if msg.State != types2.PublishMsgPending && time.Since(msg.UpdatedAt) > publishMsgKeepDuration {
+			delete(t.msgs, msgCid)
+		}
+	}
+}
+
+// list returns the tracked messages of the miner in the order of pushing, all messages are returned if miner is empty
+func (t *publishMsgTracker) list(miner address.Address) []types2.PublishMessage {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	out := make([]types2.PublishMessage, 0, len(t.msgs))
+	for _, msg := range t.msgs {
+		if !miner.Empty() && msg.Miner != miner {
+			continue
+		}
+		out = append(out, *copyPublishMessage(msg))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].PushedAt.Before(out[j].PushedAt)
+	})
+	return out
+}
+
+func copyPublishMessage(msg *types2.PublishMessage) *types2.PublishMessage {
+	m := *msg
+	m.ReplacedCids = append([]cid.Cid(nil), msg.ReplacedCids...)
+	m.Deals = append([]cid.Cid(nil), msg.Deals...)
+	return &m
+}
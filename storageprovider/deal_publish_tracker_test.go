@@ -0,0 +1,149 @@
+package storageprovider
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/ipfs-force-community/droplet/v2/models/badger"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+type fakePublishMsgAPI struct {
+	lk        sync.Mutex
+	signedCid cid.Cid
+	lookup    chan *types.MsgLookup
+}
+
+func (f *fakePublishMsgAPI) WaitMsg(ctx context.Context, _ cid.Cid, _ uint64, _ abi.ChainEpoch, _ bool) (*types.MsgLookup, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case lookup := <-f.lookup:
+		return lookup, nil
+	}
+}
+
+func (f *fakePublishMsgAPI) GetMessageChainCid(_ context.Context, _ cid.Cid) (*cid.Cid, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	c := f.signedCid
+	return &c, nil
+}
+
+func (f *fakePublishMsgAPI) setSignedCid(c cid.Cid) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.signedCid = c
+}
+
+func TestPublishMsgTracker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var msgCid, signedCid, replacedCid cid.Cid
+	testutil.Provide(t, &msgCid)
+	testutil.Provide(t, &signedCid)
+	testutil.Provide(t, &replacedCid)
+
+	miner, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	otherMiner, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+
+	r, err := badger.NewMemRepo()
+	require.NoError(t, err)
+
+	api := &fakePublishMsgAPI{signedCid: signedCid, lookup: make(chan *types.MsgLookup)}
+	tracker := newPublishMsgTracker(api, r.PublishMessageRepo())
+	tracker.track(ctx, &types2.PublishMessage{Miner: miner, MsgCid: msgCid, PushedAt: time.Now()})
+
+	require.Eventually(t, func() bool {
+		msgs := tracker.list(miner)
+		return len(msgs) == 1 && msgs[0].SignedCid == signedCid
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, types2.PublishMsgPending, tracker.list(miner)[0].State)
+	require.Empty(t, tracker.list(otherMiner))
+
+	// the message is replaced in mpool and the replacement lands on chain
+	api.setSignedCid(replacedCid)
+	api.lookup <- &types.MsgLookup{
+		Message: replacedCid,
+		Receipt: types.MessageReceipt{ExitCode: exitcode.Ok},
+		Height:  100,
+	}
+
+	require.Eventually(t, func() bool {
+		return tracker.list(miner)[0].State == types2.PublishMsgOnChain
+	}, time.Second, 10*time.Millisecond)
+	msg := tracker.list(miner)[0]
+	require.True(t, msg.Replaced())
+	require.Equal(t, []cid.Cid{signedCid}, msg.ReplacedCids)
+	require.Equal(t, replacedCid, msg.FinalCid)
+	require.Equal(t, abi.ChainEpoch(100), msg.Height)
+
+	// the message is loaded after restarting
+	require.Eventually(t, func() bool {
+		msgs, err := r.PublishMessageRepo().ListPublishMessage(ctx, time.Now().Add(-time.Minute))
+		return err == nil && len(msgs) == 1 && msgs[0].State == types2.PublishMsgOnChain
+	}, time.Second, 10*time.Millisecond)
+	loaded := newPublishMsgTracker(api, r.PublishMessageRepo())
+	require.NoError(t, loaded.load(ctx))
+	require.Len(t, loaded.list(miner), 1)
+	require.Equal(t, []cid.Cid{signedCid}, loaded.list(miner)[0].ReplacedCids)
+
+	// finished messages are pruned after being kept long enough
+	tracker.lk.Lock()
+	tracker.msgs[msgCid].UpdatedAt = time.Now().Add(-publishMsgKeepDuration - time.Minute)
+	tracker.pruneLocked()
+	tracker.lk.Unlock()
+	require.Empty(t, tracker.list(address.Undef))
+}
+
+func TestPublishMsgTrackerLoadPending(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var msgCid cid.Cid
+	testutil.Provide(t, &msgCid)
+	miner, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+
+	r, err := badger.NewMemRepo()
+	require.NoError(t, err)
+	pushedAt := time.Now().Add(-2 * publishMsgKeepDuration)
+	require.NoError(t, r.PublishMessageRepo().SavePublishMessage(ctx, &types2.PublishMessage{
+		Miner:     miner,
+		MsgCid:    msgCid,
+		State:     types2.PublishMsgPending,
+		PushedAt:  pushedAt,
+		UpdatedAt: pushedAt,
+	}))
+
+	// the pending message pushed before restarting is still waited
+	api := &fakePublishMsgAPI{signedCid: msgCid, lookup: make(chan *types.MsgLookup)}
+	tracker := newPublishMsgTracker(api, r.PublishMessageRepo())
+	require.NoError(t, tracker.load(ctx))
+	require.Len(t, tracker.list(miner), 1)
+
+	api.lookup <- &types.MsgLookup{
+		Message: msgCid,
+		Receipt: types.MessageReceipt{ExitCode: exitcode.SysErrOutOfGas},
+		Height:  100,
+	}
+	require.Eventually(t, func() bool {
+		msgs, err := r.PublishMessageRepo().ListPublishMessage(ctx, time.Now().Add(-time.Minute))
+		return err == nil && len(msgs) == 1 && msgs[0].State == types2.PublishMsgFailed
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, types2.PublishMsgFailed, tracker.list(miner)[0].State)
+	require.Equal(t, exitcode.SysErrOutOfGas, tracker.list(miner)[0].ExitCode)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -15,9 +17,11 @@ import (
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
 	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/exitcode"
 
 	"github.com/ipfs-force-community/droplet/v2/api/clients"
 	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
 	types2 "github.com/ipfs-force-community/droplet/v2/types"
 
 	"github.com/filecoin-project/venus/venus-shared/actors"
@@ -36,9 +40,22 @@ type dealPublisherAPI interface {
 	StateAccountKey(context.Context, address.Address, types.TipSetKey) (address.Address, error)
 	StateLookupID(context.Context, address.Address, types.TipSetKey) (address.Address, error)
 
+	GasEstimateMessageGas(context.Context, *types.Message, *types.MessageSendSpec, types.TipSetKey) (*types.Message, error)
+
 	PushMessage(ctx context.Context, msg *types.Message, spec *types.MessageSendSpec) (cid.Cid, error)
+	publishMsgTrackerAPI
 }
 
+// publishFeeCheckInterval is the interval to check the base fee again when publishing is delayed by high base fee
+const publishFeeCheckInterval = 5 * time.Minute
+
+// errPublishMsgInvalid is returned when the publish message fails in gas estimation
+var errPublishMsgInvalid = errors.New("publish message is invalid")
+
+// the gas estimation fails with `message execution failed: exit {exit code}, reason: ...` if the message fails
+// in the actors, the error is received as text through the rpc
+var execFailedRe = regexp.MustCompile(`message execution failed: exit (?:\w+\()?(\d+)`)
+
 type DealPublisher struct {
 	api dealPublisherAPI
 
@@ -46,23 +63,36 @@ type DealPublisher struct {
 
 	lk         sync.Mutex
 	publishers map[address.Address]*singleDealPublisher
+
+	msgTracker *publishMsgTracker
 }
 
 func NewDealPublisherWrapper(
 	cfg *config.MarketConfig,
-) func(lc fx.Lifecycle, full v1api.FullNode, msgClient clients.IMixMessage) *DealPublisher {
-	return func(lc fx.Lifecycle, full v1api.FullNode, msgClient clients.IMixMessage) *DealPublisher {
+) func(lc fx.Lifecycle, full v1api.FullNode, msgClient clients.IMixMessage, r repo.Repo) *DealPublisher {
+	return func(lc fx.Lifecycle, full v1api.FullNode, msgClient clients.IMixMessage, r repo.Repo) *DealPublisher {
+		api := struct {
+			v1api.FullNode
+			clients.IMixMessage
+		}{full, msgClient}
 		dp := &DealPublisher{
-			api: struct {
-				v1api.FullNode
-				clients.IMixMessage
-			}{full, msgClient},
+			api:        api,
 			cfg:        cfg,
 			publishers: map[address.Address]*singleDealPublisher{},
+			msgTracker: newPublishMsgTracker(api, r.PublishMessageRepo()),
 		}
 
+		trackCtx, cancel := context.WithCancel(context.Background())
 		lc.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				// keep waiting for the messages pushed before restarting
+				if err := dp.msgTracker.load(trackCtx); err != nil {
+					log.Errorf("load publish messages: %v", err)
+				}
+				return nil
+			},
 			OnStop: func(ctx context.Context) error {
+				cancel()
 				dp.lk.Lock()
 				for _, p := range dp.publishers {
 					p.Shutdown()
@@ -92,6 +122,12 @@ func (p *DealPublisher) PendingDeals() map[address.Address]marketTypes.PendingDe
 	return ret
 }
 
+// PublishMessages returns the publish messages sent in the last day and the pending ones,
+// the messages of all miners are returned if miner is empty
+func (p *DealPublisher) PublishMessages(miner address.Address) []types2.PublishMessage {
+	return p.msgTracker.list(miner)
+}
+
 // ForcePublishPendingDeals publishes all pending deals without waiting for
 // the publish period to elapse
 func (p *DealPublisher) ForcePublishPendingDeals() {
@@ -123,7 +159,12 @@ func (p *DealPublisher) Publish(ctx context.Context, deal types.ClientDealPropos
 			addrs,
 			pCfg.MaxDealsPerPublishMsg,
 			time.Duration(pCfg.PublishMsgPeriod),
-			&types.MessageSendSpec{MaxFee: abi.TokenAmount(pCfg.MaxPublishDealsFee)})
+			&types.MessageSendSpec{MaxFee: abi.TokenAmount(pCfg.MaxPublishDealsFee)},
+			publishFeeLimit{
+				maxBaseFee:   abi.TokenAmount(pCfg.MaxPublishBaseFee),
+				urgentEpochs: abi.ChainEpoch(time.Duration(pCfg.PublishUrgentWindow) / (builtin.EpochDurationSeconds * time.Second)),
+			},
+			p.msgTracker)
 		p.publishers[providerAddr] = publisher
 	}
 	publisher.processNewDeal(pdeal)
@@ -145,6 +186,8 @@ func (p *DealPublisher) Publish(ctx context.Context, deal types.ClientDealPropos
 // There is a configurable maximum number of deals that can be included in one
 // message. When the limit is reached the singleDealPublisher immediately submits a
 // publish message with all deals in the queue.
+// Publishing is delayed while the base fee is above the limit, unless a deal is going to start soon.
+// The deals which make the publish message fail in gas estimation are bisected out of the batch.
 type singleDealPublisher struct {
 	api          dealPublisherAPI
 	publishAddrs []address.Address
@@ -155,13 +198,24 @@ type singleDealPublisher struct {
 	maxDealsPerPublishMsg  uint64
 	publishPeriod          time.Duration
 	publishSpec            *types.MessageSendSpec
+	feeLimit               publishFeeLimit
+	msgTracker             *publishMsgTracker
 	cancelWaitForMoreDeals context.CancelFunc
 	publishPeriodStart     time.Time
+	// waitPeriod is the publish period or publishFeeCheckInterval if publishing is delayed by base fee
+	waitPeriod time.Duration
 
 	lk      sync.Mutex
 	pending []*pendingDeal
 }
 
+// publishFeeLimit delays publishing while the base fee is above maxBaseFee,
+// the deals whose StartEpoch is within urgentEpochs are published anyway
+type publishFeeLimit struct {
+	maxBaseFee   abi.TokenAmount
+	urgentEpochs abi.ChainEpoch
+}
+
 // A deal that is queued to be published
 type pendingDeal struct {
 	ctx    context.Context
@@ -189,6 +243,8 @@ func newDealPublisher(
 	maxDealsPerPublishMsg uint64,
 	publishPeriod time.Duration,
 	publishSpec *types.MessageSendSpec,
+	feeLimit publishFeeLimit,
+	msgTracker *publishMsgTracker,
 ) *singleDealPublisher {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &singleDealPublisher{
@@ -199,6 +255,8 @@ func newDealPublisher(
 		maxDealsPerPublishMsg: maxDealsPerPublishMsg,
 		publishPeriod:         publishPeriod,
 		publishSpec:           publishSpec,
+		feeLimit:              feeLimit,
+		msgTracker:            msgTracker,
 	}
 }
 
@@ -223,7 +281,7 @@ func (p *singleDealPublisher) pendingDeals() marketTypes.PendingDealInfo {
 	return marketTypes.PendingDealInfo{
 		Deals:              pending,
 		PublishPeriodStart: p.publishPeriodStart,
-		PublishPeriod:      p.publishPeriod,
+		PublishPeriod:      p.waitPeriod,
 	}
 }
 
@@ -234,7 +292,7 @@ func (p *singleDealPublisher) forcePublishPendingDeals() {
 	defer p.lk.Unlock()
 
 	log.Infof("force publishing deals")
-	p.publishAllDeals()
+	p.publishAllDeals(true)
 }
 
 func (p *singleDealPublisher) processNewDeal(pdeal *pendingDeal) {
@@ -284,31 +342,32 @@ func (p *singleDealPublisher) processNewDeal(pdeal *pendingDeal) {
 	// publish message
 	if uint64(len(p.pending)) >= p.maxDealsPerPublishMsg || p.publishPeriod == 0 {
 		log.Infof("publish deals queue has reached max size of %d, publishing deals", p.maxDealsPerPublishMsg)
-		p.publishAllDeals()
+		p.publishAllDeals(false)
 		return
 	}
 
 	// Otherwise wait for more deals to arrive or the timeout to be reached
-	p.waitForMoreDeals()
+	p.waitForMoreDeals(p.publishPeriod)
 }
 
-func (p *singleDealPublisher) waitForMoreDeals() {
+func (p *singleDealPublisher) waitForMoreDeals(period time.Duration) {
 	// Check if we're already waiting for deals
 	if !p.publishPeriodStart.IsZero() {
 		elapsed := types2.Clock.Since(p.publishPeriodStart)
 		log.Infof("%s elapsed of / %s until publish deals queue is published",
-			elapsed, p.publishPeriod)
+			elapsed, p.waitPeriod)
 		return
 	}
 
 	// Set a timeout to wait for more deals to arrive
-	log.Infof("waiting publish deals queue period of %s before publishing", p.publishPeriod)
+	log.Infof("waiting publish deals queue period of %s before publishing", period)
 	ctx, cancel := context.WithCancel(p.ctx)
 	p.publishPeriodStart = types2.Clock.Now()
+	p.waitPeriod = period
 	p.cancelWaitForMoreDeals = cancel
 
 	go func() {
-		timer := types2.Clock.NewTimer(p.publishPeriod)
+		timer := types2.Clock.NewTimer(period)
 		select {
 		case <-ctx.Done():
 			timer.Stop()
@@ -317,13 +376,27 @@ func (p *singleDealPublisher) waitForMoreDeals() {
 			defer p.lk.Unlock()
 
 			// The timeout has expired so publish all pending deals
-			log.Infof("publish deals queue period of %s has expired, publishing deals", p.publishPeriod)
-			p.publishAllDeals()
+			log.Infof("publish deals queue period of %s has expired, publishing deals", period)
+			p.publishAllDeals(false)
 		}
 	}()
 }
 
-func (p *singleDealPublisher) publishAllDeals() {
+// requeueDeals puts the deals delayed by base fee back to the queue, and checks the base fee again later
+func (p *singleDealPublisher) requeueDeals(deals []*pendingDeal) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	p.pending = append(deals, p.pending...)
+	p.filterCancelledDeals()
+	if len(p.pending) == 0 {
+		return
+	}
+	p.waitForMoreDeals(publishFeeCheckInterval)
+}
+
+// publishAllDeals publishes all pending deals, the base fee limit is ignored if force is true
+func (p *singleDealPublisher) publishAllDeals(force bool) {
 	// If the timeout hasn't yet been cancelled, cancel it
 	if p.cancelWaitForMoreDeals != nil {
 		p.cancelWaitForMoreDeals()
@@ -337,10 +410,10 @@ func (p *singleDealPublisher) publishAllDeals() {
 	p.pending = nil
 
 	// Send the publish message
-	go p.publishReady(deals)
+	go p.publishReady(deals, force)
 }
 
-func (p *singleDealPublisher) publishReady(ready []*pendingDeal) {
+func (p *singleDealPublisher) publishReady(ready []*pendingDeal, force bool) {
 	if len(ready) == 0 {
 		return
 	}
@@ -362,7 +435,6 @@ func (p *singleDealPublisher) publishReady(ready []*pendingDeal) {
 
 	// Validate each deal to make sure it can be published
 	validated := make([]*pendingDeal, 0, len(ready))
-	deals := make([]types.ClientDealProposal, 0, len(ready))
 	for _, pd := range ready {
 		// Validate the deal
 		if err := p.validateDeal(pd.deal); err != nil {
@@ -372,18 +444,57 @@ func (p *singleDealPublisher) publishReady(ready []*pendingDeal) {
 		}
 
 		validated = append(validated, pd)
-		deals = append(deals, pd.deal)
+	}
+
+	if len(validated) == 0 {
+		return
+	}
+
+	head, err := p.api.ChainHead(p.ctx)
+	if err != nil {
+		for _, pd := range validated {
+			go onComplete(pd, cid.Undef, err)
+		}
+		return
+	}
+	baseFee := head.Blocks()[0].ParentBaseFee
+	if !force && p.shouldDelay(head.Height(), baseFee, validated) {
+		log.Infof("base fee %s is above the limit %s, delay publishing %d deals",
+			types.FIL(baseFee), types.FIL(p.feeLimit.maxBaseFee), len(validated))
+		p.requeueDeals(validated)
+		return
 	}
 
 	// Send the publish message
-	msgCid, err := p.publishDealProposals(deals)
+	msgCid, invalid, err := p.publishDealProposals(validated, baseFee)
 
 	// Signal that each deal has been published
 	for _, pd := range validated {
+		if invalidErr, ok := invalid[pd]; ok {
+			go onComplete(pd, cid.Undef, invalidErr)
+			continue
+		}
 		go onComplete(pd, msgCid, err)
 	}
 }
 
+// shouldDelay returns true if the base fee is above the limit and no deal is going to start soon
+func (p *singleDealPublisher) shouldDelay(height abi.ChainEpoch, baseFee abi.TokenAmount, deals []*pendingDeal) bool {
+	maxBaseFee := p.feeLimit.maxBaseFee
+	if maxBaseFee.Nil() || maxBaseFee.IsZero() || baseFee.LessThanEqual(maxBaseFee) {
+		return false
+	}
+
+	for _, pd := range deals {
+		if pd.deal.Proposal.StartEpoch-height <= p.feeLimit.urgentEpochs {
+			log.Infof("deal with piece CID %s starts at epoch %d, publish it regardless of base fee %s",
+				pd.deal.Proposal.PieceCID, pd.deal.Proposal.StartEpoch, types.FIL(baseFee))
+			return false
+		}
+	}
+	return true
+}
+
 // validateDeal checks that the deal proposal start epoch hasn't already
 // elapsed
 func (p *singleDealPublisher) validateDeal(deal types.ClientDealProposal) error {
@@ -399,10 +510,11 @@ func (p *singleDealPublisher) validateDeal(deal types.ClientDealProposal) error
 	return nil
 }
 
-// Sends the publish message
-func (p *singleDealPublisher) publishDealProposals(deals []types.ClientDealProposal) (cid.Cid, error) {
+// Sends the publish message, the deals which make the message invalid are returned and not published
+func (p *singleDealPublisher) publishDealProposals(pds []*pendingDeal, baseFee abi.TokenAmount) (cid.Cid, map[*pendingDeal]error, error) {
+	deals := proposalsOf(pds)
 	if len(deals) == 0 {
-		return cid.Undef, nil
+		return cid.Undef, nil, nil
 	}
 
 	log.Infof("publishing %d deals in publish deals queue with piece CIDs: %s", len(deals), pieceCids(deals))
@@ -414,25 +526,45 @@ func (p *singleDealPublisher) publishDealProposals(deals []types.ClientDealPropo
 				"not all deals are for same provider: " +
 				fmt.Sprintf("deal with piece CID %s is for provider %s ", deals[0].Proposal.PieceCID, deals[0].Proposal.Provider) +
 				fmt.Sprintf("but deal with piece CID %s is for provider %s", dl.Proposal.PieceCID, dl.Proposal.Provider)
-			return cid.Undef, errors.New(msg)
+			return cid.Undef, nil, errors.New(msg)
 		}
 	}
 
 	mi, err := p.api.StateMinerInfo(p.ctx, provider, types.EmptyTSK)
 	if err != nil {
-		return cid.Undef, err
+		return cid.Undef, nil, err
 	}
 
-	params, err := actors.SerializeParams(&types.PublishStorageDealsParams{
-		Deals: deals,
-	})
+	addr, _, err := pickAddress(p.ctx, p.api, mi, big.Zero(), big.Zero(), p.publishAddrs)
 	if err != nil {
-		return cid.Undef, fmt.Errorf("serializing PublishStorageDeals params failed: %w", err)
+		return cid.Undef, nil, fmt.Errorf("selecting address for publishing deals: %w", err)
+	}
+
+	estimated, err := p.estimatePublish(addr, deals)
+	var invalid map[*pendingDeal]error
+	if err != nil && len(pds) > 1 && isActorExecutionErr(err) {
+		log.Warnf("publishing %d deals: %v, bisecting out the invalid deals", len(pds), err)
+		valid, bisectInvalid, bisectErr := p.bisectDeals(addr, pds, err)
+		invalid = bisectInvalid
+		// the failure is not caused by some of deals, publish the batch and let it fail as before
+		if bisectErr != nil || len(valid) == 0 {
+			if bisectErr != nil {
+				log.Warnf("stop bisecting %d deals: %v", len(pds), bisectErr)
+			}
+			valid, invalid = pds, nil
+		}
+		for pd, err := range invalid {
+			log.Errorf("deal with piece CID %s is removed from publish batch: %v", pd.deal.Proposal.PieceCID, err)
+		}
+		deals = proposalsOf(valid)
+		estimated, _ = p.estimatePublish(addr, deals)
 	}
 
-	addr, _, err := pickAddress(p.ctx, p.api, mi, big.Zero(), big.Zero(), p.publishAddrs)
+	params, err := actors.SerializeParams(&types.PublishStorageDealsParams{
+		Deals: deals,
+	})
 	if err != nil {
-		return cid.Undef, fmt.Errorf("selecting address for publishing deals: %w", err)
+		return cid.Undef, invalid, fmt.Errorf("serializing PublishStorageDeals params failed: %w", err)
 	}
 
 	msgId, err := p.api.PushMessage(
@@ -446,9 +578,106 @@ func (p *singleDealPublisher) publishDealProposals(deals []types.ClientDealPropo
 		}, p.publishSpec)
 
 	if err != nil {
-		return cid.Undef, err
+		return cid.Undef, invalid, err
+	}
+
+	published := &types2.PublishMessage{
+		Miner:        provider,
+		MsgCid:       msgId,
+		BaseFee:      baseFee,
+		EstimatedFee: big.Zero(),
+		PushedAt:     time.Now(),
+	}
+	if estimated != nil {
+		published.EstimatedFee = big.Mul(estimated.GasFeeCap, big.NewInt(estimated.GasLimit))
+	}
+	for _, dl := range deals {
+		propCid, err := dl.Proposal.Cid()
+		if err == nil {
+			published.Deals = append(published.Deals, propCid)
+		}
+	}
+	p.msgTracker.track(p.ctx, published)
+	log.Infof("published %d deals in message %s, estimated fee %s", len(deals), msgId, types.FIL(published.EstimatedFee))
+
+	return msgId, invalid, nil
+}
+
+// estimatePublish estimates the gas of the publish message, it fails if the message fails in execution
+func (p *singleDealPublisher) estimatePublish(from address.Address, deals []types.ClientDealProposal) (*types.Message, error) {
+	params, aerr := actors.SerializeParams(&types.PublishStorageDealsParams{
+		Deals: deals,
+	})
+	if aerr != nil {
+		return nil, fmt.Errorf("serializing PublishStorageDeals params failed: %w", aerr)
+	}
+
+	msg, err := p.api.GasEstimateMessageGas(p.ctx, &types.Message{
+		To:     marketactor.Address,
+		From:   from,
+		Value:  types.NewInt(0),
+		Method: builtin.MethodsMarket.PublishStorageDeals,
+		Params: params,
+	}, p.publishSpec, types.EmptyTSK)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errPublishMsgInvalid, err)
+	}
+	return msg, nil
+}
+
+// bisectDeals splits the deals into halves until the invalid deals are found by gas estimation, a deal is invalid
+// only if the message fails in actor execution. It returns an error if the estimation fails for other reasons,
+// e.g. the rpc fails, because the deals can't be told apart by it.
+func (p *singleDealPublisher) bisectDeals(from address.Address, pds []*pendingDeal, msgErr error) ([]*pendingDeal, map[*pendingDeal]error, error) {
+	if len(pds) == 1 {
+		return nil, map[*pendingDeal]error{pds[0]: msgErr}, nil
+	}
+
+	var valid []*pendingDeal
+	invalid := make(map[*pendingDeal]error)
+	mid := len(pds) / 2
+	for _, half := range [][]*pendingDeal{pds[:mid], pds[mid:]} {
+		if _, err := p.estimatePublish(from, proposalsOf(half)); err != nil {
+			if !isActorExecutionErr(err) {
+				return nil, nil, err
+			}
+			halfValid, halfInvalid, err := p.bisectDeals(from, half, err)
+			if err != nil {
+				return nil, nil, err
+			}
+			valid = append(valid, halfValid...)
+			for pd, err := range halfInvalid {
+				invalid[pd] = err
+			}
+			continue
+		}
+		valid = append(valid, half...)
+	}
+
+	return valid, invalid, nil
+}
+
+// isActorExecutionErr returns true if the message failed with an exit code in the actors, the failures of sending it,
+// e.g. the sender has a wrong nonce or not enough funds, are not caused by the deals
+func isActorExecutionErr(err error) bool {
+	matches := execFailedRe.FindStringSubmatch(err.Error())
+	if len(matches) != 2 {
+		return false
+	}
+	code, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return false
+	}
+	exitCode := exitcode.ExitCode(code)
+	return exitCode.IsError() && !exitCode.IsSendFailure()
+}
+
+func proposalsOf(pds []*pendingDeal) []types.ClientDealProposal {
+	deals := make([]types.ClientDealProposal, 0, len(pds))
+	for _, pd := range pds {
+		deals = append(deals, pd.deal)
 	}
-	return msgId, nil
+	return deals
 }
 
 func pieceCids(deals []types.ClientDealProposal) string {
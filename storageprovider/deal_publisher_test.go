@@ -0,0 +1,109 @@
+package storageprovider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	"github.com/filecoin-project/venus/venus-shared/types"
+)
+
+type fakeEstimateAPI struct {
+	dealPublisherAPI
+	// the deals whose pieces are in invalid make the message fail in execution
+	invalid map[cid.Cid]struct{}
+	// rpcErr is returned when the message has no more than rpcErrBelow deals
+	rpcErr      error
+	rpcErrBelow int
+}
+
+func (f *fakeEstimateAPI) GasEstimateMessageGas(_ context.Context, msg *types.Message, _ *types.MessageSendSpec, _ types.TipSetKey) (*types.Message, error) {
+	var params types.PublishStorageDealsParams
+	if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+		return nil, err
+	}
+	if f.rpcErr != nil && len(params.Deals) <= f.rpcErrBelow {
+		return nil, f.rpcErr
+	}
+	for _, dl := range params.Deals {
+		if _, ok := f.invalid[dl.Proposal.PieceCID]; ok {
+			return nil, fmt.Errorf("message execution failed: exit %s, reason: deal is invalid", exitcode.ErrIllegalArgument)
+		}
+	}
+	return msg, nil
+}
+
+func TestBisectDeals(t *testing.T) {
+	ctx := context.Background()
+	from := address.TestAddress
+
+	newDeals := func(n int) []*pendingDeal {
+		pds := make([]*pendingDeal, 0, n)
+		for i := 0; i < n; i++ {
+			var deal types.ClientDealProposal
+			testutil.Provide(t, &deal)
+			pds = append(pds, newPendingDeal(ctx, deal))
+		}
+		return pds
+	}
+
+	t.Run("invalid deals", func(t *testing.T) {
+		pds := newDeals(5)
+		api := &fakeEstimateAPI{invalid: map[cid.Cid]struct{}{
+			pds[1].deal.Proposal.PieceCID: {},
+			pds[4].deal.Proposal.PieceCID: {},
+		}}
+		p := &singleDealPublisher{api: api}
+
+		_, err := p.estimatePublish(from, proposalsOf(pds))
+		require.True(t, isActorExecutionErr(err))
+		valid, invalid, err := p.bisectDeals(from, pds, err)
+		require.NoError(t, err)
+		require.Equal(t, []*pendingDeal{pds[0], pds[2], pds[3]}, valid)
+		require.Len(t, invalid, 2)
+		require.Contains(t, invalid, pds[1])
+		require.Contains(t, invalid, pds[4])
+	})
+
+	t.Run("rpc error", func(t *testing.T) {
+		pds := newDeals(4)
+		api := &fakeEstimateAPI{
+			invalid:     map[cid.Cid]struct{}{pds[0].deal.Proposal.PieceCID: {}},
+			rpcErr:      errors.New("RPC client error: sendRequest failed: connection refused"),
+			rpcErrBelow: 2,
+		}
+		p := &singleDealPublisher{api: api}
+
+		// the deals aren't marked invalid by the failures not caused by them
+		_, err := p.estimatePublish(from, proposalsOf(pds))
+		require.True(t, isActorExecutionErr(err))
+		valid, invalid, err := p.bisectDeals(from, pds, err)
+		require.ErrorContains(t, err, api.rpcErr.Error())
+		require.Empty(t, valid)
+		require.Empty(t, invalid)
+	})
+}
+
+func TestIsActorExecutionErr(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		actor  bool
+		reason string
+	}{
+		{fmt.Errorf("message execution failed: exit %s, reason: deal is invalid", exitcode.ErrIllegalArgument), true, "named exit code"},
+		{errors.New("message execution failed: exit 16, reason: deal is invalid"), true, "numeric exit code"},
+		{fmt.Errorf("%w: message execution failed: exit %s, reason: bad nonce", errPublishMsgInvalid, exitcode.SysErrSenderStateInvalid), false, "send failure"},
+		{errors.New("CallWithGas failed: context deadline exceeded"), false, "no exit code"},
+		{errors.New("RPC client error: sendRequest failed: connection refused"), false, "rpc error"},
+	} {
+		require.Equal(t, tc.actor, isActorExecutionErr(tc.err), tc.reason)
+	}
+}
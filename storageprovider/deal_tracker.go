@@ -1,24 +1,34 @@
 package storageprovider
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"math/rand"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ipfs/go-cid"
 	"go.uber.org/fx"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
 	provider "github.com/ipni/index-provider"
 
 	"github.com/ipfs-force-community/droplet/v2/indexprovider"
 	"github.com/ipfs-force-community/droplet/v2/minermgr"
 	"github.com/ipfs-force-community/droplet/v2/models/repo"
 
+	"github.com/filecoin-project/venus/pkg/constants"
+	"github.com/filecoin-project/venus/pkg/events"
+	"github.com/filecoin-project/venus/pkg/events/state"
+	marketactor "github.com/filecoin-project/venus/venus-shared/actors/builtin/market"
+	lminer "github.com/filecoin-project/venus/venus-shared/actors/builtin/miner"
 	v1api "github.com/filecoin-project/venus/venus-shared/api/chain/v1"
 	vTypes "github.com/filecoin-project/venus/venus-shared/types"
 	"github.com/filecoin-project/venus/venus-shared/types/market"
@@ -32,12 +42,47 @@ func init() {
 	globalRand = rand.New(rand.NewSource(time.Now().UnixNano()))
 }
 
+const (
+	// the intervals of full scans when deal changes are watched from chain events, the scans are only a fallback
+	reconcileInterval      = time.Hour
+	reconcileSlashInterval = time.Hour * 12
+
+	// the intervals of full scans when chain events are unavailable
+	scanInterval      = time.Minute * 10
+	scanSlashInterval = time.Hour * 3
+)
+
+// minerSectorMethods are the methods of miner actor which may pre-commit or activate deals
+var minerSectorMethods = map[abi.MethodNum]struct{}{
+	builtin.MethodsMiner.PreCommitSector:       {},
+	builtin.MethodsMiner.PreCommitSectorBatch:  {},
+	builtin.MethodsMiner.PreCommitSectorBatch2: {},
+	builtin.MethodsMiner.ProveCommitSector:     {},
+	builtin.MethodsMiner.ProveCommitAggregate:  {},
+	builtin.MethodsMiner.ProveCommitSectors3:   {},
+	builtin.MethodsMiner.ProveReplicaUpdates:   {},
+	builtin.MethodsMiner.ProveReplicaUpdates2:  {},
+	builtin.MethodsMiner.ProveReplicaUpdates3:  {},
+}
+
 type DealTracker struct {
 	storageRepo      repo.StorageDealRepo
 	minerMgr         minermgr.IMinerMgr
 	fullNode         v1api.FullNode
 	eventPublisher   *EventPublishAdapter
 	indexProviderMgr *indexprovider.IndexProviderMgr
+
+	// checkLk serializes the checks from full scans and chain events
+	checkLk sync.Mutex
+
+	lk sync.Mutex
+	// watched are the deals whose state changes in market actor are watched
+	watched map[abi.DealID]watchedDeal
+}
+
+type watchedDeal struct {
+	miner       address.Address
+	proposalCid cid.Cid
 }
 
 var ReadyRetrievalDealStatus = []storagemarket.StorageDealStatus{storagemarket.StorageDealAwaitingPreCommit, storagemarket.StorageDealSealing, storagemarket.StorageDealActive}
@@ -55,6 +100,7 @@ func NewDealTracker(lc fx.Lifecycle,
 		fullNode:         fullNode,
 		eventPublisher:   pb,
 		indexProviderMgr: indexProviderMgr,
+		watched:          make(map[abi.DealID]watchedDeal),
 	}
 
 	lc.Append(fx.Hook{
@@ -67,14 +113,20 @@ func NewDealTracker(lc fx.Lifecycle,
 }
 
 func (dealTracker *DealTracker) Start(ctx metrics.MetricsCtx) {
-	ticker := time.NewTicker(time.Minute*10 + time.Minute*time.Duration(globalRand.Intn(10)))
+	dealTracker.scanDeal(ctx, true, true)
+
+	interval, slashInterval := reconcileInterval, reconcileSlashInterval
+	if err := dealTracker.watchChain(ctx); err != nil {
+		log.Errorf("watch deal changes from chain events failed, fallback to scan deals: %s", err)
+		interval, slashInterval = scanInterval, scanSlashInterval
+	}
+
+	ticker := time.NewTicker(interval + time.Minute*time.Duration(globalRand.Intn(10)))
 	defer ticker.Stop()
 
-	slashTicker := time.NewTicker(time.Hour*3 + time.Minute*time.Duration(globalRand.Intn(30)))
+	slashTicker := time.NewTicker(slashInterval + time.Minute*time.Duration(globalRand.Intn(30)))
 	defer slashTicker.Stop()
 
-	dealTracker.scanDeal(ctx, true, true)
-
 	for {
 		select {
 		case <-ticker.C:
@@ -88,7 +140,260 @@ func (dealTracker *DealTracker) Start(ctx metrics.MetricsCtx) {
 	}
 }
 
+// watchChain applies the deal transitions when the chain events are confirmed:
+// the sector messages to the miners trigger the checks of pre-committed and committed deals,
+// the state changes of the watched deals in market actor trigger the checks of activated and slashed deals.
+func (dealTracker *DealTracker) watchChain(ctx context.Context) error {
+	ev, err := events.NewEvents(ctx, dealTracker.fullNode)
+	if err != nil {
+		return err
+	}
+
+	keepWatching := func(context.Context, *vTypes.TipSet) (bool, bool, error) {
+		return false, true, nil
+	}
+	revert := func(_ context.Context, ts *vTypes.TipSet) error {
+		log.Warnf("deal changes at %d reverted, they will be corrected by the next scan", ts.Height())
+		return nil
+	}
+	confidence := int(constants.MessageConfidence) + 1
+
+	matchMsg := func(msg *vTypes.Message) (bool, error) {
+		if _, ok := minerSectorMethods[msg.Method]; !ok {
+			return false, nil
+		}
+		return dealTracker.minerMgr.Has(ctx, msg.To), nil
+	}
+	msgHandler := func(msg *vTypes.Message, rec *vTypes.MessageReceipt, ts *vTypes.TipSet, _ abi.ChainEpoch) (bool, error) {
+		if msg == nil || rec.ExitCode != 0 {
+			return true, nil
+		}
+
+		dealTracker.checkLk.Lock()
+		defer dealTracker.checkLk.Unlock()
+		if err := dealTracker.checkSectorMessage(ctx, msg, ts); err != nil {
+			log.Errorf("check sector message %s of miner %s at %d err: %s", msg.Cid(), msg.To, ts.Height(), err)
+		}
+		return true, nil
+	}
+	if err := ev.Called(ctx, keepWatching, msgHandler, revert, confidence, events.NoTimeout, matchMsg); err != nil {
+		return fmt.Errorf("watch sector messages: %w", err)
+	}
+
+	preds := state.NewStatePredicates(state.WrapFastAPI(dealTracker.fullNode))
+	matchDealState := func(oldTs, newTs *vTypes.TipSet) (bool, events.StateChange, error) {
+		if dealTracker.watchedCount() == 0 {
+			return false, nil, nil
+		}
+		return preds.OnStorageMarketActorChanged(preds.OnDealStateChanged(preds.OnDealStateAmtChanged()))(ctx, oldTs.Key(), newTs.Key())
+	}
+	stateHandler := func(_, ts *vTypes.TipSet, states events.StateChange, _ abi.ChainEpoch) (bool, error) {
+		changes, ok := states.(*marketactor.DealStateChanges)
+		if !ok || ts == nil {
+			return true, nil
+		}
+
+		dealTracker.checkLk.Lock()
+		defer dealTracker.checkLk.Unlock()
+		if err := dealTracker.checkChangedDeals(ctx, ts, changes); err != nil {
+			log.Errorf("check changed deals at %d err: %s", ts.Height(), err)
+		}
+		return true, nil
+	}
+	if err := ev.StateChanged(keepWatching, stateHandler, revert, confidence, events.NoTimeout, matchDealState); err != nil {
+		return fmt.Errorf("watch deal states: %w", err)
+	}
+
+	return nil
+}
+
+// checkSectorMessage checks the deals assigned to the sectors in the message,
+// the deals are watched so that their later state changes in market actor are applied.
+func (dealTracker *DealTracker) checkSectorMessage(ctx context.Context, msg *vTypes.Message, ts *vTypes.TipSet) error {
+	sectors, err := sectorsInMessage(msg)
+	if err != nil {
+		return err
+	}
+	if len(sectors) == 0 {
+		return nil
+	}
+
+	deals, err := dealTracker.storageRepo.GetDealsBySectors(ctx, msg.To, sectors, storagemarket.StorageDealAwaitingPreCommit, storagemarket.StorageDealSealing)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("get deals in sectors of miner %s: %w", msg.To, err)
+	}
+	dealTracker.watch(deals)
+
+	return dealTracker.checkPreCommitAndCommitDeals(ctx, msg.To, ts, deals)
+}
+
+// sectorsInMessage returns the sectors pre-committed, committed or updated by the message
+func sectorsInMessage(msg *vTypes.Message) ([]abi.SectorNumber, error) {
+	var sectors []abi.SectorNumber
+	switch msg.Method {
+	case builtin.MethodsMiner.PreCommitSector:
+		var params vTypes.PreCommitSectorParams
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return nil, fmt.Errorf("unmarshal pre commit: %w", err)
+		}
+		sectors = append(sectors, params.SectorNumber)
+	case builtin.MethodsMiner.PreCommitSectorBatch:
+		var params vTypes.PreCommitSectorBatchParams
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return nil, fmt.Errorf("unmarshal pre commit batch: %w", err)
+		}
+		for _, precommit := range params.Sectors {
+			sectors = append(sectors, precommit.SectorNumber)
+		}
+	case builtin.MethodsMiner.PreCommitSectorBatch2:
+		var params lminer.PreCommitSectorBatchParams2
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return nil, fmt.Errorf("unmarshal pre commit batch2: %w", err)
+		}
+		for _, precommit := range params.Sectors {
+			sectors = append(sectors, precommit.SectorNumber)
+		}
+	case builtin.MethodsMiner.ProveCommitSector:
+		var params vTypes.ProveCommitSectorParams
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return nil, fmt.Errorf("unmarshal prove commit: %w", err)
+		}
+		sectors = append(sectors, params.SectorNumber)
+	case builtin.MethodsMiner.ProveCommitAggregate:
+		var params lminer.ProveCommitAggregateParams
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return nil, fmt.Errorf("unmarshal prove commit aggregate: %w", err)
+		}
+		if err := params.SectorNumbers.ForEach(func(sector uint64) error {
+			sectors = append(sectors, abi.SectorNumber(sector))
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("iterate sectors of prove commit aggregate: %w", err)
+		}
+	case builtin.MethodsMiner.ProveCommitSectors3:
+		var params lminer.ProveCommitSectors3Params
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return nil, fmt.Errorf("unmarshal prove commit sectors3: %w", err)
+		}
+		for _, activation := range params.SectorActivations {
+			sectors = append(sectors, activation.SectorNumber)
+		}
+	case builtin.MethodsMiner.ProveReplicaUpdates:
+		var params lminer.ProveReplicaUpdatesParams
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return nil, fmt.Errorf("unmarshal prove replica updates: %w", err)
+		}
+		for _, update := range params.Updates {
+			sectors = append(sectors, update.SectorID)
+		}
+	case builtin.MethodsMiner.ProveReplicaUpdates2:
+		var params lminer.ProveReplicaUpdatesParams2
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return nil, fmt.Errorf("unmarshal prove replica updates2: %w", err)
+		}
+		for _, update := range params.Updates {
+			sectors = append(sectors, update.SectorID)
+		}
+	case builtin.MethodsMiner.ProveReplicaUpdates3:
+		var params lminer.ProveReplicaUpdates3Params
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return nil, fmt.Errorf("unmarshal prove replica updates3: %w", err)
+		}
+		for _, update := range params.SectorUpdates {
+			sectors = append(sectors, update.Sector)
+		}
+	}
+	return sectors, nil
+}
+
+// checkChangedDeals checks the watched deals whose states in market actor are changed
+func (dealTracker *DealTracker) checkChangedDeals(ctx context.Context, ts *vTypes.TipSet, changes *marketactor.DealStateChanges) error {
+	ids := make([]abi.DealID, 0, len(changes.Added)+len(changes.Modified)+len(changes.Removed))
+	for _, d := range changes.Added {
+		ids = append(ids, d.ID)
+	}
+	for _, d := range changes.Modified {
+		ids = append(ids, d.ID)
+	}
+	for _, d := range changes.Removed {
+		ids = append(ids, d.ID)
+	}
+
+	sealing := make(map[address.Address][]*market.MinerDeal)
+	active := make(map[address.Address][]*market.MinerDeal)
+	for _, id := range ids {
+		wd, ok := dealTracker.watchedDeal(id)
+		if !ok {
+			continue
+		}
+		deal, err := dealTracker.storageRepo.GetDeal(ctx, wd.proposalCid)
+		if err != nil {
+			return fmt.Errorf("get deal %s: %w", wd.proposalCid, err)
+		}
+		switch deal.State {
+		case storagemarket.StorageDealAwaitingPreCommit, storagemarket.StorageDealSealing:
+			sealing[wd.miner] = append(sealing[wd.miner], deal)
+		case storagemarket.StorageDealActive:
+			active[wd.miner] = append(active[wd.miner], deal)
+		default:
+			dealTracker.unwatch(id)
+		}
+	}
+
+	for addr, deals := range sealing {
+		if err := dealTracker.checkPreCommitAndCommitDeals(ctx, addr, ts, deals); err != nil {
+			return err
+		}
+	}
+	for addr, deals := range active {
+		if err := dealTracker.checkSlashDeals(ctx, addr, ts, deals); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dealTracker *DealTracker) watch(deals []*market.MinerDeal) {
+	dealTracker.lk.Lock()
+	defer dealTracker.lk.Unlock()
+
+	for _, deal := range deals {
+		if deal.DealID == 0 {
+			continue
+		}
+		dealTracker.watched[deal.DealID] = watchedDeal{miner: deal.Proposal.Provider, proposalCid: deal.ProposalCid}
+	}
+}
+
+func (dealTracker *DealTracker) unwatch(id abi.DealID) {
+	dealTracker.lk.Lock()
+	defer dealTracker.lk.Unlock()
+
+	delete(dealTracker.watched, id)
+}
+
+func (dealTracker *DealTracker) watchedDeal(id abi.DealID) (watchedDeal, bool) {
+	dealTracker.lk.Lock()
+	defer dealTracker.lk.Unlock()
+
+	wd, ok := dealTracker.watched[id]
+	return wd, ok
+}
+
+func (dealTracker *DealTracker) watchedCount() int {
+	dealTracker.lk.Lock()
+	defer dealTracker.lk.Unlock()
+
+	return len(dealTracker.watched)
+}
+
 func (dealTracker *DealTracker) scanDeal(ctx metrics.MetricsCtx, checkPreCommitAndCommit, checkSlash bool) {
+	dealTracker.checkLk.Lock()
+	defer dealTracker.checkLk.Unlock()
+
 	actors, err := dealTracker.minerMgr.ActorList(ctx)
 	if err != nil {
 		log.Errorf("get actor list err: %s", err)
@@ -120,15 +425,22 @@ func (dealTracker *DealTracker) checkPreCommitAndCommit(ctx metrics.MetricsCtx,
 	if err != nil && !errors.Is(err, repo.ErrNotFound) {
 		return fmt.Errorf("get miner %s storage deals for check StorageDealAwaitingPreCommit %w", addr, err)
 	}
+	dealTracker.watch(deals)
+
+	return dealTracker.checkPreCommitAndCommitDeals(ctx, addr, ts, deals)
+}
+
+func (dealTracker *DealTracker) checkPreCommitAndCommitDeals(ctx metrics.MetricsCtx, addr address.Address, ts *vTypes.TipSet, deals []*market.MinerDeal) error {
 
 	curHeight := ts.Height()
 
 	for _, deal := range deals {
 		if deal.Proposal.StartEpoch < curHeight {
-			err = dealTracker.storageRepo.UpdateDealStatus(ctx, deal.ProposalCid, storagemarket.StorageDealExpired, "")
+			err := dealTracker.storageRepo.UpdateDealStatus(ctx, deal.ProposalCid, storagemarket.StorageDealExpired, "")
 			if err != nil {
 				return fmt.Errorf("update deal %d status to of miner %s expired %w", deal.DealID, addr, err)
 			}
+			dealTracker.unwatch(deal.DealID)
 			log.Infof("update deal %d status to of miner %s expired", deal.DealID, addr)
 		}
 
@@ -148,7 +460,7 @@ func (dealTracker *DealTracker) checkPreCommitAndCommit(ctx metrics.MetricsCtx,
 				if !errors.Is(err, provider.ErrAlreadyAdvertised) {
 					log.Errorf("announce deal %s err: %s", deal.ProposalCid, err)
 				}
-			} else {
+			} else if c.Defined() {
 				log.Infof("announce deal %s success, payload cid: %s, cid: %s", deal.ProposalCid, deal.Ref.Root, c)
 			}
 
@@ -192,6 +504,12 @@ func (dealTracker *DealTracker) checkSlash(ctx metrics.MetricsCtx, addr address.
 	if err != nil && !errors.Is(err, repo.ErrNotFound) {
 		return fmt.Errorf("get miner %s storage deals for check StorageDealActive %w", addr, err)
 	}
+	dealTracker.watch(deals)
+
+	return dealTracker.checkSlashDeals(ctx, addr, ts, deals)
+}
+
+func (dealTracker *DealTracker) checkSlashDeals(ctx metrics.MetricsCtx, addr address.Address, ts *vTypes.TipSet, deals []*market.MinerDeal) error {
 
 	for _, deal := range deals {
 		dealProposal, err := dealTracker.fullNode.StateMarketStorageDeal(ctx, deal.DealID, ts.Key())
@@ -203,6 +521,7 @@ func (dealTracker *DealTracker) checkSlash(ctx metrics.MetricsCtx, addr address.
 			if err != nil {
 				return fmt.Errorf("update deal status to slash for sector %d of miner %s %w", deal.SectorNumber, addr, err)
 			}
+			dealTracker.unwatch(deal.DealID)
 
 			contextID := deal.ProposalCid.Bytes()
 			_, err = dealTracker.indexProviderMgr.AnnounceDealRemoved(ctx, deal.Proposal.Provider, contextID)
@@ -0,0 +1,167 @@
+package storageprovider
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+
+	marketactor "github.com/filecoin-project/venus/venus-shared/actors/builtin/market"
+	lminer "github.com/filecoin-project/venus/venus-shared/actors/builtin/miner"
+	v1api "github.com/filecoin-project/venus/venus-shared/api/chain/v1"
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	vTypes "github.com/filecoin-project/venus/venus-shared/types"
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+
+	"github.com/ipfs-force-community/droplet/v2/models/badger"
+)
+
+type dealTrackerFullNode struct {
+	v1api.FullNode
+
+	lk sync.Mutex
+	// precommitted are the deals in the pre-committed sectors
+	precommitted map[abi.SectorNumber][]abi.DealID
+	// queried are the deals queried from market actor
+	queried []abi.DealID
+}
+
+func (f *dealTrackerFullNode) StateMarketStorageDeal(_ context.Context, dealID abi.DealID, _ vTypes.TipSetKey) (*vTypes.MarketDeal, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.queried = append(f.queried, dealID)
+	return &vTypes.MarketDeal{State: vTypes.MarketDealState{SectorStartEpoch: -1, LastUpdatedEpoch: -1, SlashEpoch: -1}}, nil
+}
+
+func (f *dealTrackerFullNode) StateSectorPreCommitInfo(_ context.Context, _ address.Address, sector abi.SectorNumber, _ vTypes.TipSetKey) (*vTypes.SectorPreCommitOnChainInfo, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	dealIDs, ok := f.precommitted[sector]
+	if !ok {
+		return nil, nil
+	}
+	return &vTypes.SectorPreCommitOnChainInfo{Info: vTypes.SectorPreCommitInfo{SectorNumber: sector, DealIDs: dealIDs}}, nil
+}
+
+func newTestTipSet(t *testing.T, miner address.Address, height abi.ChainEpoch) *vTypes.TipSet {
+	var c cid.Cid
+	testutil.Provide(t, &c)
+	ts, err := vTypes.NewTipSet([]*vTypes.BlockHeader{{
+		Miner:                 miner,
+		Ticket:                &vTypes.Ticket{VRFProof: []byte{1}},
+		ParentWeight:          big.Zero(),
+		Height:                height,
+		ParentStateRoot:       c,
+		ParentMessageReceipts: c,
+		Messages:              c,
+		ParentBaseFee:         big.Zero(),
+	}})
+	require.NoError(t, err)
+	return ts
+}
+
+func TestSectorsInMessage(t *testing.T) {
+	var sealedCid cid.Cid
+	testutil.Provide(t, &sealedCid)
+
+	var buf bytes.Buffer
+	precommit := lminer.PreCommitSectorBatchParams2{Sectors: []lminer.SectorPreCommitInfo{
+		{SectorNumber: 1, SealedCID: sealedCid},
+		{SectorNumber: 3, SealedCID: sealedCid},
+	}}
+	require.NoError(t, precommit.MarshalCBOR(&buf))
+	sectors, err := sectorsInMessage(&vTypes.Message{Method: builtin.MethodsMiner.PreCommitSectorBatch2, Params: buf.Bytes()})
+	require.NoError(t, err)
+	require.Equal(t, []abi.SectorNumber{1, 3}, sectors)
+
+	buf.Reset()
+	aggregate := lminer.ProveCommitAggregateParams{SectorNumbers: bitfield.NewFromSet([]uint64{2, 5})}
+	require.NoError(t, aggregate.MarshalCBOR(&buf))
+	sectors, err = sectorsInMessage(&vTypes.Message{Method: builtin.MethodsMiner.ProveCommitAggregate, Params: buf.Bytes()})
+	require.NoError(t, err)
+	require.Equal(t, []abi.SectorNumber{2, 5}, sectors)
+
+	buf.Reset()
+	prove := lminer.ProveCommitSectors3Params{SectorActivations: []lminer.SectorActivationManifest{{SectorNumber: 7}}}
+	require.NoError(t, prove.MarshalCBOR(&buf))
+	sectors, err = sectorsInMessage(&vTypes.Message{Method: builtin.MethodsMiner.ProveCommitSectors3, Params: buf.Bytes()})
+	require.NoError(t, err)
+	require.Equal(t, []abi.SectorNumber{7}, sectors)
+}
+
+func TestDealTrackerCheckSectorMessage(t *testing.T) {
+	ctx := context.Background()
+	r, err := badger.NewMemRepo()
+	require.NoError(t, err)
+
+	miner, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	otherMiner, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+
+	newDeal := func(provider address.Address, dealID abi.DealID, sector abi.SectorNumber) *market.MinerDeal {
+		var deal market.MinerDeal
+		testutil.Provide(t, &deal)
+		deal.Proposal.Provider = provider
+		deal.Proposal.StartEpoch = 1000
+		deal.DealID = dealID
+		deal.SectorNumber = sector
+		deal.State = storagemarket.StorageDealAwaitingPreCommit
+		deal.PieceStatus = market.Assigned
+		require.NoError(t, r.StorageDealRepo().SaveDeal(ctx, &deal))
+		return &deal
+	}
+	// only the deal in the sector of the message is checked
+	inSector := newDeal(miner, 1, 10)
+	otherSector := newDeal(miner, 2, 11)
+	otherMinerDeal := newDeal(otherMiner, 3, 10)
+
+	full := &dealTrackerFullNode{precommitted: map[abi.SectorNumber][]abi.DealID{10: {1}}}
+	tracker := &DealTracker{
+		storageRepo:    r.StorageDealRepo(),
+		fullNode:       full,
+		eventPublisher: NewEventPublishAdapter(r),
+		watched:        make(map[abi.DealID]watchedDeal),
+	}
+
+	var sealedCid cid.Cid
+	testutil.Provide(t, &sealedCid)
+	var buf bytes.Buffer
+	params := lminer.PreCommitSectorBatchParams2{Sectors: []lminer.SectorPreCommitInfo{{SectorNumber: 10, SealedCID: sealedCid}}}
+	require.NoError(t, params.MarshalCBOR(&buf))
+	msg := &vTypes.Message{To: miner, Method: builtin.MethodsMiner.PreCommitSectorBatch2, Params: buf.Bytes()}
+	require.NoError(t, tracker.checkSectorMessage(ctx, msg, newTestTipSet(t, miner, 100)))
+
+	require.Equal(t, []abi.DealID{1}, full.queried)
+	deal, err := r.StorageDealRepo().GetDeal(ctx, inSector.ProposalCid)
+	require.NoError(t, err)
+	require.Equal(t, storagemarket.StorageDealSealing, deal.State)
+	require.Equal(t, market.Packing, deal.PieceStatus)
+	for _, d := range []*market.MinerDeal{otherSector, otherMinerDeal} {
+		deal, err := r.StorageDealRepo().GetDeal(ctx, d.ProposalCid)
+		require.NoError(t, err)
+		require.Equal(t, storagemarket.StorageDealAwaitingPreCommit, deal.State)
+	}
+
+	// the deal is watched without a full scan, so its later state changes in market actor are applied
+	wd, ok := tracker.watchedDeal(inSector.DealID)
+	require.True(t, ok)
+	require.Equal(t, inSector.ProposalCid, wd.proposalCid)
+	_, ok = tracker.watchedDeal(otherSector.DealID)
+	require.False(t, ok)
+
+	// the watched deal is checked again when its state in market actor changes, the others are skipped
+	full.queried = nil
+	changes := &marketactor.DealStateChanges{Modified: []marketactor.DealStateChange{{ID: inSector.DealID}, {ID: otherSector.DealID}}}
+	require.NoError(t, tracker.checkChangedDeals(ctx, newTestTipSet(t, miner, 101), changes))
+	require.Equal(t, []abi.DealID{inSector.DealID}, full.queried)
+}
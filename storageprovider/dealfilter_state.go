@@ -0,0 +1,228 @@
+package storageprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	gatewayAPIV2 "github.com/filecoin-project/venus/venus-shared/api/gateway/v2"
+	vTypes "github.com/filecoin-project/venus/venus-shared/types"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/dealfilter"
+	"github.com/ipfs-force-community/droplet/v2/fundmgr"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+var (
+	// taggedDealStates are the states of deals which are accepted, but the data has not been received
+	taggedDealStates = []storagemarket.StorageDealStatus{
+		storagemarket.StorageDealValidating,
+		storagemarket.StorageDealAcceptWait,
+		storagemarket.StorageDealStartDataTransfer,
+		storagemarket.StorageDealTransferQueued,
+		storagemarket.StorageDealTransferring,
+		storagemarket.StorageDealProviderTransferAwaitRestart,
+	}
+	// stagedDealStates are the states of deals whose data is received, but not added to a sector
+	stagedDealStates = []storagemarket.StorageDealStatus{
+		storagemarket.StorageDealVerifyData,
+		storagemarket.StorageDealReserveProviderFunds,
+		storagemarket.StorageDealProviderFunding,
+		storagemarket.StorageDealPublish,
+		storagemarket.StorageDealPublishing,
+		storagemarket.StorageDealStaged,
+		storagemarket.StorageDealAwaitingPreCommit,
+	}
+)
+
+var _ dealfilter.StateProvider = (*DealFilterStateProvider)(nil)
+
+// sealingSectorStates maps the piece status of deals to the sector states reported by boost,
+// the sealer reports the deals it packed into sectors by updating their piece status.
+var sealingSectorStates = map[types.PieceStatus]string{
+	// the deal is added to a sector which is not pre-committed yet
+	types.Assigned: "PreCommit1",
+	// the sector of the deal is pre-committed and waits to be proven
+	types.Packing: "WaitSeed",
+}
+
+// DealFilterStateProvider collects the states of the miner passed to the storage deal filter.
+// The sealers connected to droplet by the market event stream are reported as the workers,
+// and the sectors in the sealing pipeline are counted from the deals packed by the sealers.
+type DealFilterStateProvider struct {
+	cfg             *config.MarketConfig
+	dealRepo        repo.StorageDealRepo
+	pieceStorageMgr *piecestorage.PieceStorageManager
+	fundMgr         *fundmgr.FundManager
+	spn             StorageProviderNode
+	publisher       *DealPublisher
+	sealerClient    gatewayAPIV2.IMarketClient
+}
+
+func NewDealFilterStateProvider(
+	cfg *config.MarketConfig,
+	r repo.Repo,
+	pieceStorageMgr *piecestorage.PieceStorageManager,
+	fundMgr *fundmgr.FundManager,
+	spn StorageProviderNode,
+	publisher *DealPublisher,
+	sealerClient gatewayAPIV2.IMarketClient,
+) dealfilter.StateProvider {
+	return &DealFilterStateProvider{
+		cfg:             cfg,
+		dealRepo:        r.StorageDealRepo(),
+		pieceStorageMgr: pieceStorageMgr,
+		fundMgr:         fundMgr,
+		spn:             spn,
+		publisher:       publisher,
+		sealerClient:    sealerClient,
+	}
+}
+
+func (sp *DealFilterStateProvider) SealingPipelineState(ctx context.Context, mAddr address.Address) (*dealfilter.SealingPipelineState, error) {
+	state := &dealfilter.SealingPipelineState{
+		SectorStates: make(map[string]int),
+		Workers:      []*dealfilter.Worker{},
+	}
+
+	conns, err := sp.sealerClient.ListMarketConnectionsState(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list sealer connections: %w", err)
+	}
+	for _, conn := range conns {
+		if conn.Addr != mAddr {
+			continue
+		}
+		for _, c := range conn.Conn.Connections {
+			// the sealer doesn't report its jobs, so the stage of worker is unknown
+			state.Workers = append(state.Workers, &dealfilter.Worker{
+				ID:     c.ChannelID.String(),
+				Start:  c.CreateTime,
+				Sector: -1,
+			})
+		}
+	}
+
+	for pieceStatus, sectorState := range sealingSectorStates {
+		deals, err := sp.dealRepo.GetDealsByPieceStatusAndDealStatus(ctx, mAddr, pieceStatus)
+		if err != nil {
+			return nil, fmt.Errorf("list %s deals: %w", pieceStatus, err)
+		}
+		sectors := make(map[uint64]struct{})
+		for _, deal := range deals {
+			sectors[uint64(deal.SectorNumber)] = struct{}{}
+		}
+		state.SectorStates[sectorState] = len(sectors)
+	}
+
+	return state, nil
+}
+
+func (sp *DealFilterStateProvider) StorageState(ctx context.Context, mAddr address.Address) (*dealfilter.StorageState, error) {
+	state := &dealfilter.StorageState{}
+
+	infos := sp.pieceStorageMgr.ListStorageInfos()
+	for _, st := range infos.FsStorage {
+		if !st.ReadOnly && st.Status.Available > 0 {
+			state.TotalAvailable += uint64(st.Status.Available)
+		}
+	}
+	for _, st := range infos.S3Storage {
+		if !st.ReadOnly && st.Status.Available > 0 {
+			state.TotalAvailable += uint64(st.Status.Available)
+		}
+	}
+
+	deals, err := sp.dealRepo.GetDealByAddrAndStatus(ctx, mAddr, taggedDealStates...)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return nil, fmt.Errorf("list tagged deals: %w", err)
+	}
+	for _, deal := range deals {
+		// the data of offline deals is imported by user
+		if deal.Ref != nil && deal.Ref.TransferType == storagemarket.TTManual {
+			continue
+		}
+		state.Tagged += uint64(deal.Proposal.PieceSize)
+	}
+
+	deals, err = sp.dealRepo.GetDealsByPieceStatusAndDealStatus(ctx, mAddr, types.Undefine, stagedDealStates...)
+	if err != nil {
+		return nil, fmt.Errorf("list staged deals: %w", err)
+	}
+	for _, deal := range deals {
+		state.Staged += uint64(deal.Proposal.PieceSize)
+	}
+
+	if state.TotalAvailable > state.Tagged {
+		state.Free = state.TotalAvailable - state.Tagged
+	}
+
+	return state, nil
+}
+
+func (sp *DealFilterStateProvider) FundsState(ctx context.Context, mAddr address.Address) (*dealfilter.FundsState, error) {
+	bal, err := sp.spn.StateMarketBalance(ctx, mAddr, vTypes.EmptyTSK)
+	if err != nil {
+		return nil, fmt.Errorf("get market balance: %w", err)
+	}
+	available := big.Sub(bal.Escrow, bal.Locked)
+	if available.LessThan(big.Zero()) {
+		available = big.Zero()
+	}
+
+	state := &dealfilter.FundsState{
+		Escrow: dealfilter.SMAEscrow{
+			Tagged:    sp.fundMgr.GetReserved(mAddr),
+			Available: available,
+			Locked:    bal.Locked,
+		},
+		Collateral: dealfilter.CollatWallet{Balance: big.Zero()},
+		PubMsg:     dealfilter.PubMsgWallet{Balance: big.Zero(), Tagged: big.Zero()},
+	}
+
+	// provider collateral is paid from the worker address
+	tok, _, err := sp.spn.GetChainHead(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get chain head: %w", err)
+	}
+	worker, err := sp.spn.GetMinerWorkerAddress(ctx, mAddr, tok)
+	if err != nil {
+		return nil, fmt.Errorf("get worker address: %w", err)
+	}
+	state.Collateral.Address = worker.String()
+	if state.Collateral.Balance, err = sp.spn.WalletBalance(ctx, worker); err != nil {
+		return nil, fmt.Errorf("get balance of %s: %w", worker, err)
+	}
+
+	pCfg, err := sp.cfg.MinerProviderConfig(mAddr, true)
+	if err != nil {
+		return nil, err
+	}
+	if addrs := config.CfgAddrArrToNative(pCfg.DealPublishAddress); len(addrs) > 0 {
+		state.PubMsg.Address = addrs[0].String()
+		if state.PubMsg.Balance, err = sp.spn.WalletBalance(ctx, addrs[0]); err != nil {
+			return nil, fmt.Errorf("get balance of %s: %w", addrs[0], err)
+		}
+	}
+
+	// the fees of the publish messages on the way and the message for the queued deals are tagged
+	for _, msg := range sp.publisher.PublishMessages(mAddr) {
+		if msg.State == types2.PublishMsgPending && !msg.EstimatedFee.Nil() {
+			state.PubMsg.Tagged = big.Add(state.PubMsg.Tagged, msg.EstimatedFee)
+		}
+	}
+	maxFee := abi.TokenAmount(pCfg.MaxPublishDealsFee)
+	if pending, ok := sp.publisher.PendingDeals()[mAddr]; ok && len(pending.Deals) > 0 && !maxFee.Nil() {
+		state.PubMsg.Tagged = big.Add(state.PubMsg.Tagged, maxFee)
+	}
+
+	return state, nil
+}
@@ -0,0 +1,63 @@
+package storageprovider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	gatewayAPIV2 "github.com/filecoin-project/venus/venus-shared/api/gateway/v2"
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	vTypes "github.com/filecoin-project/venus/venus-shared/types"
+	gtypes "github.com/filecoin-project/venus/venus-shared/types/gateway"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/droplet/v2/models/badger"
+)
+
+type fakeSealerClient struct {
+	gatewayAPIV2.IMarketClient
+	conns []gtypes.MarketConnectionState
+}
+
+func (f *fakeSealerClient) ListMarketConnectionsState(context.Context) ([]gtypes.MarketConnectionState, error) {
+	return f.conns, nil
+}
+
+func TestSealingPipelineState(t *testing.T) {
+	ctx := context.Background()
+	r, err := badger.NewMemRepo()
+	require.NoError(t, err)
+
+	miner, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	otherMiner, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+
+	// two deals in sector 1 and one deal in sector 2 are not pre-committed, the deal in sector 3 is pre-committed
+	sectors := []abi.SectorNumber{1, 1, 2, 3}
+	for i, status := range []types.PieceStatus{types.Assigned, types.Assigned, types.Assigned, types.Packing} {
+		var deal types.MinerDeal
+		testutil.Provide(t, &deal)
+		deal.Proposal.Provider = miner
+		deal.SectorNumber = sectors[i]
+		deal.PieceStatus = status
+		require.NoError(t, r.StorageDealRepo().SaveDeal(ctx, &deal))
+	}
+
+	createTime := time.Now().Add(-time.Hour)
+	sealerClient := &fakeSealerClient{conns: []gtypes.MarketConnectionState{
+		{Addr: miner, Conn: gtypes.ConnectionStates{Connections: []*gtypes.ConnectState{{ChannelID: vTypes.NewUUID(), CreateTime: createTime}}}},
+		{Addr: otherMiner, Conn: gtypes.ConnectionStates{Connections: []*gtypes.ConnectState{{ChannelID: vTypes.NewUUID()}}}},
+	}}
+	sp := NewDealFilterStateProvider(nil, r, nil, nil, nil, nil, sealerClient)
+
+	state, err := sp.SealingPipelineState(ctx, miner)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"PreCommit1": 2, "WaitSeed": 1}, state.SectorStates)
+	require.Len(t, state.Workers, 1)
+	require.Equal(t, sealerClient.conns[0].Conn.Connections[0].ChannelID.String(), state.Workers[0].ID)
+	require.Equal(t, createTime, state.Workers[0].Start)
+}
@@ -0,0 +1,164 @@
+package storageprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/net/gostream"
+	"github.com/multiformats/go-multiaddr"
+
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const (
+	// TTHttp is the transfer type of a deal whose data is fetched from a http(s) url
+	TTHttp = "http"
+	// TTLibp2p is the transfer type of a deal whose data is fetched over http on top of a libp2p stream
+	TTLibp2p = "libp2p"
+
+	// DataTransferProtocol is the protocol the client serves deal data on when transfer type is libp2p,
+	// same as boost
+	DataTransferProtocol = "/fil/storage/transfer/1.0.0"
+
+	libp2pScheme = "libp2p"
+)
+
+// IsOnlineTransfer returns true if droplet should fetch the deal data itself
+func IsOnlineTransfer(transferType string) bool {
+	return transferType == TTHttp || transferType == TTLibp2p
+}
+
+// parseHTTPRequest decodes the transfer params of an online deal and check that the url matches the transfer type
+func parseHTTPRequest(transfer *types2.Transfer) (*types2.HttpRequest, error) {
+	if !IsOnlineTransfer(transfer.Type) {
+		return nil, fmt.Errorf("transfer type %s not support", transfer.Type)
+	}
+	if transfer.Size == 0 {
+		return nil, fmt.Errorf("transfer size must be set")
+	}
+
+	var req types2.HttpRequest
+	if err := json.Unmarshal(transfer.Params, &req); err != nil {
+		return nil, fmt.Errorf("unmarshal transfer params: %w", err)
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse transfer url %s: %w", req.URL, err)
+	}
+
+	switch transfer.Type {
+	case TTHttp:
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("transfer url scheme must be http or https, got %s", u.Scheme)
+		}
+	case TTLibp2p:
+		if u.Scheme != libp2pScheme {
+			return nil, fmt.Errorf("transfer url scheme must be %s, got %s", libp2pScheme, u.Scheme)
+		}
+		if _, err := parseLibp2pURL(u); err != nil {
+			return nil, err
+		}
+	}
+
+	return &req, nil
+}
+
+// parseLibp2pURL parse url like libp2p:///ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
+func parseLibp2pURL(u *url.URL) (*peer.AddrInfo, error) {
+	addr, err := multiaddr.NewMultiaddr(u.Path)
+	if err != nil {
+		return nil, fmt.Errorf("parse multiaddr %s: %w", u.Path, err)
+	}
+	addrInfo, err := peer.AddrInfoFromP2pAddr(addr)
+	if err != nil {
+		return nil, fmt.Errorf("multiaddr %s must include a peer id: %w", addr, err)
+	}
+
+	return addrInfo, nil
+}
+
+type httpTransport struct {
+	h      host.Host
+	client *http.Client
+}
+
+func newHTTPTransport(h host.Host) *httpTransport {
+	return &httpTransport{
+		h:      h,
+		client: &http.Client{},
+	}
+}
+
+// Open sends a GET request for the deal data starting at offset, and returns the response body and the offset
+// the body actually starts at, it will be 0 if the server doesn't support range request.
+func (t *httpTransport) Open(ctx context.Context, req *types2.HttpRequest, offset int64) (io.ReadCloser, int64, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, 0, fmt.Errorf("parse transfer url %s: %w", req.URL, err)
+	}
+
+	client := t.client
+	if u.Scheme == libp2pScheme {
+		addrInfo, err := parseLibp2pURL(u)
+		if err != nil {
+			return nil, 0, err
+		}
+		client = t.libp2pClient(addrInfo)
+		// the host of the url is meaningless, the connection is dialed through the libp2p host
+		u = &url.URL{Scheme: "http", Host: addrInfo.ID.String()}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	if offset > 0 {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, 0, fmt.Errorf("send http request: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, 0, nil
+	case http.StatusPartialContent:
+		var start, end, total int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil || start != offset {
+			_ = resp.Body.Close()
+			return nil, 0, fmt.Errorf("unexpected content range %q, request offset %d", resp.Header.Get("Content-Range"), offset)
+		}
+		return resp.Body, offset, nil
+	default:
+		_ = resp.Body.Close()
+		return nil, 0, fmt.Errorf("http request failed, status: %s", resp.Status)
+	}
+}
+
+func (t *httpTransport) libp2pClient(addrInfo *peer.AddrInfo) *http.Client {
+	t.h.Peerstore().AddAddrs(addrInfo.ID, addrInfo.Addrs, peerstore.TempAddrTTL)
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return gostream.Dial(ctx, t.h, addrInfo.ID, DataTransferProtocol)
+			},
+			IdleConnTimeout: time.Minute,
+		},
+	}
+}
@@ -71,14 +71,16 @@ func NewProviderDAGServiceDataTransfer(lc fx.Lifecycle, dagDs badger.DagTransfer
 	return dt, nil
 }
 
-func BasicDealFilter(user config.StorageDealFilter) func(onlineOk config.ConsiderOnlineStorageDealsConfigFunc,
+func BasicDealFilter(cfg *config.MarketConfig) func(onlineOk config.ConsiderOnlineStorageDealsConfigFunc,
 	offlineOk config.ConsiderOfflineStorageDealsConfigFunc,
 	verifiedOk config.ConsiderVerifiedStorageDealsConfigFunc,
 	unverifiedOk config.ConsiderUnverifiedStorageDealsConfigFunc,
 	blocklistFunc config.StorageDealPieceCidBlocklistConfigFunc,
 	expectedSealTimeFunc config.GetExpectedSealDurationFunc,
 	startDelay config.GetMaxDealStartDelayFunc,
-	spn StorageProviderNode) config.StorageDealFilter {
+	spn StorageProviderNode,
+	stateProvider dealfilter.StateProvider,
+	limiter *DealLimiter) config.StorageDealFilter {
 	return func(onlineOk config.ConsiderOnlineStorageDealsConfigFunc,
 		offlineOk config.ConsiderOfflineStorageDealsConfigFunc,
 		verifiedOk config.ConsiderVerifiedStorageDealsConfigFunc,
@@ -87,7 +89,10 @@ func BasicDealFilter(user config.StorageDealFilter) func(onlineOk config.Conside
 		expectedSealTimeFunc config.GetExpectedSealDurationFunc,
 		startDelay config.GetMaxDealStartDelayFunc,
 		spn StorageProviderNode,
+		stateProvider dealfilter.StateProvider,
+		limiter *DealLimiter,
 	) config.StorageDealFilter {
+		user := dealfilter.NewStorageDealFilter(cfg, stateProvider, limiter.Quota())
 		return func(ctx context.Context, mAddr address.Address, deal *types2.DealParams) (bool, string, error) {
 			proposal := deal.ClientDealProposal.Proposal
 			client := deal.ClientDealProposal.Proposal.Client
@@ -186,12 +191,16 @@ var StorageProviderOpts = func(cfg *config.MarketConfig) builder.Option {
 		builder.Override(new(StorageProvider), NewStorageProvider),
 		builder.Override(new(*DealPublisher), NewDealPublisherWrapper(cfg)),
 		builder.Override(HandleDealsKey, HandleDeals),
-		builder.Override(new(config.StorageDealFilter), BasicDealFilter(dealfilter.CliStorageDealFilter(cfg))),
+		builder.Override(new(config.StorageDealFilter), BasicDealFilter(cfg)),
+		builder.Override(new(dealfilter.StateProvider), NewDealFilterStateProvider),
+		builder.Override(new(*DealLimiter), NewDealLimiter),
 		builder.Override(new(StorageProviderNode), NewProviderNodeAdapter(cfg)),
 		builder.Override(new(DealAssiger), NewDealAssigner),
 		builder.Override(StartDealTracker, NewDealTracker),
 		builder.Override(new(*EventPublishAdapter), NewEventPublishAdapter),
 		builder.Override(new(*DirectDealProvider), NewDirectDealProvider),
+		builder.Override(new(*PieceGC), NewPieceGC),
+		builder.Override(new(*PieceScrubber), NewPieceScrubber),
 
 		builder.Override(DealMetricKey, NewDealMetric),
 	)
@@ -0,0 +1,263 @@
+package storageprovider
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"go.uber.org/fx"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs-force-community/metrics"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+
+	v1api "github.com/filecoin-project/venus/venus-shared/api/chain/v1"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+// terminatedStorageDealStates are the states of storage deals which no longer need the piece
+var terminatedStorageDealStates = map[storagemarket.StorageDealStatus]struct{}{
+	storagemarket.StorageDealExpired:          {},
+	storagemarket.StorageDealSlashed:          {},
+	storagemarket.StorageDealError:            {},
+	storagemarket.StorageDealFailing:          {},
+	storagemarket.StorageDealRejecting:        {},
+	storagemarket.StorageDealProposalRejected: {},
+}
+
+// terminatedDirectDealStates are the states of direct deals which no longer need the piece
+var terminatedDirectDealStates = map[types.DirectDealState]struct{}{
+	types.DealExpired: {},
+	types.DealSlashed: {},
+	types.DealError:   {},
+}
+
+// PieceGC collects the pieces in piece storage whose deals are all terminated.
+// The pieces are moved to the quarantine area first, and deleted after the grace period,
+// a quarantined piece is restored if it is referenced by a deal again.
+type PieceGC struct {
+	cfg             *config.PieceStorage
+	storageRepo     repo.StorageDealRepo
+	directDealRepo  repo.DirectDealRepo
+	pieceStorageMgr *piecestorage.PieceStorageManager
+	chainHead       func(context.Context) (abi.ChainEpoch, error)
+
+	// lk makes sure only one round of GC is running
+	lk sync.Mutex
+}
+
+func NewPieceGC(mctx metrics.MetricsCtx,
+	lc fx.Lifecycle,
+	cfg *config.PieceStorage,
+	r repo.Repo,
+	pieceStorageMgr *piecestorage.PieceStorageManager,
+	fullNode v1api.FullNode,
+) *PieceGC {
+	gc := &PieceGC{
+		cfg:             cfg,
+		storageRepo:     r.StorageDealRepo(),
+		directDealRepo:  r.DirectDealRepo(),
+		pieceStorageMgr: pieceStorageMgr,
+		chainHead: func(ctx context.Context) (abi.ChainEpoch, error) {
+			head, err := fullNode.ChainHead(ctx)
+			if err != nil {
+				return 0, err
+			}
+			return head.Height(), nil
+		},
+	}
+
+	if cfg.GCInterval > 0 {
+		ctx := metrics.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go gc.loop(ctx, time.Duration(cfg.GCInterval))
+				return nil
+			},
+		})
+	}
+	return gc
+}
+
+func (gc *PieceGC) loop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			report, err := gc.Run(ctx, false)
+			if err != nil {
+				log.Errorf("piece storage gc: %v", err)
+				continue
+			}
+			log.Infow("piece storage gc", "scanned", report.Scanned, "kept", report.Kept, "unknown", report.Unknown,
+				"quarantined", report.Quarantined, "actions", len(report.Items))
+		case <-ctx.Done():
+			log.Warnf("exit piece storage gc by context")
+			return
+		}
+	}
+}
+
+// Run runs a round of GC on all writable piece storages, the actions are only reported if dryRun is true
+func (gc *PieceGC) Run(ctx context.Context, dryRun bool) (*types2.PieceGCReport, error) {
+	gc.lk.Lock()
+	defer gc.lk.Unlock()
+
+	refs, err := gc.pieceReferences(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := &types2.PieceGCReport{DryRun: dryRun}
+	err = gc.pieceStorageMgr.EachPieceStorage(func(st piecestorage.IPieceStorage) error {
+		if st.ReadOnly() {
+			return nil
+		}
+
+		// handle the quarantined resources first, so the resources quarantined in this round are not deleted
+		quarantined, err := st.ListQuarantined(ctx)
+		if err != nil {
+			return fmt.Errorf("list quarantined resources of %s: %w", st.GetName(), err)
+		}
+		for resource, at := range quarantined {
+			item := types2.PieceGCItem{Storage: st.GetName(), Resource: resource, QuarantinedAt: at}
+			if reason := refs[resourcePieceCid(resource)]; len(reason) != 0 {
+				item.Action = types2.PieceGCRestore
+				item.Reason = reason
+			} else if now.Sub(at) >= time.Duration(gc.cfg.GCGracePeriod) {
+				item.Action = types2.PieceGCDelete
+				item.Reason = fmt.Sprintf("quarantined for more than %s", time.Duration(gc.cfg.GCGracePeriod))
+			} else {
+				report.Quarantined++
+				continue
+			}
+			report.Items = append(report.Items, gc.apply(ctx, st, item, dryRun))
+		}
+
+		resources, err := st.ListResourceIds(ctx)
+		if err != nil {
+			return fmt.Errorf("list resources of %s: %w", st.GetName(), err)
+		}
+		for _, resource := range resources {
+			report.Scanned++
+			reason, ok := refs[resourcePieceCid(resource)]
+			if !ok {
+				report.Unknown++
+				continue
+			}
+			if len(reason) != 0 {
+				report.Kept++
+				continue
+			}
+			item := types2.PieceGCItem{
+				Storage:  st.GetName(),
+				Resource: resource,
+				Action:   types2.PieceGCQuarantine,
+				Reason:   "all deals are terminated",
+			}
+			report.Items = append(report.Items, gc.apply(ctx, st, item, dryRun))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func (gc *PieceGC) apply(ctx context.Context, st piecestorage.IPieceStorage, item types2.PieceGCItem, dryRun bool) types2.PieceGCItem {
+	if dryRun {
+		return item
+	}
+
+	var err error
+	switch item.Action {
+	case types2.PieceGCQuarantine:
+		err = st.Quarantine(ctx, item.Resource)
+	case types2.PieceGCRestore:
+		err = st.Restore(ctx, item.Resource)
+	case types2.PieceGCDelete:
+		err = st.RemoveQuarantined(ctx, item.Resource)
+	}
+	if err != nil {
+		log.Errorf("%s resource %s of %s: %v", item.Action, item.Resource, item.Storage, err)
+		item.Error = err.Error()
+	} else {
+		log.Infof("%s resource %s of %s: %s", item.Action, item.Resource, item.Storage, item.Reason)
+	}
+	return item
+}
+
+// pieceReferences returns the pieces referenced by deals, the value is the reason to keep the piece,
+// it is empty if all deals of the piece are terminated
+func (gc *PieceGC) pieceReferences(ctx context.Context) (map[cid.Cid]string, error) {
+	head, err := gc.chainHead(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get chain head: %w", err)
+	}
+
+	refs := make(map[cid.Cid]string)
+	keep := func(pieceCid cid.Cid, reason string) {
+		if len(refs[pieceCid]) == 0 {
+			refs[pieceCid] = reason
+		}
+	}
+
+	deals, err := gc.storageRepo.ListDeal(ctx, &types.StorageDealQueryParams{Page: types.Page{Limit: math.MaxInt32}})
+	if err != nil {
+		return nil, fmt.Errorf("list storage deals: %w", err)
+	}
+	for _, deal := range deals {
+		pieceCid := deal.Proposal.PieceCID
+		keep(pieceCid, "")
+		if _, ok := terminatedStorageDealStates[deal.State]; !ok {
+			keep(pieceCid, fmt.Sprintf("storage deal %s is %s", deal.ProposalCid, storagemarket.DealStates[deal.State]))
+			continue
+		}
+		// the deal which requires an unsealed copy may still be on chain even if it failed in droplet
+		if deal.FastRetrieval && deal.State != storagemarket.StorageDealExpired &&
+			deal.State != storagemarket.StorageDealSlashed && deal.Proposal.EndEpoch > head {
+			keep(pieceCid, fmt.Sprintf("storage deal %s requires unsealed copy until epoch %d", deal.ProposalCid, deal.Proposal.EndEpoch))
+		}
+	}
+
+	directDeals, err := gc.directDealRepo.ListDeal(ctx, types.DirectDealQueryParams{Page: types.Page{Limit: math.MaxInt32}})
+	if err != nil {
+		return nil, fmt.Errorf("list direct deals: %w", err)
+	}
+	for _, deal := range directDeals {
+		keep(deal.PieceCID, "")
+		if _, ok := terminatedDirectDealStates[deal.State]; !ok {
+			keep(deal.PieceCID, fmt.Sprintf("direct deal %s is %s", deal.ID, deal.State))
+			continue
+		}
+		// the deal failed in droplet may still be claimed on chain, its data may be needed until it ends
+		if deal.State == types.DealError && deal.EndEpoch > head {
+			keep(deal.PieceCID, fmt.Sprintf("direct deal %s may be on chain until epoch %d", deal.ID, deal.EndEpoch))
+		}
+	}
+
+	return refs, nil
+}
+
+// resourcePieceCid parses the piece cid from resource id, which may have a car suffix
+func resourcePieceCid(resource string) cid.Cid {
+	c, err := cid.Decode(strings.TrimSuffix(resource, ".car"))
+	if err != nil {
+		return cid.Undef
+	}
+	return c
+}
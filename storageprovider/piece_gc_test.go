@@ -0,0 +1,133 @@
+package storageprovider
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/badger"
+	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func TestPieceGC(t *testing.T) {
+	ctx := context.Background()
+	r, err := badger.NewMemRepo()
+	require.NoError(t, err)
+
+	psm, err := piecestorage.NewPieceStorageManager(&config.PieceStorage{})
+	require.NoError(t, err)
+	st := piecestorage.NewMemPieceStore("mem", nil)
+	psm.AddMemPieceStorage(st)
+
+	var pieces [5]cid.Cid
+	testutil.Provide(t, &pieces)
+	for _, p := range pieces {
+		_, err := st.SaveTo(ctx, p.String(), bytes.NewReader([]byte("piece")))
+		require.NoError(t, err)
+	}
+	_, err = st.SaveTo(ctx, "unknown", bytes.NewReader([]byte("unknown")))
+	require.NoError(t, err)
+
+	saveStorageDeal := func(pieceCid cid.Cid, state storagemarket.StorageDealStatus, fastRetrieval bool) {
+		var deal types.MinerDeal
+		testutil.Provide(t, &deal)
+		deal.Proposal.PieceCID = pieceCid
+		deal.Proposal.EndEpoch = 200
+		deal.State = state
+		deal.FastRetrieval = fastRetrieval
+		require.NoError(t, r.StorageDealRepo().SaveDeal(ctx, &deal))
+	}
+	saveDirectDeal := func(pieceCid cid.Cid, state types.DirectDealState) {
+		var deal types.DirectDeal
+		testutil.Provide(t, &deal)
+		deal.PieceCID = pieceCid
+		deal.EndEpoch = 200
+		deal.State = state
+		require.NoError(t, r.DirectDealRepo().SaveDeal(ctx, &deal))
+	}
+	saveStorageDeal(pieces[0], storagemarket.StorageDealActive, false)
+	saveStorageDeal(pieces[0], storagemarket.StorageDealExpired, false)
+	saveStorageDeal(pieces[1], storagemarket.StorageDealExpired, false)
+	// the deal requires an unsealed copy until epoch 200
+	saveStorageDeal(pieces[2], storagemarket.StorageDealError, true)
+	saveDirectDeal(pieces[3], types.DealSlashed)
+	// the failed direct deal may be on chain until epoch 200
+	saveDirectDeal(pieces[4], types.DealError)
+
+	gc := &PieceGC{
+		cfg:             &config.PieceStorage{GCGracePeriod: config.Duration(time.Hour)},
+		storageRepo:     r.StorageDealRepo(),
+		directDealRepo:  r.DirectDealRepo(),
+		pieceStorageMgr: psm,
+		chainHead: func(context.Context) (abi.ChainEpoch, error) {
+			return 100, nil
+		},
+	}
+
+	actions := func(report *types2.PieceGCReport) map[string]string {
+		out := make(map[string]string)
+		for _, item := range report.Items {
+			require.Empty(t, item.Error)
+			out[item.Resource] = item.Action
+		}
+		return out
+	}
+
+	// nothing is changed in dry run
+	report, err := gc.Run(ctx, true)
+	require.NoError(t, err)
+	require.Equal(t, 6, report.Scanned)
+	require.Equal(t, 3, report.Kept)
+	require.Equal(t, 1, report.Unknown)
+	require.Equal(t, map[string]string{
+		pieces[1].String(): types2.PieceGCQuarantine,
+		pieces[3].String(): types2.PieceGCQuarantine,
+	}, actions(report))
+	resources, err := st.ListResourceIds(ctx)
+	require.NoError(t, err)
+	require.Len(t, resources, 6)
+
+	report, err = gc.Run(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, report.Items, 2)
+	quarantined, err := st.ListQuarantined(ctx)
+	require.NoError(t, err)
+	require.Len(t, quarantined, 2)
+
+	// waiting for the grace period
+	report, err = gc.Run(ctx, false)
+	require.NoError(t, err)
+	require.Empty(t, report.Items)
+	require.Equal(t, 2, report.Quarantined)
+
+	// the piece referenced by a new deal is restored, the other one is deleted after the grace period
+	saveDirectDeal(pieces[3], types.DealAllocated)
+	gc.cfg.GCGracePeriod = 0
+	report, err = gc.Run(ctx, false)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		pieces[1].String(): types2.PieceGCDelete,
+		pieces[3].String(): types2.PieceGCRestore,
+	}, actions(report))
+
+	quarantined, err = st.ListQuarantined(ctx)
+	require.NoError(t, err)
+	require.Empty(t, quarantined)
+	has, err := st.Has(ctx, pieces[3].String())
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = st.Has(ctx, pieces[1].String())
+	require.NoError(t, err)
+	require.False(t, has)
+}
@@ -0,0 +1,366 @@
+package storageprovider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.uber.org/fx"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs-force-community/metrics"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	marketMetrics "github.com/ipfs-force-community/droplet/v2/metrics"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+	"github.com/ipfs-force-community/droplet/v2/utils"
+
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+var errScrubRunning = fmt.Errorf("a piece storage scrub is running")
+
+// PieceScrubber re-reads the pieces in piece storage and checks them against the piece cid of their deals.
+// The corrupted pieces are marked in the piece storage manager, so that they are not served by the dagstore
+// and http retrieval until they are verified again or rewritten.
+type PieceScrubber struct {
+	cfg             *config.PieceStorage
+	storageRepo     repo.StorageDealRepo
+	directDealRepo  repo.DirectDealRepo
+	pieceStorageMgr *piecestorage.PieceStorageManager
+	metricsCtx      metrics.MetricsCtx
+	// ctx is the context of the scrubs running in background
+	ctx context.Context
+
+	// lk makes sure only one scrub of storages is running
+	lk       sync.Mutex
+	statusLk sync.Mutex
+	status   types2.PieceScrubStatus
+}
+
+func NewPieceScrubber(mctx metrics.MetricsCtx,
+	lc fx.Lifecycle,
+	cfg *config.PieceStorage,
+	r repo.Repo,
+	pieceStorageMgr *piecestorage.PieceStorageManager,
+) *PieceScrubber {
+	s := &PieceScrubber{
+		cfg:             cfg,
+		storageRepo:     r.StorageDealRepo(),
+		directDealRepo:  r.DirectDealRepo(),
+		pieceStorageMgr: pieceStorageMgr,
+		metricsCtx:      mctx,
+		ctx:             metrics.LifecycleCtx(mctx, lc),
+	}
+
+	if cfg.ScrubInterval > 0 {
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go s.loop(time.Duration(cfg.ScrubInterval))
+				return nil
+			},
+		})
+	}
+	return s
+}
+
+func (s *PieceScrubber) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !s.lk.TryLock() {
+				log.Infof("skip periodic piece scrub, %v", errScrubRunning)
+				continue
+			}
+			s.scrubStorages(s.ctx, "", interval)
+			s.lk.Unlock()
+		case <-s.ctx.Done():
+			log.Warnf("exit piece scrub by context")
+			return
+		}
+	}
+}
+
+// ScrubPiece checks the piece in all storages which have it
+func (s *PieceScrubber) ScrubPiece(ctx context.Context, pieceCid cid.Cid) ([]types2.PieceVerification, error) {
+	sizes, err := s.pieceSizes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var storages []piecestorage.IPieceStorage
+	_ = s.pieceStorageMgr.EachPieceStorage(func(st piecestorage.IPieceStorage) error {
+		storages = append(storages, st)
+		return nil
+	})
+
+	var out []types2.PieceVerification
+	for _, st := range storages {
+		has, err := st.Has(ctx, pieceCid.String())
+		if err != nil {
+			return nil, fmt.Errorf("check piece %s in %s: %w", pieceCid, st.GetName(), err)
+		}
+		if !has {
+			continue
+		}
+		verification, err := s.scrub(ctx, st, pieceCid, sizes[pieceCid])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *verification)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("piece %s not found in piece storage", pieceCid)
+	}
+
+	return out, nil
+}
+
+// ScrubStorage checks all pieces in the storage in background, the progress is reported by Status
+func (s *PieceScrubber) ScrubStorage(_ context.Context, storage string) error {
+	if _, err := s.pieceStorageMgr.GetPieceStorageByName(storage); err != nil {
+		return err
+	}
+	if !s.lk.TryLock() {
+		return errScrubRunning
+	}
+
+	go func() {
+		defer s.lk.Unlock()
+		s.scrubStorages(s.ctx, storage, 0)
+	}()
+	return nil
+}
+
+// Status returns the progress of the running or the last scrub of storages
+func (s *PieceScrubber) Status() types2.PieceScrubStatus {
+	s.statusLk.Lock()
+	defer s.statusLk.Unlock()
+
+	return s.status
+}
+
+func (s *PieceScrubber) updateStatus(fn func(status *types2.PieceScrubStatus)) {
+	s.statusLk.Lock()
+	defer s.statusLk.Unlock()
+
+	fn(&s.status)
+}
+
+// scrubStorages checks the pieces in the storage, all storages if storage is empty,
+// the pieces verified within skipWithin are skipped
+func (s *PieceScrubber) scrubStorages(ctx context.Context, storage string, skipWithin time.Duration) {
+	s.updateStatus(func(status *types2.PieceScrubStatus) {
+		*status = types2.PieceScrubStatus{Running: true, Storage: storage, StartedAt: time.Now()}
+	})
+
+	err := s.doScrubStorages(ctx, storage, skipWithin)
+	if err != nil {
+		log.Errorf("scrub piece storage: %v", err)
+	}
+	s.updateStatus(func(status *types2.PieceScrubStatus) {
+		status.Running = false
+		status.FinishedAt = time.Now()
+		if err != nil {
+			status.Error = err.Error()
+		}
+		log.Infow("piece storage scrub finished", "storage", status.Storage, "scanned", status.Scanned, "verified", status.Verified,
+			"corrupted", status.Corrupted, "failed", status.Failed, "skipped", status.Skipped)
+	})
+}
+
+func (s *PieceScrubber) doScrubStorages(ctx context.Context, storage string, skipWithin time.Duration) error {
+	sizes, err := s.pieceSizes(ctx)
+	if err != nil {
+		return err
+	}
+	verifications, err := s.pieceStorageMgr.ListVerification(ctx, storage)
+	if err != nil {
+		return fmt.Errorf("list piece verifications: %w", err)
+	}
+	// a piece may be kept and verified in several storages
+	type storagePiece struct {
+		storage  string
+		pieceCid cid.Cid
+	}
+	lastVerified := make(map[storagePiece]*types2.PieceVerification, len(verifications))
+	for _, verification := range verifications {
+		lastVerified[storagePiece{verification.Storage, verification.PieceCID}] = verification
+	}
+
+	var storages []piecestorage.IPieceStorage
+	_ = s.pieceStorageMgr.EachPieceStorage(func(st piecestorage.IPieceStorage) error {
+		if len(storage) == 0 || st.GetName() == storage {
+			storages = append(storages, st)
+		}
+		return nil
+	})
+
+	for _, st := range storages {
+		resources, err := st.ListResourceIds(ctx)
+		if err != nil {
+			return fmt.Errorf("list resources of %s: %w", st.GetName(), err)
+		}
+		for _, resource := range resources {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			pieceCid := resourcePieceCid(resource)
+			if !pieceCid.Defined() {
+				continue
+			}
+			s.updateStatus(func(status *types2.PieceScrubStatus) { status.Scanned++ })
+
+			if last, ok := lastVerified[storagePiece{st.GetName(), pieceCid}]; ok && skipWithin > 0 &&
+				last.State == types2.PieceVerified && time.Since(time.Unix(int64(last.UpdatedAt), 0)) < skipWithin {
+				s.updateStatus(func(status *types2.PieceScrubStatus) { status.Skipped++ })
+				continue
+			}
+
+			verification, err := s.scrub(ctx, st, pieceCid, sizes[pieceCid])
+			s.updateStatus(func(status *types2.PieceScrubStatus) {
+				switch {
+				case err != nil:
+					status.Failed++
+				case verification.State == types2.PieceCorrupted:
+					status.Corrupted++
+				default:
+					status.Verified++
+				}
+			})
+			if err != nil {
+				log.Warnf("scrub piece %s of %s: %v", pieceCid, st.GetName(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// scrub reads the piece from the storage and checks it against the piece cid, the result is saved if the piece is read,
+// the failure of reading is not treated as corruption since it may be temporary
+func (s *PieceScrubber) scrub(ctx context.Context, st piecestorage.IPieceStorage, pieceCid cid.Cid, pieceSize abi.PaddedPieceSize) (*types2.PieceVerification, error) {
+	n, match, err := s.readPiece(ctx, st, pieceCid, pieceSize)
+	s.updateStatus(func(status *types2.PieceScrubStatus) { status.BytesRead += n })
+	_ = stats.RecordWithTags(s.metricsCtx, []tag.Mutator{tag.Upsert(marketMetrics.StorageNameTag, st.GetName())},
+		marketMetrics.PieceScrubBytes.M(n))
+	if err != nil {
+		s.recordResult(st.GetName(), "Failed")
+		return nil, err
+	}
+
+	verification := &types2.PieceVerification{
+		PieceCID: pieceCid,
+		Storage:  st.GetName(),
+		State:    types2.PieceVerified,
+		Size:     n,
+	}
+	if !match {
+		verification.State = types2.PieceCorrupted
+		verification.Message = fmt.Sprintf("found by scrub at %s", time.Now().Format(time.RFC3339))
+		log.Errorf("piece %s in %s is corrupted, it won't be served until verified again or rewritten", pieceCid, st.GetName())
+	}
+	s.recordResult(st.GetName(), verification.State.String())
+
+	if err := s.pieceStorageMgr.SaveVerification(ctx, verification); err != nil {
+		return nil, fmt.Errorf("save verification of piece %s: %w", pieceCid, err)
+	}
+	return verification, nil
+}
+
+func (s *PieceScrubber) readPiece(ctx context.Context, st piecestorage.IPieceStorage, pieceCid cid.Cid, pieceSize abi.PaddedPieceSize) (int64, bool, error) {
+	r, err := st.GetReaderCloser(ctx, pieceCid.String())
+	if err != nil {
+		return 0, false, fmt.Errorf("open piece: %w", err)
+	}
+	defer r.Close() // nolint
+
+	var w utils.CommPWriter
+	n, err := io.Copy(&w, newThrottledReader(ctx, r, s.cfg.ScrubRate))
+	if err != nil {
+		return n, false, fmt.Errorf("read piece: %w", err)
+	}
+	match, err := w.Matches(pieceCid, pieceSize)
+	if err != nil {
+		// the data is too small or too large to be the piece
+		log.Warnf("compute commP of piece %s in %s: %v", pieceCid, st.GetName(), err)
+		return n, false, nil
+	}
+	return n, match, nil
+}
+
+func (s *PieceScrubber) recordResult(storage, result string) {
+	_ = stats.RecordWithTags(s.metricsCtx, []tag.Mutator{
+		tag.Upsert(marketMetrics.StorageNameTag, storage),
+		tag.Upsert(marketMetrics.ScrubResultTag, result),
+	}, marketMetrics.PieceScrubCount.M(1))
+}
+
+// pieceSizes returns the padded size of the pieces in deals
+func (s *PieceScrubber) pieceSizes(ctx context.Context) (map[cid.Cid]abi.PaddedPieceSize, error) {
+	sizes := make(map[cid.Cid]abi.PaddedPieceSize)
+	deals, err := s.storageRepo.ListDeal(ctx, &types.StorageDealQueryParams{Page: types.Page{Limit: math.MaxInt32}})
+	if err != nil {
+		return nil, fmt.Errorf("list storage deals: %w", err)
+	}
+	for _, deal := range deals {
+		sizes[deal.Proposal.PieceCID] = deal.Proposal.PieceSize
+	}
+
+	directDeals, err := s.directDealRepo.ListDeal(ctx, types.DirectDealQueryParams{Page: types.Page{Limit: math.MaxInt32}})
+	if err != nil {
+		return nil, fmt.Errorf("list direct deals: %w", err)
+	}
+	for _, deal := range directDeals {
+		sizes[deal.PieceCID] = deal.PieceSize
+	}
+
+	return sizes, nil
+}
+
+// throttledReader limits the rate of reading to rate bytes per second, 0 means no limit
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	rate  uint64
+	start time.Time
+	n     uint64
+}
+
+func newThrottledReader(ctx context.Context, r io.Reader, rate uint64) io.Reader {
+	if rate == 0 {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, rate: rate, start: time.Now()}
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if uint64(len(p)) > tr.rate {
+		p = p[:tr.rate]
+	}
+	n, err := tr.r.Read(p)
+	tr.n += uint64(n)
+
+	expect := time.Duration(float64(tr.n) / float64(tr.rate) * float64(time.Second))
+	if wait := expect - time.Since(tr.start); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-tr.ctx.Done():
+			return n, tr.ctx.Err()
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,109 @@
+package storageprovider
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/badger"
+	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+func TestThrottledReader(t *testing.T) {
+	data := bytes.Repeat([]byte{1}, 3000)
+
+	// no limit
+	r := newThrottledReader(context.Background(), bytes.NewReader(data), 0)
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, out)
+
+	start := time.Now()
+	r = newThrottledReader(context.Background(), bytes.NewReader(data), 10000)
+	out, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, out)
+	require.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = newThrottledReader(ctx, bytes.NewReader(data), 1000)
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPieceScrub(t *testing.T) {
+	ctx := context.Background()
+	r, err := badger.NewMemRepo()
+	require.NoError(t, err)
+	psm, err := piecestorage.NewPieceStorageManager(&config.PieceStorage{})
+	require.NoError(t, err)
+
+	data := make([]byte, 2000)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+	pieceCid, err := pieceCommitment(bytes.NewReader(data), uint64(len(data)), 0)
+	require.NoError(t, err)
+	corrupted := bytes.Clone(data)
+	corrupted[100]++
+
+	stores := map[string]*piecestorage.MemPieceStore{}
+	for name, content := range map[string][]byte{"good": data, "bad1": corrupted, "bad2": corrupted} {
+		st := piecestorage.NewMemPieceStore(name, nil)
+		_, err := st.SaveTo(ctx, pieceCid.String(), bytes.NewReader(content))
+		require.NoError(t, err)
+		psm.AddMemPieceStorage(st)
+		stores[name] = st
+	}
+
+	s := &PieceScrubber{
+		cfg:             &config.PieceStorage{},
+		storageRepo:     r.StorageDealRepo(),
+		directDealRepo:  r.DirectDealRepo(),
+		pieceStorageMgr: psm,
+		metricsCtx:      ctx,
+		ctx:             ctx,
+	}
+
+	verifications, err := s.ScrubPiece(ctx, pieceCid)
+	require.NoError(t, err)
+	states := make(map[string]types2.PieceVerifyState)
+	for _, verification := range verifications {
+		states[verification.Storage] = verification.State
+	}
+	require.Equal(t, map[string]types2.PieceVerifyState{
+		"good": types2.PieceVerified,
+		"bad1": types2.PieceCorrupted,
+		"bad2": types2.PieceCorrupted,
+	}, states)
+
+	// both corrupted copies are excluded from read
+	for i := 0; i < 20; i++ {
+		st, err := psm.FindStorageForRead(ctx, pieceCid.String())
+		require.NoError(t, err)
+		require.Equal(t, "good", st.GetName())
+	}
+
+	// the repaired copy is served again after it's scrubbed, the other one is still excluded
+	_, err = stores["bad1"].SaveTo(ctx, pieceCid.String(), bytes.NewReader(data))
+	require.NoError(t, err)
+	s.scrubStorages(ctx, "bad1", 0)
+	status := s.Status()
+	require.Equal(t, 1, status.Verified)
+	require.Zero(t, status.Corrupted)
+
+	served := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		st, err := psm.FindStorageForRead(ctx, pieceCid.String())
+		require.NoError(t, err)
+		served[st.GetName()] = true
+	}
+	require.Equal(t, map[string]bool{"good": true, "bad1": true}, served)
+}
@@ -4,6 +4,7 @@ package storageprovider
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -38,6 +39,9 @@ import (
 
 var log = logging.Logger("storageadapter")
 
+// errPublishMsgFailed is returned when the publish message is executed on chain with a non-zero exit code
+var errPublishMsgFailed = errors.New("publish message failed on chain")
+
 type ProviderNodeAdapter struct {
 	v1api.FullNode
 
@@ -341,7 +345,7 @@ func (pna *ProviderNodeAdapter) WaitForPublishDeals(ctx context.Context, publish
 				return
 			}
 			if receipt.Receipt.ExitCode != exitcode.Ok {
-				pna.waitMsgResp(ctx, publishCid, receipt, fmt.Errorf("WaitForPublishDeals exit code: %s", receipt.Receipt.ExitCode))
+				pna.waitMsgResp(ctx, publishCid, receipt, fmt.Errorf("WaitForPublishDeals exit code: %s: %w", receipt.Receipt.ExitCode, errPublishMsgFailed))
 				return
 			}
 			log.Debugf("wait message %s success", publishCid)
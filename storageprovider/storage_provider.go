@@ -149,6 +149,7 @@ type StorageProviderImpl struct {
 	dealProcess       StorageDealHandler
 	transferProcess   IDatatransferHandler
 	storageDealStream *StorageDealStream
+	transferMgr       *TransferManager
 	minerMgr          minermgr.IMinerMgr
 	pieceStorageMgr   *piecestorage.PieceStorageManager
 	indexProviderMgr  *indexprovider.IndexProviderMgr
@@ -169,6 +170,7 @@ func NewStorageProvider(
 	minerMgr minermgr.IMinerMgr,
 	mixMsgClient clients.IMixMessage,
 	sdf config.StorageDealFilter,
+	limiter *DealLimiter,
 	pb *EventPublishAdapter,
 	indexProviderMgr *indexprovider.IndexProviderMgr,
 ) (StorageProvider, error) {
@@ -196,7 +198,7 @@ func NewStorageProvider(
 		indexProviderMgr: indexProviderMgr,
 	}
 
-	dealProcess, err := NewStorageDealProcessImpl(mCtx, spV2.conns, newPeerTagger(spV2.net), spV2.spn, spV2.dealStore, spV2.storedAsk, tf, minerMgr, pieceStorageMgr, dataTransfer, dagStore, sdf, pb)
+	dealProcess, err := NewStorageDealProcessImpl(mCtx, spV2.conns, newPeerTagger(spV2.net), spV2.spn, spV2.dealStore, spV2.storedAsk, tf, minerMgr, pieceStorageMgr, dataTransfer, dagStore, sdf, limiter, pb)
 	if err != nil {
 		return nil, err
 	}
@@ -206,7 +208,9 @@ func NewStorageProvider(
 	// register a data transfer event handler -- this will send events to the state machines based on DT events
 	spV2.unsubDataTransfer = dataTransfer.SubscribeToEvents(ProviderDataTransferSubscriber(spV2.transferProcess, pb)) // fsm.Group
 
-	storageDealStream, err := NewStorageDealStream(spV2.conns, spV2.storedAsk, spV2.spn, spV2.dealStore, spV2.net, tf, dealProcess, mixMsgClient, pb)
+	spV2.transferMgr = NewTransferManager(repo, tf, pieceStorageMgr, dealProcess, pb, h)
+
+	storageDealStream, err := NewStorageDealStream(spV2.conns, spV2.storedAsk, spV2.spn, spV2.dealStore, repo.DealOptionsRepo(), spV2.net, tf, dealProcess, mixMsgClient, pb, spV2.transferMgr, limiter)
 	if err != nil {
 		return nil, err
 	}
@@ -249,6 +253,10 @@ func (p *StorageProviderImpl) start(ctx context.Context) error {
 		if err := p.restartDeals(ctx, deals); err != nil {
 			log.Errorf("failed to restart deals: %w", err)
 		}
+		// resume the online transfers interrupted by shutdown
+		if err := p.transferMgr.Restart(ctx); err != nil {
+			log.Errorf("failed to restart transfers: %v", err)
+		}
 	}()
 
 	return nil
@@ -33,11 +33,15 @@ type StorageDealStream struct {
 	storedAsk      IStorageAsk
 	spn            StorageProviderNode
 	deals          repo.StorageDealRepo
+	dealOptions    repo.DealOptionsRepo
 	net            network.StorageMarketNetwork
 	tf             config.TransferFileStoreConfigFunc
 	dealProcess    StorageDealHandler
 	mixMsgClient   clients.IMixMessage
 	eventPublisher *EventPublishAdapter
+
+	transferMgr *TransferManager
+	limiter     *DealLimiter
 }
 
 // NewStorageReceiver returns a new StorageReceiver implements functions for receiving incoming data on storage protocols
@@ -46,22 +50,28 @@ func NewStorageDealStream(
 	storedAsk IStorageAsk,
 	spn StorageProviderNode,
 	deals repo.StorageDealRepo,
+	dealOptions repo.DealOptionsRepo,
 	net network.StorageMarketNetwork,
 	tf config.TransferFileStoreConfigFunc,
 	dealProcess StorageDealHandler,
 	mixMsgClient clients.IMixMessage,
 	pubsub *EventPublishAdapter,
+	transferMgr *TransferManager,
+	limiter *DealLimiter,
 ) (*StorageDealStream, error) {
 	return &StorageDealStream{
 		conns:          conns,
 		storedAsk:      storedAsk,
 		spn:            spn,
 		deals:          deals,
+		dealOptions:    dealOptions,
 		net:            net,
 		tf:             tf,
 		dealProcess:    dealProcess,
 		mixMsgClient:   mixMsgClient,
 		eventPublisher: pubsub,
+		transferMgr:    transferMgr,
+		limiter:        limiter,
 	}, nil
 }
 
@@ -296,8 +306,10 @@ func (storageDealStream *StorageDealStream) HandleNewDealStream(s network2.Strea
 	}
 
 	if !proposal.IsOffline {
-		writeNewDealResponse(s, false, "not support online deal")
-		return
+		if _, err := parseHTTPRequest(&proposal.Transfer); err != nil {
+			writeNewDealResponse(s, false, fmt.Sprintf("invalid transfer params: %v", err))
+			return
+		}
 	}
 
 	// Check if we are already tracking this deal
@@ -334,12 +346,33 @@ func (storageDealStream *StorageDealStream) HandleNewDealStream(s network2.Strea
 			PieceSize:    proposal.ClientDealProposal.Proposal.PieceSize.Unpadded(),
 			RawBlockSize: proposal.Transfer.Size,
 		},
-		FastRetrieval: true,
+		// the unsealed copy is kept for fast retrieval unless the client asks to remove it
+		FastRetrieval: !proposal.RemoveUnsealedCopy,
 		CreationTime:  curTime(),
 	}
+
+	// reject the deal before saving it if the client or peer has reached the rate limits
+	if err := storageDealStream.limiter.CheckLimit(ctx, deal); err != nil {
+		writeNewDealResponse(s, false, fmt.Sprintf("deal rate limit: %v", err))
+		return
+	}
+
+	// the options are saved before the deal, so a saved deal always has its options. The options left by a deal
+	// which fails to be saved are overwritten if the client proposes it again.
+	err = storageDealStream.dealOptions.SaveDealOptions(ctx, &types2.DealOptions{
+		ProposalCid:        deal.ProposalCid,
+		SkipIPNIAnnounce:   proposal.SkipIPNIAnnounce,
+		RemoveUnsealedCopy: proposal.RemoveUnsealedCopy,
+	})
+	if err != nil {
+		log.Errorf("save deal options to database %v", err)
+		writeNewDealResponse(s, false, "failed to save deal options")
+		return
+	}
 	err = storageDealStream.deals.SaveDeal(ctx, deal)
 	if err != nil {
 		log.Errorf("save miner deal to database %v", err)
+		writeNewDealResponse(s, false, "failed to save deal")
 		return
 	}
 
@@ -348,6 +381,9 @@ func (storageDealStream *StorageDealStream) HandleNewDealStream(s network2.Strea
 	deal.State = storagemarket.StorageDealWaitingForData
 
 	err = storageDealStream.dealProcess.AcceptDeal(ctx, deal, &proposal)
+	if err == nil && !proposal.IsOffline {
+		err = storageDealStream.transferMgr.Reserve(ctx, deal, proposal.Transfer.Size)
+	}
 	if err != nil {
 		reason = err.Error()
 		deal.Message = reason
@@ -358,6 +394,14 @@ func (storageDealStream *StorageDealStream) HandleNewDealStream(s network2.Strea
 	go func() {
 		if err := storageDealStream.deals.SaveDeal(ctx, deal); err != nil {
 			log.Errorf("save deal failed: %v", err)
+			storageDealStream.transferMgr.Release(deal)
+			return
+		}
+		if accepted && !proposal.IsOffline {
+			if err := storageDealStream.transferMgr.Transfer(ctx, deal, &proposal.Transfer); err != nil {
+				storageDealStream.eventPublisher.Publish(storagemarket.ProviderEventDataTransferFailed, deal)
+				_ = storageDealStream.dealProcess.HandleError(ctx, deal, fmt.Errorf("start transfer failed: %w", err))
+			}
 		}
 	}()
 
@@ -440,7 +484,12 @@ func (storageDealStream *StorageDealStream) getDealStatus(req types2.DealStatusR
 		return errResp("signature verification failed")
 	}
 
-	isOffline := storagemarket.TTManual == pds.Ref.TransferType
+	isOffline := !IsOnlineTransfer(pds.Ref.TransferType)
+	var transferSize, nBytesReceived uint64
+	if !isOffline {
+		transferSize = pds.Ref.RawBlockSize
+		nBytesReceived = storageDealStream.transferMgr.BytesReceived(ctx, pds.ProposalCid)
+	}
 
 	return types2.DealStatusResponse{
 		DealUUID: req.DealUUID,
@@ -454,7 +503,7 @@ func (storageDealStream *StorageDealStream) getDealStatus(req types2.DealStatusR
 			ChainDealID:       pds.DealID,
 		},
 		IsOffline:      isOffline,
-		TransferSize:   0,
-		NBytesReceived: 0,
+		TransferSize:   transferSize,
+		NBytesReceived: nBytesReceived,
 	}
 }
@@ -0,0 +1,432 @@
+package storageprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/repo"
+	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+const (
+	// transferMaxRetry is the number of times to retry a transfer before the deal is failed
+	transferMaxRetry = 15
+	// transferMinBackoff is the wait time before the first retry, it doubles after each retry
+	transferMinBackoff = 10 * time.Second
+	// transferMaxBackoff is the max wait time between retries
+	transferMaxBackoff = 5 * time.Minute
+	// progressPersistInterval is how often the number of bytes received is written to the repo
+	progressPersistInterval = 5 * time.Second
+)
+
+var errCommPMismatch = errors.New("proposal CommP doesn't match calculated CommP")
+
+// TransferManager pulls the data of online deals to local files, it resumes the transfer from the
+// bytes already received when the connection is broken or droplet restarts.
+type TransferManager struct {
+	deals           repo.StorageDealRepo
+	transfers       repo.DealTransferRepo
+	tf              config.TransferFileStoreConfigFunc
+	pieceStorageMgr *piecestorage.PieceStorageManager
+	dealProcess     StorageDealHandler
+	eventPublisher  *EventPublishAdapter
+	transport       *httpTransport
+
+	lk sync.Mutex
+	// received is the bytes received of the running transfers
+	received map[cid.Cid]uint64
+}
+
+func NewTransferManager(
+	r repo.Repo,
+	tf config.TransferFileStoreConfigFunc,
+	pieceStorageMgr *piecestorage.PieceStorageManager,
+	dealProcess StorageDealHandler,
+	pb *EventPublishAdapter,
+	h host.Host,
+) *TransferManager {
+	return &TransferManager{
+		deals:           r.StorageDealRepo(),
+		transfers:       r.DealTransferRepo(),
+		tf:              tf,
+		pieceStorageMgr: pieceStorageMgr,
+		dealProcess:     dealProcess,
+		eventPublisher:  pb,
+		transport:       newHTTPTransport(h),
+		received:        make(map[cid.Cid]uint64),
+	}
+}
+
+// Reserve reserves the space of piece storage for the deal data when the online deal is accepted,
+// so the transfers in parallel won't overfill a storage. The space is released when the transfer ends,
+// or by Release if the deal fails before the transfer starts.
+func (m *TransferManager) Reserve(ctx context.Context, deal *types.MinerDeal, size uint64) error {
+	if _, err := m.pieceStorageMgr.FindStorageForRead(ctx, deal.Proposal.PieceCID.String()); err == nil {
+		return nil
+	}
+	ps, err := m.pieceStorageMgr.Reserve(deal.ProposalCid.String(), int64(size), placementTag(deal))
+	if err != nil {
+		return fmt.Errorf("reserve piece storage: %w", err)
+	}
+	log.Debugw("reserved piece storage", "proposalCid", deal.ProposalCid, "storage", ps.GetName(), "size", size)
+
+	return nil
+}
+
+// Release releases the space reserved for the deal
+func (m *TransferManager) Release(deal *types.MinerDeal) {
+	m.pieceStorageMgr.Release(deal.ProposalCid.String())
+}
+
+// Transfer creates a transfer for the deal and pulls the data in background
+func (m *TransferManager) Transfer(ctx context.Context, deal *types.MinerDeal, transfer *types2.Transfer) (err error) {
+	defer func() {
+		if err != nil {
+			m.Release(deal)
+		}
+	}()
+
+	pieceCid := deal.Proposal.PieceCID.String()
+	if _, err := m.pieceStorageMgr.FindStorageForRead(ctx, pieceCid); err == nil {
+		log.Infow("piece already in piece storage, skip transfer", "proposalCid", deal.ProposalCid, "piece", pieceCid)
+		m.Release(deal)
+		go m.handOff(ctx, deal)
+		return nil
+	}
+
+	store, err := m.tf(deal.Proposal.Provider)
+	if err != nil {
+		return fmt.Errorf("get transfer store of %s: %w", deal.Proposal.Provider, err)
+	}
+	f, err := store.CreateTemp()
+	if err != nil {
+		return fmt.Errorf("create transfer file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	dt := &types2.DealTransfer{
+		ProposalCid: deal.ProposalCid,
+		DealUUID:    deal.ID,
+		Provider:    deal.Proposal.Provider,
+		Type:        transfer.Type,
+		Params:      transfer.Params,
+		Size:        transfer.Size,
+		Path:        string(f.OsPath()),
+		State:       types2.TransferWaiting,
+	}
+	if err := m.transfers.SaveTransfer(ctx, dt); err != nil {
+		return fmt.Errorf("save transfer: %w", err)
+	}
+
+	go m.run(ctx, deal, dt)
+
+	return nil
+}
+
+// Restart resumes the transfers which were interrupted by shutdown
+func (m *TransferManager) Restart(ctx context.Context) error {
+	dts, err := m.transfers.ListTransfer(ctx, types2.TransferWaiting, types2.TransferTransferring)
+	if err != nil {
+		return err
+	}
+	log.Infof("restarting %d transfers", len(dts))
+
+	for _, dt := range dts {
+		deal, err := m.deals.GetDeal(ctx, dt.ProposalCid)
+		if err != nil {
+			log.Errorf("get deal %s of transfer: %v", dt.ProposalCid, err)
+			continue
+		}
+		if IsTerminateState(deal.State) {
+			continue
+		}
+		// the reservations are kept in memory, so reserve again for the resumed transfers. The deal fails if
+		// no storage has enough space, rather than transferring the data that can't be written.
+		if err := m.Reserve(ctx, deal, dt.Size); err != nil {
+			log.Errorf("restart transfer of deal %s: %v", dt.ProposalCid, err)
+			m.fail(ctx, deal, dt, err)
+			continue
+		}
+		go m.run(ctx, deal, dt)
+	}
+
+	return nil
+}
+
+// BytesReceived returns the number of bytes received of the deal data
+func (m *TransferManager) BytesReceived(ctx context.Context, proposalCid cid.Cid) uint64 {
+	m.lk.Lock()
+	n, ok := m.received[proposalCid]
+	m.lk.Unlock()
+	if ok {
+		return n
+	}
+
+	dt, err := m.transfers.GetTransfer(ctx, proposalCid)
+	if err != nil {
+		return 0
+	}
+	return dt.NBytesReceived
+}
+
+func (m *TransferManager) setReceived(proposalCid cid.Cid, n uint64) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.received[proposalCid] = n
+}
+
+func (m *TransferManager) run(ctx context.Context, deal *types.MinerDeal, dt *types2.DealTransfer) {
+	log := log.With("id", deal.ID, "proposalCid", deal.ProposalCid)
+	defer func() {
+		m.lk.Lock()
+		delete(m.received, dt.ProposalCid)
+		m.lk.Unlock()
+		m.Release(deal)
+	}()
+
+	deal.State = storagemarket.StorageDealTransferring
+	if err := m.deals.SaveDeal(ctx, deal); err != nil {
+		_ = m.dealProcess.HandleError(ctx, deal, fmt.Errorf("fail to save deal to database: %w", err))
+		return
+	}
+	m.eventPublisher.Publish(storagemarket.ProviderEventDataTransferInitiated, deal)
+
+	dt.State = types2.TransferTransferring
+	backoff := transferMinBackoff
+	for {
+		start := time.Now()
+		err := m.fetch(ctx, dt)
+		if err == nil {
+			log.Infow("finished transferring deal data", "size", dt.Size, "took", time.Since(start).String())
+			break
+		}
+
+		dt.Retry++
+		dt.Message = err.Error()
+		if dt.Retry > transferMaxRetry || ctx.Err() != nil {
+			m.fail(ctx, deal, dt, err)
+			return
+		}
+		if err := m.transfers.SaveTransfer(ctx, dt); err != nil {
+			log.Errorf("save transfer: %v", err)
+		}
+
+		log.Warnw("transfer deal data failed, will retry", "retry", dt.Retry, "received", dt.NBytesReceived, "backoff", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			m.fail(ctx, deal, dt, ctx.Err())
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > transferMaxBackoff {
+			backoff = transferMaxBackoff
+		}
+	}
+
+	if err := m.saveToPieceStorage(ctx, deal, dt); err != nil {
+		m.fail(ctx, deal, dt, err)
+		return
+	}
+
+	dt.State = types2.TransferCompleted
+	dt.Message = ""
+	if err := m.transfers.SaveTransfer(ctx, dt); err != nil {
+		log.Errorf("save transfer: %v", err)
+	}
+	m.eventPublisher.Publish(storagemarket.ProviderEventDataTransferCompleted, deal)
+
+	m.handOff(ctx, deal)
+}
+
+// fetch writes the deal data to the transfer file, starting from the bytes already in the file
+func (m *TransferManager) fetch(ctx context.Context, dt *types2.DealTransfer) error {
+	req, err := parseHTTPRequest(&types2.Transfer{Type: dt.Type, Params: dt.Params, Size: dt.Size})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dt.Path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open transfer file: %w", err)
+	}
+	defer f.Close() // nolint
+
+	// the file is the source of truth, the bytes received in repo may lag behind it
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	offset := fi.Size()
+	if uint64(offset) > dt.Size {
+		offset = 0
+	}
+	if uint64(offset) == dt.Size {
+		dt.NBytesReceived = dt.Size
+		return m.transfers.UpdateBytesReceived(ctx, dt.ProposalCid, dt.NBytesReceived)
+	}
+
+	body, start, err := m.transport.Open(ctx, req, offset)
+	if err != nil {
+		return err
+	}
+	defer body.Close() // nolint
+
+	// server may not support range request, then the whole data is sent again
+	if err := f.Truncate(start); err != nil {
+		return err
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+
+	w := &progressWriter{
+		w:        f,
+		received: uint64(start),
+		onProgress: func(n uint64, persist bool) {
+			dt.NBytesReceived = n
+			m.setReceived(dt.ProposalCid, n)
+			if persist {
+				if err := m.transfers.UpdateBytesReceived(ctx, dt.ProposalCid, n); err != nil {
+					log.Warnf("update bytes received of %s: %v", dt.ProposalCid, err)
+				}
+			}
+		},
+	}
+	_, err = io.Copy(w, io.LimitReader(body, int64(dt.Size)-start+1))
+	w.onProgress(w.received, true)
+	if err != nil {
+		return fmt.Errorf("receive data: %w", err)
+	}
+	if w.received != dt.Size {
+		if w.received > dt.Size {
+			// discard the data, the client sent something else
+			_ = f.Truncate(0)
+			return fmt.Errorf("received more data than expected size %d", dt.Size)
+		}
+		return fmt.Errorf("received %d bytes, but expected size is %d", w.received, dt.Size)
+	}
+
+	return f.Sync()
+}
+
+func (m *TransferManager) saveToPieceStorage(ctx context.Context, deal *types.MinerDeal, dt *types2.DealTransfer) error {
+	pieceCid := deal.Proposal.PieceCID.String()
+	// the deal has no reservation if the piece was in piece storage when it was accepted, the space is released by run
+	ps, err := m.pieceStorageMgr.ReserveForWrite(dt.ProposalCid.String(), int64(dt.Size), placementTag(deal))
+	if err != nil {
+		return fmt.Errorf("reserve piece storage: %w", err)
+	}
+
+	f, err := os.Open(dt.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint
+
+	// the piece storage is shared by all deals of the piece, so the data claimed by the client
+	// must be checked before it's written under the piece cid
+	if err := checkPieceCommitment(f, dt.Size, deal.Proposal.PieceCID, deal.Proposal.PieceSize); err != nil {
+		if err := os.Remove(dt.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("remove transfer file %s: %v", dt.Path, err)
+		}
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err := m.pieceStorageMgr.SaveTo(ctx, ps, pieceCid, deal.Proposal.PieceSize, f); err != nil {
+		return fmt.Errorf("write data to piece storage %s: %w", ps.GetName(), err)
+	}
+	// the data was checked above, so the deal doesn't compute the CommP from piece storage again when it's handed off
+	if err := m.pieceStorageMgr.SaveVerification(ctx, &types2.PieceVerification{
+		PieceCID: deal.Proposal.PieceCID,
+		Storage:  ps.GetName(),
+		State:    types2.PieceVerified,
+		Size:     int64(dt.Size),
+	}); err != nil {
+		log.Warnf("save verification of piece %s: %v", pieceCid, err)
+	}
+	if err := os.Remove(dt.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf("remove transfer file %s: %v", dt.Path, err)
+	}
+
+	return nil
+}
+
+func (m *TransferManager) fail(ctx context.Context, deal *types.MinerDeal, dt *types2.DealTransfer, err error) {
+	dt.State = types2.TransferFailed
+	dt.Message = err.Error()
+	if err := m.transfers.SaveTransfer(ctx, dt); err != nil {
+		log.Errorf("save transfer: %v", err)
+	}
+
+	m.eventPublisher.Publish(storagemarket.ProviderEventDataTransferFailed, deal)
+	_ = m.dealProcess.HandleError(ctx, deal, fmt.Errorf("transfer data failed: %w", err))
+}
+
+// handOff moves the deal to VerifyData
+func (m *TransferManager) handOff(ctx context.Context, deal *types.MinerDeal) {
+	deal.State = storagemarket.StorageDealVerifyData
+	if err := m.deals.SaveDeal(ctx, deal); err != nil {
+		_ = m.dealProcess.HandleError(ctx, deal, fmt.Errorf("fail to save deal to database: %w", err))
+		return
+	}
+
+	if err := m.dealProcess.HandleOff(ctx, deal); err != nil {
+		log.Errorf("deal %s handle off err: %s", deal.ProposalCid, err)
+	}
+}
+
+// checkPieceCommitment checks the CommP of the deal data matches the piece cid of the proposal
+func checkPieceCommitment(r io.Reader, payloadSize uint64, pieceCid cid.Cid, pieceSize abi.PaddedPieceSize) error {
+	commP, err := pieceCommitment(r, payloadSize, pieceSize)
+	if err != nil {
+		return fmt.Errorf("error generating CommP: %w", err)
+	}
+	if commP != pieceCid {
+		return fmt.Errorf("%w: proposal %s, calculated %s", errCommPMismatch, pieceCid, commP)
+	}
+	return nil
+}
+
+func placementTag(deal *types.MinerDeal) piecestorage.PlacementTag {
+	return piecestorage.PlacementTag{Miner: deal.Proposal.Provider, Client: deal.Proposal.Client}
+}
+
+// progressWriter reports the bytes written, and asks to persist it at most once every progressPersistInterval
+type progressWriter struct {
+	w          io.Writer
+	received   uint64
+	lastSave   time.Time
+	onProgress func(received uint64, persist bool)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.received += uint64(n)
+
+	persist := time.Since(w.lastSave) > progressPersistInterval
+	if persist {
+		w.lastSave = time.Now()
+	}
+	w.onProgress(w.received, persist)
+
+	return n, err
+}
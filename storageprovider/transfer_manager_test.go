@@ -0,0 +1,109 @@
+package storageprovider
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/venus/venus-shared/testutil"
+	types "github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ipfs-force-community/droplet/v2/config"
+	"github.com/ipfs-force-community/droplet/v2/models/badger"
+	"github.com/ipfs-force-community/droplet/v2/piecestorage"
+	types2 "github.com/ipfs-force-community/droplet/v2/types"
+)
+
+type handOffRecorder struct {
+	StorageDealHandler
+	handOff chan *types.MinerDeal
+}
+
+func (h *handOffRecorder) HandleOff(_ context.Context, deal *types.MinerDeal) error {
+	h.handOff <- deal
+	return nil
+}
+
+func TestTransferManagerPieceCommitment(t *testing.T) {
+	ctx := context.Background()
+	r, err := badger.NewMemRepo()
+	require.NoError(t, err)
+
+	psm, err := piecestorage.NewPieceStorageManager(&config.PieceStorage{})
+	require.NoError(t, err)
+	psm.AddMemPieceStorage(piecestorage.NewMemPieceStore("mem", &types.StorageStatus{Capacity: 1 << 30, Available: 1 << 30}))
+
+	handler := &handOffRecorder{handOff: make(chan *types.MinerDeal, 1)}
+	m := NewTransferManager(r, nil, psm, handler, nil, nil)
+
+	pieceSize := abi.PaddedPieceSize(2048)
+	newData := func() ([]byte, *types.MinerDeal) {
+		data := make([]byte, 2000)
+		_, err := rand.Read(data)
+		require.NoError(t, err)
+		pieceCid, err := pieceCommitment(bytes.NewReader(data), uint64(len(data)), pieceSize)
+		require.NoError(t, err)
+
+		var deal types.MinerDeal
+		testutil.Provide(t, &deal)
+		deal.Proposal.PieceCID = pieceCid
+		deal.Proposal.PieceSize = pieceSize
+		require.NoError(t, r.StorageDealRepo().SaveDeal(ctx, &deal))
+		return data, &deal
+	}
+	newTransfer := func(deal *types.MinerDeal, data []byte) *types2.DealTransfer {
+		path := filepath.Join(t.TempDir(), "transfer")
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		return &types2.DealTransfer{ProposalCid: deal.ProposalCid, Size: uint64(len(data)), Path: path}
+	}
+
+	t.Run("mismatch", func(t *testing.T) {
+		_, deal := newData()
+		other, _ := newData()
+		dt := newTransfer(deal, other)
+
+		err := m.saveToPieceStorage(ctx, deal, dt)
+		require.ErrorIs(t, err, errCommPMismatch)
+		// the data claimed by the client is neither stored under the piece cid nor kept locally
+		_, err = psm.FindStorageForRead(ctx, deal.Proposal.PieceCID.String())
+		require.ErrorIs(t, err, piecestorage.ErrorNotFoundForRead)
+		_, err = os.Stat(dt.Path)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("already exists", func(t *testing.T) {
+		data, deal := newData()
+		require.NoError(t, m.saveToPieceStorage(ctx, deal, newTransfer(deal, data)))
+		ps, err := psm.FindStorageForRead(ctx, deal.Proposal.PieceCID.String())
+		require.NoError(t, err)
+
+		// the transfer of a new deal of the piece is skipped
+		_, newDeal := newData()
+		newDeal.Proposal.PieceCID = deal.Proposal.PieceCID
+		require.NoError(t, m.Reserve(ctx, newDeal, uint64(len(data))))
+		_, reserved := psm.ReservedStorage(newDeal.ProposalCid.String())
+		require.False(t, reserved)
+		require.NoError(t, m.Transfer(ctx, newDeal, &types2.Transfer{Size: uint64(len(data))}))
+		select {
+		case handOff := <-handler.handOff:
+			require.Equal(t, newDeal.ProposalCid, handOff.ProposalCid)
+			require.Equal(t, storagemarket.StorageDealVerifyData, handOff.State)
+		case <-time.After(5 * time.Second):
+			t.Fatal("deal is not handed off")
+		}
+
+		// the corrupted piece is not reused by the new deals, so their data is transferred again
+		psm.MarkCorrupted(ctx, deal.Proposal.PieceCID, ps.GetName(), errCommPMismatch.Error())
+		require.NoError(t, m.Reserve(ctx, newDeal, uint64(len(data))))
+		_, reserved = psm.ReservedStorage(newDeal.ProposalCid.String())
+		require.True(t, reserved)
+		psm.Release(newDeal.ProposalCid.String())
+	})
+}
@@ -0,0 +1,39 @@
+package types
+
+import "github.com/filecoin-project/venus/venus-shared/types/market"
+
+const (
+	// DealKindBuiltinMarket is the piece of a deal published to the builtin market actor
+	DealKindBuiltinMarket = "builtin-market"
+	// DealKindDirect is the piece of a direct (DDO) deal, which is onboarded with an allocation
+	DealKindDirect = "direct"
+	// DealKindFiller is the zeroed piece which fills the remaining space of a sector
+	DealKindFiller = "filler"
+)
+
+// DealKind returns the kind of an assigned piece
+func DealKind(deal *market.DealInfoV2) string {
+	switch {
+	case deal.IsBuiltinMarket():
+		return DealKindBuiltinMarket
+	case deal.AllocationID != 0:
+		return DealKindDirect
+	default:
+		return DealKindFiller
+	}
+}
+
+// AssignedDeal is a piece assigned to a sector with its kind, the json is the same as market.DealInfoV2
+// with extra Kind and KeepUnsealed fields, so it can still be decoded as market.DealInfoV2
+type AssignedDeal struct {
+	*market.DealInfoV2
+	// Kind is DealKindBuiltinMarket, DealKindDirect or DealKindFiller
+	Kind string
+	// KeepUnsealed tells the sealer to keep an unsealed copy of the piece, it's false if the client of
+	// a storage deal asked to remove the unsealed copy, and it's always false for fillers
+	KeepUnsealed bool
+}
+
+func NewAssignedDeal(deal *market.DealInfoV2, keepUnsealed bool) *AssignedDeal {
+	return &AssignedDeal{DealInfoV2: deal, Kind: DealKind(deal), KeepUnsealed: keepUnsealed}
+}
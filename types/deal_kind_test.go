@@ -0,0 +1,39 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignedDeal(t *testing.T) {
+	publishCid, err := cid.Parse("bafy2bzacea3wsdh6y3a36tb3skempjoxqpuyompjbmfeyf34fi3uy6uue42v4")
+	require.NoError(t, err)
+
+	cases := map[string]*market.DealInfoV2{
+		DealKindBuiltinMarket: {DealID: 1, PublishCid: publishCid, PieceSize: 1024},
+		DealKindDirect:        {AllocationID: 10, PieceSize: 1024},
+		DealKindFiller:        {PieceSize: 1024},
+	}
+	for kind, info := range cases {
+		deal := NewAssignedDeal(info, kind != DealKindFiller)
+		require.Equal(t, kind, deal.Kind)
+		require.Equal(t, kind != DealKindFiller, deal.KeepUnsealed)
+
+		data, err := json.Marshal(deal)
+		require.NoError(t, err)
+
+		// the kind is kept through the api
+		var decoded AssignedDeal
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		require.Equal(t, deal, &decoded)
+
+		// the sealers which only know DealInfoV2 can decode it
+		var old market.DealInfoV2
+		require.NoError(t, json.Unmarshal(data, &old))
+		require.Equal(t, info, &old)
+	}
+}
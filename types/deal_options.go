@@ -0,0 +1,24 @@
+package types
+
+import (
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs/go-cid"
+)
+
+// DealOptions are the options of a storage deal sent by client with deal protocol v1.2.1,
+// they are kept beside MinerDeal which has no field for them
+type DealOptions struct {
+	ProposalCid cid.Cid
+	// SkipIPNIAnnounce the deal is not announced to IPNI
+	SkipIPNIAnnounce bool
+	// RemoveUnsealedCopy the sealer doesn't need to keep an unsealed copy of the deal data
+	RemoveUnsealedCopy bool
+
+	market.TimeStamp
+}
+
+// DefaultDealOptions returns the options of the deals made with deal protocol v1.2.0 or before,
+// the deal is announced to IPNI and the unsealed copy is kept
+func DefaultDealOptions(proposalCid cid.Cid) *DealOptions {
+	return &DealOptions{ProposalCid: proposalCid}
+}
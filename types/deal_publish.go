@@ -0,0 +1,50 @@
+package types
+
+import (
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/ipfs/go-cid"
+)
+
+const (
+	// PublishMsgPending is the message which is not on chain yet
+	PublishMsgPending = "pending"
+	// PublishMsgOnChain is the message executed successfully on chain
+	PublishMsgOnChain = "on-chain"
+	// PublishMsgFailed is the message failed on chain or marked as failed by messager
+	PublishMsgFailed = "failed"
+)
+
+// PublishMessage is a PublishStorageDeals message sent by the deal publisher
+type PublishMessage struct {
+	Miner address.Address
+	// MsgCid is the cid returned when pushing the message, it is the message id if sophon-messager is used
+	MsgCid cid.Cid
+	// SignedCid is the cid of the latest signed message
+	SignedCid cid.Cid
+	// ReplacedCids are the signed messages which were replaced with higher fees
+	ReplacedCids []cid.Cid
+	// FinalCid is the cid of the message executed on chain
+	FinalCid cid.Cid
+	// Deals are the proposal cids of deals in the message
+	Deals []cid.Cid
+
+	BaseFee      abi.TokenAmount
+	EstimatedFee abi.TokenAmount
+
+	State    string
+	ExitCode exitcode.ExitCode
+	Height   abi.ChainEpoch
+	Error    string
+
+	PushedAt  time.Time
+	UpdatedAt time.Time
+}
+
+// Replaced returns true if the message was replaced with higher fees
+func (m *PublishMessage) Replaced() bool {
+	return len(m.ReplacedCids) > 0
+}
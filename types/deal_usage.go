@@ -0,0 +1,23 @@
+package types
+
+import "github.com/filecoin-project/go-address"
+
+const (
+	// DealUsageClient is the usage of a client address
+	DealUsageClient = "client"
+	// DealUsagePeer is the usage of a peer
+	DealUsagePeer = "peer"
+)
+
+// DealUsage is the usage of the deal rate limits of a client address or a peer
+type DealUsage struct {
+	Miner address.Address
+	// Kind is DealUsageClient or DealUsagePeer
+	Kind string
+	// ID is the client address or the peer id
+	ID string
+
+	DealsLastHour       uint64
+	BytesLastDay        uint64
+	ConcurrentTransfers uint64
+}
@@ -0,0 +1,42 @@
+package types
+
+import (
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs/go-cid"
+)
+
+// FundAddressStatus is the market escrow of an address tracked by the fund manager
+type FundAddressStatus struct {
+	Addr address.Address
+
+	Escrow abi.TokenAmount
+	// Locked is the escrow locked by the deals on chain
+	Locked abi.TokenAmount
+	// Available is the escrow which is not locked, Escrow - Locked
+	Available abi.TokenAmount
+	// Reserved is the amount reserved for the deals which are not published yet
+	Reserved abi.TokenAmount
+
+	// MsgCid is the in-progress add balance or withdraw message
+	MsgCid *cid.Cid
+	// InFlightAdd is the amount added by the in-progress message, it is unknown after restart
+	InFlightAdd abi.TokenAmount
+	// InFlightWithdraw is the amount withdrawn by the in-progress message, it is unknown after restart
+	InFlightWithdraw abi.TokenAmount
+
+	// TopUpLastDay is the amount topped up by the escrow policy in the last 24 hours
+	TopUpLastDay abi.TokenAmount
+}
+
+// EscrowTopUp is a message sent by the escrow policy to top up the escrow of Addr from Wallet,
+// the top-ups are saved so that the daily budget of the policy is kept after restart
+type EscrowTopUp struct {
+	MsgCid cid.Cid
+	Addr   address.Address
+	Wallet address.Address
+	Amount abi.TokenAmount
+
+	market.TimeStamp
+}
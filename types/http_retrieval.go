@@ -0,0 +1,49 @@
+package types
+
+import (
+	"time"
+
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/google/uuid"
+	"github.com/ipfs/go-cid"
+)
+
+// the paths of the http retrieval server
+const (
+	HTTPRetrievalPiece = "piece"
+	HTTPRetrievalIPFS  = "ipfs"
+)
+
+// HTTPRetrieval is the record of a request to the http retrieval server
+type HTTPRetrieval struct {
+	ID uuid.UUID
+	// Client is the ip address of the client
+	Client string
+	// Path is HTTPRetrievalPiece or HTTPRetrievalIPFS
+	Path string
+	// PieceCID is the requested piece, or the piece containing the root of an ipfs request, it's undefined if unknown
+	PieceCID cid.Cid
+	// PayloadCID is the root of an ipfs request
+	PayloadCID cid.Cid
+	// Range is the Range header of a piece request or the entity-bytes of an ipfs request
+	Range string
+	// Status is the http status code of the response
+	Status int
+	// Sent is the number of bytes served
+	Sent     uint64
+	Duration time.Duration
+	Message  string
+
+	market.TimeStamp
+}
+
+// HTTPRetrievalQueryParams filters the records of http retrievals, the latest records are listed first
+type HTTPRetrievalQueryParams struct {
+	Client     string
+	PieceCID   string
+	PayloadCID string
+	// Path is HTTPRetrievalPiece or HTTPRetrievalIPFS, all paths if it's empty
+	Path string
+
+	market.Page
+}
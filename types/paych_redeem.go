@@ -0,0 +1,45 @@
+package types
+
+import (
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+)
+
+// PaychLaneRedeem is the unredeemed value of a lane in an inbound payment channel
+type PaychLaneRedeem struct {
+	Lane uint64
+	// Redeemed is the amount redeemed on chain
+	Redeemed abi.TokenAmount
+	// Best is the amount of the best spendable voucher which is not submitted yet
+	Best abi.TokenAmount
+	// Unredeemed is the value redeemed by submitting the best voucher
+	Unredeemed abi.TokenAmount
+}
+
+// PaychRedeemStatus is the redeem status of an inbound payment channel
+type PaychRedeemStatus struct {
+	Channel address.Address
+	From    address.Address
+	To      address.Address
+
+	Lanes      []PaychLaneRedeem
+	Unredeemed abi.TokenAmount
+	// SettlingAt is the epoch the channel is settled at, 0 if the channel is not settling
+	SettlingAt abi.ChainEpoch
+
+	LastRedeem time.Time
+	LastError  string
+}
+
+// PaychRedeemResult is the result of redeeming the vouchers of a payment channel
+type PaychRedeemResult struct {
+	Channel address.Address
+	// Messages are the messages submitting the vouchers
+	Messages []cid.Cid
+	Redeemed abi.TokenAmount
+	// Skipped is the number of vouchers whose value doesn't cover the gas cost
+	Skipped int
+}
@@ -0,0 +1,20 @@
+package types
+
+import (
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/ipfs/go-cid"
+)
+
+// SignedPieceURL is a time-limited url to download a piece without a token when piece access control is enabled
+type SignedPieceURL struct {
+	PieceCID cid.Cid
+	// Client is the deal client the url is signed for
+	Client  address.Address
+	Expires time.Time
+	// Query is the signed query string, it is also valid for GET /resource?resource-id={piece cid}
+	Query string
+	// Path is the path of the piece on the http retrieval server with the signed query string
+	Path string
+}
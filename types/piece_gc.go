@@ -0,0 +1,40 @@
+package types
+
+import "time"
+
+const (
+	// PieceGCQuarantine moves the piece to the quarantine area of the storage
+	PieceGCQuarantine = "quarantine"
+	// PieceGCRestore moves the quarantined piece back because it is referenced by a deal again
+	PieceGCRestore = "restore"
+	// PieceGCDelete deletes the quarantined piece after the grace period
+	PieceGCDelete = "delete"
+)
+
+// PieceGCItem is an action of piece storage GC on a resource
+type PieceGCItem struct {
+	Storage  string
+	Resource string
+	// Action is PieceGCQuarantine, PieceGCRestore or PieceGCDelete
+	Action string
+	Reason string
+	// QuarantinedAt is zero if the resource is not quarantined yet
+	QuarantinedAt time.Time
+	// Error is not empty if the action failed
+	Error string
+}
+
+// PieceGCReport is the result of a round of piece storage GC, the actions are not applied in dry run
+type PieceGCReport struct {
+	DryRun bool
+	// Scanned is the number of resources in the writable storages
+	Scanned int
+	// Kept is the number of pieces which have active deals or unsealed copy requirement
+	Kept int
+	// Unknown is the number of resources which are not referenced by any deal, they are never collected
+	Unknown int
+	// Quarantined is the number of quarantined pieces which are waiting for the grace period
+	Quarantined int
+
+	Items []PieceGCItem
+}
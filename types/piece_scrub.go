@@ -0,0 +1,23 @@
+package types
+
+import "time"
+
+// PieceScrubStatus is the progress of the running or the last scrub of piece storage
+type PieceScrubStatus struct {
+	Running bool
+	// Storage is the storage being scrubbed, empty if all storages are scrubbed by the periodic scrub
+	Storage    string
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	Scanned   int
+	Verified  int
+	Corrupted int
+	// Failed is the number of pieces which can't be read
+	Failed int
+	// Skipped is the number of pieces verified within the scrub interval
+	Skipped   int
+	BytesRead int64
+	// Error is the error which stopped the scrub
+	Error string
+}
@@ -0,0 +1,44 @@
+package types
+
+import (
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs/go-cid"
+)
+
+// PieceVerifyState is the result of checking the data of a piece against its piece cid
+type PieceVerifyState int
+
+const (
+	// PieceUnverified the data of the piece has not been checked
+	PieceUnverified PieceVerifyState = iota
+	// PieceVerified the data hashes to the piece cid
+	PieceVerified
+	// PieceCorrupted the data doesn't hash to the piece cid
+	PieceCorrupted
+)
+
+var PieceVerifyStateString = map[PieceVerifyState]string{
+	PieceUnverified: "Unverified",
+	PieceVerified:   "Verified",
+	PieceCorrupted:  "Corrupted",
+}
+
+func (s PieceVerifyState) String() string {
+	if str, ok := PieceVerifyStateString[s]; ok {
+		return str
+	}
+	return "Unknown"
+}
+
+// PieceVerification is the latest result of checking the data of a piece in piece storage
+type PieceVerification struct {
+	PieceCID cid.Cid
+	// Storage is the name of the piece storage the data was written to
+	Storage string
+	State   PieceVerifyState
+	// Size is the number of bytes checked
+	Size    int64
+	Message string
+
+	market.TimeStamp
+}
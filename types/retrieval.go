@@ -0,0 +1,57 @@
+package types
+
+import (
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/ipfs/go-cid"
+)
+
+const (
+	RetrievalProtocolGraphsync = "graphsync"
+	RetrievalProtocolHTTP      = "http"
+)
+
+// RetrievalDealParams is the retrieval request passed to the retrieval deal filter
+type RetrievalDealParams struct {
+	// ProviderDealState is the graphsync retrieval deal, it is nil for http retrieval
+	*market.ProviderDealState
+
+	// Protocol is the protocol used to retrieve data, graphsync or http
+	Protocol string
+	// PayloadCID is the root of the data to retrieve, it is undefined when retrieving a whole piece
+	PayloadCID cid.Cid
+	// PieceCID is the piece containing the data, it is undefined if unknown
+	PieceCID cid.Cid
+	// Client is the peer id of graphsync client or the remote address of http client
+	Client string
+	// Deals are the storage deals of the piece
+	Deals []RetrievalPieceDeal
+	// Unsealed is true if there is an unsealed copy of the piece in piece storage
+	Unsealed bool
+}
+
+// RetrievalPieceDeal is the storage deal which contains the piece to retrieve
+type RetrievalPieceDeal struct {
+	ProposalCid  cid.Cid
+	DealID       abi.DealID
+	Provider     address.Address
+	Client       address.Address
+	SectorNumber abi.SectorNumber
+	Offset       abi.PaddedPieceSize
+	PieceSize    abi.PaddedPieceSize
+	VerifiedDeal bool
+}
+
+func NewRetrievalPieceDeal(deal *market.MinerDeal) RetrievalPieceDeal {
+	return RetrievalPieceDeal{
+		ProposalCid:  deal.ProposalCid,
+		DealID:       deal.DealID,
+		Provider:     deal.Proposal.Provider,
+		Client:       deal.Proposal.Client,
+		SectorNumber: deal.SectorNumber,
+		Offset:       deal.Offset,
+		PieceSize:    deal.Proposal.PieceSize,
+		VerifiedDeal: deal.Proposal.VerifiedDeal,
+	}
+}
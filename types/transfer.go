@@ -0,0 +1,60 @@
+package types
+
+import (
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/venus/venus-shared/types/market"
+	"github.com/google/uuid"
+	"github.com/ipfs/go-cid"
+)
+
+// TransferState is the state of the data transfer of an online deal
+type TransferState int
+
+const (
+	// TransferWaiting the transfer has been created, but no data has been received
+	TransferWaiting TransferState = iota
+	// TransferTransferring the transfer is receiving data
+	TransferTransferring
+	// TransferCompleted all the data has been received
+	TransferCompleted
+	// TransferFailed the transfer failed after retrying
+	TransferFailed
+)
+
+var TransferStateString = map[TransferState]string{
+	TransferWaiting:      "Waiting",
+	TransferTransferring: "Transferring",
+	TransferCompleted:    "Completed",
+	TransferFailed:       "Failed",
+}
+
+func (s TransferState) String() string {
+	if str, ok := TransferStateString[s]; ok {
+		return str
+	}
+	return "Unknown"
+}
+
+// DealTransfer records the progress of pulling the data of an online deal
+type DealTransfer struct {
+	ProposalCid cid.Cid
+	DealUUID    uuid.UUID
+	Provider    address.Address
+
+	// Type is the transfer type, eg "http" or "libp2p"
+	Type string
+	// Params is the marshalled HttpRequest sent by client
+	Params []byte
+	// Size is the size of data expected to be received
+	Size uint64
+	// NBytesReceived is the number of bytes had been written to Path
+	NBytesReceived uint64
+	// Path is the local file which the data is written to
+	Path string
+
+	State   TransferState
+	Retry   uint64
+	Message string
+
+	market.TimeStamp
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/filecoin-project/go-commp-utils/ffiwrapper"
@@ -41,3 +42,46 @@ func GeneratePieceCommP(rt abi.RegisteredSealProof, rd io.Reader, carSize, piece
 
 	return pieceCid, nil
 }
+
+// CommPWriter computes the piece commitment of the data written to it, so that the data can be checked while streaming
+type CommPWriter struct {
+	commp.Calc
+}
+
+// Matches reports whether the data written hashes to pieceCid, the commitment of the data is padded up to pieceSize
+// if it is smaller. If pieceSize is 0, all the piece sizes which can hold the data are tried.
+func (w *CommPWriter) Matches(pieceCid cid.Cid, pieceSize abi.PaddedPieceSize) (bool, error) {
+	rawCommP, paddedSize, err := w.Digest()
+	if err != nil {
+		return false, fmt.Errorf("computing commP: %w", err)
+	}
+
+	sizes := []uint64{uint64(pieceSize)}
+	if pieceSize == 0 {
+		sizes = sizes[:0]
+		for size := paddedSize; size <= commp.MaxPieceSize; size <<= 1 {
+			sizes = append(sizes, size)
+		}
+	}
+	for _, size := range sizes {
+		if size < paddedSize {
+			continue
+		}
+		commP := rawCommP
+		if size > paddedSize {
+			commP, err = commp.PadCommP(rawCommP, paddedSize, size)
+			if err != nil {
+				return false, err
+			}
+		}
+		c, err := commcid.DataCommitmentV1ToCID(commP)
+		if err != nil {
+			return false, err
+		}
+		if c.Equals(pieceCid) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}